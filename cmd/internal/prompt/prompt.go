@@ -0,0 +1,65 @@
+// prompt包为命令行工具读取密码。
+package prompt
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// 标准输入不是终端时共用的读取器，保证连续读取多行时不会丢失已缓冲的内容。
+var stdin = bufio.NewReader(os.Stdin)
+
+// 读取密码：path不为空时读取密码文件的第一行，否则在终端上提示输入且不回显。
+// 标准输入不是终端时（例如通过管道传入），读取标准输入的一行。
+func Password(prompt, path string) (string, error) {
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", err
+		}
+		line, _, _ := strings.Cut(string(data), "\n")
+		return strings.TrimRight(line, "\r"), nil
+	}
+
+	fmt.Fprint(os.Stderr, prompt)
+	defer fmt.Fprintln(os.Stderr)
+
+	fd := int(os.Stdin.Fd())
+	if term.IsTerminal(fd) {
+		password, err := term.ReadPassword(fd)
+		return string(password), err
+	}
+
+	line, err := stdin.ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("读取密码失败：%s", err)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// 读取新密码：没有密码文件时要求输入两次并检查是否一致，密码不能为空。
+func NewPassword(path string) (string, error) {
+	password, err := Password("请输入新密码：", path)
+	if err != nil {
+		return "", err
+	}
+	if password == "" {
+		return "", fmt.Errorf("密码不能为空")
+	}
+	if path != "" {
+		return password, nil
+	}
+
+	confirm, err := Password("请再次输入密码：", "")
+	if err != nil {
+		return "", err
+	}
+	if confirm != password {
+		return "", fmt.Errorf("两次输入的密码不一致")
+	}
+	return password, nil
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/Luboy23/Blockchain_Project/core"
+	"github.com/Luboy23/Blockchain_Project/network"
+	"github.com/sirupsen/logrus"
+)
+
+// 导出区块：把高度在[-from, -to]之间的主链区块导出到-out。区块来自-datadir数据目录中的区块日志，
+// 以及-in指定的导出文件（可以用来截取或重新编码区块范围）。区块日志被运行中的节点使用时无法导出，需要先停止节点。
+func exportCommand(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	in := fs.String("in", "", "作为来源的导出文件")
+	out := fs.String("out", "", "导出的目标文件")
+	from := fs.Uint("from", 0, "第一个区块的高度")
+	to := fs.Uint("to", 0, "最后一个区块的高度，0表示导出到最新区块")
+	dataDir := fs.String("datadir", "", "使用该数据目录中的创世配置和区块，为空时使用默认的创世配置")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *out == "" {
+		return fmt.Errorf("必须通过-out指定导出的目标文件")
+	}
+
+	chain, err := newCommandChain(*dataDir)
+	if err != nil {
+		return err
+	}
+	if *dataDir != "" {
+		blockLog, err := openBlockLog(chain, (&Config{DataDir: *dataDir}).path(blockLogFileName))
+		if err != nil {
+			return err
+		}
+		defer blockLog.Close()
+	}
+	if *in != "" {
+		if err := importFile(chain, *in); err != nil {
+			return err
+		}
+	}
+	if *to == 0 {
+		*to = uint(chain.Height())
+	}
+
+	f, err := os.Create(*out)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := chain.ExportChain(f, uint32(*from), uint32(*to), logProgress("导出")); err != nil {
+		return err
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"文件":   *out,
+		"起始高度": *from,
+		"结束高度": *to,
+	}).Info("导出完成")
+
+	return nil
+}
+
+// 导入区块：恢复数据目录中区块日志里的区块，重新验证并添加-in指定的导出文件中的所有区块，
+// 已有的区块被跳过，新添加的区块写入区块日志，下次启动节点时生效。节点运行时无法导入，需要先停止节点。
+func importCommand(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	in := fs.String("in", "", "要导入的导出文件")
+	dataDir := fs.String("datadir", DefaultConfig().DataDir, "导入到该数据目录")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *in == "" {
+		return fmt.Errorf("必须通过-in指定要导入的文件")
+	}
+
+	cfg := &Config{DataDir: *dataDir}
+	if _, err := os.Stat(cfg.path(genesisFileName)); errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("数据目录(%s)尚未初始化，请先运行node init", cfg.DataDir)
+	}
+	chain, err := newCommandChain(cfg.DataDir)
+	if err != nil {
+		return err
+	}
+	blockLog, err := openBlockLog(chain, cfg.path(blockLogFileName))
+	if err != nil {
+		return err
+	}
+	defer blockLog.Close()
+
+	if err := importFile(chain, *in); err != nil { // 导入失败之前添加的区块已经写入区块日志
+		return err
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"区块高度": chain.Height(),
+		"区块哈希": core.BlockHasher{}.Hash(chain.CurrentHeader()),
+	}).Info("导入完成")
+
+	return nil
+}
+
+// 使用数据目录中的创世配置创建区块链，dataDir为空时使用与节点相同的默认创世配置。
+func newCommandChain(dataDir string) (*core.Blockchain, error) {
+	opts := network.ServerOpts{}
+	if dataDir != "" {
+		genesis, err := readGenesis((&Config{DataDir: dataDir}).path(genesisFileName))
+		if err != nil {
+			return nil, err
+		}
+		opts.Genesis = genesis
+	}
+
+	s, err := network.NewServer(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.Chain(), nil
+}
+
+// 打开区块日志并恢复其中的区块，之后区块链添加的区块都写入该日志。
+func openBlockLog(chain *core.Blockchain, path string) (*core.BlockLog, error) {
+	blockLog, err := core.OpenBlockLog(path)
+	if err != nil {
+		return nil, err
+	}
+
+	n, err := blockLog.Replay(chain)
+	if err != nil {
+		blockLog.Close()
+		return nil, fmt.Errorf("从区块日志(%s)恢复区块失败：%w", path, err)
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"文件":   path,
+		"恢复区块": n,
+		"区块高度": chain.Height(),
+	}).Info("已从区块日志恢复区块")
+
+	return blockLog, nil
+}
+
+// 将导出文件导入到区块链。
+func importFile(chain *core.Blockchain, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	n, err := chain.ImportChain(f, logProgress("导入"))
+	if err != nil {
+		return fmt.Errorf("已导入%d个区块，%w", n, err)
+	}
+
+	return nil
+}
+
+// 返回每处理100个区块以及处理完成时记录一次日志的进度回调。
+func logProgress(action string) core.ProgressFunc {
+	return func(done, total int) {
+		if done%100 == 0 || done == total {
+			logrus.WithFields(logrus.Fields{
+				"已处理": done,
+				"总数":  total,
+			}).Info(action + "进度")
+		}
+	}
+}
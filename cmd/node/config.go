@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// 数据目录中的文件名。
+const (
+	genesisFileName   = "genesis.json"   // 创世配置
+	configFileName    = "config.json"    // 节点配置
+	blockLogFileName  = "blocks.log"     // 区块日志，区块加入区块链时追加写入，启动时重新添加
+	signGuardFileName = "signguard.json" // 验证者的双重签名守卫记录
+)
+
+// 节点配置，保存在数据目录下的config.json中，命令行参数可以覆盖其中的值。
+type Config struct {
+	ListenAddr   string   `json:"listenAddr"`        // P2P的监听地址
+	Peers        []string `json:"peers"`             // 启动时连接的对等节点，断开后自动重连
+	DataDir      string   `json:"dataDir,omitempty"` // 数据目录
+	ValidatorKey string   `json:"validatorKey"`      // 验证者密钥库文件的路径，为空时节点不出块
+	PasswordFile string   `json:"passwordFile"`      // 密钥库密码文件的路径，为空时启动时提示输入
+	BlockTime    Duration `json:"blockTime"`         // 出块间隔，例如"5s"
+	LogLevel     string   `json:"logLevel"`          // 日志级别：debug、info、warn、error
+	RPCAddr      string   `json:"rpcAddr"`           // JSON-RPC服务的监听地址，为空时不启动
+	TxIndex      bool     `json:"txIndex"`           // 是否维护交易和地址索引
+}
+
+// 以"5s"这样的字符串进行JSON编码的时间间隔。
+type Duration time.Duration
+
+// 实现encoding.TextMarshaler接口。
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+// 实现encoding.TextUnmarshaler接口。
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+
+	*d = Duration(v)
+	return nil
+}
+
+// 返回默认的节点配置。
+func DefaultConfig() *Config {
+	return &Config{
+		ListenAddr: "127.0.0.1:3000",
+		DataDir:    "data",
+		BlockTime:  Duration(5 * time.Second),
+		LogLevel:   "info",
+		RPCAddr:    "127.0.0.1:8545",
+	}
+}
+
+// 读取配置文件，文件中没有的字段保持cfg中原来的值。
+func (cfg *Config) load(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return fmt.Errorf("解析配置文件(%s)失败：%s", path, err)
+	}
+	return nil
+}
+
+// 检查配置是否有效，并应用日志级别。
+func (cfg *Config) validate() error {
+	if cfg.ListenAddr == "" {
+		return fmt.Errorf("必须指定监听地址")
+	}
+	if cfg.DataDir == "" {
+		return fmt.Errorf("必须指定数据目录")
+	}
+	if cfg.BlockTime <= 0 {
+		return fmt.Errorf("出块间隔必须大于0")
+	}
+
+	level, err := logrus.ParseLevel(cfg.LogLevel)
+	if err != nil {
+		return fmt.Errorf("无效的日志级别(%s)", cfg.LogLevel)
+	}
+	logrus.SetLevel(level)
+
+	return nil
+}
+
+// 返回数据目录中文件的路径。
+func (cfg *Config) path(name string) string {
+	return filepath.Join(cfg.DataDir, name)
+}
+
+// 以逗号分隔的字符串列表参数。
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(s string) error {
+	*l = nil
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			*l = append(*l, v)
+		}
+	}
+	return nil
+}
+
+// 解析run命令的参数：先使用默认配置，再读取配置文件，最后用命令行中明确给出的参数覆盖。
+// 没有通过-config指定配置文件时，使用数据目录下的config.json（如果存在）。
+func parseRunConfig(args []string) (*Config, error) {
+	defaults := DefaultConfig()
+	flags := &Config{}
+
+	fs := flag.NewFlagSet("run", flag.ContinueOnError)
+	configPath := fs.String("config", "", "配置文件的路径，默认为数据目录下的"+configFileName)
+	fs.StringVar(&flags.ListenAddr, "listen", defaults.ListenAddr, "P2P的监听地址")
+	fs.Var((*stringList)(&flags.Peers), "peers", "以逗号分隔的对等节点地址")
+	fs.StringVar(&flags.DataDir, "datadir", defaults.DataDir, "数据目录")
+	fs.StringVar(&flags.ValidatorKey, "validator-key", "", "验证者密钥库文件的路径")
+	fs.StringVar(&flags.PasswordFile, "password-file", "", "从文件的第一行读取密钥库的密码，为空时提示输入")
+	fs.DurationVar((*time.Duration)(&flags.BlockTime), "block-time", time.Duration(defaults.BlockTime), "出块间隔")
+	fs.StringVar(&flags.LogLevel, "log-level", defaults.LogLevel, "日志级别：debug、info、warn、error")
+	fs.StringVar(&flags.RPCAddr, "rpc", defaults.RPCAddr, "JSON-RPC服务的监听地址，为空时不启动")
+	fs.BoolVar(&flags.TxIndex, "txindex", false, "维护交易和地址索引")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+
+	cfg := defaults
+	if set["datadir"] {
+		cfg.DataDir = flags.DataDir
+	}
+	if *configPath != "" {
+		if err := cfg.load(*configPath); err != nil {
+			return nil, err
+		}
+	} else if err := cfg.load(cfg.path(configFileName)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	for name, apply := range map[string]func(){
+		"listen":        func() { cfg.ListenAddr = flags.ListenAddr },
+		"peers":         func() { cfg.Peers = flags.Peers },
+		"datadir":       func() { cfg.DataDir = flags.DataDir },
+		"validator-key": func() { cfg.ValidatorKey = flags.ValidatorKey },
+		"password-file": func() { cfg.PasswordFile = flags.PasswordFile },
+		"block-time":    func() { cfg.BlockTime = flags.BlockTime },
+		"log-level":     func() { cfg.LogLevel = flags.LogLevel },
+		"rpc":           func() { cfg.RPCAddr = flags.RPCAddr },
+		"txindex":       func() { cfg.TxIndex = flags.TxIndex },
+	} {
+		if set[name] {
+			apply()
+		}
+	}
+
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// 测试配置的优先级：命令行参数高于配置文件，配置文件高于默认值。
+func TestParseRunConfig(t *testing.T) {
+	dir := t.TempDir()
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, configFileName), []byte(`{
+		"listenAddr": "127.0.0.1:4000",
+		"peers": ["127.0.0.1:4001"],
+		"blockTime": "2s"
+	}`), 0600))
+
+	cfg, err := parseRunConfig([]string{"-datadir", dir, "-block-time", "3s", "-peers", "a:1, b:2"})
+	assert.Nil(t, err)
+	assert.Equal(t, dir, cfg.DataDir)
+	assert.Equal(t, "127.0.0.1:4000", cfg.ListenAddr)       // 来自配置文件
+	assert.Equal(t, []string{"a:1", "b:2"}, cfg.Peers)      // 命令行参数覆盖配置文件
+	assert.Equal(t, Duration(3*time.Second), cfg.BlockTime) // 命令行参数覆盖配置文件
+	assert.Equal(t, DefaultConfig().RPCAddr, cfg.RPCAddr)   // 默认值
+
+	_, err = parseRunConfig([]string{"-datadir", dir, "-log-level", "loud"})
+	assert.NotNil(t, err)
+	_, err = parseRunConfig([]string{"-config", filepath.Join(dir, "missing.json")})
+	assert.NotNil(t, err)
+}
+
+// 测试子命令遇到无效的参数时返回错误。
+func TestCommandFlagErrors(t *testing.T) {
+	for _, command := range []func([]string) error{initCommand, exportCommand, importCommand} {
+		assert.NotNil(t, command([]string{"-unknown"}))
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/debug"
+
+	"github.com/sirupsen/logrus"
+)
+
+// 节点的版本号，发布时通过-ldflags "-X main.version=..."设置。
+var version = "dev"
+
+const usage = `用法：node <命令> [参数]
+
+命令：
+  init     使用创世配置文件初始化数据目录
+  run      启动节点
+  export   导出区块
+  import   导入区块
+  version  打印版本信息
+
+使用"node <命令> -h"查看命令的参数。`
+
+// 主函数，程序的入口点。
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	if err := runCommand(os.Args[1], os.Args[2:]); err != nil {
+		logrus.Fatal(err)
+	}
+}
+
+// 执行命令行子命令。
+func runCommand(name string, args []string) error {
+	switch name {
+	case "init":
+		return initCommand(args)
+	case "run":
+		return runNodeCommand(args)
+	case "export":
+		return exportCommand(args)
+	case "import":
+		return importCommand(args)
+	case "version":
+		return versionCommand()
+	case "help", "-h", "--help":
+		fmt.Println(usage)
+		return nil
+	default:
+		return fmt.Errorf("未知的命令(%s)\n\n%s", name, usage)
+	}
+}
+
+// 打印版本号、构建所用的Go版本、平台以及源码版本。
+func versionCommand() error {
+	fmt.Printf("node %s\n", version)
+	fmt.Printf("go: %s %s/%s\n", runtime.Version(), runtime.GOOS, runtime.GOARCH)
+
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				fmt.Printf("commit: %s\n", setting.Value)
+			case "vcs.modified":
+				if setting.Value == "true" {
+					fmt.Println("工作区有未提交的修改")
+				}
+			}
+		}
+	}
+
+	return nil
+}
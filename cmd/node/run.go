@@ -0,0 +1,101 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/Luboy23/Blockchain_Project/cmd/internal/prompt"
+	"github.com/Luboy23/Blockchain_Project/crypto"
+	"github.com/Luboy23/Blockchain_Project/network"
+	"github.com/sirupsen/logrus"
+)
+
+// 启动节点：从数据目录读取创世配置并从区块日志恢复区块，之后添加的区块都立即写入区块日志，
+// 节点崩溃后也不会丢失区块。通过TCP连接对等节点，收到SIGINT或SIGTERM后停止。
+func runNodeCommand(args []string) error {
+	cfg, err := parseRunConfig(args)
+	if err != nil {
+		return err
+	}
+
+	genesis, err := readGenesis(cfg.path(genesisFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("数据目录(%s)尚未初始化，请先运行node init", cfg.DataDir)
+	}
+	if err != nil {
+		return err
+	}
+
+	var priKey *crypto.PrivateKey
+	if cfg.ValidatorKey != "" {
+		password, err := prompt.Password("请输入验证者密钥库的密码：", cfg.PasswordFile)
+		if err != nil {
+			return err
+		}
+		key, err := crypto.ReadKeystore(cfg.ValidatorKey, password)
+		if err != nil {
+			return fmt.Errorf("无法加载验证者私钥：%w", err)
+		}
+		priKey = &key
+	}
+
+	tr := network.NewTCPTransport(network.NetAddr(cfg.ListenAddr))
+	if err := tr.Listen(); err != nil {
+		return err
+	}
+	defer tr.Close()
+
+	s, err := network.NewServer(network.ServerOpts{
+		Transports:    []network.Transport{tr},
+		BlockTime:     time.Duration(cfg.BlockTime),
+		PrivateKey:    priKey,
+		SignGuardFile: cfg.path(signGuardFileName),
+		Genesis:       genesis,
+		TxIndex:       cfg.TxIndex,
+		RPCAddr:       cfg.RPCAddr,
+	})
+	if err != nil {
+		return err
+	}
+
+	blockLog, err := openBlockLog(s.Chain(), cfg.path(blockLogFileName))
+	if err != nil {
+		return err
+	}
+	defer blockLog.Close()
+
+	for _, peer := range cfg.Peers {
+		if err := tr.AddPeer(network.NetAddr(peer)); err != nil {
+			logrus.WithField("地址", peer).WithError(err).Warn("连接对等节点失败，稍后重试")
+		}
+	}
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sigCh
+		s.Stop()
+	}()
+
+	fields := logrus.Fields{
+		"监听地址": tr.Addr(),
+		"数据目录": cfg.DataDir,
+		"区块高度": s.Chain().Height(),
+	}
+	if priKey != nil {
+		addr, err := priKey.PublicKey().Address().Bech32(s.Chain().Config().AddressHRP())
+		if err != nil {
+			return err
+		}
+		fields["验证者地址"] = addr
+	}
+	logrus.WithFields(fields).Info("节点启动")
+
+	s.Start()
+
+	return nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/Luboy23/Blockchain_Project/cmd/internal/prompt"
+	"github.com/Luboy23/Blockchain_Project/crypto"
+	"github.com/Luboy23/Blockchain_Project/types"
+)
+
+// 生成新的助记词并打印，助记词需要由用户抄写保存。
+func mnemonicCommand(args []string) error {
+	fs := flag.NewFlagSet("mnemonic", flag.ExitOnError)
+	bits := fs.Int("bits", 256, "熵的位数，128到256之间32的倍数，对应12到24个单词")
+	fs.Parse(args)
+
+	mnemonic, err := crypto.NewMnemonic(*bits)
+	if err != nil {
+		return err
+	}
+	fmt.Println(mnemonic)
+	return nil
+}
+
+// 从助记词沿-path派生私钥，加密后写入-out指定的密钥库文件。
+func deriveCommand(args []string) error {
+	fs := flag.NewFlagSet("derive", flag.ExitOnError)
+	out := fs.String("out", "", "密钥库文件的路径，文件已存在时不会覆盖")
+	path := fs.String("path", crypto.DefaultDerivationPath, "派生路径，'表示强化派生")
+	mnemonicFile := fs.String("mnemonic-file", "", "从文件的第一行读取助记词，为空时提示输入")
+	passphraseFile := fs.String("passphrase-file", "", "从文件的第一行读取助记词的口令，为空时不使用口令")
+	prefix := fs.String("prefix", types.DefaultAddressPrefix, "地址的Bech32前缀")
+	passwordFile := fs.String("password-file", "", "从文件的第一行读取密钥库的密码，为空时提示输入")
+	light := fs.Bool("light", false, "使用较弱的scrypt参数，只应用于测试")
+	fs.Parse(args)
+
+	if *out == "" {
+		return fmt.Errorf("必须通过-out指定密钥库文件")
+	}
+
+	mnemonic, err := prompt.Password("请输入助记词：", *mnemonicFile)
+	if err != nil {
+		return err
+	}
+	passphrase := ""
+	if *passphraseFile != "" {
+		if passphrase, err = prompt.Password("", *passphraseFile); err != nil {
+			return err
+		}
+	}
+
+	seed, err := crypto.MnemonicToSeed(mnemonic, passphrase)
+	if err != nil {
+		return err
+	}
+	master, err := crypto.NewMasterKey(seed)
+	if err != nil {
+		return err
+	}
+	extended, err := master.Derive(*path)
+	if err != nil {
+		return err
+	}
+	key, err := extended.PrivateKey()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("派生路径：  %s\n", *path)
+	return writeKeystore(*out, key, *prefix, *passwordFile, *light)
+}
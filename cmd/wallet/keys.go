@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/Luboy23/Blockchain_Project/cmd/internal/prompt"
+	"github.com/Luboy23/Blockchain_Project/crypto"
+	"github.com/Luboy23/Blockchain_Project/types"
+)
+
+// 生成新的私钥，用密码加密后写入-out指定的密钥库文件并打印地址。
+func keygenCommand(args []string) error {
+	fs := flag.NewFlagSet("keygen", flag.ExitOnError)
+	out := fs.String("out", "", "密钥库文件的路径，文件已存在时不会覆盖")
+	keyType := fs.String("type", crypto.KeyTypeP256.String(), "签名方案：p256、secp256k1或ed25519")
+	prefix := fs.String("prefix", types.DefaultAddressPrefix, "地址的Bech32前缀")
+	passwordFile := fs.String("password-file", "", "从文件的第一行读取密码，为空时提示输入")
+	light := fs.Bool("light", false, "使用较弱的scrypt参数，只应用于测试")
+	fs.Parse(args)
+
+	if *out == "" {
+		return fmt.Errorf("必须通过-out指定密钥库文件")
+	}
+
+	t, err := crypto.ParseKeyType(*keyType)
+	if err != nil {
+		return err
+	}
+	key, err := crypto.GenerateKey(t)
+	if err != nil {
+		return err
+	}
+	return writeKeystore(*out, key, *prefix, *passwordFile, *light)
+}
+
+// 把-in指定的未加密私钥文件导入到-out指定的密钥库文件。
+func importCommand(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	in := fs.String("in", "", "未加密的私钥文件，内容为十六进制的私钥")
+	out := fs.String("out", "", "密钥库文件的路径，文件已存在时不会覆盖")
+	prefix := fs.String("prefix", types.DefaultAddressPrefix, "地址的Bech32前缀")
+	passwordFile := fs.String("password-file", "", "从文件的第一行读取密码，为空时提示输入")
+	light := fs.Bool("light", false, "使用较弱的scrypt参数，只应用于测试")
+	fs.Parse(args)
+
+	if *in == "" || *out == "" {
+		return fmt.Errorf("必须通过-in和-out指定私钥文件和密钥库文件")
+	}
+
+	key, err := crypto.ReadKeyFile(*in)
+	if err != nil {
+		return err
+	}
+	return writeKeystore(*out, key, *prefix, *passwordFile, *light)
+}
+
+// 读取新密码，加密私钥写入密钥库文件并打印地址和公钥。
+func writeKeystore(path string, key crypto.PrivateKey, prefix, passwordFile string, light bool) error {
+	password, err := prompt.NewPassword(passwordFile)
+	if err != nil {
+		return err
+	}
+
+	params := crypto.StandardScryptParams
+	if light {
+		params = crypto.LightScryptParams
+	}
+	if err := crypto.WriteKeystore(path, key, password, params); err != nil {
+		return err
+	}
+
+	text, err := key.PublicKey().MarshalText()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("密钥库已写入%s\n", path)
+	if err := printAddress(key.PublicKey().Address(), prefix); err != nil {
+		return err
+	}
+	fmt.Printf("公钥：      %s\n", text)
+	fmt.Printf("签名方案：  %s\n", key.Type())
+	return nil
+}
+
+// 打印-key指定的密钥库文件对应的地址，地址以明文保存在密钥库中，不需要密码。
+func addressCommand(args []string) error {
+	fs := flag.NewFlagSet("address", flag.ExitOnError)
+	keyPath := fs.String("key", "", "密钥库文件的路径")
+	prefix := fs.String("prefix", types.DefaultAddressPrefix, "地址的Bech32前缀")
+	fs.Parse(args)
+
+	if *keyPath == "" {
+		return fmt.Errorf("必须通过-key指定密钥库文件")
+	}
+
+	data, err := os.ReadFile(*keyPath)
+	if err != nil {
+		return err
+	}
+	ks := &crypto.Keystore{}
+	if err := json.Unmarshal(data, ks); err != nil {
+		return fmt.Errorf("解析密钥库文件(%s)失败：%s", *keyPath, err)
+	}
+	return printAddress(ks.Address, *prefix)
+}
+
+// 打印地址的Bech32形式和十六进制形式。
+func printAddress(addr types.Address, prefix string) error {
+	bech32, err := addr.Bech32(prefix)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("地址：      %s\n", bech32)
+	fmt.Printf("十六进制：  %s\n", types.EncodeHex(addr[:]))
+	return nil
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/Luboy23/Blockchain_Project/network"
+	"github.com/Luboy23/Blockchain_Project/types"
+)
+
+// 默认连接的节点JSON-RPC地址。
+const defaultRPCURL = "http://127.0.0.1:8545"
+
+const usage = `用法：wallet <命令> [参数]
+
+命令：
+  keygen    生成新的私钥并写入加密的密钥库文件
+  import    把未加密的私钥文件导入密钥库文件
+  address   显示密钥库文件对应的地址
+  mnemonic  生成新的助记词
+  derive    从助记词派生私钥并写入加密的密钥库文件
+  transfer  签名并提交转账交易
+  deploy    签名并提交部署合约的交易
+  call      签名并提交调用合约的交易
+  status    查询交易状态
+  balance   查询账户余额和Nonce
+
+使用"wallet <命令> -h"查看命令的参数。`
+
+// 主函数，程序的入口点。
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	if err := runCommand(os.Args[1], os.Args[2:]); err != nil {
+		fmt.Fprintln(os.Stderr, "错误：", err)
+		os.Exit(1)
+	}
+}
+
+// 执行命令行子命令。
+func runCommand(name string, args []string) error {
+	switch name {
+	case "keygen":
+		return keygenCommand(args)
+	case "import":
+		return importCommand(args)
+	case "address":
+		return addressCommand(args)
+	case "mnemonic":
+		return mnemonicCommand(args)
+	case "derive":
+		return deriveCommand(args)
+	case "transfer", "deploy", "call":
+		return txCommand(name, args)
+	case "status":
+		return statusCommand(args)
+	case "balance":
+		return balanceCommand(args)
+	case "help", "-h", "--help":
+		fmt.Println(usage)
+		return nil
+	default:
+		return fmt.Errorf("未知的命令(%s)\n\n%s", name, usage)
+	}
+}
+
+// 解析地址：按使用prefix前缀的Bech32地址解析并检查校验和。
+// 0x开头的十六进制地址没有校验和，写错一位也无法发现，只有allowHex为true时才接受。
+func parseAddress(s, prefix string, allowHex bool) (types.Address, error) {
+	if strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X") {
+		if !allowHex {
+			return types.Address{}, fmt.Errorf("十六进制地址(%s)没有校验和，请使用Bech32地址，或者指定-allow-hex", s)
+		}
+		return types.AddressFromHex(s)
+	}
+	return types.ParseAddress(s, prefix)
+}
+
+// 返回地址前缀：优先使用命令行指定的前缀，否则向节点查询。
+func addressPrefix(client *network.JSONRPCClient, prefix string) (string, error) {
+	if prefix != "" {
+		return prefix, nil
+	}
+	if err := client.Call(&prefix, "chain_addressPrefix"); err != nil {
+		return "", fmt.Errorf("无法从节点获取地址前缀：%w", err)
+	}
+	return prefix, nil
+}
+
+// 以缩进的JSON打印v。
+func printJSON(v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(string(data))
+	return nil
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/Luboy23/Blockchain_Project/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// 测试只有明确允许时才接受没有校验和的十六进制地址。
+func TestParseAddress(t *testing.T) {
+	addr := types.AddressFromBytes(make([]byte, 20))
+	addr[19] = 1
+	bech32, err := addr.Bech32(types.DefaultAddressPrefix)
+	assert.Nil(t, err)
+
+	parsed, err := parseAddress(bech32, types.DefaultAddressPrefix, false)
+	assert.Nil(t, err)
+	assert.Equal(t, addr, parsed)
+
+	hex := types.EncodeHex(addr.ToSlice())
+	_, err = parseAddress(hex, types.DefaultAddressPrefix, false)
+	assert.NotNil(t, err)
+	parsed, err = parseAddress(hex, types.DefaultAddressPrefix, true)
+	assert.Nil(t, err)
+	assert.Equal(t, addr, parsed)
+}
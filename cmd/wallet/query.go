@@ -0,0 +1,65 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/Luboy23/Blockchain_Project/network"
+	"github.com/Luboy23/Blockchain_Project/types"
+)
+
+// 查询交易的状态：在交易池中等待打包，或者已打包进区块以及执行结果。
+func statusCommand(args []string) error {
+	fs := flag.NewFlagSet("status", flag.ExitOnError)
+	rpcURL := fs.String("rpc", defaultRPCURL, "节点的JSON-RPC地址")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "用法：wallet status [参数] <交易哈希>")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("必须指定交易哈希")
+	}
+	hash, err := types.HashFromHex(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	status := &network.RPCTxStatus{}
+	if err := network.NewJSONRPCClient(*rpcURL).Call(status, "tx_get", hash); err != nil {
+		return err
+	}
+	return printJSON(status)
+}
+
+// 查询账户在主链链头状态下的余额，以及下一笔交易应使用的Nonce。
+func balanceCommand(args []string) error {
+	fs := flag.NewFlagSet("balance", flag.ExitOnError)
+	rpcURL := fs.String("rpc", defaultRPCURL, "节点的JSON-RPC地址")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "用法：wallet balance [参数] <地址>")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("必须指定地址")
+	}
+
+	// 地址原样交给节点，由节点检查Bech32前缀和校验和
+	client := network.NewJSONRPCClient(*rpcURL)
+	var balance, nonce uint64
+	if err := client.Call(&balance, "account_getBalance", fs.Arg(0)); err != nil {
+		return err
+	}
+	if err := client.Call(&nonce, "account_getNonce", fs.Arg(0)); err != nil {
+		return err
+	}
+
+	fmt.Printf("余额：%d\n", balance)
+	fmt.Printf("Nonce：%d\n", nonce)
+	return nil
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/Luboy23/Blockchain_Project/cmd/internal/prompt"
+	"github.com/Luboy23/Blockchain_Project/core"
+	"github.com/Luboy23/Blockchain_Project/crypto"
+	"github.com/Luboy23/Blockchain_Project/network"
+	"github.com/Luboy23/Blockchain_Project/types"
+)
+
+// 部署和调用合约时默认的燃料上限。
+const defaultContractGas = 1_000_000
+
+// 构建、签名并提交transfer、deploy或call交易。
+// 没有通过-nonce指定Nonce时向节点查询，交易池中尚未打包的交易也计算在内，因此可以连续提交多笔交易。
+func txCommand(kind string, args []string) error {
+	fs := flag.NewFlagSet(kind, flag.ExitOnError)
+	keyPath := fs.String("key", "", "发送者的密钥库文件")
+	passwordFile := fs.String("password-file", "", "从文件的第一行读取密钥库的密码，为空时提示输入")
+	rpcURL := fs.String("rpc", defaultRPCURL, "节点的JSON-RPC地址")
+	prefix := fs.String("prefix", "", "地址的Bech32前缀，为空时向节点查询")
+	nonce := fs.Int64("nonce", -1, "交易的Nonce，小于0时向节点查询")
+	value := fs.Uint64("value", 0, "转账金额，调用合约时为转给合约的金额")
+	fee := fs.Uint64("fee", 0, "交易费")
+	txVersion := fs.Uint("tx-version", 0, "交易版本：0携带发送者的公钥，1只携带可恢复的签名（不支持ed25519）")
+	noSend := fs.Bool("no-send", false, "只打印签名后的交易，不提交")
+	var to, data, codeFile *string
+	var gas, gasPrice *uint64
+	allowHex := new(bool)
+	switch kind {
+	case "transfer":
+		to = fs.String("to", "", "接收者的Bech32地址")
+		allowHex = fs.Bool("allow-hex", false, "允许-to使用没有校验和的0x十六进制地址")
+		gas = fs.Uint64("gas", 0, "执行字节码的燃料上限，固有燃料另外收取")
+	case "deploy":
+		data = fs.String("code", "", "十六进制的合约代码")
+		codeFile = fs.String("code-file", "", "合约代码文件（二进制），与-code二选一")
+		gas = fs.Uint64("gas", defaultContractGas, "执行字节码的燃料上限，固有燃料另外收取")
+	case "call":
+		to = fs.String("to", "", "合约的Bech32地址")
+		allowHex = fs.Bool("allow-hex", false, "允许-to使用没有校验和的0x十六进制地址")
+		data = fs.String("data", "", "十六进制的调用数据")
+		gas = fs.Uint64("gas", defaultContractGas, "执行字节码的燃料上限，固有燃料另外收取")
+	}
+	gasPrice = fs.Uint64("gas-price", 0, "每单位燃料的价格")
+	fs.Parse(args)
+
+	if *keyPath == "" {
+		return fmt.Errorf("必须通过-key指定密钥库文件")
+	}
+	password, err := prompt.Password("请输入密钥库的密码：", *passwordFile)
+	if err != nil {
+		return err
+	}
+	key, err := crypto.ReadKeystore(*keyPath, password)
+	if err != nil {
+		return err
+	}
+	sender := key.PublicKey().Address()
+	client := network.NewJSONRPCClient(*rpcURL)
+
+	tx := &core.Transaction{
+		Version:  core.TxVersion(*txVersion),
+		Value:    *value,
+		Fee:      *fee,
+		GasLimit: *gas,
+		GasPrice: *gasPrice,
+	}
+	switch kind {
+	case "transfer":
+		tx.Type = core.TxTypeTransfer
+	case "deploy":
+		tx.Type = core.TxTypeDeploy
+	case "call":
+		tx.Type = core.TxTypeCall
+	}
+
+	if to != nil {
+		if *to == "" {
+			return fmt.Errorf("必须通过-to指定地址")
+		}
+		if *prefix, err = addressPrefix(client, *prefix); err != nil {
+			return err
+		}
+		if tx.To, err = parseAddress(*to, *prefix, *allowHex); err != nil {
+			return err
+		}
+	}
+	if data != nil && *data != "" {
+		if tx.Data, err = types.DecodeHex(*data); err != nil {
+			return err
+		}
+	}
+	if codeFile != nil && *codeFile != "" {
+		if len(tx.Data) > 0 {
+			return fmt.Errorf("-code和-code-file只能指定一个")
+		}
+		if tx.Data, err = os.ReadFile(*codeFile); err != nil {
+			return err
+		}
+	}
+	if kind == "deploy" && len(tx.Data) == 0 {
+		return fmt.Errorf("必须通过-code或-code-file指定合约代码")
+	}
+
+	if *nonce >= 0 {
+		tx.Nonce = uint64(*nonce)
+	} else if err := client.Call(&tx.Nonce, "account_getNonce", types.EncodeHex(sender[:])); err != nil {
+		return fmt.Errorf("无法从节点获取Nonce：%w", err)
+	}
+
+	if err := tx.Sign(key); err != nil {
+		return err
+	}
+	buf := &bytes.Buffer{}
+	if err := tx.Encode(core.NewGobTxEncoder(buf)); err != nil {
+		return err
+	}
+
+	if kind == "deploy" {
+		if *prefix, err = addressPrefix(client, *prefix); err != nil {
+			return err
+		}
+		contract, err := core.ContractAddress(sender, tx.Nonce).Bech32(*prefix)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("合约地址：%s\n", contract)
+	}
+
+	if *noSend {
+		if err := printJSON(tx); err != nil {
+			return err
+		}
+		fmt.Printf("编码后的交易：%s\n", types.EncodeHex(buf.Bytes()))
+		return nil
+	}
+
+	var hash types.Hash
+	if err := client.Call(&hash, "tx_send", types.HexBytes(buf.Bytes())); err != nil {
+		return err
+	}
+	fmt.Printf("交易已提交：%s\n", types.EncodeHex(hash[:]))
+	return nil
+}
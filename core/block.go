@@ -2,21 +2,28 @@ package core
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"encoding/gob"
 	"fmt"
 	"io"
+	"time"
 
 	"github.com/Luboy23/Blockchain_Project/crypto"
 	"github.com/Luboy23/Blockchain_Project/types"
 )
 
-//	定义区块头的结构，包括版本、数据哈希、前一个区块哈希、时间戳和高度。
+//	定义区块头的结构，包括版本、数据哈希、前一个区块哈希、时间戳、高度、工作量证明所需的难度和随机数、燃料上限以及收据根。
 type Header struct {
 	Version       uint32     // 区块版本号
 	DataHash      types.Hash // 区块中所有交易的哈希值
 	PrevBlockHash types.Hash // 前一个区块的哈希值
 	Timestamp     int64      // 区块创建的时间戳
 	Height        uint32     // 区块在链上的高度
+	Difficulty    uint64     // 工作量证明难度，为0表示未启用PoW
+	Nonce         uint64     // 工作量证明的随机数
+	GasLimit      uint64     // 区块中所有交易的燃料上限之和不能超过该值
+	ReceiptsRoot  types.Hash // 区块中所有交易收据的哈希值
+	StateRoot     types.Hash // 执行区块后的状态根
 }
 
 //	定义区块的结构，包括区块头、交易列表、验证者公钥、签名和哈希。
@@ -47,12 +54,12 @@ func (b *Block) Hash(hasher Hasher[*Header]) types.Hash {
 	return b.hash // 返回计算得到的哈希值
 }
 
-//	将区块编码为字节流，用于序列化。
+//	将区块编码到字节流中，用于序列化。数据写入编码器持有的io.Writer，w应该与它相同。
 func (b *Block) Encode(w io.Writer, enc Encoder[*Block]) error {
 	return enc.Encode(b) // 使用提供的编码器将区块编码到输出流
 }
 
-//	从字节流中解码区块，用于反序列化。
+//	从字节流中解码区块，用于反序列化。数据从解码器持有的io.Reader读取，r应该与它相同。
 func (b *Block) Decode(r io.Reader, dec Decoder[*Block]) error {
 	return dec.Decode(b) // 使用提供的解码器从输入流解码区块
 }
@@ -62,6 +69,23 @@ func (b *Block) AddTransaction(tx *Transaction) {
 	b.Transactions = append(b.Transactions, *tx) // 将交易添加到区块的交易列表中
 }
 
+//	计算交易列表的数据哈希，即按顺序拼接每笔交易的哈希后再做一次SHA-256。
+//	没有交易时返回零哈希。
+func CalculateDataHash(txx []Transaction) types.Hash {
+	if len(txx) == 0 {
+		return types.Hash{}
+	}
+
+	buf := &bytes.Buffer{} // 创建一个缓冲区，用于拼接交易哈希
+
+	for i := range txx {
+		hash := txx[i].Hash(TxHasher{}) // 计算每笔交易的哈希值
+		buf.Write(hash.ToSlice())
+	}
+
+	return types.Hash(sha256.Sum256(buf.Bytes())) // 返回拼接结果的哈希值
+}
+
 //	创建一个新的区块，包含指定的区块头和交易列表。
 func NewBlock(h *Header, txx []Transaction) *Block {
 	return &Block{ // 返回一个新的区块实例
@@ -70,6 +94,26 @@ func NewBlock(h *Header, txx []Transaction) *Block {
 	}
 }
 
+//	在指定的前一个区块头之后创建一个新的区块，自动填充高度、前区块哈希、数据哈希和时间戳。
+//	时间戳取当前时间，但至少比前一个区块大1，保证新区块能通过时间戳检查。
+func NewBlockFromPrevHeader(prevHeader *Header, txx []Transaction) *Block {
+	timestamp := time.Now().UnixNano()
+	if timestamp <= prevHeader.Timestamp {
+		timestamp = prevHeader.Timestamp + 1
+	}
+
+	header := &Header{
+		Version:       1,                             // 设置区块版本为1
+		Height:        prevHeader.Height + 1,         // 高度为前一个区块高度加1
+		PrevBlockHash: BlockHasher{}.Hash(prevHeader), // 前一个区块的哈希值
+		DataHash:      CalculateDataHash(txx),        // 交易列表的数据哈希
+		Timestamp:     timestamp,                     // 当前时间戳
+		GasLimit:      prevHeader.GasLimit,           // 燃料上限与前一个区块相同
+	}
+
+	return NewBlock(header, txx)
+}
+
 //	为区块签名，使用提供的私钥对区块头进行签名，并设置验证者公钥和签名。
 func (b *Block) Sign(priKey crypto.PrivateKey) error {
 	sig, err := priKey.Sign(b.Header.Bytes()) // 使用私钥对区块头进行签名
@@ -89,6 +133,10 @@ func (b *Block) Verify() error {
 		return fmt.Errorf("区块没有签名！") // 如果没有签名，返回错误
 	}
 
+	if b.Signature.Type != b.Validator.Type { // 检查签名方案是否与验证者公钥一致
+		return fmt.Errorf("签名的密钥类型(%s)与验证者公钥的类型(%s)不符", b.Signature.Type, b.Validator.Type)
+	}
+
 	if !b.Signature.Verify(b.Validator, b.Header.Bytes()) { // 验证签名是否有效
 		return fmt.Errorf("区块签名不匹配！") // 如果签名无效，返回错误
 	}
@@ -99,5 +147,9 @@ func (b *Block) Verify() error {
 		}
 	}
 
+	if dataHash := CalculateDataHash(b.Transactions); dataHash != b.DataHash { // 检查数据哈希是否与交易列表一致
+		return fmt.Errorf("区块(%s)的数据哈希(%s)与交易不匹配，应为(%s)", b.Hash(BlockHasher{}), b.DataHash, dataHash)
+	}
+
 	return nil // 如果所有验证通过，返回nil表示成功
 }
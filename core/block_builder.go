@@ -0,0 +1,74 @@
+package core
+
+import (
+	"errors"
+
+	"github.com/Luboy23/Blockchain_Project/crypto"
+)
+
+// 在指定父区块之上用候选交易构建一个由proposer出块的新区块（未签名）。
+// 候选交易按顺序在父区块状态上试执行，执行失败的交易不会被打包，并作为第二个返回值返回，
+// 调用者通常应将它们移出交易池。Nonce超前于发送者的交易不算执行失败：它们会在其他交易打包后重试，
+// 仍然无法执行时被跳过并留在交易池中，等待中间缺少的交易到达。
+// 最多消耗的燃料（固有燃料加燃料上限）超过区块剩余燃料的交易同样被跳过并留在交易池中，区块燃料用尽后停止打包。
+// 区块的收据根和状态根按proposer出块计算，因此必须由proposer签名。
+func (bc *Blockchain) BuildBlock(parent *Header, proposer crypto.PublicKey, candidates []*Transaction) (*Block, []*Transaction, error) {
+	parentState, err := bc.StateAt(BlockHasher{}.Hash(parent))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	state := parentState.Copy()
+	block := NewBlockFromPrevHeader(parent, nil)
+	state.beginBlock(block)
+
+	txx := []Transaction{}
+	invalid := []*Transaction{}
+	var gasUsed uint64
+	for len(candidates) > 0 {
+		included := len(txx)
+		gapped := []*Transaction{} // 本轮中Nonce超前的交易
+		for _, tx := range candidates {
+			if gasUsed >= block.GasLimit && block.GasLimit > 0 {
+				break
+			}
+			if gas, ok := tx.MaxGas(); !ok || gas > block.GasLimit-gasUsed {
+				continue
+			}
+
+			result, err := state.applyTransaction(tx, block, bc.config)
+			if errors.Is(err, ErrNonceTooHigh) {
+				gapped = append(gapped, tx)
+				continue
+			}
+			if err != nil {
+				invalid = append(invalid, tx)
+				continue
+			}
+			gasUsed += result.GasUsed
+			txx = append(txx, *tx)
+		}
+
+		if len(txx) == included {
+			break // 本轮没有打包任何交易，Nonce的空缺不会被填补
+		}
+		candidates = gapped
+	}
+
+	block.Transactions = txx
+	block.DataHash = CalculateDataHash(txx)
+	block.Validator = proposer
+
+	// 在区块头的副本上完整执行一遍区块，得到收据根和状态根，避免缓存未完成区块的哈希
+	header := *block.Header
+	probe := NewBlock(&header, txx)
+	probe.Validator = proposer
+	state, receipt, err := applyBlock(parentState, probe, bc.config)
+	if err != nil {
+		return nil, nil, err
+	}
+	block.ReceiptsRoot = CalculateReceiptsRoot(receipt.Receipts)
+	block.StateRoot = state.Root()
+
+	return block, invalid, nil
+}
@@ -0,0 +1,221 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/Luboy23/Blockchain_Project/types"
+	"github.com/sirupsen/logrus"
+)
+
+// 区块日志文件开头的魔数。
+var blockLogMagic = [4]byte{'B', 'C', 'L', 'G'}
+
+// 区块日志文件头的长度：魔数加上创世区块哈希。
+const blockLogHeaderSize = len(blockLogMagic) + len(types.Hash{})
+
+// 追加写入的区块日志，节点用它把区块持久化到数据目录中，Replay之后区块链添加的区块都会先追加到日志。
+// 文件开头是魔数和创世区块哈希，之后依次是每个区块的记录：4字节大端长度、gob编码的区块以及该编码的SHA-256。
+// 每个区块在加入区块链之前先追加到日志并同步到磁盘，节点崩溃后重新添加日志中的区块即可恢复。
+// 日志保存所有添加过的区块（包括分叉链上的区块），不随存储模式裁剪。日志在关闭之前独占文件，同一个文件不能同时被两个进程使用。
+type BlockLog struct {
+	lock     sync.Mutex
+	path     string
+	f        *os.File
+	replayed bool // 是否已经回放，回放之后才能追加
+}
+
+// 打开或创建区块日志，文件已经被其他进程使用时返回错误。打开后需要调用Replay恢复区块并开始记录。
+func OpenBlockLog(path string) (*BlockLog, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err := lockFileExclusive(f); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("区块日志(%s)正被另一个进程使用：%s", path, err)
+	}
+
+	return &BlockLog{path: path, f: f}, nil
+}
+
+// 从头按顺序把日志中的区块重新添加到区块链，区块链中已有的区块被跳过，然后把日志设置到区块链，之后添加的区块都会追加到日志。
+// 返回新添加的区块数。日志为空时写入文件头。末尾不完整或损坏的记录（例如写入时断电）被截掉，之后的追加从最后一条完整的记录开始。
+// 日志中无法添加的区块（例如当初就因为与最终确认的区块冲突而被拒绝）记录警告后跳过。
+func (l *BlockLog) Replay(bc *Blockchain) (int, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.f == nil {
+		return 0, fmt.Errorf("区块日志已关闭")
+	}
+	if l.replayed {
+		return 0, fmt.Errorf("区块日志已经回放过")
+	}
+
+	genesis, err := bc.GetHeader(0)
+	if err != nil {
+		return 0, err
+	}
+	genesisHash := BlockHasher{}.Hash(genesis)
+
+	if _, err := l.f.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	r := bufio.NewReader(l.f)
+
+	header := make([]byte, blockLogHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		if !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+			return 0, err
+		}
+		// 新建的日志，或者写入文件头时断电
+		if err := l.truncate(0); err != nil {
+			return 0, err
+		}
+		if err := l.write(append(blockLogMagic[:], genesisHash.ToSlice()...)); err != nil {
+			return 0, err
+		}
+		l.replayed = true
+		bc.setBlockLog(l)
+		return 0, nil
+	}
+	if !bytes.Equal(header[:len(blockLogMagic)], blockLogMagic[:]) {
+		return 0, fmt.Errorf("(%s)不是区块日志", l.path)
+	}
+	if hash := types.HashFromBytes(header[len(blockLogMagic):]); hash != genesisHash {
+		return 0, fmt.Errorf("区块日志属于创世区块为(%s)的链，与本链的创世区块(%s)不符", hash, genesisHash)
+	}
+
+	offset := int64(blockLogHeaderSize) // 最后一条完整记录的结尾
+	imported := 0
+	for {
+		b, size, err := readBlockLogRecord(r)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"文件": l.path,
+				"位置": offset,
+			}).WithError(err).Warn("区块日志末尾的记录不完整，已截断")
+			if err := l.truncate(offset); err != nil {
+				return imported, err
+			}
+			break
+		}
+		offset += size
+
+		if bc.HasBlockHash(b.Hash(BlockHasher{})) {
+			continue
+		}
+		if err := bc.AddBlock(b); err != nil {
+			logrus.WithFields(logrus.Fields{
+				"区块高度": b.Height,
+				"区块哈希": b.Hash(BlockHasher{}),
+			}).WithError(err).Warn("跳过区块日志中无法添加的区块")
+			continue
+		}
+		imported++
+	}
+
+	l.replayed = true
+	bc.setBlockLog(l)
+	return imported, nil
+}
+
+// 把区块追加到日志末尾并同步到磁盘。
+func (l *BlockLog) append(b *Block) error {
+	buf := &bytes.Buffer{}
+	if err := b.Encode(buf, NewGobBlockEncoder(buf)); err != nil {
+		return err
+	}
+	sum := sha256.Sum256(buf.Bytes())
+
+	record := &bytes.Buffer{}
+	if err := writeRecord(record, buf.Bytes()); err != nil {
+		return err
+	}
+	record.Write(sum[:])
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.f == nil {
+		return fmt.Errorf("区块日志已关闭")
+	}
+	if !l.replayed {
+		return fmt.Errorf("区块日志尚未回放，不能追加区块")
+	}
+	return l.write(record.Bytes())
+}
+
+// 关闭日志并释放文件，可以重复调用。
+func (l *BlockLog) Close() error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.f == nil {
+		return nil
+	}
+	err := l.f.Close()
+	l.f = nil
+	return err
+}
+
+// 在文件末尾写入数据并同步到磁盘，调用者需要持有锁。
+func (l *BlockLog) write(data []byte) error {
+	if _, err := l.f.Write(data); err != nil {
+		return err
+	}
+	return l.f.Sync()
+}
+
+// 把文件截断到指定长度，调用者需要持有锁。
+func (l *BlockLog) truncate(size int64) error {
+	if err := l.f.Truncate(size); err != nil {
+		return err
+	}
+	return l.f.Sync()
+}
+
+// 读取一条区块记录并核对校验和，返回区块和记录的字节数。日志正好在记录边界结束时返回io.EOF。
+func readBlockLogRecord(r io.Reader) (*Block, int64, error) {
+	var length [4]byte
+	if _, err := io.ReadFull(r, length[:]); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, 0, io.EOF
+		}
+		return nil, 0, fmt.Errorf("记录的长度不完整")
+	}
+	n := binary.BigEndian.Uint32(length[:])
+	if n > maxExportRecordSize {
+		return nil, 0, fmt.Errorf("区块记录的长度(%d)超过上限(%d)", n, maxExportRecordSize)
+	}
+
+	record := &bytes.Buffer{} // 按实际读到的数据增长，而不是按记录中的长度预先分配
+	if _, err := io.CopyN(record, r, int64(n)); err != nil {
+		return nil, 0, fmt.Errorf("记录不完整")
+	}
+	var sum types.Hash
+	if _, err := io.ReadFull(r, sum[:]); err != nil {
+		return nil, 0, fmt.Errorf("记录的校验和不完整")
+	}
+	if sum != sha256.Sum256(record.Bytes()) {
+		return nil, 0, fmt.Errorf("记录的校验和不正确")
+	}
+
+	b := new(Block)
+	if err := b.Decode(record, NewGobBlockDecoder(record)); err != nil {
+		return nil, 0, fmt.Errorf("解码区块失败：%s", err)
+	}
+
+	return b, int64(len(length) + int(n) + len(sum)), nil
+}
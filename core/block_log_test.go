@@ -0,0 +1,99 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Luboy23/Blockchain_Project/crypto"
+	"github.com/Luboy23/Blockchain_Project/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// 测试添加的区块都写入区块日志，重启后从日志恢复，末尾不完整的记录被截掉。
+func TestBlockLog(t *testing.T) {
+	validatorKey := crypto.GeneratePrivatekey()
+	userKey := crypto.GeneratePrivatekey()
+	g := &Genesis{
+		Alloc: map[types.Address]uint64{userKey.PublicKey().Address(): 1000},
+		Validators: []GenesisValidator{
+			{PublicKey: validatorKey.PublicKey(), Stake: 100},
+		},
+	}
+	path := filepath.Join(t.TempDir(), "blocks.log")
+
+	bc, err := NewBlockchainFromGenesis(g)
+	assert.Nil(t, err)
+	log, err := OpenBlockLog(path)
+	assert.Nil(t, err)
+	n, err := log.Replay(bc)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+
+	// 同一个日志不能同时被打开两次
+	_, err = OpenBlockLog(path)
+	assert.NotNil(t, err)
+
+	for i := 0; i < 3; i++ {
+		tx := signedTx(t, userKey, TxTypeTransfer, uint64(i), types.Address{}, 1, nil)
+		assert.Nil(t, bc.AddBlock(signedBlock(t, bc, validatorKey, []Transaction{*tx})))
+	}
+	assert.Nil(t, log.Close())
+
+	// 模拟写入最后一条记录时断电
+	info, err := os.Stat(path)
+	assert.Nil(t, err)
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	assert.Nil(t, err)
+	_, err = f.Write([]byte{0, 0, 1, 0, 42})
+	assert.Nil(t, err)
+	assert.Nil(t, f.Close())
+
+	// 模拟重启
+	restarted, err := NewBlockchainFromGenesis(g)
+	assert.Nil(t, err)
+	log, err = OpenBlockLog(path)
+	assert.Nil(t, err)
+	n, err = log.Replay(restarted)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, n)
+	assert.Equal(t, bc.CurrentHeader(), restarted.CurrentHeader())
+	assert.Equal(t, bc.State().Root(), restarted.State().Root())
+
+	truncated, err := os.Stat(path)
+	assert.Nil(t, err)
+	assert.Equal(t, info.Size(), truncated.Size())
+
+	// 截断后追加的区块可以在下次启动时恢复
+	assert.Nil(t, restarted.AddBlock(signedBlock(t, restarted, validatorKey, nil)))
+	assert.Nil(t, log.Close())
+
+	again, err := NewBlockchainFromGenesis(g)
+	assert.Nil(t, err)
+	log, err = OpenBlockLog(path)
+	assert.Nil(t, err)
+	defer log.Close()
+	n, err = log.Replay(again)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, n)
+	assert.Equal(t, uint32(4), again.Height())
+}
+
+// 测试其他链的区块日志会被拒绝。
+func TestBlockLogOtherChain(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocks.log")
+
+	bc, _ := exportTestChain(t, 0)
+	log, err := OpenBlockLog(path)
+	assert.Nil(t, err)
+	_, err = log.Replay(bc)
+	assert.Nil(t, err)
+	assert.Nil(t, log.Close())
+
+	other, _ := exportTestChain(t, 0)
+	log, err = OpenBlockLog(path)
+	assert.Nil(t, err)
+	defer log.Close()
+	_, err = log.Replay(other)
+	assert.NotNil(t, err)
+}
@@ -48,18 +48,21 @@ func randomBlock(height uint32, prevBlockHash types.Hash) *Block {
 		PrevBlockHash: prevBlockHash, // 设置前一个区块的哈希值
 		Height:        height, // 设置区块高度
 		Timestamp:     time.Now().UnixNano(), // 设置当前时间戳
+		GasLimit:      DefaultBlockGasLimit, // 设置默认的燃料上限
 	}
 
 	return NewBlock(header, []Transaction{}) // 创建一个新的区块，包含指定的区块头和空的交易列表
 }
 
-//	创建一个随机区块，并为其签名。
-func randomBlockWithSignature(t *testing.T, height uint32, prevBlockHash types.Hash) *Block {
+//	创建一个随机区块，按父区块在bc中的状态填充收据根和状态根，并为其签名。
+func randomBlockWithSignature(t *testing.T, bc *Blockchain, height uint32, prevBlockHash types.Hash) *Block {
 	priKey := crypto.GeneratePrivatekey() // 生成一个私钥
 	b := randomBlock(height, prevBlockHash) // 创建一个随机区块
 
 	tx := randomTxWithSignature(t) // 创建一个随机交易，并为其签名
 	b.AddTransaction(tx) // 将交易添加到区块中
+	b.DataHash = CalculateDataHash(b.Transactions) // 更新区块的数据哈希
+	fillRoots(bc, b, priKey.PublicKey()) // 填充收据根和状态根
 	b.Sign(priKey) // 为区块签名
 
 	assert.Nil(t, b.Sign(priKey)) // 断言签名操作不返回错误
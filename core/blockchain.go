@@ -2,8 +2,10 @@ package core
 
 import (
 	"fmt"
+	"math/big"
 	"sync"
 
+	"github.com/Luboy23/Blockchain_Project/types"
 	"github.com/sirupsen/logrus"
 )
 
@@ -12,14 +14,74 @@ type Blockchain struct {
 	store     Storage // 区块链的存储
 	lock      sync.RWMutex // 用于同步访问区块链的锁
 	headers   []*Header // 区块链中的所有区块头
+	base      uint32    // headers中第一个区块头的高度，从快照同步时为快照的高度
 	validator Validator // 用于验证区块的验证器
+
+	headerIndex map[types.Hash]*Header   // 所有已知区块头（包括分叉链），按哈希索引
+	totalWork   map[types.Hash]*big.Int // 每个已知区块的累计工作量，用于分叉选择
+	pow         *PowConfig              // 工作量证明配置，为nil表示未启用PoW
+
+	config       *ChainConfig           // 链参数
+	states       map[types.Hash]*State // 每个已知区块执行后的状态
+	genesisState *State                // 创世区块对应的初始状态
+	receipts     map[types.Hash]*BlockReceipt // 每个已知区块的奖励和交易费收据
+	txLookup     map[types.Hash][]types.Hash  // 交易哈希到包含该交易的所有已知区块哈希（包括分叉链）
+	executed     map[types.Hash]*executedBlock // 验证时已经执行过、尚未添加的区块的执行结果
+
+	snapshotInterval uint32                    // 每隔多少个区块生成一次状态快照，0表示不生成
+	snapshots        map[types.Hash]*Snapshot // 按区块哈希保存的状态快照
+	snapshotStates   map[types.Hash]*State    // 位于快照高度、尚未生成快照的区块的状态，第一次请求快照时生成
+
+	storageCfg  StorageConfig              // 存储模式及保留的区块数
+	heightIndex map[uint32][]types.Hash    // 尚未裁剪的区块哈希（包括分叉链），按高度索引
+	pruneFrom   uint32                     // 下一个需要裁剪的高度
+
+	events        *EventBus // 链事件总线
+	finalityDepth uint32    // 区块在主链上达到该深度后视为最终确认
+	finalizeFrom  uint32    // 下一个需要最终确认的高度
+
+	blockLog *BlockLog // 区块加入区块链之前追加写入的日志，为nil表示区块只保存在存储中
+}
+
+// 记录区块的执行结果。
+type executedBlock struct {
+	state   *State
+	receipt *BlockReceipt
 }
 
 //	创建一个新的区块链，初始化存储和验证器，并添加创世区块。
 func NewBlockchain(genesis *Block) (*Blockchain, error) {
+	return newBlockchain(genesis, NewState(), DefaultChainConfig())
+}
+
+//	根据创世配置创建一个新的区块链。
+func NewBlockchainFromGenesis(g *Genesis) (*Blockchain, error) {
+	if err := g.ChainConfig().Validate(); err != nil {
+		return nil, fmt.Errorf("创世配置的链参数无效：%w", err)
+	}
+
+	return newBlockchain(g.ToBlock(), g.ToState(), g.ChainConfig())
+}
+
+//	使用创世区块、创世状态和链参数创建区块链。
+func newBlockchain(genesis *Block, state *State, cfg *ChainConfig) (*Blockchain, error) {
 	bc := &Blockchain{
 		headers: []*Header{}, // 初始化区块头列表
 		store:   NewMemstore(), // 初始化内存存储
+		headerIndex: make(map[types.Hash]*Header),
+		totalWork:   make(map[types.Hash]*big.Int),
+		config:       cfg,
+		states:       make(map[types.Hash]*State),
+		receipts:     make(map[types.Hash]*BlockReceipt),
+		txLookup:     make(map[types.Hash][]types.Hash),
+		executed:     make(map[types.Hash]*executedBlock),
+		snapshots:    make(map[types.Hash]*Snapshot),
+		snapshotStates: make(map[types.Hash]*State),
+		heightIndex:  make(map[uint32][]types.Hash),
+		genesisState: state,
+		events:        NewEventBus(),
+		finalityDepth: DefaultFinalityDepth,
+		finalizeFrom:  1, // 创世区块不需要最终确认
 	}
 
 	bc.validator = NewBlockValidator(bc) // 初始化验证器
@@ -34,11 +96,25 @@ func (bc *Blockchain) SetValidator(v Validator) {
 	bc.validator = v // 设置新的验证器
 }
 
+//	启用工作量证明模式，之后的区块都必须满足难度要求。
+func (bc *Blockchain) SetPowConfig(cfg *PowConfig) {
+	bc.lock.Lock()
+	defer bc.lock.Unlock()
+	bc.pow = cfg
+}
+
+//	返回区块链的工作量证明配置，未启用PoW时返回nil。
+func (bc *Blockchain) PowConfig() *PowConfig {
+	bc.lock.RLock()
+	defer bc.lock.RUnlock()
+	return bc.pow
+}
+
 //	获取区块链的高度。
 func (bc *Blockchain) Height() uint32 {
 	bc.lock.RLock() // 获取读锁
 	defer bc.lock.RUnlock() // 确保在函数返回时释放读锁
-	return uint32(len(bc.headers) - 1) // 返回区块链的高度
+	return bc.base + uint32(len(bc.headers)-1) // 返回区块链的高度
 }
 
 //	检查指定高度的区块是否存在于区块链中。
@@ -46,13 +122,26 @@ func (bc *Blockchain) HashBlock(height uint32) bool {
 	return height <= bc.Height()// 如果指定高度小于或等于区块链高度，则返回true
 }
 
+//	检查指定哈希的区块是否已知（包括分叉链上的区块）。
+func (bc *Blockchain) HasBlockHash(hash types.Hash) bool {
+	bc.lock.RLock()
+	defer bc.lock.RUnlock()
+
+	_, ok := bc.headerIndex[hash]
+	return ok
+}
+
 //	向区块链中添加一个新的区块。
 func (bc *Blockchain) AddBlock(b *Block) error {
 	if err := bc.validator.ValidateBlock(b); err != nil { // 验证区块
 		return err // 如果验证失败，返回错误
 	}
 
-	return bc.addBlockWithoutValidation(b) // 添加区块
+	if err := bc.addBlockWithoutValidation(b); err != nil { // 添加区块
+		bc.dropExecution(b.Hash(BlockHasher{})) // 添加失败时丢弃验证时缓存的执行结果
+		return err
+	}
+	return nil
 }
 
 //	获取指定高度的区块头。
@@ -63,19 +152,338 @@ func (bc *Blockchain) GetHeader(height uint32) (*Header, error) {
 	bc.lock.Lock() // 获取写锁
 	defer bc.lock.Unlock() // 确保在函数返回时释放写锁
 
-	return bc.headers[height], nil // 返回指定高度的区块头
+	if height < bc.base { // 从快照同步的节点没有快照之前的区块
+		return nil, fmt.Errorf("区块高度(%d)早于快照高度(%d)，本节点没有该区块", height, bc.base)
+	}
+
+	return bc.headers[height-bc.base], nil // 返回指定高度的区块头
+}
+
+//	按哈希获取区块头，分叉链上的区块头同样可以查到。
+func (bc *Blockchain) GetHeaderByHash(hash types.Hash) (*Header, error) {
+	bc.lock.RLock()
+	defer bc.lock.RUnlock()
+
+	h, ok := bc.headerIndex[hash]
+	if !ok {
+		return nil, fmt.Errorf("未知的区块哈希(%s)", hash)
+	}
+
+	return h, nil
+}
+
+//	按哈希获取区块，分叉链上的区块同样可以查到。裁剪模式下超出保留范围的区块返回ErrBlockPruned。
+func (bc *Blockchain) GetBlock(hash types.Hash) (*Block, error) {
+	b, err := bc.store.Get(hash)
+	if err != nil {
+		return nil, bc.bodyError(hash, err)
+	}
+
+	return b, nil
+}
+
+//	获取当前主链的最新区块头。
+func (bc *Blockchain) CurrentHeader() *Header {
+	bc.lock.RLock()
+	defer bc.lock.RUnlock()
+
+	return bc.headers[len(bc.headers)-1]
+}
+
+//	返回区块链的链参数。
+func (bc *Blockchain) Config() *ChainConfig {
+	return bc.config
+}
+
+//	获取指定区块执行后的状态，返回的状态不可修改。
+func (bc *Blockchain) StateAt(hash types.Hash) (*State, error) {
+	bc.lock.RLock()
+	defer bc.lock.RUnlock()
+
+	return bc.stateAt(hash)
+}
+
+//	获取当前主链最新区块执行后的状态。
+func (bc *Blockchain) State() *State {
+	bc.lock.RLock()
+	defer bc.lock.RUnlock()
+
+	return bc.states[bc.tipHash()]
+}
+
+//	获取指定区块的奖励和交易费收据。
+func (bc *Blockchain) GetBlockReceipt(hash types.Hash) (*BlockReceipt, error) {
+	bc.lock.RLock()
+	defer bc.lock.RUnlock()
+
+	receipt, ok := bc.receipts[hash]
+	if !ok {
+		if _, known := bc.headerIndex[hash]; known {
+			return nil, fmt.Errorf("区块(%s)的%w", hash, ErrStatePruned)
+		}
+		return nil, fmt.Errorf("没有区块(%s)的收据", hash)
+	}
+
+	return receipt, nil
+}
+
+//	获取指定区块中所有交易的收据。裁剪模式下超出保留范围的区块返回ErrBlockPruned。
+func (bc *Blockchain) GetReceipts(blockHash types.Hash) ([]*Receipt, error) {
+	receipts, err := bc.store.GetReceipts(blockHash)
+	if err != nil {
+		return nil, bc.bodyError(blockHash, err)
+	}
+
+	return receipts, nil
+}
+
+//	按交易哈希获取当前主链上该交易的收据。
+//	同一笔交易可能被打包进多个分叉区块，只返回位于主链上的那一个，因此主链重组后查询结果随之改变。
+func (bc *Blockchain) GetReceipt(txHash types.Hash) (*Receipt, error) {
+	bc.lock.RLock()
+	var blockHash types.Hash
+	found := false
+	for _, hash := range bc.txLookup[txHash] {
+		if bc.isCanonical(bc.headerIndex[hash]) {
+			blockHash, found = hash, true
+			break
+		}
+	}
+	bc.lock.RUnlock()
+
+	if !found {
+		return nil, fmt.Errorf("主链上没有交易(%s)", txHash)
+	}
+
+	receipts, err := bc.GetReceipts(blockHash)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range receipts {
+		if r.TxHash == txHash {
+			return r, nil
+		}
+	}
+
+	return nil, fmt.Errorf("区块(%s)中没有交易(%s)的收据", blockHash, txHash)
+}
+
+//	返回当前主链上已处理的所有作恶记录。
+func (bc *Blockchain) Offences() []*Offence {
+	return bc.State().Offences()
+}
+
+//	返回当前主链上指定验证者的作恶记录。
+func (bc *Blockchain) OffencesOf(addr types.Address) []*Offence {
+	offences := []*Offence{}
+	for _, o := range bc.Offences() {
+		if o.Offender == addr {
+			offences = append(offences, o)
+		}
+	}
+
+	return offences
+}
+
+//	获取当前主链的累计工作量。
+func (bc *Blockchain) TotalWork() *big.Int {
+	bc.lock.RLock()
+	defer bc.lock.RUnlock()
+
+	return new(big.Int).Set(bc.totalWork[bc.tipHash()])
+}
+
+//	返回主链最新区块的哈希，调用者需要持有锁。
+func (bc *Blockchain) tipHash() types.Hash {
+	return BlockHasher{}.Hash(bc.headers[len(bc.headers)-1])
+}
+
+//	计算在指定父区块之后出块所需的难度，未启用PoW时返回0。
+func (bc *Blockchain) NextDifficulty(parent *Header) (uint64, error) {
+	cfg := bc.PowConfig()
+	if cfg == nil {
+		return 0, nil
+	}
+
+	return cfg.NextDifficulty(parent, bc.ancestor)
+}
+
+//	沿着PrevBlockHash回溯，获取与指定区块处于同一分支、位于指定高度的祖先区块头。
+func (bc *Blockchain) ancestor(h *Header, height uint32) (*Header, error) {
+	for h.Height > height {
+		parent, err := bc.GetHeaderByHash(h.PrevBlockHash)
+		if err != nil {
+			return nil, err
+		}
+		h = parent
+	}
+
+	return h, nil
 }
 
 //	 添加一个新的区块到区块链中，不进行验证。
+//	如果区块延伸了当前主链则直接追加；否则作为分叉区块保存，当其所在分支的累计工作量超过主链时切换主链。
 func (bc *Blockchain) addBlockWithoutValidation(b *Block) error {
+	hash := b.Hash(BlockHasher{})
+
+	bc.lock.RLock()
+	conflict := bc.conflictsWithFinalized(b.Header)
+	blockLog := bc.blockLog
+	bc.lock.RUnlock()
+	if conflict {
+		return fmt.Errorf("高度为(%d)的%w", b.Height, ErrFinalizedConflict)
+	}
+
+	state, receipt, err := bc.executeBlock(b) // 执行区块中的交易
+	if err != nil {
+		return err
+	}
+	if err := bc.store.PutReceipts(hash, receipt.Receipts); err != nil { // 将交易收据存储到存储中
+		return err
+	}
+	if blockLog != nil {
+		if err := blockLog.append(b); err != nil {
+			return fmt.Errorf("写入区块日志失败：%w", err)
+		}
+	}
+	// 先保存区块体再登记区块头，区块头可以查到时区块体一定可以查到
+	if err := bc.store.Put(b); err != nil {
+		return err
+	}
+
 	bc.lock.Lock() // 获取写锁
-	bc.headers = append(bc.headers, b.Header) // 将新区块的头添加到区块头列表
+	if bc.conflictsWithFinalized(b.Header) { // 执行期间可能有新的区块被最终确认
+		bc.lock.Unlock()
+		if err := bc.store.Delete(hash); err != nil {
+			logrus.WithField("区块哈希", hash).Error(err)
+		}
+		return fmt.Errorf("高度为(%d)的%w", b.Height, ErrFinalizedConflict)
+	}
+	bc.states[hash] = state
+	bc.receipts[hash] = receipt
+	if bc.isSnapshotHeight(b.Height) {
+		bc.snapshotStates[hash] = state // 快照在第一次被请求时生成，不占用添加区块的时间
+	}
+	for _, r := range receipt.Receipts {
+		bc.txLookup[r.TxHash] = append(bc.txLookup[r.TxHash], hash)
+	}
+	work := b.Work()
+	if parentWork, ok := bc.totalWork[b.PrevBlockHash]; ok && len(bc.headers) > 0 {
+		work.Add(work, parentWork) // 累计工作量 = 父区块累计工作量 + 本区块工作量
+	}
+	bc.headerIndex[hash] = b.Header
+	bc.heightIndex[b.Height] = append(bc.heightIndex[b.Height], hash)
+	bc.totalWork[hash] = work
+
+	var oldHead *Header
+	var reverted, applied []*Header // 离开主链和加入主链的区块头
+	if len(bc.headers) == 0 || b.PrevBlockHash == bc.tipHash() {
+		if len(bc.headers) > 0 {
+			oldHead = bc.headers[len(bc.headers)-1]
+			applied = []*Header{b.Header}
+		}
+		bc.headers = append(bc.headers, b.Header) // 将新区块的头添加到区块头列表
+	} else if work.Cmp(bc.totalWork[bc.tipHash()]) > 0 {
+		oldHead = bc.headers[len(bc.headers)-1]
+		reverted, applied = bc.reorg(b.Header) // 分叉链的累计工作量更大，切换主链
+	}
+	finalized := bc.finalize() // 新达到最终确认深度的区块
+	bc.prune() // 裁剪超出保留范围的数据
 	bc.lock.Unlock() // 释放写锁
 
 	logrus.WithFields(logrus.Fields{ // 记录日志
 		"区块高度": b.Height,
-		"区块哈希": b.Hash(BlockHasher{}),
+		"区块哈希": hash,
+		"主链重组": len(reverted) > 0,
 	}).Info("添加了一个新的区块")
 
-	return bc.store.Put(b) // 将新区块存储到存储中
+	if len(applied) > 0 {
+		bc.publishHead(b, oldHead, reverted, applied, finalized) // 通知订阅者主链的变化
+	}
+
+	return nil
+}
+
+//	在父区块的状态上执行区块，创世区块直接使用创世状态。验证时已经执行过的区块直接返回缓存的结果。
+func (bc *Blockchain) executeBlock(b *Block) (*State, *BlockReceipt, error) {
+	bc.lock.Lock()
+	if result, ok := bc.executed[b.Hash(BlockHasher{})]; ok {
+		delete(bc.executed, b.Hash(BlockHasher{}))
+		bc.lock.Unlock()
+		return result.state, result.receipt, nil
+	}
+	isGenesis := len(bc.headers) == 0
+	parent, err := bc.stateAt(b.PrevBlockHash)
+	bc.lock.Unlock()
+
+	if isGenesis {
+		return bc.genesisState, &BlockReceipt{BlockHash: b.Hash(BlockHasher{})}, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("无法执行区块(%s)：%w", b.Hash(BlockHasher{}), err)
+	}
+
+	return ExecuteBlock(parent, b, bc.config)
+}
+
+//	缓存验证时的执行结果，供随后添加区块时使用。
+func (bc *Blockchain) cacheExecution(hash types.Hash, state *State, receipt *BlockReceipt) {
+	bc.lock.Lock()
+	defer bc.lock.Unlock()
+
+	bc.executed[hash] = &executedBlock{state: state, receipt: receipt}
+}
+
+//	设置区块日志，之后添加的区块都先追加到日志。
+func (bc *Blockchain) setBlockLog(l *BlockLog) {
+	bc.lock.Lock()
+	defer bc.lock.Unlock()
+
+	bc.blockLog = l
+}
+
+//	丢弃验证时缓存的执行结果。
+func (bc *Blockchain) dropExecution(hash types.Hash) {
+	bc.lock.Lock()
+	defer bc.lock.Unlock()
+
+	delete(bc.executed, hash)
+}
+
+//	检查区块头是否位于当前主链上，调用者需要持有锁。
+func (bc *Blockchain) isCanonical(h *Header) bool {
+	if h.Height < bc.base || int(h.Height-bc.base) >= len(bc.headers) {
+		return false
+	}
+
+	return BlockHasher{}.Hash(bc.headers[h.Height-bc.base]) == BlockHasher{}.Hash(h)
+}
+
+//	将主链切换到以newTip为链头的分支，调用者需要持有写锁。
+//	返回离开主链的区块头（从旧链头开始倒序）和加入主链的区块头（按高度升序，以newTip结尾）。
+func (bc *Blockchain) reorg(newTip *Header) ([]*Header, []*Header) {
+	branch := []*Header{} // 从新链头回溯到分叉点之间的区块头（倒序）
+	for h := newTip; !bc.isCanonical(h); {
+		branch = append(branch, h)
+		parent, ok := bc.headerIndex[h.PrevBlockHash]
+		if !ok {
+			return nil, nil // 分叉点已被裁剪，无法切换到该分支
+		}
+		h = parent
+	}
+
+	forkHeight := branch[len(branch)-1].Height - 1 // 分叉点的高度
+	reverted := []*Header{}
+	for i := len(bc.headers) - 1; i > int(forkHeight-bc.base); i-- {
+		reverted = append(reverted, bc.headers[i])
+	}
+
+	applied := []*Header{}
+	bc.headers = bc.headers[:forkHeight-bc.base+1]
+	for i := len(branch) - 1; i >= 0; i-- {
+		bc.headers = append(bc.headers, branch[i])
+		applied = append(applied, branch[i])
+	}
+
+	return reverted, applied
 }
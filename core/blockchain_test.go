@@ -2,8 +2,11 @@ package core
 
 import (
 	"fmt"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/Luboy23/Blockchain_Project/crypto"
 	"github.com/Luboy23/Blockchain_Project/types"
 	"github.com/stretchr/testify/assert"
 )
@@ -22,7 +25,7 @@ func TestAddBlock(t *testing.T) {
 
 	lenBlocks := 1000 // 定义要添加的区块数量
 	for i := 0; i < lenBlocks; i++ { // 循环添加区块
-		block := randomBlockWithSignature(t, uint32(i+1), getPrevBlockHash(t, bc, uint32(i+1))) // 创建并签名新的区块
+		block := randomBlockWithSignature(t, bc, uint32(i+1), getPrevBlockHash(t, bc, uint32(i+1))) // 创建并签名新的区块
 		assert.Nil(t, bc.AddBlock(block)) // 断言添加区块不返回错误
 	}
 
@@ -32,6 +35,27 @@ func TestAddBlock(t *testing.T) {
 	assert.NotNil(t, bc.AddBlock(randomBlock(48, types.Hash{}))) // 断言添加无效区块返回错误
 }
 
+// 保存区块总是失败的存储。
+type failingStore struct {
+	*MemoryStore
+}
+
+func (failingStore) Put(*Block) error {
+	return fmt.Errorf("磁盘已满")
+}
+
+//	测试保存区块失败时区块不会加入区块链，验证时缓存的执行结果也被丢弃。
+func TestAddBlockStoreFailure(t *testing.T) {
+	bc := newBlockchainWithGenesis(t)
+	bc.store = failingStore{NewMemstore()}
+
+	block := randomBlockWithSignature(t, bc, 1, getPrevBlockHash(t, bc, 1))
+	assert.NotNil(t, bc.AddBlock(block))
+	assert.Equal(t, uint32(0), bc.Height())
+	assert.False(t, bc.HasBlockHash(block.Hash(BlockHasher{})))
+	assert.Empty(t, bc.executed)
+}
+
 //	测试创建新的区块链。
 func TestNewBlockchain(t *testing.T) {
 	bc := newBlockchainWithGenesis(t) // 创建一个新的区块链
@@ -43,6 +67,22 @@ func TestNewBlockchain(t *testing.T) {
 	fmt.Println(bc.Height()) // 打印区块链高度
 }
 
+//	测试创世配置中无效的地址前缀在创建区块链时被拒绝。
+func TestNewBlockchainInvalidAddressPrefix(t *testing.T) {
+	for _, prefix := range []string{"l b", strings.Repeat("a", 84)} {
+		cfg := DefaultChainConfig()
+		cfg.AddressPrefix = prefix
+		_, err := NewBlockchainFromGenesis(&Genesis{Config: cfg})
+		assert.NotNil(t, err, prefix)
+	}
+
+	cfg := DefaultChainConfig()
+	cfg.AddressPrefix = "test"
+	bc, err := NewBlockchainFromGenesis(&Genesis{Config: cfg})
+	assert.Nil(t, err)
+	assert.Equal(t, "test", bc.Config().AddressHRP())
+}
+
 //	测试检查区块是否存在于区块链中。
 func TestTheHasBlock(t *testing.T) {
 	bc := newBlockchainWithGenesis(t) // 创建一个新的区块链
@@ -56,9 +96,9 @@ func TestTheHasBlock(t *testing.T) {
 func TestAddBlockToHeight(t *testing.T) {
 	bc := newBlockchainWithGenesis(t) // 创建一个新的区块链
 
-	assert.Nil(t, bc.AddBlock(randomBlockWithSignature(t, 1, getPrevBlockHash(t, bc, uint32(1))))) // 断言添加第1个区块不返回错误
+	assert.Nil(t, bc.AddBlock(randomBlockWithSignature(t, bc, 1, getPrevBlockHash(t, bc, uint32(1))))) // 断言添加第1个区块不返回错误
 
-	assert.NotNil(t, bc.AddBlock(randomBlockWithSignature(t, 3, types.Hash{}))) // 断言添加第3个区块返回错误
+	assert.NotNil(t, bc.AddBlock(randomBlockWithSignature(t, bc, 3, types.Hash{}))) // 断言添加第3个区块返回错误
 }
 
 //	测试获取指定高度的区块头。
@@ -66,7 +106,7 @@ func TestGetHeader(t *testing.T) {
 	bc := newBlockchainWithGenesis(t) // 创建一个新的区块链
 
 	for i := 0; i < 1000; i++ { // 循环添加区块
-		block := randomBlockWithSignature(t, uint32(i+1), getPrevBlockHash(t, bc, uint32(i+1))) // 创建并签名新的区块
+		block := randomBlockWithSignature(t, bc, uint32(i+1), getPrevBlockHash(t, bc, uint32(i+1))) // 创建并签名新的区块
 		assert.Nil(t, bc.AddBlock(block)) // 断言添加区块不返回错误
 
 		header, err := bc.GetHeader(uint32(i + 1)) // 获取指定高度的区块头
@@ -75,6 +115,63 @@ func TestGetHeader(t *testing.T) {
 	}
 }
 
+//	测试分叉选择：累计工作量更大的分叉链会成为主链。
+func TestForkChoiceCumulativeWork(t *testing.T) {
+	bc := newBlockchainWithGenesis(t) // 创建一个新的区块链
+	genesis, err := bc.GetHeader(0)
+	assert.Nil(t, err)
+
+	// 主链上添加两个区块
+	a1 := randomBlockWithSignature(t, bc, 1, BlockHasher{}.Hash(genesis))
+	assert.Nil(t, bc.AddBlock(a1))
+	a2 := randomBlockWithSignature(t, bc, 2, BlockHasher{}.Hash(a1.Header))
+	assert.Nil(t, bc.AddBlock(a2))
+
+	// 从创世区块分叉，工作量相同时保持原主链
+	b1 := randomBlockWithSignature(t, bc, 1, BlockHasher{}.Hash(genesis))
+	assert.Nil(t, bc.AddBlock(b1))
+	b2 := randomBlockWithSignature(t, bc, 2, BlockHasher{}.Hash(b1.Header))
+	assert.Nil(t, bc.AddBlock(b2))
+	assert.Equal(t, a2.Header, bc.CurrentHeader())
+
+	// 分叉链的累计工作量超过主链后发生重组
+	b3 := randomBlockWithSignature(t, bc, 3, BlockHasher{}.Hash(b2.Header))
+	assert.Nil(t, bc.AddBlock(b3))
+	assert.Equal(t, uint32(3), bc.Height())
+	assert.Equal(t, b3.Header, bc.CurrentHeader())
+
+	header, err := bc.GetHeader(1)
+	assert.Nil(t, err)
+	assert.Equal(t, b1.Header, header)
+
+	// 重复添加同一区块返回错误
+	assert.NotNil(t, bc.AddBlock(b3))
+}
+
+//	测试区块的时间戳必须晚于父区块，且不能超前本地时间太多。
+func TestBlockTimestamp(t *testing.T) {
+	bc := newBlockchainWithGenesis(t)
+	genesis, err := bc.GetHeader(0)
+	assert.Nil(t, err)
+
+	withTimestamp := func(timestamp int64) *Block {
+		priKey := crypto.GeneratePrivatekey()
+		b := randomBlock(1, BlockHasher{}.Hash(genesis))
+		b.Timestamp = timestamp
+		fillRoots(bc, b, priKey.PublicKey())
+		assert.Nil(t, b.Sign(priKey))
+		return b
+	}
+
+	assert.NotNil(t, bc.AddBlock(withTimestamp(genesis.Timestamp)))
+	assert.NotNil(t, bc.AddBlock(withTimestamp(time.Now().Add(2*MaxBlockTimeDrift).UnixNano())))
+	assert.Nil(t, bc.AddBlock(withTimestamp(genesis.Timestamp+1)))
+
+	// 父区块的时间戳在本地时间之后时，新区块的时间戳仍然晚于父区块
+	parent := &Header{Height: 1, Timestamp: time.Now().Add(time.Minute).UnixNano()}
+	assert.Greater(t, NewBlockFromPrevHeader(parent, nil).Timestamp, parent.Timestamp)
+}
+
 //	获取指定高度的前一个区块的哈希值。
 func getPrevBlockHash(t *testing.T, bc *Blockchain, height uint32) types.Hash {
 	prevHeader, err := bc.GetHeader(height - 1) // 获取前一个区块的头
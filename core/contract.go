@@ -0,0 +1,263 @@
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/Luboy23/Blockchain_Project/types"
+	"github.com/Luboy23/Blockchain_Project/vm"
+)
+
+// 记录一笔交易的执行结果。
+type ExecutionResult struct {
+	GasUsed         uint64        // 实际消耗的燃料
+	ReturnData      []byte        // 合约调用的返回数据
+	ContractAddress types.Address // 部署交易创建的合约地址
+	Logs            []*vm.Log     // 执行成功时记录的日志
+	Err             error         // 字节码执行的错误，为nil表示执行成功
+}
+
+// 根据发送者地址和部署交易的Nonce派生合约地址。
+func ContractAddress(sender types.Address, nonce uint64) types.Address {
+	buf := make([]byte, len(sender)+8)
+	copy(buf, sender[:])
+	binary.BigEndian.PutUint64(buf[len(sender):], nonce)
+
+	h := sha256.Sum256(buf)
+	return types.AddressFromBytes(h[len(h)-20:])
+}
+
+// 合约执行期间的分层状态，每一层对应一次调用，只记录该调用中修改的余额和存储。
+// 调用成功时修改并入上一层，最外层提交时才写入State，调用失败时直接丢弃该层。
+type execState struct {
+	state    *State
+	parent   *execState
+	balances map[types.Address]uint64
+	storage  map[types.Address]map[string][]byte
+}
+
+// 在状态之上创建最外层的执行状态。
+func newExecState(state *State) *execState {
+	return &execState{
+		state:    state,
+		balances: make(map[types.Address]uint64),
+		storage:  make(map[types.Address]map[string][]byte),
+	}
+}
+
+// 创建一个新的调用层。
+func (es *execState) child() *execState {
+	child := newExecState(es.state)
+	child.parent = es
+
+	return child
+}
+
+// 读取余额，依次查找本层、上层以及状态。
+func (es *execState) balance(addr types.Address) uint64 {
+	for layer := es; layer != nil; layer = layer.parent {
+		if b, ok := layer.balances[addr]; ok {
+			return b
+		}
+	}
+
+	return es.state.Balance(addr)
+}
+
+// 读取存储，依次查找本层、上层以及状态。
+func (es *execState) storageAt(addr types.Address, key []byte) []byte {
+	for layer := es; layer != nil; layer = layer.parent {
+		if v, ok := layer.storage[addr][string(key)]; ok {
+			return v
+		}
+	}
+
+	return es.state.StorageAt(addr, key)
+}
+
+// 在本层写入存储。
+func (es *execState) setStorage(addr types.Address, key, value []byte) {
+	namespace, ok := es.storage[addr]
+	if !ok {
+		namespace = make(map[string][]byte)
+		es.storage[addr] = namespace
+	}
+
+	namespace[string(key)] = value
+}
+
+// 在本层转账。
+func (es *execState) transfer(from, to types.Address, amount uint64) error {
+	if amount == 0 {
+		return nil
+	}
+
+	if es.balance(from) < amount {
+		return fmt.Errorf("账户(%s)余额不足以转账(%d)", from, amount)
+	}
+
+	es.balances[from] = es.balance(from) - amount
+	es.balances[to] = es.balance(to) + amount
+
+	return nil
+}
+
+// 将本层的修改并入上一层，最外层则写入状态。
+func (es *execState) commit() {
+	if es.parent == nil {
+		for addr, b := range es.balances {
+			es.state.account(addr).Balance = b
+		}
+		for addr, kv := range es.storage {
+			for k, v := range kv {
+				es.state.setStorage(addr, []byte(k), v)
+			}
+		}
+		return
+	}
+
+	for addr, b := range es.balances {
+		es.parent.balances[addr] = b
+	}
+	for addr, kv := range es.storage {
+		for k, v := range kv {
+			es.parent.setStorage(addr, []byte(k), v)
+		}
+	}
+}
+
+// 在新的调用层中执行字节码：先向ctx.Address转账ctx.Value，执行成功后修改并入本层并返回记录的日志。
+func (es *execState) execute(code []byte, ctx vm.Context, gas uint64) ([]byte, uint64, []*vm.Log, error) {
+	frame := es.child()
+	if err := frame.transfer(ctx.Caller, ctx.Address, ctx.Value); err != nil {
+		return nil, 0, nil, err
+	}
+
+	machine := vm.New(code, &contractStorage{es: frame, address: ctx.Address}, ctx, gas)
+	machine.SetHost(frame)
+	if err := machine.Run(); err != nil {
+		return machine.ReturnData(), machine.GasUsed(), nil, fmt.Errorf("字节码执行失败：%w", err)
+	}
+	frame.commit()
+
+	return machine.ReturnData(), machine.GasUsed(), machine.Logs(), nil
+}
+
+// 实现了vm.Host接口：调用to处的合约，to没有代码时只转账。
+func (es *execState) Call(caller, to types.Address, value uint64, input []byte, gas uint64, depth int) ([]byte, uint64, []*vm.Log, error) {
+	if depth > vm.MaxCallDepth {
+		return nil, 0, nil, fmt.Errorf("合约调用深度超过上限(%d)", vm.MaxCallDepth)
+	}
+
+	ctx := vm.Context{
+		Caller:  caller,
+		Address: to,
+		Value:   value,
+		Input:   input,
+		Depth:   depth,
+	}
+
+	return es.execute(es.state.Code(to), ctx, gas)
+}
+
+// 合约在执行状态中的存储视图，实现了vm.Storage接口。
+type contractStorage struct {
+	es      *execState
+	address types.Address
+}
+
+// 读取键对应的值。
+func (cs *contractStorage) Get(key []byte) []byte {
+	return cs.es.storageAt(cs.address, key)
+}
+
+// 写入键值。
+func (cs *contractStorage) Set(key, value []byte) {
+	cs.es.setStorage(cs.address, key, append([]byte{}, value...))
+}
+
+// 执行数据交易：如果数据是字节码，则以发送者为调用者、以交易的燃料上限在虚拟机中执行，并在成功后提交存储的写入。
+// 字节码使用自身哈希派生的地址作为存储命名空间，执行出错时不提交任何写入。
+func (s *State) applyData(tx *Transaction) *ExecutionResult {
+	if !vm.IsBytecode(tx.Data) {
+		return &ExecutionResult{}
+	}
+
+	code := vm.CodeFromData(tx.Data)
+	ctx := vm.Context{
+		Caller:  tx.Sender().Address(),
+		Address: vm.CodeAddress(code),
+	}
+
+	es := newExecState(s)
+	ret, gasUsed, logs, err := es.execute(code, ctx, tx.GasLimit)
+	es.commit()
+
+	return &ExecutionResult{GasUsed: gasUsed, ReturnData: ret, Logs: logs, Err: err}
+}
+
+// 执行部署交易：将交易数据作为合约代码保存在由发送者地址和Nonce派生的地址上，并向合约转账Value。
+// 燃料按代码长度收取，燃料不足时不部署。
+func (s *State) applyDeploy(tx *Transaction) (*ExecutionResult, error) {
+	if len(tx.Data) == 0 {
+		return nil, fmt.Errorf("部署交易没有合约代码")
+	}
+
+	sender := tx.Sender().Address()
+	addr := ContractAddress(sender, tx.Nonce)
+	if len(s.Code(addr)) > 0 {
+		return nil, fmt.Errorf("地址(%s)已经存在合约", addr)
+	}
+
+	if s.Balance(sender) < tx.Value {
+		return nil, fmt.Errorf("账户(%s)余额不足以转账(%d)", sender, tx.Value)
+	}
+
+	result := &ExecutionResult{
+		GasUsed:         vm.GasCodeByte * uint64(len(tx.Data)),
+		ContractAddress: addr,
+	}
+	if result.GasUsed > tx.GasLimit {
+		result.GasUsed = tx.GasLimit
+		result.Err = fmt.Errorf("部署合约失败：%w", vm.ErrOutOfGas)
+		return result, nil
+	}
+
+	s.code[addr] = append([]byte{}, tx.Data...)
+	s.touch(addr)
+	s.account(sender).Balance -= tx.Value
+	s.account(addr).Balance += tx.Value
+
+	return result, nil
+}
+
+// 执行调用交易：向合约To转账Value并以交易数据为输入执行合约代码。
+// 执行出错时转账和所有写入都被回滚。
+func (s *State) applyCall(tx *Transaction) (*ExecutionResult, error) {
+	if len(s.Code(tx.To)) == 0 {
+		return nil, fmt.Errorf("地址(%s)没有合约代码", tx.To)
+	}
+
+	sender := tx.Sender().Address()
+	if s.Balance(sender) < tx.Value {
+		return nil, fmt.Errorf("账户(%s)余额不足以转账(%d)", sender, tx.Value)
+	}
+
+	es := newExecState(s)
+	ret, gasUsed, logs, err := es.Call(sender, tx.To, tx.Value, tx.Data, tx.GasLimit, 0)
+	es.commit()
+
+	return &ExecutionResult{GasUsed: gasUsed, ReturnData: ret, Logs: logs, Err: err}, nil
+}
+
+// 在当前主链最新的状态上只读地调用合约，返回返回数据和消耗的燃料，不会修改状态。
+func (bc *Blockchain) Call(from, to types.Address, input []byte, gas uint64) ([]byte, uint64, error) {
+	state := bc.State()
+	if len(state.Code(to)) == 0 {
+		return nil, 0, fmt.Errorf("地址(%s)没有合约代码", to)
+	}
+
+	ret, gasUsed, _, err := newExecState(state).Call(from, to, 0, input, gas, 0)
+	return ret, gasUsed, err
+}
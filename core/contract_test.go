@@ -0,0 +1,303 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/Luboy23/Blockchain_Project/crypto"
+	"github.com/Luboy23/Blockchain_Project/types"
+	"github.com/Luboy23/Blockchain_Project/vm"
+	"github.com/stretchr/testify/assert"
+)
+
+// 测试字节码交易在区块执行时运行，并将存储的写入提交到状态。
+func TestExecuteBytecode(t *testing.T) {
+	validatorKey := crypto.GeneratePrivatekey()
+	bc, err := NewBlockchainFromGenesis(&Genesis{
+		Validators: []GenesisValidator{
+			{PublicKey: validatorKey.PublicKey(), Stake: 100},
+		},
+	})
+	assert.Nil(t, err)
+
+	// 计数器：n = n + 1
+	counter := [][]byte{
+		vm.Push([]byte("n")), vm.Push([]byte("n")), {byte(vm.SLOAD)}, vm.Push([]byte{1}), {byte(vm.ADD)}, {byte(vm.SSTORE)},
+	}
+	contract := vm.CodeAddress(vm.CodeFromData(vm.NewProgram(counter...)))
+
+	userKey := crypto.GeneratePrivatekey()
+	tx := signedTx(t, userKey, TxTypeData, 0, types.Address{}, 0, vm.NewProgram(counter...))
+	assert.Nil(t, bc.AddBlock(signedBlock(t, bc, validatorKey, []Transaction{*tx})))
+	assert.Equal(t, byte(1), bc.State().StorageAt(contract, []byte("n"))[31])
+
+	tx = signedTx(t, userKey, TxTypeData, 1, types.Address{}, 0, vm.NewProgram(counter...))
+	assert.Nil(t, bc.AddBlock(signedBlock(t, bc, validatorKey, []Transaction{*tx})))
+	assert.Equal(t, byte(2), bc.State().StorageAt(contract, []byte("n"))[31])
+
+	// 父区块的状态没有被修改
+	parentState, err := bc.StateAt(bc.CurrentHeader().PrevBlockHash)
+	assert.Nil(t, err)
+	assert.Equal(t, byte(1), parentState.StorageAt(contract, []byte("n"))[31])
+
+	// 普通数据交易不执行
+	plain := &Transaction{Nonce: 2, Data: []byte("foo")}
+	assert.Nil(t, plain.Sign(userKey))
+	assert.Nil(t, bc.AddBlock(signedBlock(t, bc, validatorKey, []Transaction{*plain})))
+}
+
+// 测试执行出错的字节码交易不会留下任何写入，但交易仍被打包并收取燃料费。
+func TestExecuteBytecodeFailure(t *testing.T) {
+	validatorKey := crypto.GeneratePrivatekey()
+	userKey := crypto.GeneratePrivatekey()
+	bc, err := NewBlockchainFromGenesis(&Genesis{
+		Alloc: map[types.Address]uint64{
+			userKey.PublicKey().Address(): 100000,
+		},
+		Validators: []GenesisValidator{
+			{PublicKey: validatorKey.PublicKey(), Stake: 100},
+		},
+	})
+	assert.Nil(t, err)
+
+	store := [][]byte{
+		vm.Push([]byte("k")), vm.Push([]byte("v")), {byte(vm.SSTORE)},
+	}
+	storeGas := 2*vm.GasFast + vm.GasSstore + 2*vm.GasStoreByte
+
+	// 栈下溢：写入被丢弃，已经消耗的燃料照常收取
+	failing := append(append([][]byte{}, store...), []byte{byte(vm.POP)})
+	contract := vm.CodeAddress(vm.CodeFromData(vm.NewProgram(failing...)))
+	tx := signedTx(t, userKey, TxTypeData, 0, types.Address{}, 0, vm.NewProgram(failing...))
+	tx.GasLimit = 1000
+	tx.GasPrice = 2
+	assert.Nil(t, tx.Sign(userKey))
+	gasUsed := tx.IntrinsicGas() + storeGas + vm.GasQuick // 固有燃料同样被收取
+
+	block, invalid, err := bc.BuildBlock(bc.CurrentHeader(), validatorKey.PublicKey(), []*Transaction{tx})
+	assert.Nil(t, err)
+	assert.Len(t, block.Transactions, 1)
+	assert.Len(t, invalid, 0)
+	assert.Nil(t, block.Sign(validatorKey))
+	assert.Nil(t, bc.AddBlock(block))
+
+	assert.Nil(t, bc.State().StorageAt(contract, []byte("k")))
+	assert.Equal(t, uint64(1), bc.State().Nonce(userKey.PublicKey().Address()))
+	assert.Equal(t, 100000-gasUsed*2, bc.State().Balance(userKey.PublicKey().Address()))
+
+	receipt, err := bc.GetBlockReceipt(BlockHasher{}.Hash(bc.CurrentHeader()))
+	assert.Nil(t, err)
+	assert.Equal(t, gasUsed, receipt.GasUsed)
+	assert.Equal(t, gasUsed*2, receipt.Fees)
+
+	// 燃料耗尽：写入被回滚，燃料上限全部作为燃料费收取
+	contract = vm.CodeAddress(vm.CodeFromData(vm.NewProgram(store...)))
+	tx = signedTx(t, userKey, TxTypeData, 1, types.Address{}, 0, vm.NewProgram(store...))
+	tx.GasLimit = storeGas - 1
+	tx.GasPrice = 3
+	assert.Nil(t, tx.Sign(userKey))
+
+	before := bc.State().Balance(userKey.PublicKey().Address())
+	assert.Nil(t, bc.AddBlock(signedBlock(t, bc, validatorKey, []Transaction{*tx})))
+	assert.Nil(t, bc.State().StorageAt(contract, []byte("k")))
+	assert.Equal(t, before-(tx.IntrinsicGas()+storeGas-1)*3, bc.State().Balance(userKey.PublicKey().Address()))
+
+	// 燃料足够时写入成功，未使用的燃料被退还
+	tx = signedTx(t, userKey, TxTypeData, 2, types.Address{}, 0, vm.NewProgram(store...))
+	tx.GasLimit = storeGas + 100
+	tx.GasPrice = 3
+	assert.Nil(t, tx.Sign(userKey))
+
+	before = bc.State().Balance(userKey.PublicKey().Address())
+	assert.Nil(t, bc.AddBlock(signedBlock(t, bc, validatorKey, []Transaction{*tx})))
+	assert.Equal(t, []byte("v"), bc.State().StorageAt(contract, []byte("k")))
+	assert.Equal(t, before-(tx.IntrinsicGas()+storeGas)*3, bc.State().Balance(userKey.PublicKey().Address()))
+
+	// 余额不足以支付燃料上限的交易无效
+	tx = signedTx(t, userKey, TxTypeData, 3, types.Address{}, 0, vm.NewProgram(store...))
+	tx.GasLimit = 1000
+	tx.GasPrice = 1 << 40
+	assert.Nil(t, tx.Sign(userKey))
+	_, invalid, err = bc.BuildBlock(bc.CurrentHeader(), validatorKey.PublicKey(), []*Transaction{tx})
+	assert.Nil(t, err)
+	assert.Len(t, invalid, 1)
+}
+
+// 测试区块燃料上限：构建区块时跳过放不下的交易，验证时拒绝超过上限的区块。
+func TestBlockGasLimit(t *testing.T) {
+	// 死循环会耗尽交易的全部燃料
+	loop := [][]byte{{byte(vm.JUMPDEST)}, vm.Push([]byte{0}), {byte(vm.JUMP)}}
+	candidates := []*Transaction{}
+	for i := 0; i < 3; i++ {
+		priKey := crypto.GeneratePrivatekey()
+		tx := signedTx(t, priKey, TxTypeData, 0, types.Address{}, 0, vm.NewProgram(loop...))
+		tx.GasLimit = 1000
+		assert.Nil(t, tx.Sign(priKey))
+		candidates = append(candidates, tx)
+	}
+	txGas, ok := candidates[0].MaxGas()
+	assert.True(t, ok)
+	gasLimit := 2*txGas + txGas/2 // 只能放下两笔交易
+
+	validatorKey := crypto.GeneratePrivatekey()
+	bc, err := NewBlockchainFromGenesis(&Genesis{
+		GasLimit: gasLimit,
+		Validators: []GenesisValidator{
+			{PublicKey: validatorKey.PublicKey(), Stake: 100},
+		},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, gasLimit, bc.CurrentHeader().GasLimit)
+
+	block, invalid, err := bc.BuildBlock(bc.CurrentHeader(), validatorKey.PublicKey(), candidates)
+	assert.Nil(t, err)
+	assert.Len(t, invalid, 0)
+	assert.Len(t, block.Transactions, 2) // 第三笔交易放不下，留在交易池中
+	assert.Equal(t, gasLimit, block.GasLimit)
+
+	// 燃料上限之和超过区块上限的区块无效
+	over := signedBlock(t, bc, validatorKey, []Transaction{*candidates[0], *candidates[1], *candidates[2]})
+	assert.NotNil(t, bc.AddBlock(over))
+
+	// 修改燃料上限的区块无效
+	changed := NewBlockFromPrevHeader(bc.CurrentHeader(), nil)
+	changed.GasLimit = 2 * gasLimit
+	assert.Nil(t, changed.Sign(validatorKey))
+	assert.NotNil(t, bc.AddBlock(changed))
+
+	assert.Nil(t, block.Sign(validatorKey))
+	assert.Nil(t, bc.AddBlock(block))
+}
+
+// 拼接字节码片段。
+func contractCode(parts ...[]byte) []byte {
+	code := []byte{}
+	for _, p := range parts {
+		code = append(code, p...)
+	}
+
+	return code
+}
+
+// 测试合约的部署、调用、转账、返回数据以及合约之间的调用。
+func TestDeployAndCallContract(t *testing.T) {
+	validatorKey := crypto.GeneratePrivatekey()
+	userKey := crypto.GeneratePrivatekey()
+	user := userKey.PublicKey().Address()
+	bc, err := NewBlockchainFromGenesis(&Genesis{
+		Alloc: map[types.Address]uint64{
+			user: 1000,
+		},
+		Validators: []GenesisValidator{
+			{PublicKey: validatorKey.PublicKey(), Stake: 100},
+		},
+	})
+	assert.Nil(t, err)
+
+	// 保存输入数据并返回 "hi:" || 输入数据
+	echo := contractCode(
+		vm.Push([]byte("last")), []byte{byte(vm.INPUT)}, []byte{byte(vm.SSTORE)},
+		vm.Push([]byte("hi:")), []byte{byte(vm.INPUT)}, []byte{byte(vm.CONCAT)}, []byte{byte(vm.RETURN)},
+	)
+	deploy := signedTx(t, userKey, TxTypeDeploy, 0, types.Address{}, 100, echo)
+	assert.Nil(t, bc.AddBlock(signedBlock(t, bc, validatorKey, []Transaction{*deploy})))
+
+	echoAddr := ContractAddress(user, 0)
+	assert.Equal(t, echo, bc.State().Code(echoAddr))
+	assert.Equal(t, uint64(100), bc.State().Balance(echoAddr))
+	assert.Equal(t, uint64(900), bc.State().Balance(user))
+
+	// 调用合约并转账
+	call := signedTx(t, userKey, TxTypeCall, 1, echoAddr, 50, []byte("x"))
+	assert.Nil(t, bc.AddBlock(signedBlock(t, bc, validatorKey, []Transaction{*call})))
+	assert.Equal(t, []byte("x"), bc.State().StorageAt(echoAddr, []byte("last")))
+	assert.Equal(t, uint64(150), bc.State().Balance(echoAddr))
+
+	// 只读调用返回数据且不修改状态
+	ret, gasUsed, err := bc.Call(user, echoAddr, []byte("y"), 100000)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("hi:y"), ret)
+	assert.True(t, gasUsed > 0)
+	assert.Equal(t, []byte("x"), bc.State().StorageAt(echoAddr, []byte("last")))
+
+	// 代理合约把输入转发给echo合约并返回其返回数据
+	proxy := contractCode(
+		vm.Push(echoAddr.ToSlice()), vm.Push([]byte{}), []byte{byte(vm.INPUT)}, []byte{byte(vm.CALL)},
+		[]byte{byte(vm.POP)}, []byte{byte(vm.RETURN)},
+	)
+	deploy = signedTx(t, userKey, TxTypeDeploy, 2, types.Address{}, 0, proxy)
+	assert.Nil(t, bc.AddBlock(signedBlock(t, bc, validatorKey, []Transaction{*deploy})))
+
+	proxyAddr := ContractAddress(user, 2)
+	ret, _, err = bc.Call(user, proxyAddr, []byte("z"), 100000)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("hi:z"), ret)
+
+	// 调用没有代码的地址是无效交易
+	_, invalid, err := bc.BuildBlock(bc.CurrentHeader(), validatorKey.PublicKey(), []*Transaction{signedTx(t, userKey, TxTypeCall, 3, user, 0, nil)})
+	assert.Nil(t, err)
+	assert.Len(t, invalid, 1)
+
+	// 没有代码的部署交易是无效交易
+	_, invalid, err = bc.BuildBlock(bc.CurrentHeader(), validatorKey.PublicKey(), []*Transaction{signedTx(t, userKey, TxTypeDeploy, 3, types.Address{}, 0, nil)})
+	assert.Nil(t, err)
+	assert.Len(t, invalid, 1)
+}
+
+// 测试合约回滚时转账和所有写入都被撤销，但交易仍被打包。
+func TestCallContractRevert(t *testing.T) {
+	validatorKey := crypto.GeneratePrivatekey()
+	userKey := crypto.GeneratePrivatekey()
+	user := userKey.PublicKey().Address()
+	bc, err := NewBlockchainFromGenesis(&Genesis{
+		Alloc: map[types.Address]uint64{
+			user: 1000,
+		},
+		Validators: []GenesisValidator{
+			{PublicKey: validatorKey.PublicKey(), Stake: 100},
+		},
+	})
+	assert.Nil(t, err)
+
+	reverting := contractCode(
+		vm.Push([]byte("k")), vm.Push([]byte("v")), []byte{byte(vm.SSTORE)},
+		vm.Push([]byte("no")), []byte{byte(vm.REVERT)},
+	)
+	deploy := signedTx(t, userKey, TxTypeDeploy, 0, types.Address{}, 0, reverting)
+	call := signedTx(t, userKey, TxTypeCall, 1, ContractAddress(user, 0), 300, nil)
+	assert.Nil(t, bc.AddBlock(signedBlock(t, bc, validatorKey, []Transaction{*deploy, *call})))
+
+	addr := ContractAddress(user, 0)
+	assert.Nil(t, bc.State().StorageAt(addr, []byte("k")))
+	assert.Equal(t, uint64(0), bc.State().Balance(addr))
+	assert.Equal(t, uint64(1000), bc.State().Balance(user))
+	assert.Equal(t, uint64(2), bc.State().Nonce(user))
+
+	ret, _, err := bc.Call(user, addr, nil, 100000)
+	assert.ErrorIs(t, err, vm.ErrReverted)
+	assert.Equal(t, []byte("no"), ret)
+}
+
+// 测试合约递归调用自身时受到调用深度的限制。
+func TestCallDepthLimit(t *testing.T) {
+	validatorKey := crypto.GeneratePrivatekey()
+	userKey := crypto.GeneratePrivatekey()
+	bc, err := NewBlockchainFromGenesis(&Genesis{
+		Validators: []GenesisValidator{
+			{PublicKey: validatorKey.PublicKey(), Stake: 100},
+		},
+	})
+	assert.Nil(t, err)
+
+	// n = n + 1，然后调用自身
+	recursive := contractCode(
+		vm.Push([]byte("n")), vm.Push([]byte("n")), []byte{byte(vm.SLOAD)}, vm.Push([]byte{1}), []byte{byte(vm.ADD)}, []byte{byte(vm.SSTORE)},
+		[]byte{byte(vm.ADDRESS)}, vm.Push([]byte{}), vm.Push([]byte{}), []byte{byte(vm.CALL)},
+	)
+	deploy := signedTx(t, userKey, TxTypeDeploy, 0, types.Address{}, 0, recursive)
+	call := signedTx(t, userKey, TxTypeCall, 1, ContractAddress(userKey.PublicKey().Address(), 0), 0, nil)
+	assert.Nil(t, bc.AddBlock(signedBlock(t, bc, validatorKey, []Transaction{*deploy, *call})))
+
+	// 深度0到MaxCallDepth的调用各执行一次
+	n := bc.State().StorageAt(ContractAddress(userKey.PublicKey().Address(), 0), []byte("n"))
+	assert.Equal(t, byte(vm.MaxCallDepth+1), n[31])
+}
@@ -1,7 +1,6 @@
 package core
 
 import (
-	"crypto/elliptic"
 	"encoding/gob"
 	"io"
 )
@@ -23,7 +22,6 @@ type GobTxEncoder struct {
 
 //	创建一个新的GobTxEncoder实例。
 func NewGobTxEncoder(w io.Writer) *GobTxEncoder {
-	gob.Register(elliptic.P256()) // 注册椭圆曲线P256以支持其编码
 	return &GobTxEncoder{w: w} // 返回新创建的GobTxEncoder实例
 }
 
@@ -40,7 +38,6 @@ type GobTxDecoder struct {
 
 //	创建一个新的GobTxDecoder实例。
 func NewGobTxDecoder(r io.Reader) *GobTxDecoder {
-	gob.Register(elliptic.P256()) // 注册椭圆曲线P256以支持其解码
 	return &GobTxDecoder{r: r} // 返回新创建的GobTxDecoder实例
 }
 
@@ -49,3 +46,63 @@ func (e *GobTxDecoder) Decode(tx *Transaction) error {
 	return gob.NewDecoder(e.r).Decode(tx) // 使用gob解码器解码Transaction
 
 }
+
+//	实现Encoder接口，用于编码Block类型的数据。
+type GobBlockEncoder struct {
+	w io.Writer // 用于写入编码数据的io.Writer
+}
+
+//	创建一个新的GobBlockEncoder实例。
+func NewGobBlockEncoder(w io.Writer) *GobBlockEncoder {
+	return &GobBlockEncoder{w: w}
+}
+
+//	使用GobBlockEncoder编码Block。
+func (e *GobBlockEncoder) Encode(b *Block) error {
+	return gob.NewEncoder(e.w).Encode(b) // 使用gob编码器编码Block
+}
+
+//	实现Decoder接口，用于解码Block类型的数据。
+type GobBlockDecoder struct {
+	r io.Reader // 用于读取解码数据的io.Reader
+}
+
+//	创建一个新的GobBlockDecoder实例。
+func NewGobBlockDecoder(r io.Reader) *GobBlockDecoder {
+	return &GobBlockDecoder{r: r}
+}
+
+//	使用GobBlockDecoder解码Block。
+func (d *GobBlockDecoder) Decode(b *Block) error {
+	return gob.NewDecoder(d.r).Decode(b) // 使用gob解码器解码Block
+}
+
+//	实现Encoder接口，用于编码SnapshotChunk类型的数据。
+type GobSnapshotChunkEncoder struct {
+	w io.Writer // 用于写入编码数据的io.Writer
+}
+
+//	创建一个新的GobSnapshotChunkEncoder实例。
+func NewGobSnapshotChunkEncoder(w io.Writer) *GobSnapshotChunkEncoder {
+	return &GobSnapshotChunkEncoder{w: w}
+}
+
+//	使用GobSnapshotChunkEncoder编码SnapshotChunk。
+func (e *GobSnapshotChunkEncoder) Encode(c *SnapshotChunk) error {
+	return gob.NewEncoder(e.w).Encode(c)
+}
+
+//	实现Decoder接口，用于解码SnapshotChunk类型的数据。
+type GobSnapshotChunkDecoder struct {
+	r io.Reader // 用于读取解码数据的io.Reader
+}
+
+//	创建一个新的GobSnapshotChunkDecoder实例。
+func NewGobSnapshotChunkDecoder(r io.Reader) *GobSnapshotChunkDecoder {
+	return &GobSnapshotChunkDecoder{r: r}
+}
+
+//	使用GobSnapshotChunkDecoder解码SnapshotChunk。
+func (d *GobSnapshotChunkDecoder) Decode(c *SnapshotChunk) error {
+	return gob.NewDecoder(d.r).Decode(c)
+}
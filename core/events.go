@@ -0,0 +1,280 @@
+package core
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	DefaultEventBuffer   = 64 // 订阅通道的默认缓冲区大小
+	DefaultFinalityDepth = 6  // 区块在主链上之后有多少个区块时视为最终确认
+)
+
+// 区块所在的分支与已经最终确认的主链区块冲突，接受它可能导致已确认的区块被回滚。
+var ErrFinalizedConflict = errors.New("区块与已经最终确认的区块冲突")
+
+// 定义了订阅者处理过慢、通道缓冲区已满时的处理策略。
+type SlowConsumerPolicy byte
+
+const (
+	DropNewest SlowConsumerPolicy = iota // 丢弃新事件，保留缓冲区中已有的事件
+	DropOldest                           // 丢弃缓冲区中最旧的事件，为新事件腾出位置
+	Disconnect                           // 关闭通道并取消订阅
+)
+
+// 一个类型化的事件源，向所有订阅者发送T类型的事件，零值可以直接使用。
+// 发送事件永远不会阻塞，订阅者跟不上时按订阅时指定的策略处理。
+type Feed[T any] struct {
+	lock sync.Mutex
+	subs map[*Subscription[T]]struct{}
+}
+
+// 表示对Feed的一个订阅。
+type Subscription[T any] struct {
+	feed    *Feed[T]
+	ch      chan T
+	policy  SlowConsumerPolicy
+	dropped uint64 // 被丢弃的事件数，由feed.lock保护
+	closed  bool   // 通道是否已经关闭，由feed.lock保护
+}
+
+// 订阅事件，buffer为通道的缓冲区大小（不大于0时使用DefaultEventBuffer），policy为缓冲区满时的处理策略。
+func (f *Feed[T]) Subscribe(buffer int, policy SlowConsumerPolicy) *Subscription[T] {
+	if buffer <= 0 {
+		buffer = DefaultEventBuffer
+	}
+
+	sub := &Subscription[T]{
+		feed:   f,
+		ch:     make(chan T, buffer),
+		policy: policy,
+	}
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if f.subs == nil {
+		f.subs = make(map[*Subscription[T]]struct{})
+	}
+	f.subs[sub] = struct{}{}
+
+	return sub
+}
+
+// 向所有订阅者发送事件，返回成功送达的订阅者数量。
+func (f *Feed[T]) Send(event T) int {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	sent := 0
+	for sub := range f.subs {
+		if sub.deliver(event) {
+			sent++
+		}
+	}
+
+	return sent
+}
+
+// 返回当前的订阅者数量。
+func (f *Feed[T]) Len() int {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	return len(f.subs)
+}
+
+// 按订阅的策略把事件放入通道，调用者需要持有feed.lock。
+func (s *Subscription[T]) deliver(event T) bool {
+	select {
+	case s.ch <- event:
+		return true
+	default:
+	}
+
+	s.dropped++
+	switch s.policy {
+	case DropOldest:
+		select {
+		case <-s.ch: // 丢弃最旧的事件，订阅者可能同时取走了它，此时通道同样有了空位
+		default:
+		}
+		select {
+		case s.ch <- event:
+			return true
+		default:
+			return false
+		}
+	case Disconnect:
+		s.close()
+		logrus.WithFields(logrus.Fields{
+			"丢弃事件数": s.dropped,
+		}).Warn("事件订阅者处理过慢，已取消订阅")
+	}
+
+	return false
+}
+
+// 关闭通道并从Feed中移除订阅，调用者需要持有feed.lock。
+func (s *Subscription[T]) close() {
+	if s.closed {
+		return
+	}
+	s.closed = true
+	delete(s.feed.subs, s)
+	close(s.ch)
+}
+
+// 返回接收事件的通道，取消订阅后通道被关闭。
+func (s *Subscription[T]) Chan() <-chan T {
+	return s.ch
+}
+
+// 取消订阅并关闭通道，可以重复调用。
+func (s *Subscription[T]) Unsubscribe() {
+	s.feed.lock.Lock()
+	defer s.feed.lock.Unlock()
+
+	s.close()
+}
+
+// 返回因缓冲区已满而被丢弃的事件数。
+func (s *Subscription[T]) Dropped() uint64 {
+	s.feed.lock.Lock()
+	defer s.feed.lock.Unlock()
+
+	return s.dropped
+}
+
+// 主链的链头发生变化。
+// Reverted为离开主链的区块（从旧链头开始倒序），Applied为加入主链的区块（按高度升序，以Block结尾），
+// 按顺序处理Reverted和Applied即可维护与主链一致的索引。
+type NewHeadEvent struct {
+	Block    *Block
+	Reverted []*Block
+	Applied  []*Block
+}
+
+// 主链发生了重组。
+type ReorgEvent struct {
+	OldHead  *Header
+	NewHead  *Header
+	Reverted []*Block // 离开主链的区块，从旧链头开始倒序
+	Applied  []*Block // 加入主链的区块，按高度升序
+}
+
+// 交易被加入交易池。
+type TxAddedEvent struct {
+	Tx *Transaction
+}
+
+// 交易被从交易池中丢弃。
+type TxDroppedEvent struct {
+	Tx     *Transaction
+	Reason string // 丢弃的原因
+}
+
+// 区块在主链上达到了最终确认深度。
+type BlockFinalizedEvent struct {
+	Header *Header
+}
+
+// 链事件总线，节点的各个模块通过订阅相应的Feed接收链事件。
+type EventBus struct {
+	NewHead        Feed[NewHeadEvent]
+	Reorg          Feed[ReorgEvent]
+	TxAdded        Feed[TxAddedEvent]
+	TxDropped      Feed[TxDroppedEvent]
+	BlockFinalized Feed[BlockFinalizedEvent]
+}
+
+// 创建一个新的事件总线。
+func NewEventBus() *EventBus {
+	return &EventBus{}
+}
+
+// 返回区块链的事件总线。
+func (bc *Blockchain) Events() *EventBus {
+	return bc.events
+}
+
+// 设置最终确认深度，区块之后有depth个主链区块时发布BlockFinalized事件。
+func (bc *Blockchain) SetFinalityDepth(depth uint32) {
+	bc.lock.Lock()
+	defer bc.lock.Unlock()
+
+	bc.finalityDepth = depth
+}
+
+// 返回新达到最终确认深度的主链区块头，调用者需要持有写锁。
+func (bc *Blockchain) finalize() []*Header {
+	tip := bc.base + uint32(len(bc.headers)-1)
+	if tip < bc.finalityDepth {
+		return nil
+	}
+
+	finalized := []*Header{}
+	for ; bc.finalizeFrom <= tip-bc.finalityDepth; bc.finalizeFrom++ {
+		finalized = append(finalized, bc.headers[bc.finalizeFrom-bc.base])
+	}
+
+	return finalized
+}
+
+// 检查区块所在的分支是否在已经最终确认的高度上离开主链，调用者需要持有锁。
+// 这样的分支无论累计工作量多大都不能成为主链，因此直接拒绝，而不是保存后等待重组。
+func (bc *Blockchain) conflictsWithFinalized(h *Header) bool {
+	for !bc.isCanonical(h) {
+		parent, ok := bc.headerIndex[h.PrevBlockHash]
+		if !ok {
+			return false // 父区块未知或已被裁剪，由区块验证和重组处理
+		}
+		h = parent
+	}
+
+	return h.Height+1 < bc.finalizeFrom // 分叉点之后的第一个高度已经被最终确认
+}
+
+// 发布主链变化的事件，b为新链头，调用者不能持有锁。
+func (bc *Blockchain) publishHead(b *Block, oldHead *Header, reverted, applied []*Header, finalized []*Header) {
+	revertedBlocks := bc.blocksOf(reverted)
+	appliedBlocks := bc.blocksOf(applied)
+
+	bc.events.NewHead.Send(NewHeadEvent{
+		Block:    b,
+		Reverted: revertedBlocks,
+		Applied:  appliedBlocks,
+	})
+
+	if len(reverted) > 0 {
+		bc.events.Reorg.Send(ReorgEvent{
+			OldHead:  oldHead,
+			NewHead:  b.Header,
+			Reverted: revertedBlocks,
+			Applied:  appliedBlocks,
+		})
+	}
+
+	for _, h := range finalized {
+		bc.events.BlockFinalized.Send(BlockFinalizedEvent{Header: h})
+	}
+}
+
+// 从存储中取出区块头对应的区块。
+func (bc *Blockchain) blocksOf(headers []*Header) []*Block {
+	blocks := make([]*Block, 0, len(headers))
+	for _, h := range headers {
+		b, err := bc.store.Get(BlockHasher{}.Hash(h))
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"区块高度": h.Height,
+			}).Error(err)
+			continue
+		}
+		blocks = append(blocks, b)
+	}
+
+	return blocks
+}
@@ -0,0 +1,147 @@
+package core
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Luboy23/Blockchain_Project/crypto"
+	"github.com/stretchr/testify/assert"
+)
+
+// 测试订阅者跟不上时三种处理策略的行为。
+func TestFeedSlowConsumerPolicies(t *testing.T) {
+	feed := &Feed[int]{}
+	newest := feed.Subscribe(2, DropNewest)
+	oldest := feed.Subscribe(2, DropOldest)
+	disconnect := feed.Subscribe(2, Disconnect)
+	assert.Equal(t, 3, feed.Len())
+
+	for i := 1; i <= 3; i++ {
+		feed.Send(i)
+	}
+
+	assert.Equal(t, 1, <-newest.Chan())
+	assert.Equal(t, 2, <-newest.Chan())
+	assert.Equal(t, uint64(1), newest.Dropped())
+
+	assert.Equal(t, 2, <-oldest.Chan())
+	assert.Equal(t, 3, <-oldest.Chan())
+	assert.Equal(t, uint64(1), oldest.Dropped())
+
+	// 缓冲区中的事件仍然可以读出，之后通道被关闭
+	assert.Equal(t, 1, <-disconnect.Chan())
+	assert.Equal(t, 2, <-disconnect.Chan())
+	_, ok := <-disconnect.Chan()
+	assert.False(t, ok)
+	assert.Equal(t, 2, feed.Len())
+
+	newest.Unsubscribe()
+	newest.Unsubscribe() // 可以重复取消订阅
+	_, ok = <-newest.Chan()
+	assert.False(t, ok)
+	assert.Equal(t, 1, feed.Send(4))
+}
+
+// 测试区块上链、主链重组和最终确认时发布的事件。
+func TestChainEvents(t *testing.T) {
+	validatorKey := crypto.GeneratePrivatekey()
+	bc, err := NewBlockchainFromGenesis(&Genesis{
+		Validators: []GenesisValidator{
+			{PublicKey: validatorKey.PublicKey(), Stake: 100},
+		},
+	})
+	assert.Nil(t, err)
+	bc.SetFinalityDepth(2)
+	genesis := bc.CurrentHeader()
+
+	heads := bc.Events().NewHead.Subscribe(0, DropNewest)
+	reorgs := bc.Events().Reorg.Subscribe(0, DropNewest)
+	finalized := bc.Events().BlockFinalized.Subscribe(0, DropNewest)
+
+	b1 := signedBlock(t, bc, validatorKey, nil)
+	assert.Nil(t, bc.AddBlock(b1))
+
+	ev := <-heads.Chan()
+	assert.Equal(t, b1, ev.Block)
+	assert.Empty(t, ev.Reverted)
+	assert.Equal(t, []*Block{b1}, ev.Applied)
+
+	// 更长的分叉链成为主链
+	parent := genesis
+	fork := []*Block{}
+	for i := 0; i < 2; i++ {
+		b := NewBlockFromPrevHeader(parent, nil)
+		b.Timestamp = genesis.Timestamp + int64(i) + 1
+		fillRoots(bc, b, validatorKey.PublicKey())
+		assert.Nil(t, b.Sign(validatorKey))
+		assert.Nil(t, bc.AddBlock(b))
+		fork = append(fork, b)
+		parent = b.Header
+	}
+
+	// 第一个分叉区块的累计工作量与b1相同，不改变主链，因此只有一次链头变化
+	ev = <-heads.Chan()
+	assert.Equal(t, fork[1], ev.Block)
+	assert.Equal(t, []*Block{b1}, ev.Reverted)
+	assert.Equal(t, fork, ev.Applied)
+	assert.Equal(t, 0, len(heads.Chan()))
+
+	reorg := <-reorgs.Chan()
+	assert.Equal(t, b1.Header, reorg.OldHead)
+	assert.Equal(t, fork[1].Header, reorg.NewHead)
+	assert.Equal(t, []*Block{b1}, reorg.Reverted)
+	assert.Equal(t, fork, reorg.Applied)
+
+	// 主链高度为2，最终确认深度为2，此时还没有区块被最终确认
+	assert.Equal(t, 0, len(finalized.Chan()))
+
+	assert.Nil(t, bc.AddBlock(signedBlock(t, bc, validatorKey, nil)))
+	fin := <-finalized.Chan()
+	assert.Equal(t, fork[0].Header, fin.Header)
+	assert.Equal(t, 0, len(reorgs.Chan()))
+}
+
+// 测试累计工作量更大的分叉链不能回滚已经最终确认的区块，但可以从最终确认的区块之后分叉。
+func TestReorgBelowFinalized(t *testing.T) {
+	bc := newBlockchainWithGenesis(t)
+	bc.SetPowConfig(&PowConfig{
+		InitialDifficulty: 1 << 4,
+		RetargetInterval:  100,
+		TargetBlockTime:   time.Second,
+	})
+	bc.SetFinalityDepth(2)
+	genesis := bc.CurrentHeader()
+	reorgs := bc.Events().Reorg.Subscribe(0, DropNewest)
+
+	main := []*Header{genesis}
+	for i := 0; i < 4; i++ {
+		b := minedBlock(t, bc, bc.CurrentHeader())
+		assert.Nil(t, bc.AddBlock(b))
+		main = append(main, b.Header)
+	}
+
+	// 从创世区块分叉会回滚已经最终确认的高度1和2，第一个分叉区块就被拒绝
+	b := minedBlock(t, bc, genesis)
+	assert.True(t, errors.Is(bc.AddBlock(b), ErrFinalizedConflict))
+	assert.False(t, bc.HasBlockHash(b.Hash(BlockHasher{})))
+	assert.True(t, errors.Is(bc.AddBlock(minedBlock(t, bc, main[1])), ErrFinalizedConflict))
+
+	// 从最后一个最终确认的区块分叉，累计工作量更大时正常重组
+	parent := main[2]
+	for i := 0; i < 3; i++ {
+		b := minedBlock(t, bc, parent)
+		assert.Nil(t, bc.AddBlock(b))
+		parent = b.Header
+	}
+	assert.Equal(t, parent, bc.CurrentHeader())
+	reorg := <-reorgs.Chan()
+	assert.Equal(t, main[4], reorg.OldHead)
+	assert.Equal(t, 2, len(reorg.Reverted))
+
+	for height := uint32(1); height <= 2; height++ {
+		h, err := bc.GetHeader(height)
+		assert.Nil(t, err)
+		assert.Equal(t, main[height], h)
+	}
+}
@@ -0,0 +1,171 @@
+package core
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/Luboy23/Blockchain_Project/crypto"
+	"github.com/Luboy23/Blockchain_Project/types"
+)
+
+// 带有验证者签名的区块头，是双重签名证据的组成部分。
+type SignedHeader struct {
+	Header    *Header           // 被签名的区块头
+	Validator crypto.PublicKey  // 签名的验证者公钥
+	Signature *crypto.Signature // 验证者对区块头的签名
+}
+
+// 从区块中提取带签名的区块头。
+func NewSignedHeader(b *Block) *SignedHeader {
+	return &SignedHeader{
+		Header:    b.Header,
+		Validator: b.Validator,
+		Signature: b.Signature,
+	}
+}
+
+// 验证区块头上的签名。
+func (sh *SignedHeader) Verify() error {
+	if sh.Header == nil || sh.Signature == nil || sh.Validator.Key == nil {
+		return fmt.Errorf("签名区块头不完整")
+	}
+
+	if !sh.Signature.Verify(sh.Validator, sh.Header.Bytes()) {
+		return fmt.Errorf("区块头(%s)签名不匹配！", BlockHasher{}.Hash(sh.Header))
+	}
+
+	return nil
+}
+
+// 双重签名的证据：同一个验证者在同一高度签名了两个不同的区块头。
+type DoubleSignEvidence struct {
+	A *SignedHeader
+	B *SignedHeader
+}
+
+// 返回作恶验证者的地址。
+func (e *DoubleSignEvidence) Offender() types.Address {
+	return e.A.Validator.Address()
+}
+
+// 返回发生双重签名的高度。
+func (e *DoubleSignEvidence) Height() uint32 {
+	return e.A.Header.Height
+}
+
+// 验证证据：两个签名都有效、来自同一个验证者、位于同一高度且区块头不同。
+func (e *DoubleSignEvidence) Verify() error {
+	if e.A == nil || e.B == nil {
+		return fmt.Errorf("双重签名证据不完整")
+	}
+
+	if err := e.A.Verify(); err != nil {
+		return err
+	}
+	if err := e.B.Verify(); err != nil {
+		return err
+	}
+
+	if e.A.Validator.Address() != e.B.Validator.Address() {
+		return fmt.Errorf("证据中的两个区块头来自不同的验证者")
+	}
+
+	if e.A.Header.Height != e.B.Header.Height {
+		return fmt.Errorf("证据中的两个区块头高度不同(%d, %d)", e.A.Header.Height, e.B.Header.Height)
+	}
+
+	if (BlockHasher{}).Hash(e.A.Header) == (BlockHasher{}).Hash(e.B.Header) {
+		return fmt.Errorf("证据中的两个区块头相同")
+	}
+
+	return nil
+}
+
+// 检测同一验证者在同一高度签名的两个不同区块头，并收集证据。
+// 只记录已知验证者在当前链头附近window个高度以内签名的区块头，任意节点都无法让已见区块头无限增长。
+type EquivocationDetector struct {
+	lock     sync.Mutex
+	window   uint32                            // 只记录高度与当前链头相差不超过window的区块头
+	seen     map[equivocationKey]*SignedHeader // 每个验证者在每个高度第一次签名的区块头
+	evidence []*DoubleSignEvidence             // 已收集到的证据
+}
+
+// 用于索引已见区块头的键。
+type equivocationKey struct {
+	validator types.Address
+	height    uint32
+}
+
+// 创建一个新的双重签名检测器，只记录高度与链头相差不超过window的区块头。
+func NewEquivocationDetector(window uint32) *EquivocationDetector {
+	return &EquivocationDetector{
+		window: window,
+		seen:   make(map[equivocationKey]*SignedHeader),
+	}
+}
+
+// 检查一个区块，head为当前链头的高度，state为当前链头的状态。
+// 签名无效、签名者不是state中的验证者或高度不在链头附近的区块会被忽略。
+// 如果该验证者已经在同一高度签名过另一个区块头，则记录并返回双重签名证据。
+func (d *EquivocationDetector) Check(b *Block, head uint32, state *State) *DoubleSignEvidence {
+	if b.Height+d.window < head || b.Height > head+d.window {
+		return nil // 过旧或过新的区块头不记录
+	}
+	if _, ok := state.Validator(b.Validator.Address()); !ok {
+		return nil // 只有已知的验证者才可能被惩罚
+	}
+
+	sh := NewSignedHeader(b)
+	if sh.Verify() != nil {
+		return nil // 只有有效签名才能构成证据
+	}
+
+	key := equivocationKey{
+		validator: sh.Validator.Address(),
+		height:    sh.Header.Height,
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	first, ok := d.seen[key]
+	if !ok {
+		d.seen[key] = sh
+		return nil
+	}
+
+	if (BlockHasher{}).Hash(first.Header) == (BlockHasher{}).Hash(sh.Header) {
+		return nil // 同一个区块被重复广播
+	}
+
+	ev := &DoubleSignEvidence{
+		A: first,
+		B: sh,
+	}
+	d.evidence = append(d.evidence, ev)
+
+	return ev
+}
+
+// 返回所有已收集的证据。
+func (d *EquivocationDetector) Evidence() []*DoubleSignEvidence {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	evidence := make([]*DoubleSignEvidence, len(d.evidence))
+	copy(evidence, d.evidence)
+
+	return evidence
+}
+
+// 丢弃低于指定高度的已见区块头，避免内存无限增长。
+func (d *EquivocationDetector) Prune(height uint32) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	for key := range d.seen {
+		if key.height < height {
+			delete(d.seen, key)
+		}
+	}
+}
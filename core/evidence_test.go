@@ -0,0 +1,99 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/Luboy23/Blockchain_Project/crypto"
+	"github.com/Luboy23/Blockchain_Project/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// 测试检测器在同一验证者于同一高度签名两个不同区块时收集证据。
+func TestEquivocationDetector(t *testing.T) {
+	priKey := crypto.GeneratePrivatekey()
+	otherKey := crypto.GeneratePrivatekey()
+	state := NewState()
+	state.SetValidator(&ValidatorRecord{PublicKey: priKey.PublicKey()})
+	state.SetValidator(&ValidatorRecord{PublicKey: otherKey.PublicKey()})
+	d := NewEquivocationDetector(10)
+
+	a := randomBlock(3, types.Hash{})
+	assert.Nil(t, a.Sign(priKey))
+	assert.Nil(t, d.Check(a, 3, state))
+	assert.Nil(t, d.Check(a, 3, state)) // 重复广播的同一区块不是证据
+
+	// 其他验证者在同一高度签名不构成证据
+	other := randomBlock(3, types.Hash{})
+	assert.Nil(t, other.Sign(otherKey))
+	assert.Nil(t, d.Check(other, 3, state))
+
+	// 签名无效的区块被忽略
+	forged := randomBlock(3, types.Hash{})
+	forged.Timestamp++
+	assert.Nil(t, forged.Sign(priKey))
+	forged.Nonce++
+	assert.Nil(t, d.Check(forged, 3, state))
+
+	b := randomBlock(3, types.Hash{})
+	b.Timestamp += 2
+	assert.Nil(t, b.Sign(priKey))
+
+	ev := d.Check(b, 3, state)
+	assert.NotNil(t, ev)
+	assert.Nil(t, ev.Verify())
+	assert.Equal(t, priKey.PublicKey().Address(), ev.Offender())
+	assert.Equal(t, uint32(3), ev.Height())
+	assert.Len(t, d.Evidence(), 1)
+}
+
+// 测试检测器只记录已知验证者在链头附近签名的区块头。
+func TestEquivocationDetectorBounds(t *testing.T) {
+	priKey := crypto.GeneratePrivatekey()
+	state := NewState()
+	state.SetValidator(&ValidatorRecord{PublicKey: priKey.PublicKey()})
+	d := NewEquivocationDetector(10)
+
+	// 未知签名者的区块头不记录
+	for i := 0; i < 100; i++ {
+		b := randomBlock(50, types.Hash{})
+		assert.Nil(t, b.Sign(crypto.GeneratePrivatekey()))
+		assert.Nil(t, d.Check(b, 50, state))
+	}
+
+	// 距离链头超过窗口的区块头不记录
+	for _, height := range []uint32{1, 39, 61, 1000} {
+		b := randomBlock(height, types.Hash{})
+		assert.Nil(t, b.Sign(priKey))
+		assert.Nil(t, d.Check(b, 50, state))
+	}
+	assert.Empty(t, d.seen)
+
+	b := randomBlock(60, types.Hash{})
+	assert.Nil(t, b.Sign(priKey))
+	assert.Nil(t, d.Check(b, 50, state))
+	assert.Len(t, d.seen, 1)
+}
+
+// 测试证据验证拒绝不构成双重签名的情况。
+func TestDoubleSignEvidenceVerify(t *testing.T) {
+	priKey := crypto.GeneratePrivatekey()
+
+	a := randomBlock(1, types.Hash{})
+	assert.Nil(t, a.Sign(priKey))
+	b := randomBlock(2, types.Hash{})
+	assert.Nil(t, b.Sign(priKey))
+
+	// 高度不同
+	ev := &DoubleSignEvidence{A: NewSignedHeader(a), B: NewSignedHeader(b)}
+	assert.NotNil(t, ev.Verify())
+
+	// 同一个区块头
+	ev = &DoubleSignEvidence{A: NewSignedHeader(a), B: NewSignedHeader(a)}
+	assert.NotNil(t, ev.Verify())
+
+	// 不同的验证者
+	c := randomBlock(1, types.Hash{})
+	assert.Nil(t, c.Sign(crypto.GeneratePrivatekey()))
+	ev = &DoubleSignEvidence{A: NewSignedHeader(a), B: NewSignedHeader(c)}
+	assert.NotNil(t, ev.Verify())
+}
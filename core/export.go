@@ -0,0 +1,210 @@
+package core
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/Luboy23/Blockchain_Project/types"
+)
+
+// 导出文件开头的魔数。
+var exportMagic = [4]byte{'B', 'C', 'E', 'X'}
+
+// 导出文件格式的版本号。
+const exportVersion uint16 = 2
+
+// 单个区块记录的最大字节数，防止损坏的文件导致分配过多内存。
+const maxExportRecordSize = 32 << 20
+
+// 导出文件的文件头，记录区块范围和所属链的创世区块哈希。
+// 文件头之后依次是每个区块的记录：4字节大端长度加上gob编码的区块，
+// 最后是所有区块记录的SHA-256校验和，因此导入和导出都可以逐个处理区块。
+type ExportHeader struct {
+	Version     uint16     // 文件格式版本
+	GenesisHash types.Hash // 创世区块哈希，导入时必须与目标区块链一致
+	From        uint32     // 第一个区块的高度
+	To          uint32     // 最后一个区块的高度
+}
+
+// 导入和导出的进度回调，done为已处理的区块数，total为区块总数。
+type ProgressFunc func(done, total int)
+
+// 将主链上高度在[from, to]之间的区块从存储中逐个导出到w。
+func (bc *Blockchain) ExportChain(w io.Writer, from, to uint32, progress ProgressFunc) error {
+	if from > to {
+		return fmt.Errorf("导出范围无效：起始高度(%d)大于结束高度(%d)", from, to)
+	}
+	if to > bc.Height() {
+		return fmt.Errorf("导出范围无效：结束高度(%d)超过区块链高度(%d)", to, bc.Height())
+	}
+
+	genesis, err := bc.GetHeader(0)
+	if err != nil {
+		return err
+	}
+
+	header := &ExportHeader{
+		Version:     exportVersion,
+		GenesisHash: BlockHasher{}.Hash(genesis),
+		From:        from,
+		To:          to,
+	}
+	if err := header.write(w); err != nil {
+		return err
+	}
+
+	total := int(to-from) + 1
+	checksum := sha256.New()
+	buf := &bytes.Buffer{}
+	for height := from; height <= to; height++ {
+		header, err := bc.GetHeader(height)
+		if err != nil {
+			return err
+		}
+		b, err := bc.GetBlock(BlockHasher{}.Hash(header))
+		if err != nil {
+			return fmt.Errorf("无法导出高度为(%d)的区块：%w", height, err)
+		}
+
+		buf.Reset()
+		if err := b.Encode(buf, NewGobBlockEncoder(buf)); err != nil {
+			return err
+		}
+		if err := writeRecord(io.MultiWriter(w, checksum), buf.Bytes()); err != nil {
+			return err
+		}
+		if progress != nil {
+			progress(int(height-from)+1, total)
+		}
+	}
+
+	_, err = w.Write(checksum.Sum(nil))
+	return err
+}
+
+// 从r逐个读取区块并通过AddBlock重新验证和添加，最后核对文件末尾的校验和。
+// 每个区块都经过完整的验证，校验和只用于发现损坏或被截断的文件，因此校验和不符时已经添加的区块会被保留。
+// 区块链中已经存在的区块会被跳过，因此中断后可以用同一个文件继续导入。返回新添加的区块数。
+func (bc *Blockchain) ImportChain(r io.Reader, progress ProgressFunc) (int, error) {
+	header, err := ReadExportHeader(r)
+	if err != nil {
+		return 0, err
+	}
+
+	genesis, err := bc.GetHeader(0)
+	if err != nil {
+		return 0, err
+	}
+	if hash := (BlockHasher{}).Hash(genesis); hash != header.GenesisHash {
+		return 0, fmt.Errorf("导出文件属于创世区块为(%s)的链，与本链的创世区块(%s)不符", header.GenesisHash, hash)
+	}
+
+	total := int(header.To-header.From) + 1 // 只用于报告进度，文件头中的数据不可信，不能用来分配内存
+	imported := 0
+	checksum := sha256.New()
+	for i := 0; i < total; i++ {
+		record, err := readRecord(io.TeeReader(r, checksum))
+		if err != nil {
+			return imported, fmt.Errorf("读取第%d个区块失败：%s", i+1, err)
+		}
+
+		b := new(Block)
+		recordReader := bytes.NewReader(record)
+		if err := b.Decode(recordReader, NewGobBlockDecoder(recordReader)); err != nil {
+			return imported, fmt.Errorf("解码第%d个区块失败：%s", i+1, err)
+		}
+		if b.Height != header.From+uint32(i) {
+			return imported, fmt.Errorf("第%d个区块的高度(%d)不正确，应为(%d)", i+1, b.Height, header.From+uint32(i))
+		}
+
+		if !bc.HasBlockHash(b.Hash(BlockHasher{})) { // 已经导入的区块直接跳过
+			if err := bc.AddBlock(b); err != nil {
+				return imported, fmt.Errorf("导入高度为(%d)的区块失败：%w", b.Height, err)
+			}
+			imported++
+		}
+		if progress != nil {
+			progress(i+1, total)
+		}
+	}
+
+	var sum types.Hash
+	if _, err := io.ReadFull(r, sum[:]); err != nil {
+		return imported, fmt.Errorf("读取导出文件的校验和失败：%s", err)
+	}
+	if expected := types.HashFromBytes(checksum.Sum(nil)); sum != expected {
+		return imported, fmt.Errorf("导出文件的校验和(%s)不正确，应为(%s)", sum, expected)
+	}
+
+	return imported, nil
+}
+
+// 读取并检查导出文件的文件头。
+func ReadExportHeader(r io.Reader) (*ExportHeader, error) {
+	var magic [4]byte
+	if _, err := io.ReadFull(r, magic[:]); err != nil {
+		return nil, fmt.Errorf("读取导出文件头失败：%s", err)
+	}
+	if magic != exportMagic {
+		return nil, fmt.Errorf("不是区块导出文件")
+	}
+
+	h := &ExportHeader{}
+	for _, v := range []any{&h.Version, &h.GenesisHash, &h.From, &h.To} {
+		if err := binary.Read(r, binary.BigEndian, v); err != nil {
+			return nil, fmt.Errorf("读取导出文件头失败：%s", err)
+		}
+	}
+	if h.Version != exportVersion {
+		return nil, fmt.Errorf("不支持的导出文件版本(%d)", h.Version)
+	}
+	if h.From > h.To {
+		return nil, fmt.Errorf("导出文件的区块范围无效：起始高度(%d)大于结束高度(%d)", h.From, h.To)
+	}
+
+	return h, nil
+}
+
+// 写入文件头。
+func (h *ExportHeader) write(w io.Writer) error {
+	if _, err := w.Write(exportMagic[:]); err != nil {
+		return err
+	}
+	for _, v := range []any{h.Version, h.GenesisHash, h.From, h.To} {
+		if err := binary.Write(w, binary.BigEndian, v); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// 写入一条带长度前缀的记录。
+func writeRecord(w io.Writer, record []byte) error {
+	if err := binary.Write(w, binary.BigEndian, uint32(len(record))); err != nil {
+		return err
+	}
+	_, err := w.Write(record)
+	return err
+}
+
+// 读取一条带长度前缀的记录。
+func readRecord(r io.Reader) ([]byte, error) {
+	var n uint32
+	if err := binary.Read(r, binary.BigEndian, &n); err != nil {
+		return nil, err
+	}
+	if n > maxExportRecordSize {
+		return nil, fmt.Errorf("区块记录的长度(%d)超过上限(%d)", n, maxExportRecordSize)
+	}
+
+	record := &bytes.Buffer{} // 按实际读到的数据增长，而不是按记录中的长度预先分配
+	if _, err := io.CopyN(record, r, int64(n)); err != nil {
+		return nil, err
+	}
+
+	return record.Bytes(), nil
+}
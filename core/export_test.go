@@ -0,0 +1,126 @@
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"github.com/Luboy23/Blockchain_Project/crypto"
+	"github.com/Luboy23/Blockchain_Project/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// 创建一个包含指定数量区块的区块链，每个区块包含一笔转账。
+func exportTestChain(t *testing.T, n int) (*Blockchain, *Genesis) {
+	validatorKey := crypto.GeneratePrivatekey()
+	userKey := crypto.GeneratePrivatekey()
+	g := &Genesis{
+		Alloc: map[types.Address]uint64{userKey.PublicKey().Address(): 1000},
+		Validators: []GenesisValidator{
+			{PublicKey: validatorKey.PublicKey(), Stake: 100},
+		},
+	}
+	bc, err := NewBlockchainFromGenesis(g)
+	assert.Nil(t, err)
+
+	for i := 0; i < n; i++ {
+		tx := signedTx(t, userKey, TxTypeTransfer, uint64(i), crypto.GeneratePrivatekey().PublicKey().Address(), 1, nil)
+		assert.Nil(t, bc.AddBlock(signedBlock(t, bc, validatorKey, []Transaction{*tx})))
+	}
+
+	return bc, g
+}
+
+// 测试导出的区块可以导入到另一个节点，并且中断后可以继续导入。
+func TestExportImportChain(t *testing.T) {
+	bc, g := exportTestChain(t, 5)
+
+	buf := &bytes.Buffer{}
+	exported := 0
+	assert.Nil(t, bc.ExportChain(buf, 0, 5, func(done, total int) {
+		exported = done
+		assert.Equal(t, 6, total)
+	}))
+	assert.Equal(t, 6, exported)
+
+	header, err := ReadExportHeader(bytes.NewReader(buf.Bytes()))
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(0), header.From)
+	assert.Equal(t, uint32(5), header.To)
+
+	// 先导入前3个区块，模拟一次中断的导入
+	partial := &bytes.Buffer{}
+	assert.Nil(t, bc.ExportChain(partial, 1, 3, nil))
+
+	other, err := NewBlockchainFromGenesis(g)
+	assert.Nil(t, err)
+	n, err := other.ImportChain(partial, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, n)
+	assert.Equal(t, uint32(3), other.Height())
+
+	// 用完整的文件继续导入，已有的区块被跳过
+	progress := 0
+	n, err = other.ImportChain(bytes.NewReader(buf.Bytes()), func(done, total int) {
+		progress = done
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, 6, progress)
+	assert.Equal(t, bc.CurrentHeader(), other.CurrentHeader())
+	assert.Equal(t, bc.State().Root(), other.State().Root())
+}
+
+// 测试损坏的文件、不同链的文件以及无效的导出范围都会被拒绝。
+func TestImportChainRejectsInvalidFile(t *testing.T) {
+	bc, g := exportTestChain(t, 3)
+
+	buf := &bytes.Buffer{}
+	assert.Nil(t, bc.ExportChain(buf, 1, 3, nil))
+	data := buf.Bytes()
+
+	// 修改第一个区块记录中的字节后，不会导入任何区块
+	corrupted := append([]byte{}, data...)
+	first := len(exportMagic) + 2 + len(types.Hash{}) + 8 // 第一个区块记录的长度前缀
+	corrupted[first+4+int(binary.BigEndian.Uint32(corrupted[first:]))-1] ^= 0xff
+	other, err := NewBlockchainFromGenesis(g)
+	assert.Nil(t, err)
+	_, err = other.ImportChain(bytes.NewReader(corrupted), nil)
+	assert.NotNil(t, err)
+	assert.Equal(t, uint32(0), other.Height())
+
+	// 修改末尾的校验和后导入失败，但已经验证的区块被保留
+	corrupted = append([]byte{}, data...)
+	corrupted[len(corrupted)-1] ^= 0xff
+	n, err := other.ImportChain(bytes.NewReader(corrupted), nil)
+	assert.NotNil(t, err)
+	assert.Equal(t, 3, n)
+
+	// 文件头中的区块范围远大于实际的区块数
+	huge := append([]byte{}, data...)
+	binary.BigEndian.PutUint32(huge[first-4:], math.MaxUint32)
+	_, err = other.ImportChain(bytes.NewReader(huge), nil)
+	assert.NotNil(t, err)
+
+	// 文件被截断
+	_, err = other.ImportChain(bytes.NewReader(data[:len(data)-10]), nil)
+	assert.NotNil(t, err)
+
+	// 不是导出文件
+	_, err = other.ImportChain(bytes.NewReader([]byte("hello world")), nil)
+	assert.NotNil(t, err)
+
+	// 创世区块不同的链
+	different, _ := exportTestChain(t, 0)
+	_, err = different.ImportChain(bytes.NewReader(data), nil)
+	assert.NotNil(t, err)
+
+	// 无效的导出范围
+	assert.NotNil(t, bc.ExportChain(&bytes.Buffer{}, 2, 1, nil))
+	assert.NotNil(t, bc.ExportChain(&bytes.Buffer{}, 0, 4, nil))
+
+	// 区块体已被裁剪时无法导出
+	assert.Nil(t, bc.SetStorageConfig(StorageConfig{Mode: StorageModePruned, Retain: 1}))
+	assert.NotNil(t, bc.ExportChain(&bytes.Buffer{}, 1, 3, nil))
+}
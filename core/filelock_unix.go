@@ -0,0 +1,24 @@
+//go:build !windows
+
+package core
+
+import (
+	"os"
+	"syscall"
+)
+
+// 对文件加排他锁，已经被其他打开的文件持有时立即返回错误。锁随文件关闭或进程退出释放。
+func lockFileExclusive(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+}
+
+// 同步目录，使目录中的重命名持久化。
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	return d.Sync()
+}
@@ -0,0 +1,19 @@
+//go:build windows
+
+package core
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// 对文件加排他锁，已经被其他打开的文件持有时立即返回错误。锁随文件关闭或进程退出释放。
+func lockFileExclusive(f *os.File) error {
+	return windows.LockFileEx(windows.Handle(f.Fd()), windows.LOCKFILE_EXCLUSIVE_LOCK|windows.LOCKFILE_FAIL_IMMEDIATELY, 0, 1, 0, &windows.Overlapped{})
+}
+
+// Windows不支持同步目录，重命名由文件系统的日志保证。
+func syncDir(dir string) error {
+	return nil
+}
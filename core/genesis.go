@@ -0,0 +1,163 @@
+package core
+
+import (
+	"github.com/Luboy23/Blockchain_Project/crypto"
+	"github.com/Luboy23/Blockchain_Project/types"
+)
+
+// 创世配置未指定时使用的区块燃料上限。
+const DefaultBlockGasLimit uint64 = 10_000_000
+
+// 定义了双重签名的惩罚参数。
+type SlashingConfig struct {
+	BurnRate uint64 // 每次双重签名销毁的质押比例，单位为万分之一
+	Jail     bool   // 是否监禁作恶的验证者
+}
+
+// 定义了质押和委托的参数。
+type StakingConfig struct {
+	EpochLength     uint32 // 每个纪元包含的区块数，在纪元边界重新计算活跃验证者集合
+	UnbondingPeriod uint32 // 解除质押或委托后需要等待的区块数
+	MaxValidators   int    // 活跃验证者集合的最大数量
+	MinSelfBond     uint64 // 成为活跃验证者所需的最小自我质押
+	CommissionRate  uint64 // 验证者从奖励中抽取的佣金比例，单位为万分之一
+}
+
+// 定义了区块奖励策略的类型。
+type RewardPolicyType byte
+
+const (
+	RewardNone    RewardPolicyType = iota // 没有区块奖励，出块者只获得交易费
+	RewardFixed                           // 每个区块固定奖励
+	RewardHalving                         // 每隔HalvingInterval个区块奖励减半
+)
+
+// 定义了区块奖励策略。
+type RewardPolicy struct {
+	Type            RewardPolicyType // 奖励策略类型
+	InitialReward   uint64           // 固定奖励，或减半策略下的初始奖励
+	HalvingInterval uint32           // 减半策略下每隔多少个区块奖励减半
+}
+
+// 返回指定高度的区块奖励。
+func (p RewardPolicy) RewardAt(height uint32) uint64 {
+	switch p.Type {
+	case RewardFixed:
+		return p.InitialReward
+	case RewardHalving:
+		if p.HalvingInterval == 0 {
+			return p.InitialReward
+		}
+		halvings := height / p.HalvingInterval
+		if halvings >= 64 {
+			return 0
+		}
+		return p.InitialReward >> halvings
+	default:
+		return 0
+	}
+}
+
+// 定义了链的共识和经济参数，由创世配置决定，所有节点必须一致。
+type ChainConfig struct {
+	Slashing SlashingConfig // 双重签名的惩罚参数
+	Staking  StakingConfig  // 质押和委托的参数
+	Reward   RewardPolicy   // 区块奖励策略
+
+	AddressPrefix string // 地址Bech32编码的人类可读前缀，用于区分不同的网络，为空时使用types.DefaultAddressPrefix
+}
+
+// 返回地址Bech32编码使用的人类可读前缀。
+func (c *ChainConfig) AddressHRP() string {
+	if c.AddressPrefix == "" {
+		return types.DefaultAddressPrefix
+	}
+	return c.AddressPrefix
+}
+
+// 检查链参数。地址前缀必须能够用于编码地址，否则节点在显示地址时才会发现错误。
+func (c *ChainConfig) Validate() error {
+	if _, err := (types.Address{}).Bech32(c.AddressHRP()); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// 返回默认的链参数：双重签名销毁5%的质押并监禁验证者，每100个区块为一个纪元。
+func DefaultChainConfig() *ChainConfig {
+	return &ChainConfig{
+		Slashing: SlashingConfig{
+			BurnRate: 500,
+			Jail:     true,
+		},
+		Staking: StakingConfig{
+			EpochLength:     100,
+			UnbondingPeriod: 100,
+			MaxValidators:   21,
+			MinSelfBond:     1,
+			CommissionRate:  1000,
+		},
+	}
+}
+
+// 定义了创世配置中的初始验证者。
+type GenesisValidator struct {
+	PublicKey crypto.PublicKey // 验证者公钥
+	Stake     uint64           // 初始质押数量
+}
+
+// 定义了创世配置，包括链参数、创世时间戳、区块燃料上限、初始余额和初始验证者。
+type Genesis struct {
+	Config     *ChainConfig             // 链参数，为nil时使用默认参数
+	Timestamp  int64                    // 创世区块的时间戳
+	GasLimit   uint64                   // 区块燃料上限，为0时使用DefaultBlockGasLimit
+	Alloc      map[types.Address]uint64 // 初始账户余额
+	Validators []GenesisValidator       // 初始验证者
+}
+
+// 根据创世配置生成创世区块。
+func (g *Genesis) ToBlock() *Block {
+	header := &Header{
+		Version:   1,
+		DataHash:  types.Hash{},
+		Height:    0,
+		Timestamp: g.Timestamp,
+		GasLimit:  g.GasLimit,
+	}
+	if header.GasLimit == 0 {
+		header.GasLimit = DefaultBlockGasLimit
+	}
+	header.StateRoot = g.ToState().Root()
+
+	return NewBlock(header, nil)
+}
+
+// 根据创世配置生成创世状态。
+func (g *Genesis) ToState() *State {
+	state := NewState()
+
+	for addr, balance := range g.Alloc {
+		state.account(addr).Balance = balance
+	}
+
+	for _, v := range g.Validators {
+		state.SetValidator(&ValidatorRecord{
+			PublicKey: v.PublicKey,
+			Stake:     v.Stake,
+		})
+	}
+
+	state.updateActiveSet(g.ChainConfig()) // 创世验证者组成第一个纪元的活跃集合
+
+	return state
+}
+
+// 返回创世配置中的链参数，未设置时返回默认参数。
+func (g *Genesis) ChainConfig() *ChainConfig {
+	if g.Config == nil {
+		return DefaultChainConfig()
+	}
+
+	return g.Config
+}
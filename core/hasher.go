@@ -1,7 +1,9 @@
 package core
 
 import (
+	"bytes"
 	"crypto/sha256"
+	"encoding/binary"
 
 	"github.com/Luboy23/Blockchain_Project/types"
 )
@@ -27,6 +29,44 @@ type TxHasher struct {
 }
 
 //	使用TxHasher计算交易的哈希值。
+//	哈希覆盖交易的签名内容以及发送者公钥，避免不同发送者发出相同数据的交易发生冲突。
+//	版本1的交易不携带公钥，使用从签名恢复的公钥。
 func (TxHasher) Hash(tx *Transaction) types.Hash {
-	return types.Hash(sha256.Sum256(tx.Data)) // 使用SHA-256算法计算交易数据的哈希值
+	buf := &bytes.Buffer{}
+	buf.Write(tx.signingBytes()) // 交易的签名内容
+	if sender := tx.Sender(); sender.Key != nil {
+		buf.Write(sender.ToSlice()) // 发送者的公钥
+	}
+
+	return types.Hash(sha256.Sum256(buf.Bytes())) // 使用SHA-256算法计算哈希值
+}
+
+//	实现Hasher接口，用于计算交易收据（Receipt）的哈希值。
+type ReceiptHasher struct {
+}
+
+//	使用ReceiptHasher计算收据的哈希值。
+//	哈希覆盖交易哈希和执行结果，不包括收据所在区块的位置，因此在区块签名之前就可以计算收据根。
+func (ReceiptHasher) Hash(r *Receipt) types.Hash {
+	buf := &bytes.Buffer{}
+	buf.Write(r.TxHash.ToSlice())                            // 交易哈希
+	buf.WriteByte(byte(r.Status))                            // 执行状态
+	binary.Write(buf, binary.BigEndian, r.GasUsed)           // 消耗的燃料
+	binary.Write(buf, binary.BigEndian, r.CumulativeGasUsed) // 累计消耗的燃料
+	buf.Write(r.ContractAddress.ToSlice())                   // 合约地址
+	writeBytes(buf, r.ReturnData)                            // 返回数据
+	binary.Write(buf, binary.BigEndian, uint32(len(r.Logs))) // 日志数量
+	for _, l := range r.Logs {
+		buf.Write(l.Address.ToSlice())
+		writeBytes(buf, l.Topic)
+		writeBytes(buf, l.Data)
+	}
+
+	return types.Hash(sha256.Sum256(buf.Bytes()))
+}
+
+//	写入带长度前缀的字节切片，避免相邻的变长字段产生歧义。
+func writeBytes(buf *bytes.Buffer, b []byte) {
+	binary.Write(buf, binary.BigEndian, uint32(len(b)))
+	buf.Write(b)
 }
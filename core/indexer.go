@@ -0,0 +1,245 @@
+package core
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/Luboy23/Blockchain_Project/types"
+	"github.com/sirupsen/logrus"
+)
+
+// 索引的持久化接口，索引与区块保存在同一个存储中，MemoryStore实现了该接口。
+// 存储中已有的索引记录在启动时被复用，缺少的记录（例如MemoryStore在重启后为空）由Indexer.Start从主链区块重建。
+type IndexStore interface {
+	PutTxLocation(types.Hash, *TxLocation) error
+	GetTxLocation(types.Hash) (*TxLocation, error)
+	DeleteTxLocation(types.Hash) error
+	PutAddressTxs(types.Address, []types.Hash) error
+	GetAddressTxs(types.Address) ([]types.Hash, error)
+	PutIndexedBlock(uint32, types.Hash) error
+	GetIndexedBlock(uint32) (types.Hash, bool)
+	DeleteIndexedBlock(uint32) error
+}
+
+// 交易在主链上的位置。
+type TxLocation struct {
+	BlockHash types.Hash // 包含该交易的主链区块的哈希
+	Index     uint32     // 交易在区块中的位置
+}
+
+// 交易和地址索引器，订阅主链链头的变化，维护交易哈希到交易位置、发送者地址到交易哈希的索引。
+// 索引只包含主链上的区块，主链重组时离开主链的区块的交易会从索引中移除。
+type Indexer struct {
+	bc    *Blockchain
+	store IndexStore
+
+	lock sync.Mutex // 保证区块按顺序被索引
+	next uint32     // 已索引的最高高度加一
+
+	sub    *Subscription[NewHeadEvent]
+	quitCh chan struct{}
+}
+
+// 为区块链创建索引器，区块链的存储必须实现IndexStore接口。
+func NewIndexer(bc *Blockchain) (*Indexer, error) {
+	store, ok := bc.store.(IndexStore)
+	if !ok {
+		return nil, fmt.Errorf("区块链的存储不支持索引")
+	}
+
+	bc.lock.RLock()
+	next := bc.base
+	bc.lock.RUnlock()
+	for { // 从已有的索引记录中恢复索引进度
+		if _, ok := store.GetIndexedBlock(next); !ok {
+			break
+		}
+		next++
+	}
+
+	return &Indexer{
+		bc:     bc,
+		store:  store,
+		next:   next,
+		quitCh: make(chan struct{}),
+	}, nil
+}
+
+// 订阅链头变化，补齐索引启动之前的主链区块，然后在后台处理之后的变化。
+// 节点重启并重新导入区块后，存储中没有索引记录的主链区块都在这里重新索引。
+func (ix *Indexer) Start() {
+	ix.sub = ix.bc.Events().NewHead.Subscribe(DefaultEventBuffer, Disconnect)
+	ix.sync()
+
+	go ix.loop()
+}
+
+// 停止索引器。
+func (ix *Indexer) Stop() {
+	close(ix.quitCh)
+}
+
+// 查询交易在主链上的位置。
+func (ix *Indexer) TxLocation(hash types.Hash) (*TxLocation, error) {
+	return ix.store.GetTxLocation(hash)
+}
+
+// 查询地址发送的所有主链交易的哈希，按上链顺序排列。
+func (ix *Indexer) AddressTxs(addr types.Address) ([]types.Hash, error) {
+	return ix.store.GetAddressTxs(addr)
+}
+
+// 处理链头事件。处理过慢被取消订阅时重新订阅，并直接与主链对比补齐错过的变化。
+func (ix *Indexer) loop() {
+	for {
+		select {
+		case ev, ok := <-ix.sub.Chan():
+			if !ok {
+				ix.sub = ix.bc.Events().NewHead.Subscribe(DefaultEventBuffer, Disconnect)
+				ix.sync()
+				continue
+			}
+			ix.processNewHead(ev)
+
+		case <-ix.quitCh:
+			ix.sub.Unsubscribe()
+			return
+		}
+	}
+}
+
+// 按顺序撤销离开主链的区块，再索引加入主链的区块。
+func (ix *Indexer) processNewHead(ev NewHeadEvent) {
+	ix.lock.Lock()
+	defer ix.lock.Unlock()
+
+	for _, b := range ev.Reverted {
+		if hash, ok := ix.store.GetIndexedBlock(b.Height); ok && hash == b.Hash(BlockHasher{}) {
+			ix.revertHeight(b.Height)
+		}
+	}
+	for _, b := range ev.Applied {
+		ix.apply(b)
+	}
+}
+
+// 与主链对比：撤销不在主链上的已索引区块，然后索引尚未索引的主链区块。
+func (ix *Indexer) sync() {
+	ix.lock.Lock()
+	defer ix.lock.Unlock()
+
+	tip := ix.bc.Height()
+	for ix.next > tip+1 {
+		ix.revertHeight(ix.next - 1)
+	}
+	for ix.next > 0 {
+		h, err := ix.bc.GetHeader(ix.next - 1)
+		if err != nil {
+			break // 早于快照高度
+		}
+		if hash, ok := ix.store.GetIndexedBlock(h.Height); ok && hash == (BlockHasher{}).Hash(h) {
+			break
+		}
+		ix.revertHeight(h.Height)
+	}
+
+	for height := ix.next; height <= tip; height++ {
+		h, err := ix.bc.GetHeader(height)
+		if err != nil {
+			continue // 早于快照高度
+		}
+		hash := (BlockHasher{}).Hash(h)
+		b, err := ix.bc.GetBlock(hash)
+		if err != nil { // 快照起点或已被裁剪的区块没有区块体，只记录索引进度
+			logrus.WithFields(logrus.Fields{
+				"区块高度": height,
+			}).Warn(err)
+			ix.put(height, hash)
+			continue
+		}
+		ix.apply(b)
+	}
+}
+
+// 索引区块中的交易，该高度已经索引了其他区块时先撤销，调用者需要持有锁。
+func (ix *Indexer) apply(b *Block) {
+	hash := b.Hash(BlockHasher{})
+	if indexed, ok := ix.store.GetIndexedBlock(b.Height); ok {
+		if indexed == hash {
+			return
+		}
+		ix.revertHeight(b.Height)
+	}
+
+	for i := range b.Transactions {
+		tx := &b.Transactions[i]
+		txHash := tx.Hash(TxHasher{})
+		ix.logError(ix.store.PutTxLocation(txHash, &TxLocation{BlockHash: hash, Index: uint32(i)}))
+
+		sender := tx.Sender().Address()
+		hashes, err := ix.store.GetAddressTxs(sender)
+		ix.logError(err)
+		ix.logError(ix.store.PutAddressTxs(sender, append(hashes, txHash)))
+	}
+
+	ix.put(b.Height, hash)
+}
+
+// 撤销指定高度已索引区块的交易，调用者需要持有锁。
+func (ix *Indexer) revertHeight(height uint32) {
+	if height+1 == ix.next {
+		ix.next = height
+	}
+
+	hash, ok := ix.store.GetIndexedBlock(height)
+	if !ok {
+		return
+	}
+
+	b, err := ix.bc.GetBlock(hash)
+	if err != nil { // 区块体已被裁剪，无法撤销其中的交易
+		logrus.WithFields(logrus.Fields{
+			"区块高度": height,
+		}).Warn(err)
+	} else {
+		for i := range b.Transactions {
+			tx := &b.Transactions[i]
+			txHash := tx.Hash(TxHasher{})
+			ix.logError(ix.store.DeleteTxLocation(txHash))
+
+			sender := tx.Sender().Address()
+			hashes, err := ix.store.GetAddressTxs(sender)
+			ix.logError(err)
+			ix.logError(ix.store.PutAddressTxs(sender, removeHash(hashes, txHash)))
+		}
+	}
+
+	ix.logError(ix.store.DeleteIndexedBlock(height))
+}
+
+// 记录某个高度已被索引，调用者需要持有锁。
+func (ix *Indexer) put(height uint32, hash types.Hash) {
+	ix.logError(ix.store.PutIndexedBlock(height, hash))
+	if height+1 > ix.next {
+		ix.next = height + 1
+	}
+}
+
+// 记录索引存储返回的错误。
+func (ix *Indexer) logError(err error) {
+	if err != nil {
+		logrus.Error(err)
+	}
+}
+
+// 从哈希列表中删除指定的哈希。
+func removeHash(hashes []types.Hash, hash types.Hash) []types.Hash {
+	out := hashes[:0]
+	for _, h := range hashes {
+		if h != hash {
+			out = append(out, h)
+		}
+	}
+
+	return out
+}
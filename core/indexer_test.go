@@ -0,0 +1,98 @@
+package core
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/Luboy23/Blockchain_Project/crypto"
+	"github.com/Luboy23/Blockchain_Project/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// 测试索引器补齐启动之前的区块、索引之后的区块，以及在主链重组时移除离开主链的交易。
+func TestIndexer(t *testing.T) {
+	validatorKey := crypto.GeneratePrivatekey()
+	userKey := crypto.GeneratePrivatekey()
+	user := userKey.PublicKey().Address()
+	bc, err := NewBlockchainFromGenesis(&Genesis{
+		Alloc: map[types.Address]uint64{user: 1000},
+		Validators: []GenesisValidator{
+			{PublicKey: validatorKey.PublicKey(), Stake: 100},
+		},
+	})
+	assert.Nil(t, err)
+	genesis := bc.CurrentHeader()
+
+	tx0 := signedTx(t, userKey, TxTypeTransfer, 0, types.Address{}, 1, nil)
+	b1 := signedBlock(t, bc, validatorKey, []Transaction{*tx0})
+	assert.Nil(t, bc.AddBlock(b1))
+
+	ix, err := NewIndexer(bc)
+	assert.Nil(t, err)
+	ix.Start() // 启动时补齐已有的区块
+	defer ix.Stop()
+
+	loc, err := ix.TxLocation(tx0.Hash(TxHasher{}))
+	assert.Nil(t, err)
+	assert.Equal(t, &TxLocation{BlockHash: b1.Hash(BlockHasher{}), Index: 0}, loc)
+
+	tx1 := signedTx(t, userKey, TxTypeTransfer, 1, types.Address{}, 1, nil)
+	b2 := signedBlock(t, bc, validatorKey, []Transaction{*tx1})
+	assert.Nil(t, bc.AddBlock(b2))
+
+	expected := []types.Hash{tx0.Hash(TxHasher{}), tx1.Hash(TxHasher{})}
+	assert.Eventually(t, func() bool {
+		hashes, err := ix.AddressTxs(user)
+		return err == nil && assert.ObjectsAreEqual(expected, hashes)
+	}, time.Second, 10*time.Millisecond)
+
+	// 不包含任何交易的更长分支成为主链
+	parent := genesis
+	for i := 0; i < 3; i++ {
+		b := NewBlockFromPrevHeader(parent, nil)
+		b.Timestamp = genesis.Timestamp + int64(i) + 1
+		fillRoots(bc, b, validatorKey.PublicKey())
+		assert.Nil(t, b.Sign(validatorKey))
+		assert.Nil(t, bc.AddBlock(b))
+		parent = b.Header
+	}
+	assert.Equal(t, BlockHasher{}.Hash(parent), BlockHasher{}.Hash(bc.CurrentHeader()))
+
+	assert.Eventually(t, func() bool {
+		hashes, err := ix.AddressTxs(user)
+		return err == nil && len(hashes) == 0
+	}, time.Second, 10*time.Millisecond)
+	_, err = ix.TxLocation(tx0.Hash(TxHasher{}))
+	assert.NotNil(t, err)
+	_, err = ix.TxLocation(tx1.Hash(TxHasher{}))
+	assert.NotNil(t, err)
+}
+
+// 测试节点重启后，新的存储中的索引从重新导入的主链区块重建。
+func TestIndexerRebuildAfterRestart(t *testing.T) {
+	bc, g := exportTestChain(t, 3)
+	b, err := bc.GetBlock(BlockHasher{}.Hash(bc.CurrentHeader()))
+	assert.Nil(t, err)
+	tx := &b.Transactions[0]
+
+	// 模拟重启：新的区块链使用空的存储，从导出的文件重新导入区块
+	buf := &bytes.Buffer{}
+	assert.Nil(t, bc.ExportChain(buf, 0, bc.Height(), nil))
+	restarted, err := NewBlockchainFromGenesis(g)
+	assert.Nil(t, err)
+	_, err = restarted.ImportChain(buf, nil)
+	assert.Nil(t, err)
+
+	ix, err := NewIndexer(restarted)
+	assert.Nil(t, err)
+	ix.Start()
+	defer ix.Stop()
+
+	loc, err := ix.TxLocation(tx.Hash(TxHasher{}))
+	assert.Nil(t, err)
+	assert.Equal(t, &TxLocation{BlockHash: b.Hash(BlockHasher{}), Index: 0}, loc)
+	hashes, err := ix.AddressTxs(tx.Sender().Address())
+	assert.Nil(t, err)
+	assert.Len(t, hashes, 3)
+}
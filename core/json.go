@@ -0,0 +1,218 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/Luboy23/Blockchain_Project/crypto"
+	"github.com/Luboy23/Blockchain_Project/types"
+)
+
+// 区块头的JSON表示，哈希和地址使用0x开头的十六进制字符串。
+// 编码时附带区块哈希，解码时如果带有哈希则检查它与内容是否一致。
+type headerJSON struct {
+	Hash          *types.Hash `json:"hash,omitempty"`
+	Version       uint32      `json:"version"`
+	DataHash      types.Hash  `json:"dataHash"`
+	PrevBlockHash types.Hash  `json:"prevBlockHash"`
+	Timestamp     int64       `json:"timestamp"`
+	Height        uint32      `json:"height"`
+	Difficulty    uint64      `json:"difficulty"`
+	Nonce         uint64      `json:"nonce"`
+	GasLimit      uint64      `json:"gasLimit"`
+	ReceiptsRoot  types.Hash  `json:"receiptsRoot"`
+	StateRoot     types.Hash  `json:"stateRoot"`
+}
+
+// 区块的JSON表示，区块头的字段与区块的其他字段处于同一层。
+type blockJSON struct {
+	headerJSON
+	Validator    crypto.PublicKey  `json:"validator"`
+	Signature    *crypto.Signature `json:"signature"`
+	Transactions []*Transaction    `json:"transactions"`
+}
+
+// 交易的JSON表示。From为发送者的公钥，Sender为由公钥计算出的地址，只在编码时输出。
+type txJSON struct {
+	Hash      *types.Hash       `json:"hash,omitempty"`
+	Version   TxVersion         `json:"version,omitempty"`
+	Type      TxType            `json:"type"`
+	Nonce     uint64            `json:"nonce"`
+	To        types.Address     `json:"to"`
+	Value     uint64            `json:"value"`
+	Fee       uint64            `json:"fee"`
+	Data      types.HexBytes    `json:"data"`
+	GasLimit  uint64            `json:"gasLimit"`
+	GasPrice  uint64            `json:"gasPrice"`
+	From      *crypto.PublicKey `json:"from,omitempty"`
+	Sender    *types.Address    `json:"sender,omitempty"`
+	Signature *crypto.Signature `json:"signature"`
+}
+
+// 将区块头转换为JSON表示。
+func (h *Header) toJSON() headerJSON {
+	hash := (BlockHasher{}).Hash(h)
+	return headerJSON{
+		Hash:          &hash,
+		Version:       h.Version,
+		DataHash:      h.DataHash,
+		PrevBlockHash: h.PrevBlockHash,
+		Timestamp:     h.Timestamp,
+		Height:        h.Height,
+		Difficulty:    h.Difficulty,
+		Nonce:         h.Nonce,
+		GasLimit:      h.GasLimit,
+		ReceiptsRoot:  h.ReceiptsRoot,
+		StateRoot:     h.StateRoot,
+	}
+}
+
+// 从JSON表示还原区块头，并检查哈希。
+func (j *headerJSON) toHeader() (*Header, error) {
+	h := &Header{
+		Version:       j.Version,
+		DataHash:      j.DataHash,
+		PrevBlockHash: j.PrevBlockHash,
+		Timestamp:     j.Timestamp,
+		Height:        j.Height,
+		Difficulty:    j.Difficulty,
+		Nonce:         j.Nonce,
+		GasLimit:      j.GasLimit,
+		ReceiptsRoot:  j.ReceiptsRoot,
+		StateRoot:     j.StateRoot,
+	}
+	if j.Hash != nil {
+		if hash := (BlockHasher{}).Hash(h); hash != *j.Hash {
+			return nil, fmt.Errorf("区块头的哈希(%s)与内容不符，应为(%s)", *j.Hash, hash)
+		}
+	}
+
+	return h, nil
+}
+
+// 实现json.Marshaler接口。
+func (h *Header) MarshalJSON() ([]byte, error) {
+	return json.Marshal(h.toJSON())
+}
+
+// 实现json.Unmarshaler接口。
+func (h *Header) UnmarshalJSON(data []byte) error {
+	j := &headerJSON{}
+	if err := json.Unmarshal(data, j); err != nil {
+		return err
+	}
+
+	header, err := j.toHeader()
+	if err != nil {
+		return err
+	}
+
+	*h = *header
+	return nil
+}
+
+// 实现json.Marshaler接口。
+func (b *Block) MarshalJSON() ([]byte, error) {
+	txx := make([]*Transaction, len(b.Transactions))
+	for i := range b.Transactions {
+		txx[i] = &b.Transactions[i]
+	}
+
+	return json.Marshal(&blockJSON{
+		headerJSON:   b.Header.toJSON(),
+		Validator:    b.Validator,
+		Signature:    b.Signature,
+		Transactions: txx,
+	})
+}
+
+// 实现json.Unmarshaler接口。
+func (b *Block) UnmarshalJSON(data []byte) error {
+	j := &blockJSON{}
+	if err := json.Unmarshal(data, j); err != nil {
+		return err
+	}
+
+	header, err := j.headerJSON.toHeader()
+	if err != nil {
+		return err
+	}
+
+	txx := make([]Transaction, len(j.Transactions))
+	for i, tx := range j.Transactions {
+		if tx == nil {
+			return fmt.Errorf("区块中的第%d笔交易为空", i)
+		}
+		txx[i] = *tx
+	}
+
+	*b = Block{
+		Header:       header,
+		Transactions: txx,
+		Validator:    j.Validator,
+		Signature:    j.Signature,
+	}
+	return nil
+}
+
+// 实现json.Marshaler接口。
+func (tx *Transaction) MarshalJSON() ([]byte, error) {
+	hash := tx.Hash(TxHasher{})
+	j := &txJSON{
+		Hash:      &hash,
+		Version:   tx.Version,
+		Type:      tx.Type,
+		Nonce:     tx.Nonce,
+		To:        tx.To,
+		Value:     tx.Value,
+		Fee:       tx.Fee,
+		Data:      tx.Data,
+		GasLimit:  tx.GasLimit,
+		GasPrice:  tx.GasPrice,
+		Signature: tx.Signature,
+	}
+	if tx.From.Key != nil {
+		j.From = &tx.From
+	}
+	if sender := tx.Sender(); sender.Key != nil {
+		addr := sender.Address()
+		j.Sender = &addr
+	}
+
+	return json.Marshal(j)
+}
+
+// 实现json.Unmarshaler接口。
+func (tx *Transaction) UnmarshalJSON(data []byte) error {
+	j := &txJSON{}
+	if err := json.Unmarshal(data, j); err != nil {
+		return err
+	}
+
+	decoded := Transaction{
+		Version:   j.Version,
+		Type:      j.Type,
+		Nonce:     j.Nonce,
+		To:        j.To,
+		Value:     j.Value,
+		Fee:       j.Fee,
+		Data:      j.Data,
+		GasLimit:  j.GasLimit,
+		GasPrice:  j.GasPrice,
+		Signature: j.Signature,
+	}
+	if j.From != nil {
+		decoded.From = *j.From
+	}
+	if j.Hash != nil {
+		if hash := decoded.Hash(TxHasher{}); hash != *j.Hash {
+			return fmt.Errorf("交易的哈希(%s)与内容不符，应为(%s)", *j.Hash, hash)
+		}
+	}
+	if sender := decoded.Sender(); j.Sender != nil && (sender.Key == nil || sender.Address() != *j.Sender) {
+		return fmt.Errorf("交易的发送者地址(%s)与公钥不符", *j.Sender)
+	}
+
+	*tx = decoded
+	return nil
+}
@@ -0,0 +1,48 @@
+package core
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/Luboy23/Blockchain_Project/crypto"
+	"github.com/Luboy23/Blockchain_Project/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// 测试区块和交易的JSON编码可以还原出哈希相同的对象，并拒绝与内容不符的哈希。
+func TestBlockJSON(t *testing.T) {
+	priKey := crypto.GeneratePrivatekey()
+	tx := &Transaction{Type: TxTypeTransfer, Nonce: 1, To: types.Address{1}, Value: 10, Data: []byte("hi")}
+	assert.Nil(t, tx.Sign(priKey))
+
+	b := randomBlock(1, types.RandomHash())
+	b.Transactions = append(b.Transactions, *tx)
+	b.DataHash = CalculateDataHash(b.Transactions)
+	assert.Nil(t, b.Sign(priKey))
+
+	data, err := json.Marshal(b)
+	assert.Nil(t, err)
+	assert.Contains(t, string(data), `"hash":"0x`+b.Hash(BlockHasher{}).String()+`"`)
+	assert.Contains(t, string(data), `"sender":"0x`+priKey.PublicKey().Address().String()+`"`)
+	assert.Contains(t, string(data), `"data":"0x6869"`)
+
+	decoded := &Block{}
+	assert.Nil(t, json.Unmarshal(data, decoded))
+	assert.Equal(t, b.Hash(BlockHasher{}), decoded.Hash(BlockHasher{}))
+	assert.Nil(t, decoded.Verify())
+	assert.Equal(t, tx.Hash(TxHasher{}), decoded.Transactions[0].Hash(TxHasher{}))
+
+	header := &Header{}
+	assert.Nil(t, json.Unmarshal(data, header))
+	assert.Equal(t, b.Hash(BlockHasher{}), BlockHasher{}.Hash(header))
+
+	// 修改内容后哈希不再匹配
+	tampered := strings.Replace(string(data), `"height":1`, `"height":2`, 1)
+	assert.NotNil(t, json.Unmarshal([]byte(tampered), &Block{}))
+
+	txData, err := json.Marshal(tx)
+	assert.Nil(t, err)
+	tampered = strings.Replace(string(txData), `"value":10`, `"value":11`, 1)
+	assert.NotNil(t, json.Unmarshal([]byte(tampered), &Transaction{}))
+}
@@ -0,0 +1,178 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// 工作量证明目标值的上界，即2^256。
+var maxTarget = new(big.Int).Lsh(big.NewInt(1), 256)
+
+// 挖矿被外部中止（例如收到了竞争区块）时返回的错误。
+var ErrMiningAborted = errors.New("挖矿已被中止")
+
+// 定义了可选的工作量证明（PoW）模式的参数。
+type PowConfig struct {
+	InitialDifficulty uint64        // 创世区块之后使用的初始难度
+	RetargetInterval  uint32        // 每隔多少个区块调整一次难度
+	TargetBlockTime   time.Duration // 期望的出块时间间隔
+}
+
+// 返回一个适合教学和本地压测的默认PoW配置。
+func DefaultPowConfig() *PowConfig {
+	return &PowConfig{
+		InitialDifficulty: 1 << 12,
+		RetargetInterval:  10,
+		TargetBlockTime:   5 * time.Second,
+	}
+}
+
+// 计算区块头难度对应的目标值，target = 2^256 / difficulty，区块哈希必须小于该值。
+func (h *Header) Target() *big.Int {
+	if h.Difficulty == 0 {
+		return new(big.Int).Set(maxTarget) // 难度为0时任何哈希都满足要求
+	}
+
+	return new(big.Int).Div(maxTarget, new(big.Int).SetUint64(h.Difficulty))
+}
+
+// 返回区块头所代表的工作量。未启用PoW（难度为0）的区块记为1，此时分叉选择退化为最长链规则。
+func (h *Header) Work() *big.Int {
+	if h.Difficulty == 0 {
+		return big.NewInt(1)
+	}
+
+	return new(big.Int).SetUint64(h.Difficulty)
+}
+
+// 检查区块头的哈希是否满足其难度对应的目标值。
+func CheckProofOfWork(h *Header) error {
+	hash := BlockHasher{}.Hash(h) // 计算区块头的哈希值
+
+	if new(big.Int).SetBytes(hash.ToSlice()).Cmp(h.Target()) >= 0 {
+		return fmt.Errorf("区块(%s)的工作量不满足难度(%d)要求", hash, h.Difficulty)
+	}
+
+	return nil
+}
+
+// 根据父区块及其祖先计算下一个区块的难度。
+// 每隔RetargetInterval个区块，按照实际耗时与期望耗时的比例调整难度，单次调整幅度限制在4倍以内。
+func (c *PowConfig) NextDifficulty(parent *Header, ancestor func(*Header, uint32) (*Header, error)) (uint64, error) {
+	if parent.Difficulty == 0 {
+		return c.InitialDifficulty, nil // 父区块未启用PoW（通常是创世区块），使用初始难度
+	}
+
+	if c.RetargetInterval == 0 || (parent.Height+1)%c.RetargetInterval != 0 {
+		return parent.Difficulty, nil // 不在调整边界上，沿用父区块的难度
+	}
+
+	var from uint32 // 调整窗口起始区块的高度
+	if parent.Height >= c.RetargetInterval {
+		from = parent.Height - c.RetargetInterval
+	}
+
+	first, err := ancestor(parent, from) // 获取同一分支上窗口起始的区块头
+	if err != nil {
+		return 0, err
+	}
+
+	expected := int64(parent.Height-first.Height) * int64(c.TargetBlockTime) // 期望耗时
+	actual := parent.Timestamp - first.Timestamp                             // 实际耗时
+
+	// 限制单次调整的幅度，避免时间戳异常导致难度剧烈波动
+	if actual < expected/4 {
+		actual = expected / 4
+	}
+	if actual > expected*4 {
+		actual = expected * 4
+	}
+	if actual <= 0 {
+		return parent.Difficulty, nil
+	}
+
+	next := new(big.Int).SetUint64(parent.Difficulty)
+	next.Mul(next, big.NewInt(expected))
+	next.Div(next, big.NewInt(actual))
+
+	if next.Sign() == 0 {
+		return 1, nil // 难度至少为1
+	}
+	if !next.IsUint64() {
+		return ^uint64(0), nil
+	}
+
+	return next.Uint64(), nil
+}
+
+// 定义了一个多协程的PoW矿工，每个工作协程按步长搜索互不重叠的Nonce区间。
+type Miner struct {
+	workers int // 工作协程的数量
+}
+
+// 创建一个新的矿工，workers小于等于0时使用CPU核数。
+func NewMiner(workers int) *Miner {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	return &Miner{
+		workers: workers,
+	}
+}
+
+// 对区块头进行挖矿，找到满足难度目标的Nonce后写回区块头。
+// 当quitCh被关闭时（例如收到了同高度的竞争区块），所有工作协程退出并返回ErrMiningAborted。
+func (m *Miner) Mine(h *Header, quitCh <-chan struct{}) error {
+	target := h.Target()
+
+	foundCh := make(chan uint64, 1) // 用于接收找到的Nonce
+	doneCh := make(chan struct{})   // 用于通知其他工作协程停止
+	wg := sync.WaitGroup{}
+
+	for i := 0; i < m.workers; i++ {
+		wg.Add(1)
+
+		header := *h // 每个工作协程使用区块头的副本，在启动前复制，避免与写回Nonce竞争
+		go func(header Header, start uint64) {
+			defer wg.Done()
+
+			for nonce := start; ; nonce += uint64(m.workers) {
+				select {
+				case <-doneCh:
+					return
+				case <-quitCh:
+					return
+				default:
+				}
+
+				header.Nonce = nonce
+				hash := BlockHasher{}.Hash(&header)
+				if new(big.Int).SetBytes(hash.ToSlice()).Cmp(target) < 0 {
+					select {
+					case foundCh <- nonce:
+					default:
+					}
+					return
+				}
+			}
+		}(header, uint64(i))
+	}
+
+	var err error
+	select {
+	case nonce := <-foundCh:
+		h.Nonce = nonce // 将找到的Nonce写回区块头
+	case <-quitCh:
+		err = ErrMiningAborted
+	}
+
+	close(doneCh)
+	wg.Wait()
+
+	return err
+}
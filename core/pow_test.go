@@ -0,0 +1,162 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Luboy23/Blockchain_Project/crypto"
+	"github.com/Luboy23/Blockchain_Project/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// 测试挖矿得到的区块头满足工作量要求，修改Nonce后不再满足。
+func TestMineProofOfWork(t *testing.T) {
+	b := randomBlock(1, types.Hash{})
+	b.Difficulty = 1 << 10
+
+	assert.Nil(t, NewMiner(4).Mine(b.Header, make(chan struct{})))
+	assert.Nil(t, CheckProofOfWork(b.Header))
+
+	// 找到一个不满足目标值的Nonce
+	for nonce := uint64(0); ; nonce++ {
+		b.Nonce = nonce
+		if CheckProofOfWork(b.Header) != nil {
+			break
+		}
+	}
+	assert.NotNil(t, CheckProofOfWork(b.Header))
+}
+
+// 测试关闭quitCh后挖矿会被中止。
+func TestMineAbort(t *testing.T) {
+	b := randomBlock(1, types.Hash{})
+	b.Difficulty = 1 << 62 // 几乎不可能挖到的难度
+
+	quitCh := make(chan struct{})
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		close(quitCh)
+	}()
+
+	assert.Equal(t, ErrMiningAborted, NewMiner(2).Mine(b.Header, quitCh))
+}
+
+// 测试难度调整：出块过快时难度上升，过慢时下降，且单次调整不超过4倍。
+func TestNextDifficulty(t *testing.T) {
+	cfg := &PowConfig{
+		InitialDifficulty: 1000,
+		RetargetInterval:  10,
+		TargetBlockTime:   time.Second,
+	}
+
+	chainOf := func(interval time.Duration) []*Header {
+		headers := []*Header{}
+		for i := uint32(0); i < 10; i++ {
+			headers = append(headers, &Header{
+				Height:     i,
+				Difficulty: 1000,
+				Timestamp:  int64(i) * int64(interval),
+			})
+		}
+		return headers
+	}
+	ancestorOf := func(headers []*Header) func(*Header, uint32) (*Header, error) {
+		return func(_ *Header, height uint32) (*Header, error) {
+			return headers[height], nil
+		}
+	}
+
+	// 不在调整边界上时沿用父区块难度
+	fast := chainOf(time.Second / 2)
+	d, err := cfg.NextDifficulty(fast[5], ancestorOf(fast))
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(1000), d)
+
+	d, err = cfg.NextDifficulty(fast[9], ancestorOf(fast))
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(2000), d)
+
+	slow := chainOf(2 * time.Second)
+	d, err = cfg.NextDifficulty(slow[9], ancestorOf(slow))
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(500), d)
+
+	veryFast := chainOf(time.Millisecond)
+	d, err = cfg.NextDifficulty(veryFast[9], ancestorOf(veryFast))
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(4000), d)
+
+	// 父区块未启用PoW时使用初始难度
+	d, err = cfg.NextDifficulty(&Header{}, ancestorOf(fast))
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(1000), d)
+}
+
+// 测试启用PoW后，区块链会检查难度和工作量。
+func TestPowBlockchain(t *testing.T) {
+	bc := newBlockchainWithGenesis(t)
+	bc.SetPowConfig(&PowConfig{
+		InitialDifficulty: 1 << 8,
+		RetargetInterval:  100,
+		TargetBlockTime:   time.Second,
+	})
+
+	for i := uint32(1); i <= 3; i++ {
+		assert.Nil(t, bc.AddBlock(minedBlock(t, bc, bc.CurrentHeader())))
+	}
+	assert.Equal(t, uint32(3), bc.Height())
+
+	// 难度不正确
+	b := randomBlock(4, BlockHasher{}.Hash(bc.CurrentHeader()))
+	b.Difficulty = 1
+	assert.Nil(t, b.Sign(crypto.GeneratePrivatekey()))
+	assert.NotNil(t, bc.AddBlock(b))
+
+	// 难度正确但没有完成工作量
+	b = randomBlock(4, BlockHasher{}.Hash(bc.CurrentHeader()))
+	b.Difficulty = 1 << 8
+	for CheckProofOfWork(b.Header) == nil {
+		b.Nonce++
+	}
+	assert.Nil(t, b.Sign(crypto.GeneratePrivatekey()))
+	assert.NotNil(t, bc.AddBlock(b))
+}
+
+// 测试启用PoW后，不在活跃验证者集合中的矿工也可以出块。
+func TestPowIgnoresValidatorSet(t *testing.T) {
+	bc, err := NewBlockchainFromGenesis(&Genesis{
+		Config: DefaultChainConfig(),
+		Validators: []GenesisValidator{
+			{PublicKey: crypto.GeneratePrivatekey().PublicKey(), Stake: 1000},
+		},
+	})
+	assert.Nil(t, err)
+
+	// 未启用PoW时，活跃验证者集合之外的区块被拒绝
+	b := minedBlock(t, bc, bc.CurrentHeader())
+	assert.ErrorContains(t, bc.AddBlock(b), "不是当前纪元的活跃验证者")
+
+	bc.SetPowConfig(&PowConfig{
+		InitialDifficulty: 1 << 8,
+		RetargetInterval:  100,
+		TargetBlockTime:   time.Second,
+	})
+	assert.Nil(t, bc.AddBlock(minedBlock(t, bc, bc.CurrentHeader())))
+	assert.Equal(t, uint32(1), bc.Height())
+}
+
+// 在指定父区块之后挖出并签名一个区块。
+func minedBlock(t *testing.T, bc *Blockchain, parent *Header) *Block {
+	b := NewBlockFromPrevHeader(parent, nil)
+
+	difficulty, err := bc.NextDifficulty(parent)
+	assert.Nil(t, err)
+	b.Difficulty = difficulty
+
+	priKey := crypto.GeneratePrivatekey()
+	fillRoots(bc, b, priKey.PublicKey()) // 状态根参与工作量计算，必须在挖矿之前填充
+	assert.Nil(t, NewMiner(2).Mine(b.Header, make(chan struct{})))
+	assert.Nil(t, b.Sign(priKey))
+
+	return b
+}
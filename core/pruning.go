@@ -0,0 +1,200 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Luboy23/Blockchain_Project/types"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	ErrStatePruned = errors.New("状态已被裁剪")  // 查询的区块状态超出了保留范围
+	ErrBlockPruned = errors.New("区块体已被裁剪") // 查询的区块体（交易和收据）超出了保留范围，区块头仍然可以查询
+)
+
+// 定义了节点的存储模式。
+type StorageMode byte
+
+const (
+	StorageModeArchive StorageMode = iota // 归档模式：保留所有区块以及每个区块执行后的状态
+	StorageModeFull                       // 全节点模式：保留所有区块，只保留最近Retain个区块的状态
+	StorageModePruned                     // 裁剪模式：只保留最近Retain个区块的状态和区块体，更早的区块只保留区块头
+)
+
+// 返回存储模式的名称。
+func (m StorageMode) String() string {
+	switch m {
+	case StorageModeArchive:
+		return "archive"
+	case StorageModeFull:
+		return "full"
+	case StorageModePruned:
+		return "pruned"
+	default:
+		return fmt.Sprintf("StorageMode(%d)", byte(m))
+	}
+}
+
+// 根据名称解析存储模式。
+func ParseStorageMode(s string) (StorageMode, error) {
+	for _, m := range []StorageMode{StorageModeArchive, StorageModeFull, StorageModePruned} {
+		if m.String() == s {
+			return m, nil
+		}
+	}
+
+	return 0, fmt.Errorf("未知的存储模式(%s)，可选值为archive、full和pruned", s)
+}
+
+// 定义了节点的存储配置。
+type StorageConfig struct {
+	Mode   StorageMode // 存储模式
+	Retain uint32      // 全节点和裁剪模式下保留最近多少个区块的数据，必须大于0，归档模式下忽略
+}
+
+// 检查存储配置是否有效。
+func (cfg StorageConfig) Validate() error {
+	switch cfg.Mode {
+	case StorageModeArchive:
+		return nil
+	case StorageModeFull, StorageModePruned:
+		if cfg.Retain == 0 {
+			return fmt.Errorf("%s模式必须至少保留一个区块的数据", cfg.Mode)
+		}
+		return nil
+	default:
+		return fmt.Errorf("未知的存储模式(%d)", cfg.Mode)
+	}
+}
+
+// 设置区块链的存储配置，立即裁剪超出保留范围的数据。
+func (bc *Blockchain) SetStorageConfig(cfg StorageConfig) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	bc.lock.Lock()
+	defer bc.lock.Unlock()
+
+	bc.storageCfg = cfg
+	bc.prune()
+
+	return nil
+}
+
+// 返回区块链的存储配置。
+func (bc *Blockchain) StorageConfig() StorageConfig {
+	bc.lock.RLock()
+	defer bc.lock.RUnlock()
+
+	return bc.storageCfg
+}
+
+// 按存储配置裁剪低于保留范围的区块的状态、收据、累计工作量和快照（裁剪模式下还有区块体），分叉链上的区块同样被裁剪。
+// 主链的区块头在所有模式下都保留，分叉链上的区块头和交易索引随之删除，因此按哈希索引的数据都只与保留范围有关。
+// 超出保留范围的快照只保留最近的一个，供其他节点同步。调用者需要持有写锁。
+func (bc *Blockchain) prune() {
+	if bc.storageCfg.Mode == StorageModeArchive {
+		return
+	}
+
+	tip := bc.base + uint32(len(bc.headers)-1)
+	if tip < bc.storageCfg.Retain {
+		return
+	}
+	cutoff := tip - bc.storageCfg.Retain // 高度不超过cutoff的区块超出保留范围
+
+	for ; bc.pruneFrom <= cutoff; bc.pruneFrom++ {
+		for _, hash := range bc.heightIndex[bc.pruneFrom] {
+			if !bc.isCanonical(bc.headerIndex[hash]) {
+				if receipt, ok := bc.receipts[hash]; ok {
+					for _, r := range receipt.Receipts {
+						bc.dropTxLookup(r.TxHash, hash)
+					}
+				}
+				delete(bc.headerIndex, hash)
+				delete(bc.snapshots, hash) // 分叉链上的快照不会被用于同步
+				delete(bc.snapshotStates, hash)
+			}
+			delete(bc.states, hash)
+			delete(bc.receipts, hash)
+			delete(bc.totalWork, hash)
+			if bc.storageCfg.Mode == StorageModePruned {
+				if err := bc.store.Delete(hash); err != nil {
+					logrus.WithFields(logrus.Fields{
+						"区块哈希": hash,
+					}).Error(err)
+				}
+			}
+		}
+		delete(bc.heightIndex, bc.pruneFrom)
+	}
+	bc.pruneSnapshots()
+}
+
+// 从交易索引中删除指向指定区块的记录，调用者需要持有写锁。
+func (bc *Blockchain) dropTxLookup(txHash, blockHash types.Hash) {
+	hashes := bc.txLookup[txHash]
+	for i, hash := range hashes {
+		if hash == blockHash {
+			hashes = append(hashes[:i:i], hashes[i+1:]...)
+			break
+		}
+	}
+
+	if len(hashes) == 0 {
+		delete(bc.txLookup, txHash)
+		return
+	}
+	bc.txLookup[txHash] = hashes
+}
+
+// 删除超出保留范围的主链快照（包括尚未生成的），但保留最近的一个，调用者需要持有写锁。
+func (bc *Blockchain) pruneSnapshots() {
+	heights := map[types.Hash]uint32{}
+	for hash, snapshot := range bc.snapshots {
+		heights[hash] = snapshot.Header.Height
+	}
+	for hash := range bc.snapshotStates {
+		heights[hash] = bc.headerIndex[hash].Height
+	}
+
+	latest := uint32(0)
+	for _, height := range heights {
+		if height > latest {
+			latest = height
+		}
+	}
+	for hash, height := range heights {
+		if height < bc.pruneFrom && height < latest {
+			delete(bc.snapshots, hash)
+			delete(bc.snapshotStates, hash)
+		}
+	}
+}
+
+// 获取指定区块执行后的状态，区分状态已被裁剪和区块未知两种情况，调用者需要持有锁。
+func (bc *Blockchain) stateAt(hash types.Hash) (*State, error) {
+	if state, ok := bc.states[hash]; ok {
+		return state, nil
+	}
+
+	if _, ok := bc.headerIndex[hash]; ok {
+		return nil, fmt.Errorf("区块(%s)的%w", hash, ErrStatePruned)
+	}
+
+	return nil, fmt.Errorf("没有区块(%s)的状态", hash)
+}
+
+// 检查区块体是否因裁剪而不可用，区块体不存在且不是因为裁剪时返回原错误。
+func (bc *Blockchain) bodyError(hash types.Hash, err error) error {
+	bc.lock.RLock()
+	defer bc.lock.RUnlock()
+
+	if _, ok := bc.headerIndex[hash]; ok {
+		return fmt.Errorf("区块(%s)的%w", hash, ErrBlockPruned)
+	}
+
+	return err
+}
@@ -0,0 +1,171 @@
+package core
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Luboy23/Blockchain_Project/crypto"
+	"github.com/Luboy23/Blockchain_Project/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// 测试三种存储模式分别保留哪些数据，以及查询已裁剪数据时返回的错误。
+func TestStorageModes(t *testing.T) {
+	for _, mode := range []StorageMode{StorageModeArchive, StorageModeFull, StorageModePruned} {
+		t.Run(mode.String(), func(t *testing.T) {
+			validatorKey := crypto.GeneratePrivatekey()
+			userKey := crypto.GeneratePrivatekey()
+			bc, err := NewBlockchainFromGenesis(&Genesis{
+				Alloc: map[types.Address]uint64{userKey.PublicKey().Address(): 1000},
+				Validators: []GenesisValidator{
+					{PublicKey: validatorKey.PublicKey(), Stake: 100},
+				},
+			})
+			assert.Nil(t, err)
+			assert.Nil(t, bc.SetStorageConfig(StorageConfig{Mode: mode, Retain: 2}))
+
+			txx := []*Transaction{}
+			for i := 0; i < 5; i++ {
+				tx := signedTx(t, userKey, TxTypeTransfer, uint64(i), types.Address{}, 1, nil)
+				assert.Nil(t, bc.AddBlock(signedBlock(t, bc, validatorKey, []Transaction{*tx})))
+				txx = append(txx, tx)
+			}
+
+			old, err := bc.GetHeader(1)
+			assert.Nil(t, err) // 所有模式都保留区块头
+			oldHash := BlockHasher{}.Hash(old)
+
+			// 最近两个区块的数据总是可用
+			for _, height := range []uint32{4, 5} {
+				h, err := bc.GetHeader(height)
+				assert.Nil(t, err)
+				_, err = bc.StateAt(BlockHasher{}.Hash(h))
+				assert.Nil(t, err)
+				_, err = bc.GetBlock(BlockHasher{}.Hash(h))
+				assert.Nil(t, err)
+			}
+
+			_, err = bc.StateAt(oldHash)
+			if mode == StorageModeArchive {
+				assert.Nil(t, err)
+			} else {
+				assert.True(t, errors.Is(err, ErrStatePruned))
+			}
+
+			_, blockErr := bc.GetBlock(oldHash)
+			_, receiptsErr := bc.GetReceipts(oldHash)
+			_, receiptErr := bc.GetReceipt(txx[0].Hash(TxHasher{}))
+			if mode == StorageModePruned {
+				assert.True(t, errors.Is(blockErr, ErrBlockPruned))
+				assert.True(t, errors.Is(receiptsErr, ErrBlockPruned))
+				assert.True(t, errors.Is(receiptErr, ErrBlockPruned))
+			} else {
+				assert.Nil(t, blockErr)
+				assert.Nil(t, receiptsErr)
+				assert.Nil(t, receiptErr)
+			}
+
+			// 未知的区块不会被当作已裁剪
+			_, err = bc.StateAt(types.RandomHash())
+			assert.NotNil(t, err)
+			assert.False(t, errors.Is(err, ErrStatePruned))
+			_, err = bc.GetBlock(types.RandomHash())
+			assert.NotNil(t, err)
+			assert.False(t, errors.Is(err, ErrBlockPruned))
+
+			// 父区块状态已被裁剪时，无法在其上添加分叉区块
+			fork := NewBlockFromPrevHeader(old, nil)
+			assert.Nil(t, fork.Sign(validatorKey))
+			err = bc.AddBlock(fork)
+			if mode == StorageModeArchive {
+				assert.NotNil(t, err) // 状态根不正确
+			} else {
+				assert.True(t, errors.Is(err, ErrStatePruned))
+			}
+		})
+	}
+}
+
+// 测试存储配置的解析和检查。
+func TestStorageConfig(t *testing.T) {
+	for _, mode := range []StorageMode{StorageModeArchive, StorageModeFull, StorageModePruned} {
+		parsed, err := ParseStorageMode(mode.String())
+		assert.Nil(t, err)
+		assert.Equal(t, mode, parsed)
+	}
+	_, err := ParseStorageMode("light")
+	assert.NotNil(t, err)
+
+	assert.Nil(t, StorageConfig{Mode: StorageModeArchive}.Validate())
+	assert.NotNil(t, StorageConfig{Mode: StorageModeFull}.Validate())
+	assert.NotNil(t, StorageConfig{Mode: StorageModePruned}.Validate())
+	assert.Nil(t, StorageConfig{Mode: StorageModePruned, Retain: 1}.Validate())
+	assert.NotNil(t, StorageConfig{Mode: StorageMode(9), Retain: 1}.Validate())
+
+	bc := newBlockchainWithGenesis(t)
+	assert.NotNil(t, bc.SetStorageConfig(StorageConfig{Mode: StorageModeFull}))
+	assert.Equal(t, StorageModeArchive, bc.StorageConfig().Mode)
+}
+
+// 测试持续出块时按哈希索引的数据只保留最近的区块，分叉区块和旧快照同样被裁剪。
+func TestPruneBounded(t *testing.T) {
+	validatorKey := crypto.GeneratePrivatekey()
+	userKey := crypto.GeneratePrivatekey()
+	bc, err := NewBlockchainFromGenesis(&Genesis{
+		Alloc: map[types.Address]uint64{userKey.PublicKey().Address(): 1000},
+		Validators: []GenesisValidator{
+			{PublicKey: validatorKey.PublicKey(), Stake: 100},
+		},
+	})
+	assert.Nil(t, err)
+	assert.Nil(t, bc.SetStorageConfig(StorageConfig{Mode: StorageModeFull, Retain: 2}))
+	bc.SetSnapshotInterval(3)
+
+	txx := []*Transaction{}
+	for i := 0; i < 20; i++ {
+		tx := signedTx(t, userKey, TxTypeTransfer, uint64(i), types.Address{}, 1, nil)
+		txx = append(txx, tx)
+
+		// 包含同一笔交易的分叉区块，累计工作量相同，不会切换主链
+		fork := NewBlockFromPrevHeader(bc.CurrentHeader(), []Transaction{*tx})
+		fork.Timestamp++
+		fillRoots(bc, fork, validatorKey.PublicKey())
+		assert.Nil(t, fork.Sign(validatorKey))
+		assert.Nil(t, bc.AddBlock(signedBlock(t, bc, validatorKey, []Transaction{*tx})))
+		assert.Nil(t, bc.AddBlock(fork))
+
+		bc.lock.RLock()
+		blocks := 2 * int(bc.storageCfg.Retain+1) // 保留范围内的主链区块和分叉区块
+		assert.LessOrEqual(t, len(bc.states), blocks)
+		assert.LessOrEqual(t, len(bc.receipts), blocks)
+		assert.LessOrEqual(t, len(bc.totalWork), blocks)
+		assert.LessOrEqual(t, len(bc.headerIndex)-len(bc.headers), blocks) // 分叉区块头
+		assert.LessOrEqual(t, len(bc.snapshots)+len(bc.snapshotStates), 3)
+		bc.lock.RUnlock()
+	}
+	assert.Equal(t, uint32(20), bc.Height())
+
+	// 旧交易的索引只指向主链区块，收据仍可查询
+	bc.lock.RLock()
+	assert.Len(t, bc.txLookup[txx[0].Hash(TxHasher{})], 1)
+	bc.lock.RUnlock()
+	receipt, err := bc.GetReceipt(txx[0].Hash(TxHasher{}))
+	assert.Nil(t, err)
+	assert.Equal(t, txx[0].Hash(TxHasher{}), receipt.TxHash)
+
+	// 最近的快照仍然可用
+	h, err := bc.GetHeader(18)
+	assert.Nil(t, err)
+	_, err = bc.GetSnapshot(BlockHasher{}.Hash(h))
+	assert.Nil(t, err)
+	h, err = bc.GetHeader(15)
+	assert.Nil(t, err)
+	_, err = bc.GetSnapshot(BlockHasher{}.Hash(h))
+	assert.NotNil(t, err)
+
+	// 区块奖励收据随状态一起被裁剪
+	h, err = bc.GetHeader(1)
+	assert.Nil(t, err)
+	_, err = bc.GetBlockReceipt(BlockHasher{}.Hash(h))
+	assert.True(t, errors.Is(err, ErrStatePruned))
+}
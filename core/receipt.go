@@ -0,0 +1,69 @@
+package core
+
+import (
+	"bytes"
+	"crypto/sha256"
+
+	"github.com/Luboy23/Blockchain_Project/types"
+	"github.com/Luboy23/Blockchain_Project/vm"
+)
+
+// 定义了交易的执行状态。
+type ReceiptStatus byte
+
+const (
+	ReceiptStatusFailed     ReceiptStatus = iota // 字节码执行失败，写入和转账已被回滚，但燃料费照常收取
+	ReceiptStatusSuccessful                      // 执行成功
+)
+
+// 记录一笔已打包交易的执行结果。
+type Receipt struct {
+	TxHash            types.Hash    // 交易哈希
+	Status            ReceiptStatus // 执行状态
+	GasUsed           uint64        // 该交易消耗的燃料
+	CumulativeGasUsed uint64        // 区块中截止到该交易（包括该交易）累计消耗的燃料
+	ContractAddress   types.Address // 部署交易创建的合约地址
+	ReturnData        []byte        // 合约调用的返回数据
+	Logs              []*vm.Log     // 执行成功时记录的日志
+	Error             string        // 执行失败的原因
+
+	BlockHash   types.Hash // 所在区块的哈希，不参与收据哈希的计算
+	BlockHeight uint32     // 所在区块的高度，不参与收据哈希的计算
+	Index       uint32     // 在区块中的位置，不参与收据哈希的计算
+}
+
+// 根据交易及其执行结果创建收据。
+func newReceipt(tx *Transaction, index int, result *ExecutionResult, cumulativeGasUsed uint64) *Receipt {
+	r := &Receipt{
+		TxHash:            tx.Hash(TxHasher{}),
+		Status:            ReceiptStatusSuccessful,
+		GasUsed:           result.GasUsed,
+		CumulativeGasUsed: cumulativeGasUsed,
+		ContractAddress:   result.ContractAddress,
+		ReturnData:        result.ReturnData,
+		Logs:              result.Logs,
+		Index:             uint32(index),
+	}
+	if result.Err != nil {
+		r.Status = ReceiptStatusFailed
+		r.Error = result.Err.Error()
+	}
+
+	return r
+}
+
+// 计算收据列表的收据根，即按顺序拼接每个收据的哈希后再做一次SHA-256。
+// 没有收据时返回零哈希。
+func CalculateReceiptsRoot(receipts []*Receipt) types.Hash {
+	if len(receipts) == 0 {
+		return types.Hash{}
+	}
+
+	buf := &bytes.Buffer{}
+	for _, r := range receipts {
+		hash := ReceiptHasher{}.Hash(r)
+		buf.Write(hash.ToSlice())
+	}
+
+	return types.Hash(sha256.Sum256(buf.Bytes()))
+}
@@ -0,0 +1,130 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/Luboy23/Blockchain_Project/crypto"
+	"github.com/Luboy23/Blockchain_Project/types"
+	"github.com/Luboy23/Blockchain_Project/vm"
+	"github.com/stretchr/testify/assert"
+)
+
+// 测试每笔交易的收据记录了执行状态、燃料、日志以及所在区块的位置，并且可以按交易哈希查询。
+func TestTransactionReceipts(t *testing.T) {
+	validatorKey := crypto.GeneratePrivatekey()
+	userKey := crypto.GeneratePrivatekey()
+	user := userKey.PublicKey().Address()
+	bc, err := NewBlockchainFromGenesis(&Genesis{
+		Alloc: map[types.Address]uint64{
+			user: 1000,
+		},
+		Validators: []GenesisValidator{
+			{PublicKey: validatorKey.PublicKey(), Stake: 100},
+		},
+	})
+	assert.Nil(t, err)
+
+	// 记录主题为"transfer"、数据为输入的日志
+	logger := contractCode(vm.Push([]byte("transfer")), []byte{byte(vm.INPUT)}, []byte{byte(vm.LOG)})
+	reverting := contractCode(vm.Push([]byte("no")), []byte{byte(vm.REVERT)})
+
+	deployLogger := signedTx(t, userKey, TxTypeDeploy, 0, types.Address{}, 0, logger)
+	deployReverting := signedTx(t, userKey, TxTypeDeploy, 1, types.Address{}, 0, reverting)
+	call := signedTx(t, userKey, TxTypeCall, 2, ContractAddress(user, 0), 0, []byte("alice"))
+	failed := signedTx(t, userKey, TxTypeCall, 3, ContractAddress(user, 1), 0, nil)
+	txx := []*Transaction{deployLogger, deployReverting, call, failed}
+
+	block, invalid, err := bc.BuildBlock(bc.CurrentHeader(), validatorKey.PublicKey(), txx)
+	assert.Nil(t, err)
+	assert.Len(t, invalid, 0)
+	assert.False(t, block.ReceiptsRoot.IsZero())
+	assert.Nil(t, block.Sign(validatorKey))
+	assert.Nil(t, bc.AddBlock(block))
+
+	blockHash := block.Hash(BlockHasher{})
+	receipts, err := bc.GetReceipts(blockHash)
+	assert.Nil(t, err)
+	assert.Len(t, receipts, 4)
+	assert.Equal(t, block.ReceiptsRoot, CalculateReceiptsRoot(receipts))
+
+	var cumulative uint64
+	for i, tx := range txx {
+		r, err := bc.GetReceipt(tx.Hash(TxHasher{}))
+		assert.Nil(t, err)
+		assert.Equal(t, receipts[i], r)
+		assert.Equal(t, blockHash, r.BlockHash)
+		assert.Equal(t, uint32(1), r.BlockHeight)
+		assert.Equal(t, uint32(i), r.Index)
+
+		cumulative += r.GasUsed
+		assert.Equal(t, cumulative, r.CumulativeGasUsed)
+	}
+
+	assert.Equal(t, ReceiptStatusSuccessful, receipts[0].Status)
+	assert.Equal(t, ContractAddress(user, 0), receipts[0].ContractAddress)
+	assert.Equal(t, deployLogger.IntrinsicGas()+vm.GasCodeByte*uint64(len(logger)), receipts[0].GasUsed)
+
+	assert.Equal(t, ReceiptStatusSuccessful, receipts[2].Status)
+	assert.Equal(t, []*vm.Log{{Address: ContractAddress(user, 0), Topic: []byte("transfer"), Data: []byte("alice")}}, receipts[2].Logs)
+
+	assert.Equal(t, ReceiptStatusFailed, receipts[3].Status)
+	assert.Equal(t, []byte("no"), receipts[3].ReturnData)
+	assert.NotEmpty(t, receipts[3].Error)
+	assert.Empty(t, receipts[3].Logs)
+
+	_, err = bc.GetReceipt(types.RandomHash())
+	assert.NotNil(t, err)
+}
+
+// 测试区块头中的收据根必须与执行结果一致。
+func TestInvalidReceiptsRoot(t *testing.T) {
+	validatorKey := crypto.GeneratePrivatekey()
+	bc, err := NewBlockchainFromGenesis(&Genesis{
+		Validators: []GenesisValidator{
+			{PublicKey: validatorKey.PublicKey(), Stake: 100},
+		},
+	})
+	assert.Nil(t, err)
+
+	tx := signedTx(t, crypto.GeneratePrivatekey(), TxTypeData, 0, types.Address{}, 0, vm.NewProgram(vm.Push([]byte{1})))
+	block, _, err := bc.BuildBlock(bc.CurrentHeader(), validatorKey.PublicKey(), []*Transaction{tx})
+	assert.Nil(t, err)
+
+	block.ReceiptsRoot = types.RandomHash()
+	assert.Nil(t, block.Sign(validatorKey))
+	assert.NotNil(t, bc.AddBlock(block))
+}
+
+// 测试主链重组后按交易哈希只能查询到主链上的收据。
+func TestReceiptAfterReorg(t *testing.T) {
+	validatorKey := crypto.GeneratePrivatekey()
+	bc, err := NewBlockchainFromGenesis(&Genesis{
+		Validators: []GenesisValidator{
+			{PublicKey: validatorKey.PublicKey(), Stake: 100},
+		},
+	})
+	assert.Nil(t, err)
+	genesis := bc.CurrentHeader()
+
+	tx := signedTx(t, crypto.GeneratePrivatekey(), TxTypeData, 0, types.Address{}, 0, vm.NewProgram(vm.Push([]byte{1})))
+	assert.Nil(t, bc.AddBlock(signedBlock(t, bc, validatorKey, []Transaction{*tx})))
+
+	r, err := bc.GetReceipt(tx.Hash(TxHasher{}))
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(1), r.BlockHeight)
+
+	// 不包含该交易的更长分支成为主链
+	parent := genesis
+	for i := 0; i < 2; i++ {
+		b := NewBlockFromPrevHeader(parent, nil)
+		b.Timestamp = genesis.Timestamp + int64(i) + 1
+		fillRoots(bc, b, validatorKey.PublicKey())
+		assert.Nil(t, b.Sign(validatorKey))
+		assert.Nil(t, bc.AddBlock(b))
+		parent = b.Header
+	}
+	assert.Equal(t, uint32(2), bc.Height())
+
+	_, err = bc.GetReceipt(tx.Hash(TxHasher{}))
+	assert.NotNil(t, err)
+}
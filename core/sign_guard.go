@@ -0,0 +1,185 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/Luboy23/Blockchain_Project/crypto"
+	"github.com/Luboy23/Blockchain_Project/types"
+)
+
+// 试图在同一高度/轮次对不同区块签名时返回的错误。
+var ErrDoubleSign = errors.New("拒绝签名：可能导致双重签名")
+
+// 记录验证者最后一次签名的高度、轮次和区块哈希。
+type SignRecord struct {
+	Height    uint32     `json:"height"`    // 最后签名的区块高度
+	Round     uint32     `json:"round"`     // 最后签名的轮次
+	BlockHash types.Hash `json:"blockHash"` // 最后签名的区块哈希
+}
+
+// 防止验证者双重签名的守卫。
+// 每次签名前都会与最后一次签名记录比较，并在返回签名之前先把新的记录持久化到磁盘，这样节点重启后也不会在同一高度签出两个不同的区块。
+// 使用持久化文件的守卫在关闭之前独占旁边的锁文件，误启动的第二个实例（共享同一个文件）无法创建守卫，因此不能签名。
+type SignGuard struct {
+	lock     sync.Mutex
+	path     string      // 持久化文件的路径，为空表示只保存在内存中
+	lockFile *os.File    // 持有排他锁的锁文件，进程退出时锁自动释放
+	last     *SignRecord // 最后一次签名的记录，为nil表示从未签名
+}
+
+// 创建一个新的签名守卫，如果持久化文件已存在则从中恢复最后一次签名的记录。
+// 持久化文件已经被另一个守卫使用时返回错误，守卫不再使用时需要调用Close释放。
+func NewSignGuard(path string) (*SignGuard, error) {
+	g := &SignGuard{
+		path: path,
+	}
+
+	if path == "" {
+		return g, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	lockFile, err := os.OpenFile(path+".lock", os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err := lockFileExclusive(lockFile); err != nil {
+		lockFile.Close()
+		return nil, fmt.Errorf("签名记录文件(%s)正被另一个实例使用：%s", path, err)
+	}
+	g.lockFile = lockFile
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return g, nil // 第一次启动，还没有签名记录
+	}
+	if err != nil {
+		g.Close()
+		return nil, err
+	}
+
+	record := &SignRecord{}
+	if err := json.Unmarshal(data, record); err != nil {
+		g.Close()
+		return nil, fmt.Errorf("解析签名记录文件(%s)失败：%s", path, err)
+	}
+	g.last = record
+
+	return g, nil
+}
+
+// 释放锁文件，之后其他守卫可以使用同一个持久化文件。可以重复调用。
+func (g *SignGuard) Close() error {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	if g.lockFile == nil {
+		return nil
+	}
+	err := g.lockFile.Close() // 关闭文件同时释放锁
+	g.lockFile = nil
+	return err
+}
+
+// 返回最后一次签名的记录。
+func (g *SignGuard) LastSigned() (SignRecord, bool) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	if g.last == nil {
+		return SignRecord{}, false
+	}
+	return *g.last, true
+}
+
+// 通过守卫对区块签名。
+// 高度（或同一高度下的轮次）必须大于最后一次签名；对同一高度、同一轮次的同一个区块重复签名是允许的。
+func (g *SignGuard) SignBlock(b *Block, round uint32, priKey crypto.PrivateKey) error {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	hash := b.Hash(BlockHasher{})
+
+	if err := g.check(b.Height, round, hash); err != nil {
+		return err
+	}
+
+	record := &SignRecord{
+		Height:    b.Height,
+		Round:     round,
+		BlockHash: hash,
+	}
+	if err := g.persist(record); err != nil { // 先持久化记录，再签名
+		return err
+	}
+	g.last = record
+
+	return b.Sign(priKey)
+}
+
+// 检查在指定高度和轮次对指定区块签名是否安全。
+func (g *SignGuard) check(height, round uint32, hash types.Hash) error {
+	if g.last == nil {
+		return nil
+	}
+
+	switch {
+	case height > g.last.Height:
+		return nil
+	case height < g.last.Height:
+		return fmt.Errorf("%w：高度(%d)低于最后签名的高度(%d)", ErrDoubleSign, height, g.last.Height)
+	case round > g.last.Round:
+		return nil
+	case round < g.last.Round:
+		return fmt.Errorf("%w：高度(%d)的轮次(%d)低于最后签名的轮次(%d)", ErrDoubleSign, height, round, g.last.Round)
+	case hash != g.last.BlockHash:
+		return fmt.Errorf("%w：已经在高度(%d)轮次(%d)签名了区块(%s)", ErrDoubleSign, height, round, g.last.BlockHash)
+	}
+
+	return nil
+}
+
+// 将签名记录原子地写入持久化文件。
+// 临时文件在重命名前同步到磁盘，重命名后再同步所在目录，断电后读到的不会是更早的记录。
+func (g *SignGuard) persist(record *SignRecord) error {
+	if g.path == "" {
+		return nil
+	}
+	if g.lockFile == nil {
+		return fmt.Errorf("签名守卫已关闭")
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	tmp := g.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp, g.path); err != nil { // 重命名保证文件要么是旧记录，要么是新记录
+		return err
+	}
+	return syncDir(filepath.Dir(g.path))
+}
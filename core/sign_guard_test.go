@@ -0,0 +1,86 @@
+package core
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/Luboy23/Blockchain_Project/crypto"
+	"github.com/Luboy23/Blockchain_Project/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// 测试守卫拒绝在同一高度签名不同的区块，但允许重复签名同一区块。
+func TestSignGuardRefusesConflict(t *testing.T) {
+	priKey := crypto.GeneratePrivatekey()
+	g, err := NewSignGuard("")
+	assert.Nil(t, err)
+
+	a := randomBlock(1, types.Hash{})
+	assert.Nil(t, g.SignBlock(a, 0, priKey))
+	assert.Nil(t, g.SignBlock(a, 0, priKey)) // 同一区块可以重复签名
+
+	b := randomBlock(1, types.Hash{})
+	b.Timestamp++
+	assert.True(t, errors.Is(g.SignBlock(b, 0, priKey), ErrDoubleSign))
+	assert.Nil(t, b.Signature)
+
+	// 更高的轮次或高度是允许的
+	assert.Nil(t, g.SignBlock(b, 1, priKey))
+	assert.Nil(t, g.SignBlock(randomBlock(2, types.Hash{}), 0, priKey))
+
+	// 低于最后签名的高度会被拒绝
+	assert.True(t, errors.Is(g.SignBlock(randomBlock(1, types.Hash{}), 5, priKey), ErrDoubleSign))
+}
+
+// 测试签名记录会被持久化，重启后依然生效。
+func TestSignGuardPersistence(t *testing.T) {
+	priKey := crypto.GeneratePrivatekey()
+	path := filepath.Join(t.TempDir(), "sign_state.json")
+
+	g, err := NewSignGuard(path)
+	assert.Nil(t, err)
+	a := randomBlock(7, types.Hash{})
+	assert.Nil(t, g.SignBlock(a, 0, priKey))
+
+	// 模拟重启
+	assert.Nil(t, g.Close())
+	g, err = NewSignGuard(path)
+	assert.Nil(t, err)
+	defer g.Close()
+
+	last, ok := g.LastSigned()
+	assert.True(t, ok)
+	assert.Equal(t, uint32(7), last.Height)
+	assert.Equal(t, a.Hash(BlockHasher{}), last.BlockHash)
+
+	b := randomBlock(7, types.Hash{})
+	b.Timestamp++
+	assert.True(t, errors.Is(g.SignBlock(b, 0, priKey), ErrDoubleSign))
+}
+
+// 测试两个守卫不能同时使用同一个持久化文件，前一个关闭后才能打开。
+func TestSignGuardExclusive(t *testing.T) {
+	priKey := crypto.GeneratePrivatekey()
+	path := filepath.Join(t.TempDir(), "sign_state.json")
+
+	g, err := NewSignGuard(path)
+	assert.Nil(t, err)
+	assert.Nil(t, g.SignBlock(randomBlock(3, types.Hash{}), 0, priKey))
+
+	// 第二个实例无法打开同一个文件，也就无法在同一高度签出另一个区块
+	_, err = NewSignGuard(path)
+	assert.NotNil(t, err)
+
+	assert.Nil(t, g.Close())
+	assert.Nil(t, g.Close())
+	assert.NotNil(t, g.SignBlock(randomBlock(4, types.Hash{}), 0, priKey)) // 关闭后不能再签名
+
+	other, err := NewSignGuard(path)
+	assert.Nil(t, err)
+	defer other.Close()
+
+	b := randomBlock(3, types.Hash{})
+	b.Timestamp++
+	assert.True(t, errors.Is(other.SignBlock(b, 0, priKey), ErrDoubleSign))
+}
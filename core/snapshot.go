@@ -0,0 +1,281 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/Luboy23/Blockchain_Project/trie"
+	"github.com/Luboy23/Blockchain_Project/types"
+	"github.com/sirupsen/logrus"
+)
+
+// 每个快照分片默认包含的账户数。
+const DefaultSnapshotChunkSize = 128
+
+// 快照中一个地址的完整状态。
+type AccountSnapshot struct {
+	Address     types.Address    // 地址
+	Account     Account          // 余额和Nonce
+	Code        []byte           // 合约代码
+	Storage     []StorageEntry   // 合约存储，按键排序
+	Validator   *ValidatorRecord // 验证者记录，不是验证者时为nil
+	Delegations []*Delegation    // 作为委托人的委托，按验证者地址排序
+	Unbondings  []*Unbonding     // 处于解绑期的质押和委托
+}
+
+// 合约存储中的一个键值对。
+type StorageEntry struct {
+	Key   []byte
+	Value []byte
+}
+
+// 快照中不属于单个地址的状态。
+type SystemSnapshot struct {
+	ActiveSet []types.Address // 当前纪元的活跃验证者集合
+	Offences  []*Offence      // 作恶记录，不包含双重签名证据
+}
+
+// 快照的一个分片，包含若干账户以及每个账户在状态树中的证明，第一个分片还包含系统状态。
+// 每个分片都可以单独根据状态根验证，不需要等待其他分片。
+type SnapshotChunk struct {
+	Index       uint32             // 分片序号
+	Accounts    []*AccountSnapshot // 按键排序的账户
+	Proofs      []*trie.Proof      // 每个账户的证明
+	System      *SystemSnapshot    // 系统状态，只在第一个分片中
+	SystemProof *trie.Proof        // 系统状态的证明
+}
+
+// 某个区块执行后的状态快照。
+type Snapshot struct {
+	Header *Header          // 快照对应的区块头
+	Chunks []*SnapshotChunk // 快照的所有分片
+}
+
+// 将状态切分为快照分片，每个分片最多包含chunkSize个账户。
+func (s *State) Snapshot(chunkSize int) []*SnapshotChunk {
+	if chunkSize <= 0 {
+		chunkSize = DefaultSnapshotChunkSize
+	}
+
+	t := s.trie()
+	accounts := s.accountSnapshots()
+	keys := make(map[types.Address]types.Hash, len(accounts))
+	for _, a := range accounts {
+		keys[a.Address] = accountKey(a.Address)
+	}
+	sort.Slice(accounts, func(i, j int) bool { // 按状态树中的键排序
+		ki, kj := keys[accounts[i].Address], keys[accounts[j].Address]
+		return bytes.Compare(ki[:], kj[:]) < 0
+	})
+
+	chunks := []*SnapshotChunk{}
+	for start := 0; start == 0 || start < len(accounts); start += chunkSize {
+		end := start + chunkSize
+		if end > len(accounts) {
+			end = len(accounts)
+		}
+
+		chunk := &SnapshotChunk{
+			Index:    uint32(len(chunks)),
+			Accounts: accounts[start:end],
+		}
+		for _, a := range chunk.Accounts {
+			chunk.Proofs = append(chunk.Proofs, t.Prove(accountKey(a.Address)))
+		}
+		chunks = append(chunks, chunk)
+	}
+
+	chunks[0].System = s.systemSnapshot()
+	chunks[0].SystemProof = t.Prove(systemKey)
+
+	return chunks
+}
+
+// 根据状态根验证分片中的每个账户以及系统状态。
+func (c *SnapshotChunk) Verify(root types.Hash) error {
+	if len(c.Proofs) != len(c.Accounts) {
+		return fmt.Errorf("快照分片(%d)的证明数量(%d)与账户数量(%d)不符", c.Index, len(c.Proofs), len(c.Accounts))
+	}
+
+	for i, a := range c.Accounts {
+		key := accountKey(a.Address)
+		if i > 0 {
+			prev := accountKey(c.Accounts[i-1].Address)
+			if bytes.Compare(prev[:], key[:]) >= 0 {
+				return fmt.Errorf("快照分片(%d)中的账户没有按键排序", c.Index)
+			}
+		}
+		if c.Proofs[i] == nil {
+			return fmt.Errorf("快照分片(%d)中账户(%s)的证明为空", c.Index, a.Address)
+		}
+		if err := c.Proofs[i].Verify(root, key, a.leaf(), true); err != nil {
+			return fmt.Errorf("快照分片(%d)中账户(%s)的证明无效：%s", c.Index, a.Address, err)
+		}
+	}
+
+	if c.Index == 0 {
+		if c.System == nil || c.SystemProof == nil {
+			return fmt.Errorf("第一个快照分片缺少系统状态")
+		}
+		if err := c.SystemProof.Verify(root, systemKey, c.System.hash(), true); err != nil {
+			return fmt.Errorf("快照分片中系统状态的证明无效：%s", err)
+		}
+	}
+
+	return nil
+}
+
+// 验证快照的所有分片并重建状态。重建后的状态根必须与区块头中的状态根一致，从而保证分片没有缺失。
+func StateFromSnapshot(header *Header, chunks []*SnapshotChunk) (*State, error) {
+	if len(chunks) == 0 {
+		return nil, fmt.Errorf("快照没有分片")
+	}
+
+	state := NewState()
+	for i, c := range chunks {
+		if c == nil || c.Index != uint32(i) {
+			return nil, fmt.Errorf("缺少快照分片(%d)", i)
+		}
+		if err := c.Verify(header.StateRoot); err != nil {
+			return nil, err
+		}
+		state.restoreAccounts(c.Accounts)
+	}
+
+	sys := chunks[0].System
+	state.activeSet = append(state.activeSet, sys.ActiveSet...)
+	for _, o := range sys.Offences {
+		offence := *o
+		state.offences = append(state.offences, &offence)
+	}
+
+	if root := state.Root(); root != header.StateRoot {
+		return nil, fmt.Errorf("快照重建的状态根(%s)与区块头的状态根(%s)不符", root, header.StateRoot)
+	}
+
+	return state, nil
+}
+
+// 将快照中的账户写入状态。
+func (s *State) restoreAccounts(accounts []*AccountSnapshot) {
+	for _, a := range accounts {
+		s.touch(a.Address)
+		if a.Account != (Account{}) {
+			*s.account(a.Address) = a.Account
+		}
+		if len(a.Code) > 0 {
+			s.code[a.Address] = append([]byte{}, a.Code...)
+		}
+		for _, e := range a.Storage {
+			s.setStorage(a.Address, e.Key, append([]byte{}, e.Value...))
+		}
+		if a.Validator != nil {
+			record := *a.Validator
+			s.validators[a.Address] = &record
+		}
+		for _, d := range a.Delegations {
+			delegation := *d
+			delegation.Delegator = a.Address
+			s.delegations[delegationKey{delegator: a.Address, validator: d.Validator}] = &delegation
+		}
+		for _, u := range a.Unbondings {
+			unbonding := *u
+			unbonding.Owner = a.Address
+			s.unbondings = append(s.unbondings, &unbonding)
+		}
+	}
+}
+
+// 设置生成状态快照的间隔，之后添加的高度为interval整数倍的区块都会保留快照，快照在第一次被请求时生成。
+func (bc *Blockchain) SetSnapshotInterval(interval uint32) {
+	bc.lock.Lock()
+	defer bc.lock.Unlock()
+
+	bc.snapshotInterval = interval
+}
+
+// 检查区块高度是否为快照高度，调用者需要持有锁。
+func (bc *Blockchain) isSnapshotHeight(height uint32) bool {
+	return bc.snapshotInterval > 0 && height > 0 && height%bc.snapshotInterval == 0
+}
+
+// 获取指定区块的状态快照。快照高度的区块第一次被请求快照时在调用者的协程中生成快照，之后直接返回。
+func (bc *Blockchain) GetSnapshot(hash types.Hash) (*Snapshot, error) {
+	bc.lock.RLock()
+	snapshot, ok := bc.snapshots[hash]
+	state, pending := bc.snapshotStates[hash]
+	header := bc.headerIndex[hash]
+	bc.lock.RUnlock()
+
+	if ok {
+		return snapshot, nil
+	}
+	if !pending {
+		return nil, fmt.Errorf("没有区块(%s)的状态快照", hash)
+	}
+
+	snapshot = &Snapshot{
+		Header: header,
+		Chunks: state.Snapshot(DefaultSnapshotChunkSize), // 生成快照时不持有锁，状态提交后不会再被修改
+	}
+
+	bc.lock.Lock()
+	defer bc.lock.Unlock()
+
+	if existing, ok := bc.snapshots[hash]; ok {
+		return existing, nil // 其他协程已经生成了快照
+	}
+	if _, ok := bc.snapshotStates[hash]; ok { // 生成期间没有被裁剪
+		delete(bc.snapshotStates, hash)
+		bc.snapshots[hash] = snapshot
+	}
+
+	return snapshot, nil
+}
+
+// 用可信区块头对应的状态快照重置区块链：验证并重建状态后，区块链以该区块头为起点，
+// 之后的区块照常验证和执行，快照之前的区块和状态不可查询。
+func (bc *Blockchain) ImportSnapshot(header *Header, chunks []*SnapshotChunk) error {
+	state, err := StateFromSnapshot(header, chunks)
+	if err != nil {
+		return err
+	}
+
+	hash := BlockHasher{}.Hash(header)
+
+	bc.lock.Lock()
+	defer bc.lock.Unlock()
+
+	bc.headers = []*Header{header}
+	bc.base = header.Height
+	bc.headerIndex = map[types.Hash]*Header{hash: header}
+	bc.totalWork = map[types.Hash]*big.Int{hash: header.Work()}
+	bc.states = map[types.Hash]*State{hash: state}
+	bc.receipts = map[types.Hash]*BlockReceipt{hash: {BlockHash: hash, Height: header.Height}}
+	bc.txLookup = make(map[types.Hash][]types.Hash)
+	bc.executed = make(map[types.Hash]*executedBlock)
+	bc.snapshots = map[types.Hash]*Snapshot{hash: {Header: header, Chunks: chunks}}
+	bc.snapshotStates = make(map[types.Hash]*State)
+	bc.heightIndex = map[uint32][]types.Hash{header.Height: {hash}}
+	bc.pruneFrom = header.Height
+	bc.finalizeFrom = header.Height + 1
+
+	logrus.WithFields(logrus.Fields{
+		"区块高度": header.Height,
+		"区块哈希": hash,
+	}).Info("从状态快照恢复了区块链")
+
+	return nil
+}
+
+// 使用提供的编码器对快照分片进行编码。
+func (c *SnapshotChunk) Encode(enc Encoder[*SnapshotChunk]) error {
+	return enc.Encode(c)
+}
+
+// 使用提供的解码器对快照分片进行解码。
+func (c *SnapshotChunk) Decode(dec Decoder[*SnapshotChunk]) error {
+	return dec.Decode(c)
+}
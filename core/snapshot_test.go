@@ -0,0 +1,137 @@
+package core
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/Luboy23/Blockchain_Project/crypto"
+	"github.com/Luboy23/Blockchain_Project/types"
+	"github.com/Luboy23/Blockchain_Project/vm"
+	"github.com/stretchr/testify/assert"
+)
+
+// 创建一个每隔两个区块生成快照的区块链，并添加四个包含转账、质押、委托、解绑和合约存储的区块。
+func snapshotTestChain(t *testing.T) (*Blockchain, *Genesis, []*Block) {
+	validatorKey := crypto.GeneratePrivatekey()
+	userKey := crypto.GeneratePrivatekey()
+	g := &Genesis{
+		Alloc: map[types.Address]uint64{userKey.PublicKey().Address(): 10000},
+		Validators: []GenesisValidator{
+			{PublicKey: validatorKey.PublicKey(), Stake: 1000},
+		},
+	}
+	bc, err := NewBlockchainFromGenesis(g)
+	assert.Nil(t, err)
+	bc.SetSnapshotInterval(2)
+
+	blocks := []*Block{}
+	for _, txx := range [][]Transaction{
+		{
+			*signedTx(t, userKey, TxTypeDelegate, 0, validatorKey.PublicKey().Address(), 500, nil),
+			*signedTx(t, validatorKey, TxTypeUnbond, 0, types.Address{}, 100, nil),
+		},
+		{
+			*signedTx(t, userKey, TxTypeData, 1, types.Address{}, 0, vm.NewProgram(vm.Push([]byte("k")), vm.Push([]byte("v")), []byte{byte(vm.SSTORE)})),
+			*signedTx(t, userKey, TxTypeTransfer, 2, crypto.GeneratePrivatekey().PublicKey().Address(), 10, nil),
+		},
+		{*signedTx(t, userKey, TxTypeTransfer, 3, crypto.GeneratePrivatekey().PublicKey().Address(), 20, nil)},
+		nil,
+	} {
+		b := signedBlock(t, bc, validatorKey, txx)
+		assert.Nil(t, bc.AddBlock(b))
+		blocks = append(blocks, b)
+	}
+
+	return bc, g, blocks
+}
+
+// 测试快照分片经过编码后可以验证并重建出相同的状态，篡改或缺失分片时重建失败。
+func TestSnapshotRoundTrip(t *testing.T) {
+	bc, _, _ := snapshotTestChain(t)
+
+	// 添加区块时只保留快照高度的状态，快照在第一次被请求时生成
+	assert.Len(t, bc.snapshots, 0)
+	assert.Len(t, bc.snapshotStates, 2)
+
+	header, err := bc.GetHeader(2)
+	assert.Nil(t, err)
+	snapshot, err := bc.GetSnapshot(BlockHasher{}.Hash(header))
+	assert.Nil(t, err)
+	assert.Len(t, bc.snapshots, 1)
+	assert.Len(t, bc.snapshotStates, 1)
+	cached, err := bc.GetSnapshot(BlockHasher{}.Hash(header))
+	assert.Nil(t, err)
+	assert.Same(t, snapshot, cached)
+	assert.Equal(t, header, snapshot.Header)
+
+	// 非快照高度没有快照
+	header1, err := bc.GetHeader(1)
+	assert.Nil(t, err)
+	_, err = bc.GetSnapshot(BlockHasher{}.Hash(header1))
+	assert.NotNil(t, err)
+
+	state, err := bc.StateAt(BlockHasher{}.Hash(header))
+	assert.Nil(t, err)
+	chunks := state.Snapshot(2)
+	assert.True(t, len(chunks) > 1)
+
+	decoded := []*SnapshotChunk{}
+	for _, c := range chunks {
+		buf := &bytes.Buffer{}
+		assert.Nil(t, c.Encode(NewGobSnapshotChunkEncoder(buf)))
+		chunk := new(SnapshotChunk)
+		assert.Nil(t, chunk.Decode(NewGobSnapshotChunkDecoder(buf)))
+		assert.Nil(t, chunk.Verify(header.StateRoot))
+		decoded = append(decoded, chunk)
+	}
+
+	restored, err := StateFromSnapshot(header, decoded)
+	assert.Nil(t, err)
+	assert.Equal(t, header.StateRoot, restored.Root())
+	assert.Equal(t, state.delegations, restored.delegations)
+	assert.Equal(t, len(state.unbondings), len(restored.unbondings))
+
+	// 缺少分片时重建的状态根不符
+	_, err = StateFromSnapshot(header, decoded[:len(decoded)-1])
+	assert.NotNil(t, err)
+
+	// 篡改的账户无法通过验证
+	decoded[1].Accounts[0].Account.Balance++
+	assert.NotNil(t, decoded[1].Verify(header.StateRoot))
+	_, err = StateFromSnapshot(header, decoded)
+	assert.NotNil(t, err)
+}
+
+// 测试从快照恢复的区块链可以继续验证和添加快照之后的区块。
+func TestImportSnapshot(t *testing.T) {
+	bc, g, blocks := snapshotTestChain(t)
+
+	header, err := bc.GetHeader(2)
+	assert.Nil(t, err)
+	snapshot, err := bc.GetSnapshot(BlockHasher{}.Hash(header))
+	assert.Nil(t, err)
+
+	synced, err := NewBlockchainFromGenesis(g)
+	assert.Nil(t, err)
+	assert.Nil(t, synced.ImportSnapshot(header, snapshot.Chunks))
+	assert.Equal(t, uint32(2), synced.Height())
+
+	for _, b := range blocks[2:] {
+		assert.Nil(t, synced.AddBlock(b))
+	}
+	assert.Equal(t, bc.Height(), synced.Height())
+	assert.Equal(t, bc.CurrentHeader(), synced.CurrentHeader())
+	assert.Equal(t, bc.State().Root(), synced.State().Root())
+
+	// 快照之前的区块无法查询
+	_, err = synced.GetHeader(1)
+	assert.NotNil(t, err)
+	current, err := synced.GetHeader(4)
+	assert.Nil(t, err)
+	assert.Equal(t, bc.CurrentHeader(), current)
+
+	// 状态根不符的快照被拒绝
+	forged := *header
+	forged.StateRoot = types.RandomHash()
+	assert.NotNil(t, synced.ImportSnapshot(&forged, snapshot.Chunks))
+}
@@ -0,0 +1,219 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/Luboy23/Blockchain_Project/types"
+)
+
+// 执行自我质押交易：从余额中扣除Value并计入验证者的自我质押，首次质押时注册为验证者。
+func (s *State) applyBond(tx *Transaction) error {
+	sender := tx.Sender().Address()
+	if tx.Value == 0 {
+		return fmt.Errorf("质押数量不能为0")
+	}
+	if s.Balance(sender) < tx.Value {
+		return fmt.Errorf("账户(%s)余额不足以质押(%d)", sender, tx.Value)
+	}
+
+	v, ok := s.validator(sender)
+	if !ok {
+		v = &ValidatorRecord{
+			PublicKey: tx.Sender(),
+		}
+		s.SetValidator(v)
+	}
+
+	s.account(sender).Balance -= tx.Value
+	v.Stake += tx.Value
+
+	return nil
+}
+
+// 执行解除质押交易：减少验证者的自我质押，解绑期结束后返还余额。
+func (s *State) applyUnbond(tx *Transaction, b *Block, cfg *ChainConfig) error {
+	sender := tx.Sender().Address()
+	v, ok := s.validator(sender)
+	if !ok {
+		return fmt.Errorf("账户(%s)不是验证者", sender)
+	}
+	if tx.Value == 0 || tx.Value > v.Stake {
+		return fmt.Errorf("解除质押数量(%d)无效，当前自我质押为(%d)", tx.Value, v.Stake)
+	}
+
+	v.Stake -= tx.Value
+	s.addUnbonding(sender, sender, tx.Value, b, cfg)
+
+	return nil
+}
+
+// 执行委托交易：从余额中扣除Value并委托给验证者To。
+func (s *State) applyDelegate(tx *Transaction) error {
+	sender := tx.Sender().Address()
+	if tx.Value == 0 {
+		return fmt.Errorf("委托数量不能为0")
+	}
+	if sender == tx.To {
+		return fmt.Errorf("验证者不能委托给自己，请使用质押交易")
+	}
+
+	v, ok := s.Validator(tx.To)
+	if !ok {
+		return fmt.Errorf("委托目标(%s)不是验证者", tx.To)
+	}
+	if v.Jailed {
+		return fmt.Errorf("验证者(%s)已被监禁，不能接受委托", tx.To)
+	}
+	if s.Balance(sender) < tx.Value {
+		return fmt.Errorf("账户(%s)余额不足以委托(%d)", sender, tx.Value)
+	}
+
+	d, ok := s.delegation(delegationKey{delegator: sender, validator: tx.To})
+	if !ok {
+		d = &Delegation{
+			Delegator: sender,
+			Validator: tx.To,
+		}
+		s.setDelegation(d)
+	}
+	v, _ = s.validator(tx.To)
+
+	s.account(sender).Balance -= tx.Value
+	d.Amount += tx.Value
+	v.Delegated += tx.Value
+
+	return nil
+}
+
+// 执行撤回委托交易：减少对验证者To的委托，解绑期结束后返还余额。
+func (s *State) applyUndelegate(tx *Transaction, b *Block, cfg *ChainConfig) error {
+	sender := tx.Sender().Address()
+	key := delegationKey{delegator: sender, validator: tx.To}
+
+	d, ok := s.Delegation(sender, tx.To)
+	if !ok {
+		return fmt.Errorf("账户(%s)没有委托给验证者(%s)", sender, tx.To)
+	}
+	if tx.Value == 0 || tx.Value > d.Amount {
+		return fmt.Errorf("撤回委托数量(%d)无效，当前委托为(%d)", tx.Value, d.Amount)
+	}
+
+	d, _ = s.delegation(key)
+	v, _ := s.validator(tx.To)
+	d.Amount -= tx.Value
+	v.Delegated -= tx.Value
+	s.addUnbonding(sender, tx.To, tx.Value, b, cfg)
+	s.cleanupDelegation(key)
+
+	return nil
+}
+
+// 执行领取奖励交易：将在验证者To处累积的委托奖励转入余额。
+func (s *State) applyClaimRewards(tx *Transaction) error {
+	sender := tx.Sender().Address()
+	key := delegationKey{delegator: sender, validator: tx.To}
+
+	d, ok := s.Delegation(sender, tx.To)
+	if !ok || d.Rewards == 0 {
+		return fmt.Errorf("账户(%s)在验证者(%s)处没有可领取的奖励", sender, tx.To)
+	}
+
+	s.account(sender).Balance += d.Rewards
+	d, _ = s.delegation(key)
+	d.Rewards = 0
+	s.cleanupDelegation(key)
+
+	return nil
+}
+
+// 添加一笔从验证者validator处解绑的记录，到期高度为当前区块高度加上解绑期。
+func (s *State) addUnbonding(owner, validator types.Address, amount uint64, b *Block, cfg *ChainConfig) {
+	s.unbondings = append(s.unbondings, &Unbonding{
+		Owner:            owner,
+		Validator:        validator,
+		Amount:           amount,
+		CreationHeight:   b.Height,
+		CompletionHeight: b.Height + cfg.Staking.UnbondingPeriod,
+	})
+	s.touch(owner)
+}
+
+// 委托数量和奖励都为0时删除委托。
+func (s *State) cleanupDelegation(key delegationKey) {
+	if d := s.delegations[key]; d.Amount == 0 && d.Rewards == 0 {
+		delete(s.delegations, key)
+		s.touch(key.delegator)
+	}
+}
+
+// 将到期的解绑记录返还到所有者的余额。
+func (s *State) releaseUnbondings(height uint32) {
+	pending := []*Unbonding{}
+	for _, u := range s.unbondings {
+		if u.CompletionHeight <= height {
+			s.account(u.Owner).Balance += u.Amount
+			continue
+		}
+		pending = append(pending, u)
+	}
+
+	s.unbondings = pending
+}
+
+// 将奖励分配给出块者及其委托人。
+// 出块者先抽取佣金，剩余部分按自我质押和各委托的比例分配；出块者的部分直接计入余额，委托人的部分累积为待领取的奖励。
+// 出块者不是验证者时，奖励全部计入其余额。
+func (s *State) distributeReward(proposer types.Address, amount uint64, cfg *ChainConfig) {
+	if amount == 0 {
+		return
+	}
+
+	v, ok := s.Validator(proposer)
+	if !ok || v.Stake+v.Delegated == 0 {
+		s.account(proposer).Balance += amount
+		return
+	}
+
+	commission := mulDiv(amount, cfg.Staking.CommissionRate, 10000)
+	rest := amount - commission
+	power := v.Stake + v.Delegated
+
+	distributed := uint64(0)
+	for _, d := range s.DelegationsTo(proposer) {
+		share := mulDiv(rest, d.Amount, power)
+		d, _ = s.delegation(delegationKey{delegator: d.Delegator, validator: proposer})
+		d.Rewards += share
+		distributed += share
+	}
+
+	s.account(proposer).Balance += amount - distributed // 佣金、自我质押部分以及舍入的余数
+}
+
+// 根据投票权重新计算活跃验证者集合：排除被监禁或自我质押不足的验证者，按投票权从高到低取前MaxValidators个。
+func (s *State) updateActiveSet(cfg *ChainConfig) {
+	candidates := []*ValidatorRecord{}
+	for _, v := range s.Validators() {
+		if v.Jailed || v.Stake < cfg.Staking.MinSelfBond || v.VotingPower() == 0 {
+			continue
+		}
+		candidates = append(candidates, v)
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].VotingPower() > candidates[j].VotingPower()
+	})
+
+	if len(candidates) == 0 {
+		return // 没有符合条件的候选者时保留原集合，避免链退化为任何人都可以出块
+	}
+
+	if cfg.Staking.MaxValidators > 0 && len(candidates) > cfg.Staking.MaxValidators {
+		candidates = candidates[:cfg.Staking.MaxValidators]
+	}
+
+	s.activeSet = []types.Address{}
+	for _, v := range candidates {
+		s.activeSet = append(s.activeSet, v.Address())
+	}
+}
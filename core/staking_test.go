@@ -0,0 +1,124 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/Luboy23/Blockchain_Project/crypto"
+	"github.com/Luboy23/Blockchain_Project/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// 测试质押、委托、奖励分配、纪元切换以及解绑期的完整流程。
+func TestStakingLifecycle(t *testing.T) {
+	v1 := crypto.GeneratePrivatekey()
+	a := crypto.GeneratePrivatekey()
+	d := crypto.GeneratePrivatekey()
+	small := crypto.GeneratePrivatekey()
+
+	cfg := DefaultChainConfig()
+	cfg.Staking = StakingConfig{
+		EpochLength:     2,
+		UnbondingPeriod: 2,
+		MaxValidators:   2,
+		MinSelfBond:     100,
+		CommissionRate:  1000,
+	}
+	cfg.Reward = RewardPolicy{
+		Type:          RewardFixed,
+		InitialReward: 1000,
+	}
+
+	bc, err := NewBlockchainFromGenesis(&Genesis{
+		Config: cfg,
+		Alloc: map[types.Address]uint64{
+			a.PublicKey().Address():     5000,
+			d.PublicKey().Address():     3000,
+			small.PublicKey().Address(): 100,
+		},
+		Validators: []GenesisValidator{
+			{PublicKey: v1.PublicKey(), Stake: 1000},
+		},
+	})
+	assert.Nil(t, err)
+
+	// 高度1：A质押成为验证者，D委托给V1，质押不足的账户也注册为验证者
+	assert.Nil(t, bc.AddBlock(signedBlock(t, bc, v1, []Transaction{
+		*signedTx(t, a, TxTypeBond, 0, types.Address{}, 2000, nil),
+		*signedTx(t, d, TxTypeDelegate, 0, v1.PublicKey().Address(), 1000, nil),
+		*signedTx(t, small, TxTypeBond, 0, types.Address{}, 50, nil),
+	})))
+
+	state := bc.State()
+	record, ok := state.Validator(a.PublicKey().Address())
+	assert.True(t, ok)
+	assert.Equal(t, uint64(2000), record.VotingPower())
+	assert.Equal(t, uint64(3000), state.Balance(a.PublicKey().Address()))
+
+	// 佣金100，剩余900按 1000:1000 分配给V1和D
+	delegation, ok := state.Delegation(d.PublicKey().Address(), v1.PublicKey().Address())
+	assert.True(t, ok)
+	assert.Equal(t, uint64(450), delegation.Rewards)
+	assert.Equal(t, uint64(550), state.Balance(v1.PublicKey().Address()))
+
+	// 纪元尚未结束，A还不能出块
+	assert.NotNil(t, bc.AddBlock(signedBlock(t, bc, a, nil)))
+
+	// 高度2：纪元边界，重新计算活跃验证者集合
+	assert.Nil(t, bc.AddBlock(signedBlock(t, bc, v1, nil)))
+	active := bc.State().ActiveValidators()
+	assert.Len(t, active, 2)
+	assert.False(t, bc.State().IsActiveValidator(small.PublicKey().Address()))
+
+	// 高度3：A出块，D领取奖励并撤回委托
+	assert.Nil(t, bc.AddBlock(signedBlock(t, bc, a, []Transaction{
+		*signedTx(t, d, TxTypeClaimRewards, 1, v1.PublicKey().Address(), 0, nil),
+		*signedTx(t, d, TxTypeUndelegate, 2, v1.PublicKey().Address(), 1000, nil),
+	})))
+
+	state = bc.State()
+	assert.Equal(t, uint64(2900), state.Balance(d.PublicKey().Address()))
+	assert.Equal(t, uint64(4000), state.Balance(a.PublicKey().Address()))
+	assert.Len(t, state.UnbondingsOf(d.PublicKey().Address()), 1)
+	_, ok = state.Delegation(d.PublicKey().Address(), v1.PublicKey().Address())
+	assert.False(t, ok)
+
+	// 解绑期内余额不变，到期后返还
+	assert.Nil(t, bc.AddBlock(signedBlock(t, bc, a, nil)))
+	assert.Equal(t, uint64(2900), bc.State().Balance(d.PublicKey().Address()))
+	assert.Nil(t, bc.AddBlock(signedBlock(t, bc, a, nil)))
+	assert.Equal(t, uint64(3900), bc.State().Balance(d.PublicKey().Address()))
+	assert.Len(t, bc.State().UnbondingsOf(d.PublicKey().Address()), 0)
+}
+
+// 测试Nonce不正确或余额不足的交易会导致区块无效。
+func TestStakingInvalidTransactions(t *testing.T) {
+	a := crypto.GeneratePrivatekey()
+	bc, err := NewBlockchainFromGenesis(&Genesis{
+		Alloc: map[types.Address]uint64{
+			a.PublicKey().Address(): 100,
+		},
+	})
+	assert.Nil(t, err)
+
+	proposer := crypto.GeneratePrivatekey()
+	assert.NotNil(t, bc.AddBlock(signedBlock(t, bc, proposer, []Transaction{
+		*signedTx(t, a, TxTypeBond, 1, types.Address{}, 10, nil),
+	})))
+	assert.NotNil(t, bc.AddBlock(signedBlock(t, bc, proposer, []Transaction{
+		*signedTx(t, a, TxTypeBond, 0, types.Address{}, 1000, nil),
+	})))
+	assert.NotNil(t, bc.AddBlock(signedBlock(t, bc, proposer, []Transaction{
+		*signedTx(t, a, TxTypeDelegate, 0, crypto.GeneratePrivatekey().PublicKey().Address(), 10, nil),
+	})))
+	assert.NotNil(t, bc.AddBlock(signedBlock(t, bc, proposer, []Transaction{
+		*signedTx(t, a, TxTypeUnbond, 0, types.Address{}, 10, nil),
+	})))
+
+	// 同一发送者的交易必须按Nonce顺序执行
+	assert.Nil(t, bc.AddBlock(signedBlock(t, bc, proposer, []Transaction{
+		*signedTx(t, a, TxTypeTransfer, 0, proposer.PublicKey().Address(), 10, nil),
+		*signedTx(t, a, TxTypeBond, 1, types.Address{}, 10, nil),
+	})))
+	assert.Equal(t, uint64(80), bc.State().Balance(a.PublicKey().Address()))
+	assert.Equal(t, uint64(2), bc.State().Nonce(a.PublicKey().Address()))
+}
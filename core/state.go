@@ -0,0 +1,357 @@
+package core
+
+import (
+	"bytes"
+	"sort"
+	"sync"
+
+	"github.com/Luboy23/Blockchain_Project/crypto"
+	"github.com/Luboy23/Blockchain_Project/trie"
+	"github.com/Luboy23/Blockchain_Project/types"
+)
+
+// 定义了一个账户的状态。
+type Account struct {
+	Balance uint64 // 可用余额
+	Nonce   uint64 // 下一笔交易必须使用的序号
+}
+
+// 记录一个验证者的质押和惩罚状态。
+type ValidatorRecord struct {
+	PublicKey crypto.PublicKey // 验证者用于签名区块的公钥
+	Stake     uint64           // 验证者自我质押的数量
+	Delegated uint64           // 委托给该验证者的总量
+	Jailed    bool             // 是否因作恶被监禁，被监禁的验证者不能再出块
+}
+
+// 返回验证者的地址。
+func (v *ValidatorRecord) Address() types.Address {
+	return v.PublicKey.Address()
+}
+
+// 返回验证者的投票权，等于自我质押与委托之和，被监禁的验证者没有投票权。
+func (v *ValidatorRecord) VotingPower() uint64 {
+	if v.Jailed {
+		return 0
+	}
+
+	return v.Stake + v.Delegated
+}
+
+// 记录一个委托人对一个验证者的委托。
+type Delegation struct {
+	Delegator types.Address // 委托人地址
+	Validator types.Address // 验证者地址
+	Amount    uint64        // 委托数量
+	Rewards   uint64        // 尚未领取的奖励
+}
+
+// 记录一笔处于解绑期的质押或委托，到期后返还到所有者的余额。
+type Unbonding struct {
+	Owner            types.Address // 所有者地址
+	Validator        types.Address // 解绑的质押或委托所属的验证者
+	Amount           uint64        // 解绑数量
+	CreationHeight   uint32        // 发起解绑的区块高度
+	CompletionHeight uint32        // 到期高度，执行该高度的区块时返还
+}
+
+// 记录一次已被链上处理的作恶行为。
+type Offence struct {
+	Offender   types.Address       // 作恶验证者的地址
+	Height     uint32              // 发生双重签名的高度
+	ReportedAt uint32              // 证据被打包进区块的高度
+	Reporter   types.Address       // 提交证据的账户地址
+	Burned     uint64              // 被销毁的质押数量（包括委托）
+	Jailed     bool                // 是否因此被监禁
+	Evidence   *DoubleSignEvidence // 双重签名证据
+}
+
+// 用于索引委托的键。
+type delegationKey struct {
+	delegator types.Address
+	validator types.Address
+}
+
+// 定义了区块执行后的链上状态。
+// 每个区块都对应一个独立的状态，执行区块时先复制父区块的状态，因此已提交的状态不会再被修改。
+// 状态中的记录在状态之间共享，修改时先替换为副本（见account、validator和delegation），并将所属地址标记为已修改，
+// 计算状态根时只需要更新这些地址在状态树中的叶子。
+type State struct {
+	accounts    map[types.Address]*Account          // 按地址索引的账户
+	validators  map[types.Address]*ValidatorRecord  // 按地址索引的验证者
+	delegations map[delegationKey]*Delegation       // 按委托人和验证者索引的委托
+	unbondings  []*Unbonding                        // 处于解绑期的质押和委托
+	activeSet   []types.Address                     // 当前纪元的活跃验证者集合，为空表示任何人都可以出块
+	offences    []*Offence                          // 按时间顺序记录的作恶行为
+	storage     map[types.Address]map[string][]byte // 按合约地址划分命名空间的键值存储
+	code        map[types.Address][]byte            // 已部署的合约代码
+
+	ownedStorage map[types.Address]struct{} // 已经从父状态复制、可以原地修改的存储命名空间
+
+	treeLock sync.Mutex                 // 保护tree和dirty，已提交的状态可能被并发地计算状态根或生成证明
+	tree     *trie.SparseMerkleTree     // 上一次计算状态根时的状态树
+	dirty    map[types.Address]struct{} // 上一次计算状态根之后发生变化的地址
+}
+
+// 创建一个空的状态。
+func NewState() *State {
+	return &State{
+		accounts:     make(map[types.Address]*Account),
+		validators:   make(map[types.Address]*ValidatorRecord),
+		delegations:  make(map[delegationKey]*Delegation),
+		unbondings:   []*Unbonding{},
+		activeSet:    []types.Address{},
+		offences:     []*Offence{},
+		storage:      make(map[types.Address]map[string][]byte),
+		code:         make(map[types.Address][]byte),
+		ownedStorage: make(map[types.Address]struct{}),
+		tree:         trie.New(),
+		dirty:        make(map[types.Address]struct{}),
+	}
+}
+
+// 复制状态，修改副本不会影响原状态。
+// 记录在修改时才复制，这里只复制索引；状态树的节点不可修改，副本与原状态共享。
+func (s *State) Copy() *State {
+	cp := NewState()
+
+	for addr, a := range s.accounts {
+		cp.accounts[addr] = a
+	}
+	for addr, v := range s.validators {
+		cp.validators[addr] = v
+	}
+	for key, d := range s.delegations {
+		cp.delegations[key] = d
+	}
+	cp.unbondings = append(cp.unbondings, s.unbondings...) // 解绑记录和作恶记录写入后不会原地修改（惩罚时替换为副本），可以共享
+	cp.activeSet = append(cp.activeSet, s.activeSet...)
+	cp.offences = append(cp.offences, s.offences...)
+	for addr, kv := range s.storage { // 命名空间在第一次写入时复制（见setStorage）
+		cp.storage[addr] = kv
+	}
+	for addr, code := range s.code { // 合约代码部署后不可修改，可以共享
+		cp.code[addr] = code
+	}
+
+	s.treeLock.Lock()
+	cp.tree = s.tree.Copy()
+	for addr := range s.dirty {
+		cp.dirty[addr] = struct{}{}
+	}
+	s.treeLock.Unlock()
+
+	return cp
+}
+
+// 将地址标记为已修改，下一次计算状态根时重新计算它的叶子。
+func (s *State) touch(addr types.Address) {
+	s.treeLock.Lock()
+	s.dirty[addr] = struct{}{}
+	s.treeLock.Unlock()
+}
+
+// 获取指定地址的账户，账户不存在时返回零值。
+func (s *State) Account(addr types.Address) Account {
+	if a, ok := s.accounts[addr]; ok {
+		return *a
+	}
+
+	return Account{}
+}
+
+// 获取指定地址的余额。
+func (s *State) Balance(addr types.Address) uint64 {
+	return s.Account(addr).Balance
+}
+
+// 获取指定地址下一笔交易应使用的Nonce。
+func (s *State) Nonce(addr types.Address) uint64 {
+	return s.Account(addr).Nonce
+}
+
+// 获取可修改的账户，不存在时创建。账户可能与其他状态共享，因此总是替换为副本。
+func (s *State) account(addr types.Address) *Account {
+	a := &Account{}
+	if old, ok := s.accounts[addr]; ok {
+		*a = *old
+	}
+	s.accounts[addr] = a
+	s.touch(addr)
+
+	return a
+}
+
+// 获取指定地址的验证者。
+func (s *State) Validator(addr types.Address) (*ValidatorRecord, bool) {
+	v, ok := s.validators[addr]
+	return v, ok
+}
+
+// 返回所有验证者，按地址排序以保证结果确定。
+func (s *State) Validators() []*ValidatorRecord {
+	validators := make([]*ValidatorRecord, 0, len(s.validators))
+	for _, v := range s.validators {
+		validators = append(validators, v)
+	}
+
+	sort.Slice(validators, func(i, j int) bool {
+		return addressLess(validators[i].Address(), validators[j].Address())
+	})
+
+	return validators
+}
+
+// 获取可修改的验证者，与account一样替换为副本。
+func (s *State) validator(addr types.Address) (*ValidatorRecord, bool) {
+	v, ok := s.validators[addr]
+	if !ok {
+		return nil, false
+	}
+
+	record := *v
+	s.validators[addr] = &record
+	s.touch(addr)
+
+	return &record, true
+}
+
+// 添加或替换一个验证者。
+func (s *State) SetValidator(v *ValidatorRecord) {
+	s.validators[v.Address()] = v
+	s.touch(v.Address())
+}
+
+// 返回当前纪元的活跃验证者集合，按投票权从高到低排序。
+func (s *State) ActiveValidators() []*ValidatorRecord {
+	active := make([]*ValidatorRecord, 0, len(s.activeSet))
+	for _, addr := range s.activeSet {
+		active = append(active, s.validators[addr])
+	}
+
+	return active
+}
+
+// 检查指定地址是否可以在当前纪元出块。活跃集合为空时任何人都可以出块。
+func (s *State) IsActiveValidator(addr types.Address) bool {
+	if len(s.activeSet) == 0 {
+		return true
+	}
+
+	for _, a := range s.activeSet {
+		if a == addr {
+			return true
+		}
+	}
+
+	return false
+}
+
+// 获取指定委托人对指定验证者的委托。
+func (s *State) Delegation(delegator, validator types.Address) (*Delegation, bool) {
+	d, ok := s.delegations[delegationKey{delegator: delegator, validator: validator}]
+	return d, ok
+}
+
+// 获取可修改的委托，与account一样替换为副本。委托属于委托人的状态。
+func (s *State) delegation(key delegationKey) (*Delegation, bool) {
+	d, ok := s.delegations[key]
+	if !ok {
+		return nil, false
+	}
+
+	delegation := *d
+	s.delegations[key] = &delegation
+	s.touch(key.delegator)
+
+	return &delegation, true
+}
+
+// 添加或替换一个委托。
+func (s *State) setDelegation(d *Delegation) {
+	s.delegations[delegationKey{delegator: d.Delegator, validator: d.Validator}] = d
+	s.touch(d.Delegator)
+}
+
+// 返回委托给指定验证者的所有委托，按委托人地址排序。
+func (s *State) DelegationsTo(validator types.Address) []*Delegation {
+	delegations := []*Delegation{}
+	for key, d := range s.delegations {
+		if key.validator == validator {
+			delegations = append(delegations, d)
+		}
+	}
+
+	sort.Slice(delegations, func(i, j int) bool {
+		return addressLess(delegations[i].Delegator, delegations[j].Delegator)
+	})
+
+	return delegations
+}
+
+// 返回指定地址所有处于解绑期的记录。
+func (s *State) UnbondingsOf(owner types.Address) []*Unbonding {
+	unbondings := []*Unbonding{}
+	for _, u := range s.unbondings {
+		if u.Owner == owner {
+			unbondings = append(unbondings, u)
+		}
+	}
+
+	return unbondings
+}
+
+// 返回所有已处理的作恶记录。
+func (s *State) Offences() []*Offence {
+	offences := make([]*Offence, len(s.offences))
+	copy(offences, s.offences)
+
+	return offences
+}
+
+// 读取指定合约存储中键对应的值，不存在时返回nil。
+func (s *State) StorageAt(addr types.Address, key []byte) []byte {
+	return s.storage[addr][string(key)]
+}
+
+// 返回指定地址的合约代码，普通账户返回nil。
+func (s *State) Code(addr types.Address) []byte {
+	return s.code[addr]
+}
+
+// 写入指定合约存储中的键值，值为空时删除该键。命名空间可能与父状态共享，第一次写入时复制。
+func (s *State) setStorage(addr types.Address, key, value []byte) {
+	namespace := s.storage[addr]
+	if _, ok := s.ownedStorage[addr]; !ok {
+		owned := make(map[string][]byte, len(namespace)+1)
+		for k, v := range namespace { // 存储的值写入后不会被原地修改，可以共享
+			owned[k] = v
+		}
+		namespace = owned
+		s.storage[addr] = namespace
+		s.ownedStorage[addr] = struct{}{}
+	}
+	s.touch(addr)
+
+	if len(value) == 0 {
+		delete(namespace, string(key))
+		return
+	}
+	namespace[string(key)] = value
+}
+
+// 检查指定验证者在指定高度的双重签名是否已经被处理过。
+func (s *State) hasOffence(offender types.Address, height uint32) bool {
+	for _, o := range s.offences {
+		if o.Offender == offender && o.Height == height {
+			return true
+		}
+	}
+
+	return false
+}
+
+// 按字节序比较两个地址。
+func addressLess(a, b types.Address) bool {
+	return bytes.Compare(a[:], b[:]) < 0
+}
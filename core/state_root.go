@@ -0,0 +1,298 @@
+package core
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"sort"
+
+	"github.com/Luboy23/Blockchain_Project/trie"
+	"github.com/Luboy23/Blockchain_Project/types"
+)
+
+// 系统叶子的键，保存活跃验证者集合和作恶记录等不属于单个地址的状态。
+// 账户叶子的键是地址的SHA-256哈希，不会与之冲突。
+var systemKey = types.Hash(sha256.Sum256([]byte("state/system")))
+
+// 返回地址在状态树中的键。
+func accountKey(addr types.Address) types.Hash {
+	return types.Hash(sha256.Sum256(addr.ToSlice()))
+}
+
+// 计算状态根：以地址为键、以账户的全部状态为值的稀疏默克尔树的根哈希。
+// 没有任何状态的地址不会出现在树中，因此创建又清空的账户不会影响状态根。
+func (s *State) Root() types.Hash {
+	return s.trie().Root()
+}
+
+// 返回状态树的一个副本。状态树随状态一起复制，这里只重新计算上一次计算之后发生变化的地址的叶子。
+func (s *State) trie() *trie.SparseMerkleTree {
+	s.treeLock.Lock()
+	defer s.treeLock.Unlock()
+
+	if len(s.dirty) > 0 {
+		delegations := make(map[types.Address][]*Delegation)
+		for key, d := range s.delegations {
+			if _, ok := s.dirty[key.delegator]; ok {
+				delegations[key.delegator] = append(delegations[key.delegator], d)
+			}
+		}
+		unbondings := make(map[types.Address][]*Unbonding)
+		for _, u := range s.unbondings {
+			if _, ok := s.dirty[u.Owner]; ok {
+				unbondings[u.Owner] = append(unbondings[u.Owner], u)
+			}
+		}
+
+		for addr := range s.dirty {
+			if a := s.accountSnapshot(addr, delegations[addr], unbondings[addr]); a != nil {
+				s.tree.Update(accountKey(addr), a.leaf())
+			} else {
+				s.tree.Delete(accountKey(addr))
+			}
+		}
+		s.dirty = make(map[types.Address]struct{})
+	}
+
+	if sys := s.systemSnapshot().hash(); sys != s.systemLeaf() {
+		s.tree.Update(systemKey, sys)
+	}
+
+	return s.tree.Copy()
+}
+
+// 返回状态树中系统叶子的值。
+func (s *State) systemLeaf() types.Hash {
+	v, _ := s.tree.Get(systemKey)
+	return v
+}
+
+// 返回状态中所有地址的完整状态，顺序不确定。
+func (s *State) accountSnapshots() []*AccountSnapshot {
+	addrs := make(map[types.Address]struct{})
+	for addr := range s.accounts {
+		addrs[addr] = struct{}{}
+	}
+	for addr := range s.validators {
+		addrs[addr] = struct{}{}
+	}
+	for addr := range s.storage {
+		addrs[addr] = struct{}{}
+	}
+	for addr := range s.code {
+		addrs[addr] = struct{}{}
+	}
+	delegations := make(map[types.Address][]*Delegation)
+	for key, d := range s.delegations {
+		addrs[key.delegator] = struct{}{}
+		delegations[key.delegator] = append(delegations[key.delegator], d)
+	}
+	unbondings := make(map[types.Address][]*Unbonding)
+	for _, u := range s.unbondings {
+		addrs[u.Owner] = struct{}{}
+		unbondings[u.Owner] = append(unbondings[u.Owner], u)
+	}
+
+	accounts := []*AccountSnapshot{}
+	for addr := range addrs {
+		if a := s.accountSnapshot(addr, delegations[addr], unbondings[addr]); a != nil {
+			accounts = append(accounts, a)
+		}
+	}
+
+	return accounts
+}
+
+// 返回一个地址的完整状态，地址没有任何状态时返回nil。delegations和unbondings是该地址作为委托人的委托和解绑记录。
+func (s *State) accountSnapshot(addr types.Address, delegations []*Delegation, unbondings []*Unbonding) *AccountSnapshot {
+	a := &AccountSnapshot{
+		Address:     addr,
+		Account:     s.Account(addr),
+		Code:        s.code[addr],
+		Delegations: delegations,
+		Unbondings:  unbondings,
+	}
+
+	kv := s.storage[addr] // 合约存储按键排序
+	keys := make([]string, 0, len(kv))
+	for k := range kv {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		a.Storage = append(a.Storage, StorageEntry{Key: []byte(k), Value: kv[k]})
+	}
+
+	if v, ok := s.validators[addr]; ok {
+		record := *v
+		a.Validator = &record
+	}
+
+	sort.Slice(a.Delegations, func(i, j int) bool { // 作为委托人的委托按验证者地址排序
+		return addressLess(a.Delegations[i].Validator, a.Delegations[j].Validator)
+	})
+
+	if a.Account == (Account{}) && len(a.Code) == 0 && len(a.Storage) == 0 && a.Validator == nil &&
+		len(a.Delegations) == 0 && len(a.Unbondings) == 0 {
+		return nil
+	}
+
+	return a
+}
+
+// 计算账户叶子的值，由地址、余额、Nonce和账户其余状态的哈希组成。
+func (a *AccountSnapshot) leaf() types.Hash {
+	return accountLeaf(a.Address, a.Account, a.extraHash())
+}
+
+// 根据地址、余额、Nonce和账户其余状态的哈希计算账户叶子的值。
+func accountLeaf(addr types.Address, account Account, extra types.Hash) types.Hash {
+	buf := &bytes.Buffer{}
+	buf.Write(addr.ToSlice())
+	binary.Write(buf, binary.BigEndian, account.Balance)
+	binary.Write(buf, binary.BigEndian, account.Nonce)
+	buf.Write(extra.ToSlice())
+
+	return types.Hash(sha256.Sum256(buf.Bytes()))
+}
+
+// 计算账户除余额和Nonce之外的状态的哈希，包括合约代码、合约存储、验证者记录、委托以及解绑记录。
+func (a *AccountSnapshot) extraHash() types.Hash {
+	buf := &bytes.Buffer{}
+
+	writeBytes(buf, a.Code)
+
+	binary.Write(buf, binary.BigEndian, uint32(len(a.Storage)))
+	for _, e := range a.Storage {
+		writeBytes(buf, e.Key)
+		writeBytes(buf, e.Value)
+	}
+
+	if v := a.Validator; v != nil {
+		buf.WriteByte(1)
+		writeBytes(buf, v.PublicKey.ToSlice())
+		binary.Write(buf, binary.BigEndian, v.Stake)
+		binary.Write(buf, binary.BigEndian, v.Delegated)
+		binary.Write(buf, binary.BigEndian, v.Jailed)
+	} else {
+		buf.WriteByte(0)
+	}
+
+	binary.Write(buf, binary.BigEndian, uint32(len(a.Delegations)))
+	for _, d := range a.Delegations {
+		buf.Write(d.Validator.ToSlice())
+		binary.Write(buf, binary.BigEndian, d.Amount)
+		binary.Write(buf, binary.BigEndian, d.Rewards)
+	}
+
+	binary.Write(buf, binary.BigEndian, uint32(len(a.Unbondings)))
+	for _, u := range a.Unbondings {
+		buf.Write(u.Validator.ToSlice())
+		binary.Write(buf, binary.BigEndian, u.Amount)
+		binary.Write(buf, binary.BigEndian, u.CreationHeight)
+		binary.Write(buf, binary.BigEndian, u.CompletionHeight)
+	}
+
+	return types.Hash(sha256.Sum256(buf.Bytes()))
+}
+
+// 返回不属于单个地址的状态。
+func (s *State) systemSnapshot() *SystemSnapshot {
+	sys := &SystemSnapshot{
+		ActiveSet: append([]types.Address{}, s.activeSet...),
+	}
+	for _, o := range s.offences {
+		offence := *o
+		offence.Evidence = nil // 证据不参与状态根的计算，也不包含在快照中
+		sys.Offences = append(sys.Offences, &offence)
+	}
+
+	return sys
+}
+
+// 计算系统叶子的值，包括活跃验证者集合和作恶记录。
+func (sys *SystemSnapshot) hash() types.Hash {
+	buf := &bytes.Buffer{}
+
+	binary.Write(buf, binary.BigEndian, uint32(len(sys.ActiveSet)))
+	for _, addr := range sys.ActiveSet {
+		buf.Write(addr.ToSlice())
+	}
+
+	binary.Write(buf, binary.BigEndian, uint32(len(sys.Offences)))
+	for _, o := range sys.Offences {
+		buf.Write(o.Offender.ToSlice())
+		binary.Write(buf, binary.BigEndian, o.Height)
+		binary.Write(buf, binary.BigEndian, o.ReportedAt)
+		buf.Write(o.Reporter.ToSlice())
+		binary.Write(buf, binary.BigEndian, o.Burned)
+		binary.Write(buf, binary.BigEndian, o.Jailed)
+	}
+
+	return types.Hash(sha256.Sum256(buf.Bytes()))
+}
+
+// 单个账户的默克尔证明，可以在只知道状态根的情况下验证账户的余额和Nonce。
+type AccountProof struct {
+	Address   types.Address // 账户地址
+	Account   Account       // 账户的余额和Nonce
+	ExtraHash types.Hash    // 账户其余状态的哈希
+	Exists    bool          // 账户是否存在于状态树中，为false时证明账户不存在
+	Proof     *trie.Proof   // 状态树中的证明
+}
+
+// 生成指定账户的证明。
+func (s *State) ProveAccount(addr types.Address) *AccountProof {
+	p := &AccountProof{
+		Address: addr,
+		Proof:   s.trie().Prove(accountKey(addr)),
+	}
+	if a := s.accountSnapshot(addr, s.delegationsFrom(addr), s.UnbondingsOf(addr)); a != nil {
+		p.Exists = true
+		p.Account = a.Account
+		p.ExtraHash = a.extraHash()
+	}
+
+	return p
+}
+
+// 根据状态根验证账户证明。
+func (p *AccountProof) Verify(root types.Hash) error {
+	if p.Proof == nil {
+		return fmt.Errorf("账户(%s)的证明为空", p.Address)
+	}
+
+	if !p.Exists && p.Account != (Account{}) {
+		return fmt.Errorf("不存在的账户(%s)不能有余额或Nonce", p.Address)
+	}
+
+	leaf := accountLeaf(p.Address, p.Account, p.ExtraHash)
+	if err := p.Proof.Verify(root, accountKey(p.Address), leaf, p.Exists); err != nil {
+		return fmt.Errorf("账户(%s)的证明无效：%s", p.Address, err)
+	}
+
+	return nil
+}
+
+// 返回指定委托人的所有委托。
+func (s *State) delegationsFrom(delegator types.Address) []*Delegation {
+	delegations := []*Delegation{}
+	for key, d := range s.delegations {
+		if key.delegator == delegator {
+			delegations = append(delegations, d)
+		}
+	}
+
+	return delegations
+}
+
+// 在指定区块执行后的状态上生成账户证明，可以用该区块头中的状态根验证。
+func (bc *Blockchain) ProveAccount(blockHash types.Hash, addr types.Address) (*AccountProof, error) {
+	state, err := bc.StateAt(blockHash)
+	if err != nil {
+		return nil, err
+	}
+
+	return state.ProveAccount(addr), nil
+}
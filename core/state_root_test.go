@@ -0,0 +1,146 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/Luboy23/Blockchain_Project/crypto"
+	"github.com/Luboy23/Blockchain_Project/trie"
+	"github.com/Luboy23/Blockchain_Project/types"
+	"github.com/Luboy23/Blockchain_Project/vm"
+	"github.com/stretchr/testify/assert"
+)
+
+// 测试区块头中的状态根与执行后的状态一致，状态根不正确的区块被拒绝。
+func TestStateRoot(t *testing.T) {
+	validatorKey := crypto.GeneratePrivatekey()
+	userKey := crypto.GeneratePrivatekey()
+	user := userKey.PublicKey().Address()
+	g := &Genesis{
+		Alloc: map[types.Address]uint64{user: 1000},
+		Validators: []GenesisValidator{
+			{PublicKey: validatorKey.PublicKey(), Stake: 100},
+		},
+	}
+	bc, err := NewBlockchainFromGenesis(g)
+	assert.Nil(t, err)
+	assert.Equal(t, bc.State().Root(), bc.CurrentHeader().StateRoot)
+
+	// 初始余额不同的创世状态有不同的状态根
+	g.Alloc[user] = 999
+	assert.NotEqual(t, bc.CurrentHeader().StateRoot, g.ToBlock().StateRoot)
+
+	tx := signedTx(t, userKey, TxTypeTransfer, 0, crypto.GeneratePrivatekey().PublicKey().Address(), 10, nil)
+	block, _, err := bc.BuildBlock(bc.CurrentHeader(), validatorKey.PublicKey(), []*Transaction{tx})
+	assert.Nil(t, err)
+
+	// 篡改状态根的区块被拒绝
+	forged := *block.Header
+	forged.StateRoot = types.RandomHash()
+	bad := NewBlock(&forged, block.Transactions)
+	assert.Nil(t, bad.Sign(validatorKey))
+	assert.NotNil(t, bc.AddBlock(bad))
+
+	assert.Nil(t, block.Sign(validatorKey))
+	assert.Nil(t, bc.AddBlock(block))
+	assert.Equal(t, uint32(1), bc.Height())
+	assert.Equal(t, bc.State().Root(), bc.CurrentHeader().StateRoot)
+}
+
+// 测试账户证明可以用区块头中的状态根验证，篡改账户内容后验证失败。
+func TestAccountProof(t *testing.T) {
+	validatorKey := crypto.GeneratePrivatekey()
+	userKey := crypto.GeneratePrivatekey()
+	user := userKey.PublicKey().Address()
+	bc, err := NewBlockchainFromGenesis(&Genesis{
+		Alloc: map[types.Address]uint64{user: 1000},
+		Validators: []GenesisValidator{
+			{PublicKey: validatorKey.PublicKey(), Stake: 100},
+		},
+	})
+	assert.Nil(t, err)
+
+	to := crypto.GeneratePrivatekey().PublicKey().Address()
+	tx := signedTx(t, userKey, TxTypeTransfer, 0, to, 10, nil)
+	assert.Nil(t, bc.AddBlock(signedBlock(t, bc, validatorKey, []Transaction{*tx})))
+	header := bc.CurrentHeader()
+
+	proof, err := bc.ProveAccount(BlockHasher{}.Hash(header), user)
+	assert.Nil(t, err)
+	assert.True(t, proof.Exists)
+	assert.Equal(t, Account{Balance: 990, Nonce: 1}, proof.Account)
+	assert.Nil(t, proof.Verify(header.StateRoot))
+
+	// 其他区块的状态根不能验证该证明
+	genesis, err := bc.GetHeader(0)
+	assert.Nil(t, err)
+	assert.NotNil(t, proof.Verify(genesis.StateRoot))
+
+	// 篡改余额后验证失败
+	proof.Account.Balance = 1000
+	assert.NotNil(t, proof.Verify(header.StateRoot))
+
+	// 验证者账户的证明同样有效
+	proof, err = bc.ProveAccount(BlockHasher{}.Hash(header), validatorKey.PublicKey().Address())
+	assert.Nil(t, err)
+	assert.True(t, proof.Exists)
+	assert.Nil(t, proof.Verify(header.StateRoot))
+
+	// 不存在的账户可以证明不存在，但不能伪造余额
+	proof, err = bc.ProveAccount(BlockHasher{}.Hash(header), crypto.GeneratePrivatekey().PublicKey().Address())
+	assert.Nil(t, err)
+	assert.False(t, proof.Exists)
+	assert.Nil(t, proof.Verify(header.StateRoot))
+
+	proof.Account.Balance = 1
+	assert.NotNil(t, proof.Verify(header.StateRoot))
+	proof.Exists = true
+	assert.NotNil(t, proof.Verify(header.StateRoot))
+}
+
+// 测试增量计算的状态根与重新构建整棵状态树的结果一致，并且执行区块不会修改父区块的状态。
+func TestIncrementalStateRoot(t *testing.T) {
+	validatorKey := crypto.GeneratePrivatekey()
+	userKey := crypto.GeneratePrivatekey()
+	user := userKey.PublicKey().Address()
+	validator := validatorKey.PublicKey().Address()
+	cfg := DefaultChainConfig()
+	cfg.Reward = RewardPolicy{Type: RewardFixed, InitialReward: 50}
+	bc, err := NewBlockchainFromGenesis(&Genesis{
+		Config: cfg,
+		Alloc:  map[types.Address]uint64{user: 10000},
+		Validators: []GenesisValidator{
+			{PublicKey: validatorKey.PublicKey(), Stake: 1000},
+		},
+	})
+	assert.Nil(t, err)
+
+	store := vm.NewProgram(vm.Push([]byte("k")), vm.Push([]byte("v")), []byte{byte(vm.SSTORE)})
+	for _, txx := range [][]Transaction{
+		{*signedTx(t, userKey, TxTypeDelegate, 0, validator, 500, nil)},
+		{*signedTx(t, userKey, TxTypeData, 1, types.Address{}, 0, store)},
+		{*signedTx(t, userKey, TxTypeUndelegate, 2, validator, 200, nil), *signedTx(t, validatorKey, TxTypeUnbond, 0, types.Address{}, 100, nil)},
+		{*signedTx(t, userKey, TxTypeClaimRewards, 3, validator, 0, nil)},
+		{*signedTx(t, userKey, TxTypeTransfer, 4, crypto.GeneratePrivatekey().PublicKey().Address(), 10, nil)},
+	} {
+		parent := bc.State()
+		parentRoot := parent.Root()
+		assert.Nil(t, bc.AddBlock(signedBlock(t, bc, validatorKey, txx)))
+
+		state := bc.State()
+		full := trie.New()
+		for _, a := range state.accountSnapshots() {
+			full.Update(accountKey(a.Address), a.leaf())
+		}
+		full.Update(systemKey, state.systemSnapshot().hash())
+		assert.Equal(t, full.Root(), state.Root())
+
+		// 父状态重新构建的状态树与执行子区块之前一致
+		rebuilt := trie.New()
+		for _, a := range parent.accountSnapshots() {
+			rebuilt.Update(accountKey(a.Address), a.leaf())
+		}
+		rebuilt.Update(systemKey, parent.systemSnapshot().hash())
+		assert.Equal(t, parentRoot, rebuilt.Root())
+	}
+	assert.Equal(t, []byte("v"), bc.State().StorageAt(vm.CodeAddress(vm.CodeFromData(store)), []byte("k")))
+}
@@ -0,0 +1,235 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"math/bits"
+
+	"github.com/Luboy23/Blockchain_Project/types"
+)
+
+// 交易的Nonce大于发送者当前的Nonce时返回的错误。中间缺少的交易到达后，该交易可能变为可以执行。
+var ErrNonceTooHigh = errors.New("交易的Nonce超前于账户")
+
+// 交易的Nonce小于发送者当前的Nonce时返回的错误，该交易已经不可能被执行。
+var ErrNonceTooLow = errors.New("交易的Nonce已被使用")
+
+// 记录一个区块发放给出块者的奖励和交易费。
+type BlockReceipt struct {
+	BlockHash types.Hash    // 区块哈希
+	Height    uint32        // 区块高度
+	Proposer  types.Address // 出块者地址
+	Reward    uint64        // 按奖励策略发放的区块奖励
+	Fees      uint64        // 区块中所有交易的交易费之和，包括燃料费
+	GasUsed   uint64        // 区块中所有交易实际消耗的燃料之和
+	Receipts  []*Receipt    // 区块中每笔交易的收据
+}
+
+// 返回出块者获得的总收入。
+func (r *BlockReceipt) Total() uint64 {
+	return r.Reward + r.Fees
+}
+
+// 在父区块的状态上执行区块，返回区块执行后的新状态以及区块收据。
+// 执行顺序为：返还到期的解绑、依次执行交易并收取交易费、发放区块奖励和交易费、在纪元边界更新活跃验证者集合。
+// 任何一笔交易执行失败、交易的燃料上限超过区块剩余的燃料，或收据根与区块头不符，整个区块都被视为无效。
+// 字节码执行出错（包括燃料耗尽）不会使交易无效，只是不提交其写入。
+func ExecuteBlock(parent *State, b *Block, cfg *ChainConfig) (*State, *BlockReceipt, error) {
+	state, receipt, err := applyBlock(parent, b, cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if root := CalculateReceiptsRoot(receipt.Receipts); root != b.ReceiptsRoot {
+		return nil, nil, fmt.Errorf("区块(%s)的收据根(%s)不正确，应为(%s)", receipt.BlockHash, b.ReceiptsRoot, root)
+	}
+
+	return state, receipt, nil
+}
+
+// 在父区块的状态上执行区块中的交易并生成收据，不检查区块头中的收据根。
+func applyBlock(parent *State, b *Block, cfg *ChainConfig) (*State, *BlockReceipt, error) {
+	state := parent.Copy()
+	state.beginBlock(b)
+
+	receipt := &BlockReceipt{
+		BlockHash: b.Hash(BlockHasher{}),
+		Height:    b.Height,
+		Proposer:  b.Validator.Address(),
+		Reward:    cfg.Reward.RewardAt(b.Height),
+	}
+
+	for i := range b.Transactions {
+		tx := &b.Transactions[i]
+		if gas, ok := tx.MaxGas(); !ok || gas > b.GasLimit-receipt.GasUsed {
+			return nil, nil, fmt.Errorf("交易(%s)最多消耗的燃料(%d)超过区块剩余的燃料(%d)", tx.Hash(TxHasher{}), gas, b.GasLimit-receipt.GasUsed)
+		}
+
+		result, err := state.applyTransaction(tx, b, cfg)
+		if err != nil {
+			return nil, nil, fmt.Errorf("交易(%s)执行失败：%s", tx.Hash(TxHasher{}), err)
+		}
+		receipt.Fees += tx.Fee + result.GasUsed*tx.GasPrice
+		receipt.GasUsed += result.GasUsed
+
+		r := newReceipt(tx, i, result, receipt.GasUsed)
+		r.BlockHash = receipt.BlockHash
+		r.BlockHeight = b.Height
+		receipt.Receipts = append(receipt.Receipts, r)
+	}
+
+	state.endBlock(b, receipt, cfg)
+
+	return state, receipt, nil
+}
+
+// 在执行交易之前处理区块级别的状态变化。
+func (s *State) beginBlock(b *Block) {
+	s.releaseUnbondings(b.Height)
+}
+
+// 在执行交易之后处理区块级别的状态变化。
+func (s *State) endBlock(b *Block, receipt *BlockReceipt, cfg *ChainConfig) {
+	s.distributeReward(receipt.Proposer, receipt.Total(), cfg) // 区块奖励和交易费一起发放给出块者及其委托人
+
+	if cfg.Staking.EpochLength > 0 && b.Height%cfg.Staking.EpochLength == 0 {
+		s.updateActiveSet(cfg) // 纪元边界，根据最新的质押重新计算活跃验证者集合
+	}
+}
+
+// 检查交易的Nonce并预扣交易费和全部燃料费，根据交易类型对状态执行相应的转换，成功后增加发送者的Nonce，
+// 退还未使用的燃料费并返回执行结果。执行结果中的燃料包括固有燃料，固有燃料不会被退还。
+// 每种交易在修改状态之前都会完成所有检查，执行失败时退还预扣的费用，因此不会留下部分修改。
+func (s *State) applyTransaction(tx *Transaction, b *Block, cfg *ChainConfig) (*ExecutionResult, error) {
+	sender := tx.Sender().Address()
+	if nonce := s.Nonce(sender); tx.Nonce > nonce {
+		return nil, fmt.Errorf("%w：交易的Nonce(%d)大于账户(%s)当前的Nonce(%d)", ErrNonceTooHigh, tx.Nonce, sender, nonce)
+	} else if tx.Nonce < nonce {
+		return nil, fmt.Errorf("%w：交易的Nonce(%d)小于账户(%s)当前的Nonce(%d)", ErrNonceTooLow, tx.Nonce, sender, nonce)
+	}
+
+	cost, ok := tx.MaxCost()
+	if !ok {
+		return nil, fmt.Errorf("交易的费用溢出")
+	}
+	if s.Balance(sender) < cost {
+		return nil, fmt.Errorf("账户(%s)余额不足以支付交易费(%d)", sender, cost)
+	}
+	s.account(sender).Balance -= cost
+
+	result := &ExecutionResult{}
+	var err error
+	switch tx.Type {
+	case TxTypeData:
+		result = s.applyData(tx) // 字节码执行出错时写入已被丢弃，燃料照常收取
+	case TxTypeEvidence:
+		err = s.applyEvidence(tx, b, cfg)
+	case TxTypeTransfer:
+		err = s.applyTransfer(tx)
+	case TxTypeBond:
+		err = s.applyBond(tx)
+	case TxTypeUnbond:
+		err = s.applyUnbond(tx, b, cfg)
+	case TxTypeDelegate:
+		err = s.applyDelegate(tx)
+	case TxTypeUndelegate:
+		err = s.applyUndelegate(tx, b, cfg)
+	case TxTypeClaimRewards:
+		err = s.applyClaimRewards(tx)
+	case TxTypeDeploy:
+		result, err = s.applyDeploy(tx)
+	case TxTypeCall:
+		result, err = s.applyCall(tx)
+	default:
+		err = fmt.Errorf("未知的交易类型(%d)", tx.Type)
+	}
+	if err != nil {
+		s.account(sender).Balance += cost // 退还预扣的费用
+		return nil, err
+	}
+
+	s.account(sender).Balance += (tx.GasLimit - result.GasUsed) * tx.GasPrice // 退还未使用的燃料费
+	result.GasUsed += tx.IntrinsicGas()
+	s.account(sender).Nonce++
+
+	return result, nil
+}
+
+// 执行转账交易：从发送者余额中扣除Value并计入接收者余额。
+func (s *State) applyTransfer(tx *Transaction) error {
+	sender := tx.Sender().Address()
+	if s.Balance(sender) < tx.Value {
+		return fmt.Errorf("账户(%s)余额不足以转账(%d)", sender, tx.Value)
+	}
+
+	s.account(sender).Balance -= tx.Value
+	s.account(tx.To).Balance += tx.Value
+
+	return nil
+}
+
+// 执行双重签名证据交易：按照惩罚参数销毁作恶验证者及其委托人的部分质押（包括作恶之后发起的解绑）、监禁验证者，并记录作恶行为。
+func (s *State) applyEvidence(tx *Transaction, b *Block, cfg *ChainConfig) error {
+	ev, err := tx.Evidence()
+	if err != nil {
+		return err
+	}
+
+	offender := ev.Offender()
+	if _, ok := s.Validator(offender); !ok {
+		return fmt.Errorf("作恶者(%s)不是验证者", offender)
+	}
+
+	if s.hasOffence(offender, ev.Height()) {
+		return fmt.Errorf("验证者(%s)在高度(%d)的双重签名已经被处罚过", offender, ev.Height())
+	}
+
+	v, _ := s.validator(offender)
+
+	burned := mulDiv(v.Stake, cfg.Slashing.BurnRate, 10000) // 按比例销毁自我质押
+	v.Stake -= burned
+	for _, d := range s.DelegationsTo(offender) { // 委托人承担同样比例的惩罚
+		amount := mulDiv(d.Amount, cfg.Slashing.BurnRate, 10000)
+		d, _ = s.delegation(delegationKey{delegator: d.Delegator, validator: offender})
+		d.Amount -= amount
+		v.Delegated -= amount
+		burned += amount
+	}
+	// 不早于作恶高度发起的解绑在作恶时仍处于质押中，同样承担惩罚，避免在证据上链之前抢先解绑逃避处罚
+	for i, u := range s.unbondings {
+		if u.Validator != offender || u.CreationHeight < ev.Height() {
+			continue
+		}
+		amount := mulDiv(u.Amount, cfg.Slashing.BurnRate, 10000)
+		unbonding := *u // 解绑记录在状态之间共享，替换为副本而不是原地修改
+		unbonding.Amount -= amount
+		s.unbondings[i] = &unbonding
+		s.touch(u.Owner)
+		burned += amount
+	}
+	if cfg.Slashing.Jail {
+		v.Jailed = true
+	}
+
+	s.offences = append(s.offences, &Offence{
+		Offender:   offender,
+		Height:     ev.Height(),
+		ReportedAt: b.Height,
+		Reporter:   tx.Sender().Address(),
+		Burned:     burned,
+		Jailed:     cfg.Slashing.Jail,
+		Evidence:   ev,
+	})
+
+	return nil
+}
+
+// 计算a*b/c，中间结果使用128位避免溢出，结果超过uint64时截断为最大值。
+func mulDiv(a, b, c uint64) uint64 {
+	hi, lo := bits.Mul64(a, b)
+	if hi >= c {
+		return ^uint64(0)
+	}
+	q, _ := bits.Div64(hi, lo, c)
+	return q
+}
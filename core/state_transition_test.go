@@ -0,0 +1,300 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/Luboy23/Blockchain_Project/crypto"
+	"github.com/Luboy23/Blockchain_Project/types"
+	"github.com/Luboy23/Blockchain_Project/vm"
+	"github.com/stretchr/testify/assert"
+)
+
+// 测试证据交易会销毁作恶验证者的部分质押、监禁验证者并记录作恶行为。
+func TestSlashDoubleSign(t *testing.T) {
+	validatorKey := crypto.GeneratePrivatekey()
+	proposerKey := crypto.GeneratePrivatekey()
+	bc, err := NewBlockchainFromGenesis(&Genesis{
+		Validators: []GenesisValidator{
+			{PublicKey: validatorKey.PublicKey(), Stake: 10000},
+			{PublicKey: proposerKey.PublicKey(), Stake: 10000},
+		},
+	})
+	assert.Nil(t, err)
+
+	assert.Nil(t, bc.AddBlock(signedBlock(t, bc, proposerKey, nil)))
+
+	reporterKey := crypto.GeneratePrivatekey()
+	tx := signedTx(t, reporterKey, TxTypeEvidence, 0, types.Address{}, 0, evidenceData(t, doubleSignEvidence(t, validatorKey, 1)))
+	assert.Nil(t, bc.AddBlock(signedBlock(t, bc, proposerKey, []Transaction{*tx})))
+
+	record, ok := bc.State().Validator(validatorKey.PublicKey().Address())
+	assert.True(t, ok)
+	assert.Equal(t, uint64(9500), record.Stake)
+	assert.True(t, record.Jailed)
+
+	offences := bc.OffencesOf(validatorKey.PublicKey().Address())
+	assert.Len(t, offences, 1)
+	assert.Equal(t, uint32(1), offences[0].Height)
+	assert.Equal(t, uint32(2), offences[0].ReportedAt)
+	assert.Equal(t, reporterKey.PublicKey().Address(), offences[0].Reporter)
+	assert.Equal(t, uint64(500), offences[0].Burned)
+
+	// 父区块的状态没有被修改
+	genesisState, err := bc.StateAt(BlockHasher{}.Hash(bc.headers[0]))
+	assert.Nil(t, err)
+	record, _ = genesisState.Validator(validatorKey.PublicKey().Address())
+	assert.Equal(t, uint64(10000), record.Stake)
+
+	// 被监禁的验证者不能再出块
+	assert.NotNil(t, bc.AddBlock(signedBlock(t, bc, validatorKey, nil)))
+
+	// 同一次双重签名不能被处罚两次
+	dup := signedTx(t, crypto.GeneratePrivatekey(), TxTypeEvidence, 0, types.Address{}, 0, evidenceData(t, doubleSignEvidence(t, validatorKey, 1)))
+	assert.NotNil(t, bc.AddBlock(signedBlock(t, bc, proposerKey, []Transaction{*dup})))
+
+	// 构建区块时会跳过无法执行的证据交易
+	block, invalid, err := bc.BuildBlock(bc.CurrentHeader(), proposerKey.PublicKey(), []*Transaction{dup})
+	assert.Nil(t, err)
+	assert.Len(t, block.Transactions, 0)
+	assert.Len(t, invalid, 1)
+}
+
+// 测试证据交易同样惩罚不早于作恶高度发起的解绑，更早的解绑不受影响。
+func TestSlashUnbonding(t *testing.T) {
+	validatorKey := crypto.GeneratePrivatekey()
+	proposerKey := crypto.GeneratePrivatekey()
+	delegatorKey := crypto.GeneratePrivatekey()
+	bc, err := NewBlockchainFromGenesis(&Genesis{
+		Alloc: map[types.Address]uint64{
+			delegatorKey.PublicKey().Address(): 1000,
+		},
+		Validators: []GenesisValidator{
+			{PublicKey: validatorKey.PublicKey(), Stake: 10000},
+			{PublicKey: proposerKey.PublicKey(), Stake: 10000},
+		},
+	})
+	assert.Nil(t, err)
+	validator := validatorKey.PublicKey().Address()
+	delegator := delegatorKey.PublicKey().Address()
+
+	// 高度1：作恶之前解绑2000，委托人委托1000
+	assert.Nil(t, bc.AddBlock(signedBlock(t, bc, proposerKey, []Transaction{
+		*signedTx(t, validatorKey, TxTypeUnbond, 0, types.Address{}, 2000, nil),
+		*signedTx(t, delegatorKey, TxTypeDelegate, 0, validator, 1000, nil),
+	})))
+	// 高度2：验证者在该高度双重签名
+	assert.Nil(t, bc.AddBlock(signedBlock(t, bc, proposerKey, nil)))
+	// 高度3：证据上链之前，验证者解绑4000，委托人撤回全部委托
+	assert.Nil(t, bc.AddBlock(signedBlock(t, bc, proposerKey, []Transaction{
+		*signedTx(t, validatorKey, TxTypeUnbond, 1, types.Address{}, 4000, nil),
+		*signedTx(t, delegatorKey, TxTypeUndelegate, 1, validator, 1000, nil),
+	})))
+
+	tx := signedTx(t, crypto.GeneratePrivatekey(), TxTypeEvidence, 0, types.Address{}, 0, evidenceData(t, doubleSignEvidence(t, validatorKey, 2)))
+	assert.Nil(t, bc.AddBlock(signedBlock(t, bc, proposerKey, []Transaction{*tx})))
+
+	state := bc.State()
+	record, _ := state.Validator(validator)
+	assert.Equal(t, uint64(3800), record.Stake)
+
+	unbondings := state.UnbondingsOf(validator)
+	assert.Len(t, unbondings, 2)
+	assert.Equal(t, uint64(2000), unbondings[0].Amount) // 作恶之前发起的解绑不受惩罚
+	assert.Equal(t, uint64(3800), unbondings[1].Amount)
+
+	unbondings = state.UnbondingsOf(delegator)
+	assert.Len(t, unbondings, 1)
+	assert.Equal(t, uint64(950), unbondings[0].Amount)
+
+	offences := bc.OffencesOf(validator)
+	assert.Len(t, offences, 1)
+	assert.Equal(t, uint64(200+200+50), offences[0].Burned)
+
+	// 父区块状态中的解绑记录没有被修改
+	parent, err := bc.StateAt(bc.CurrentHeader().PrevBlockHash)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(4000), parent.UnbondingsOf(validator)[1].Amount)
+}
+
+// 测试区块验证器拒绝无效的证据。
+func TestValidateInvalidEvidence(t *testing.T) {
+	validatorKey := crypto.GeneratePrivatekey()
+	bc, err := NewBlockchainFromGenesis(&Genesis{
+		Validators: []GenesisValidator{
+			{PublicKey: validatorKey.PublicKey(), Stake: 10000},
+		},
+	})
+	assert.Nil(t, err)
+
+	// 两个区块头来自不同的验证者
+	ev := doubleSignEvidence(t, validatorKey, 0)
+	other := randomBlock(0, types.Hash{})
+	assert.Nil(t, other.Sign(crypto.GeneratePrivatekey()))
+	ev.B = NewSignedHeader(other)
+
+	tx := signedTx(t, crypto.GeneratePrivatekey(), TxTypeEvidence, 0, types.Address{}, 0, evidenceData(t, ev))
+	assert.NotNil(t, bc.AddBlock(signedBlock(t, bc, validatorKey, []Transaction{*tx})))
+
+	// 证据的高度不能晚于区块
+	tx = signedTx(t, crypto.GeneratePrivatekey(), TxTypeEvidence, 0, types.Address{}, 0, evidenceData(t, doubleSignEvidence(t, validatorKey, 5)))
+	assert.NotNil(t, bc.AddBlock(signedBlock(t, bc, validatorKey, []Transaction{*tx})))
+	assert.Equal(t, uint32(0), bc.Height())
+
+	// 有效的区块可以上链
+	assert.Nil(t, bc.AddBlock(signedBlock(t, bc, validatorKey, nil)))
+}
+
+// 在当前链头之后创建一个包含指定交易并由指定私钥签名的区块。
+// 交易能够执行时填入正确的收据根，否则保留零值，由调用者断言区块无效。
+func signedBlock(t *testing.T, bc *Blockchain, priKey crypto.PrivateKey, txx []Transaction) *Block {
+	b := NewBlockFromPrevHeader(bc.CurrentHeader(), txx)
+	fillRoots(bc, b, priKey.PublicKey())
+	assert.Nil(t, b.Sign(priKey))
+
+	return b
+}
+
+// 在父区块的状态上按proposer出块执行区块，填充收据根和状态根。父区块未知或执行失败时不填充。
+func fillRoots(bc *Blockchain, b *Block, proposer crypto.PublicKey) {
+	parent, err := bc.StateAt(b.PrevBlockHash)
+	if err != nil {
+		return
+	}
+
+	probe := NewBlock(b.Header, b.Transactions) // 在副本上执行，避免缓存尚未确定的区块哈希
+	probe.Validator = proposer
+	if state, receipt, err := applyBlock(parent, probe, bc.Config()); err == nil {
+		b.ReceiptsRoot = CalculateReceiptsRoot(receipt.Receipts)
+		b.StateRoot = state.Root()
+	}
+}
+
+// 让指定验证者在指定高度签名两个不同的区块头，构造双重签名证据。
+func doubleSignEvidence(t *testing.T, priKey crypto.PrivateKey, height uint32) *DoubleSignEvidence {
+	a := randomBlock(height, types.Hash{})
+	assert.Nil(t, a.Sign(priKey))
+	b := randomBlock(height, types.Hash{})
+	b.Timestamp++
+	assert.Nil(t, b.Sign(priKey))
+
+	return &DoubleSignEvidence{
+		A: NewSignedHeader(a),
+		B: NewSignedHeader(b),
+	}
+}
+
+// 将双重签名证据编码为证据交易的数据。
+func evidenceData(t *testing.T, ev *DoubleSignEvidence) []byte {
+	tx, err := NewEvidenceTransaction(ev)
+	assert.Nil(t, err)
+
+	return tx.Data
+}
+
+// 测试不同的区块奖励策略。
+func TestRewardPolicy(t *testing.T) {
+	assert.Equal(t, uint64(0), RewardPolicy{}.RewardAt(10))
+
+	fixed := RewardPolicy{Type: RewardFixed, InitialReward: 50}
+	assert.Equal(t, uint64(50), fixed.RewardAt(1))
+	assert.Equal(t, uint64(50), fixed.RewardAt(100000))
+
+	halving := RewardPolicy{Type: RewardHalving, InitialReward: 100, HalvingInterval: 2}
+	assert.Equal(t, uint64(100), halving.RewardAt(1))
+	assert.Equal(t, uint64(50), halving.RewardAt(2))
+	assert.Equal(t, uint64(50), halving.RewardAt(3))
+	assert.Equal(t, uint64(25), halving.RewardAt(4))
+	assert.Equal(t, uint64(0), halving.RewardAt(1000))
+}
+
+// 测试区块奖励和交易费被计入出块者的余额，并记录在区块收据中。
+func TestBlockRewardAndFees(t *testing.T) {
+	sender := crypto.GeneratePrivatekey()
+	proposer := crypto.GeneratePrivatekey()
+
+	cfg := DefaultChainConfig()
+	cfg.Reward = RewardPolicy{Type: RewardFixed, InitialReward: 50}
+	bc, err := NewBlockchainFromGenesis(&Genesis{
+		Config: cfg,
+		Alloc: map[types.Address]uint64{
+			sender.PublicKey().Address(): 1000,
+		},
+	})
+	assert.Nil(t, err)
+
+	tx := &Transaction{
+		Type:  TxTypeTransfer,
+		To:    types.Address{1},
+		Value: 100,
+		Fee:   10,
+	}
+	assert.Nil(t, tx.Sign(sender))
+
+	b := signedBlock(t, bc, proposer, []Transaction{*tx})
+	assert.Nil(t, bc.AddBlock(b))
+
+	state := bc.State()
+	assert.Equal(t, uint64(890), state.Balance(sender.PublicKey().Address()))
+	assert.Equal(t, uint64(100), state.Balance(types.Address{1}))
+	assert.Equal(t, uint64(60), state.Balance(proposer.PublicKey().Address()))
+
+	receipt, err := bc.GetBlockReceipt(b.Hash(BlockHasher{}))
+	assert.Nil(t, err)
+	assert.Equal(t, proposer.PublicKey().Address(), receipt.Proposer)
+	assert.Equal(t, uint64(50), receipt.Reward)
+	assert.Equal(t, uint64(10), receipt.Fees)
+	assert.Equal(t, uint64(60), receipt.Total())
+
+	// 余额不足以同时支付金额和交易费
+	tx = &Transaction{
+		Type:  TxTypeTransfer,
+		Nonce: 1,
+		To:    types.Address{1},
+		Value: 890,
+		Fee:   1,
+	}
+	assert.Nil(t, tx.Sign(sender))
+	assert.NotNil(t, bc.AddBlock(signedBlock(t, bc, proposer, []Transaction{*tx})))
+}
+
+// 测试固有燃料对不执行字节码的交易同样收取，并按交易数据的长度计费。
+func TestIntrinsicGas(t *testing.T) {
+	sender := crypto.GeneratePrivatekey()
+	proposer := crypto.GeneratePrivatekey()
+	bc, err := NewBlockchainFromGenesis(&Genesis{
+		GasLimit: 2 * vm.GasTx,
+		Alloc: map[types.Address]uint64{
+			sender.PublicKey().Address(): 100000,
+		},
+	})
+	assert.Nil(t, err)
+
+	tx := &Transaction{
+		Type:     TxTypeTransfer,
+		To:       types.Address{1},
+		Value:    100,
+		GasPrice: 2,
+		Data:     []byte("memo"),
+	}
+	assert.Nil(t, tx.Sign(sender))
+	intrinsic := vm.GasTx + 4*vm.GasTxDataByte
+	assert.Equal(t, intrinsic, tx.IntrinsicGas())
+
+	b := signedBlock(t, bc, proposer, []Transaction{*tx})
+	assert.Nil(t, bc.AddBlock(b))
+	assert.Equal(t, 100000-100-intrinsic*2, bc.State().Balance(sender.PublicKey().Address()))
+
+	receipt, err := bc.GetBlockReceipt(b.Hash(BlockHasher{}))
+	assert.Nil(t, err)
+	assert.Equal(t, intrinsic, receipt.GasUsed)
+	assert.Equal(t, intrinsic*2, receipt.Fees)
+
+	// 固有燃料之和超过区块燃料上限的区块无效
+	txx := []Transaction{}
+	for i := uint64(1); i <= 2; i++ {
+		tx := &Transaction{Type: TxTypeTransfer, Nonce: i, To: types.Address{1}, Value: 1, Data: []byte("memo")}
+		assert.Nil(t, tx.Sign(sender))
+		txx = append(txx, *tx)
+	}
+	assert.NotNil(t, bc.AddBlock(signedBlock(t, bc, proposer, txx)))
+}
@@ -1,21 +1,191 @@
 package core
 
-//	定义一个存储接口，包含一个Put方法，用于将区块存储到存储系统中。
+import (
+	"fmt"
+	"sync"
+
+	"github.com/Luboy23/Blockchain_Project/types"
+)
+
+// 定义一个存储接口，用于存储区块以及按哈希查询区块，同时按区块哈希存储区块中交易的收据。
+// Delete删除区块及其收据，用于裁剪模式下丢弃旧的区块体。
 type Storage interface {
 	Put(*Block) error
+	Get(types.Hash) (*Block, error)
+	Has(types.Hash) bool
+	PutReceipts(types.Hash, []*Receipt) error
+	GetReceipts(types.Hash) ([]*Receipt, error)
+	Delete(types.Hash) error
 }
 
-//	实现Storage接口，提供了一个内存存储的实现。
+// 实现Storage接口，提供了一个内存存储的实现。
 type MemoryStore struct {
+	lock     sync.RWMutex              // 保护所有映射的读写锁
+	blocks   map[types.Hash]*Block     // 按区块哈希保存的所有区块（包括分叉链上的区块）
+	receipts map[types.Hash][]*Receipt // 按区块哈希保存的交易收据
+
+	txIndex      map[types.Hash]*TxLocation     // 交易索引：交易哈希到交易在主链上的位置
+	addressIndex map[types.Address][]types.Hash // 地址索引：发送者地址到其主链交易的哈希
+	indexed      map[uint32]types.Hash          // 每个高度已被索引的区块哈希
 }
 
-//	创建一个新的MemoryStore实例。
+// 创建一个新的MemoryStore实例。
 func NewMemstore() *MemoryStore {
-	return &MemoryStore{}
+	return &MemoryStore{
+		blocks:       make(map[types.Hash]*Block),
+		receipts:     make(map[types.Hash][]*Receipt),
+		txIndex:      make(map[types.Hash]*TxLocation),
+		addressIndex: make(map[types.Address][]types.Hash),
+		indexed:      make(map[uint32]types.Hash),
+	}
 }
 
-//	实现Storage接口的Put方法，用于将区块存储到内存中。
-// 注意：这里的实现仅仅是一个占位符，实际上并没有将数据存储到任何地方。
+// 实现Storage接口的Put方法，用于将区块存储到内存中。
 func (s *MemoryStore) Put(b *Block) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.blocks[b.Hash(BlockHasher{})] = b // 以区块哈希为键保存区块
+
 	return nil //	返回nil表示操作成功
 }
+
+// 实现Storage接口的Get方法，按哈希获取区块。
+func (s *MemoryStore) Get(hash types.Hash) (*Block, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	b, ok := s.blocks[hash]
+	if !ok {
+		return nil, fmt.Errorf("未找到哈希为(%s)的区块", hash)
+	}
+
+	return b, nil
+}
+
+// 实现Storage接口的Has方法，检查指定哈希的区块是否存在。
+func (s *MemoryStore) Has(hash types.Hash) bool {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	_, ok := s.blocks[hash]
+	return ok
+}
+
+// 实现Storage接口的Delete方法，删除指定区块及其收据。
+func (s *MemoryStore) Delete(hash types.Hash) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	delete(s.blocks, hash)
+	delete(s.receipts, hash)
+
+	return nil
+}
+
+// 实现Storage接口的PutReceipts方法，保存指定区块中交易的收据。
+func (s *MemoryStore) PutReceipts(hash types.Hash, receipts []*Receipt) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.receipts[hash] = receipts
+
+	return nil
+}
+
+// 实现Storage接口的GetReceipts方法，获取指定区块中交易的收据。
+func (s *MemoryStore) GetReceipts(hash types.Hash) ([]*Receipt, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	receipts, ok := s.receipts[hash]
+	if !ok {
+		return nil, fmt.Errorf("未找到区块(%s)的收据", hash)
+	}
+
+	return receipts, nil
+}
+
+// 实现IndexStore接口的PutTxLocation方法，保存交易的位置。
+func (s *MemoryStore) PutTxLocation(hash types.Hash, loc *TxLocation) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.txIndex[hash] = loc
+
+	return nil
+}
+
+// 实现IndexStore接口的GetTxLocation方法，获取交易的位置。
+func (s *MemoryStore) GetTxLocation(hash types.Hash) (*TxLocation, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	loc, ok := s.txIndex[hash]
+	if !ok {
+		return nil, fmt.Errorf("索引中没有交易(%s)", hash)
+	}
+
+	return loc, nil
+}
+
+// 实现IndexStore接口的DeleteTxLocation方法，删除交易的位置。
+func (s *MemoryStore) DeleteTxLocation(hash types.Hash) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	delete(s.txIndex, hash)
+
+	return nil
+}
+
+// 实现IndexStore接口的PutAddressTxs方法，保存地址发送的交易哈希，列表为空时删除该地址。
+func (s *MemoryStore) PutAddressTxs(addr types.Address, hashes []types.Hash) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if len(hashes) == 0 {
+		delete(s.addressIndex, addr)
+		return nil
+	}
+	s.addressIndex[addr] = hashes
+
+	return nil
+}
+
+// 实现IndexStore接口的GetAddressTxs方法，获取地址发送的交易哈希。
+func (s *MemoryStore) GetAddressTxs(addr types.Address) ([]types.Hash, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return append([]types.Hash{}, s.addressIndex[addr]...), nil
+}
+
+// 实现IndexStore接口的PutIndexedBlock方法，记录某个高度已被索引的区块。
+func (s *MemoryStore) PutIndexedBlock(height uint32, hash types.Hash) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.indexed[height] = hash
+
+	return nil
+}
+
+// 实现IndexStore接口的GetIndexedBlock方法，获取某个高度已被索引的区块。
+func (s *MemoryStore) GetIndexedBlock(height uint32) (types.Hash, bool) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	hash, ok := s.indexed[height]
+	return hash, ok
+}
+
+// 实现IndexStore接口的DeleteIndexedBlock方法，删除某个高度的索引记录。
+func (s *MemoryStore) DeleteIndexedBlock(height uint32) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	delete(s.indexed, height)
+
+	return nil
+}
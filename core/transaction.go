@@ -1,19 +1,62 @@
 package core
 
 import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
 	"fmt"
+	"math/bits"
 
 	"github.com/Luboy23/Blockchain_Project/crypto"
 	"github.com/Luboy23/Blockchain_Project/types"
+	"github.com/Luboy23/Blockchain_Project/vm"
 )
 
-// 定义交易的结构体，包括交易数据、发送者的公钥、签名、哈希值和首次出现的时间戳。
+// 定义了交易的类型，不同类型的交易在区块执行时有不同的状态转换。
+type TxType byte
+
+const (
+	TxTypeData         TxType = iota // 普通数据交易，数据只被签名和哈希
+	TxTypeEvidence                   // 双重签名证据交易，数据为编码后的DoubleSignEvidence
+	TxTypeTransfer                   // 转账交易，向To转账Value
+	TxTypeBond                       // 验证者自我质押Value，首次质押时注册为验证者
+	TxTypeUnbond                     // 验证者解除质押Value，经过解绑期后返还余额
+	TxTypeDelegate                   // 向验证者To委托Value
+	TxTypeUndelegate                 // 从验证者To撤回委托Value，经过解绑期后返还余额
+	TxTypeClaimRewards               // 领取在验证者To处累积的委托奖励
+	TxTypeDeploy                     // 部署合约，数据为合约代码，合约地址由发送者地址和Nonce派生
+	TxTypeCall                       // 调用合约To，数据为输入数据，同时向合约转账Value
+)
+
+// 定义了交易的版本，决定交易如何携带发送者的公钥。
+type TxVersion byte
+
+const (
+	TxVersionLegacy      TxVersion = iota // 携带发送者的公钥和签名
+	TxVersionRecoverable                  // 只携带可恢复的签名，发送者的公钥从签名和签名内容恢复
+)
+
+// 签名内容中版本号前面的标记字节，它不是有效的交易类型，因此不同版本的签名内容不会混淆。
+const txVersionMarker = 0xff
+
+// 定义交易的结构体，包括交易版本、交易类型、账户随机数、接收者、金额、交易数据、发送者的公钥、签名、哈希值和首次出现的时间戳。
 type Transaction struct {
-	Data []byte // 交易数据
+	Version TxVersion // 交易版本，零值为携带公钥的版本0，保证之前编码的交易仍然可以解码
+
+	Type  TxType        // 交易类型
+	Nonce uint64        // 发送者账户的交易序号，必须与账户当前的Nonce相等
+	To    types.Address // 接收者地址，质押相关交易中为验证者地址
+	Value uint64        // 转账或质押的金额
+	Fee   uint64        // 交易费，由出块者获得
+	Data  []byte        // 交易数据
+
+	GasLimit uint64 // 执行字节码最多可以消耗的燃料，不包括另外收取的固有燃料
+	GasPrice uint64 // 每单位燃料的价格，实际消耗的燃料乘以价格作为额外的交易费
 
-	From      crypto.PublicKey // 发送者的公钥
+	From      crypto.PublicKey // 发送者的公钥，其密钥类型决定了交易使用的签名方案，版本1的交易为空
 	Signature *crypto.Signature // 交易签名
 
+	sender    crypto.PublicKey // 从签名恢复的发送者公钥，只用于版本1的交易
 	hash      types.Hash // 交易的哈希值
 	firstSeen int64 // 交易首次出现的时间戳
 }
@@ -25,6 +68,80 @@ func NewTransaction(data []byte) *Transaction {
 	}
 }
 
+//	创建一个携带双重签名证据的交易。
+func NewEvidenceTransaction(ev *DoubleSignEvidence) (*Transaction, error) {
+	buf := &bytes.Buffer{}
+	if err := gob.NewEncoder(buf).Encode(ev); err != nil { // 将证据编码为交易数据
+		return nil, err
+	}
+
+	return &Transaction{
+		Type: TxTypeEvidence,
+		Data: buf.Bytes(),
+	}, nil
+}
+
+//	解码证据交易中携带的双重签名证据。
+func (tx *Transaction) Evidence() (*DoubleSignEvidence, error) {
+	if tx.Type != TxTypeEvidence {
+		return nil, fmt.Errorf("交易类型(%d)不是证据交易", tx.Type)
+	}
+
+	ev := new(DoubleSignEvidence)
+	if err := gob.NewDecoder(bytes.NewReader(tx.Data)).Decode(ev); err != nil {
+		return nil, fmt.Errorf("解码双重签名证据失败：%s", err)
+	}
+
+	return ev, nil
+}
+
+//	返回交易中需要签名的内容，包括交易类型、Nonce、接收者、金额、交易费、燃料上限、燃料价格和交易数据。
+//	版本0之后的交易在最前面加上标记字节和版本号，版本0的签名内容保持不变。
+func (tx *Transaction) signingBytes() []byte {
+	buf := &bytes.Buffer{}
+	if tx.Version != TxVersionLegacy {
+		buf.WriteByte(txVersionMarker)  // 版本标记
+		buf.WriteByte(byte(tx.Version)) // 交易版本
+	}
+	buf.WriteByte(byte(tx.Type))                     // 交易类型
+	binary.Write(buf, binary.BigEndian, tx.Nonce)    // 账户随机数
+	buf.Write(tx.To.ToSlice())                       // 接收者地址
+	binary.Write(buf, binary.BigEndian, tx.Value)    // 金额
+	binary.Write(buf, binary.BigEndian, tx.Fee)      // 交易费
+	binary.Write(buf, binary.BigEndian, tx.GasLimit) // 燃料上限
+	binary.Write(buf, binary.BigEndian, tx.GasPrice) // 燃料价格
+	buf.Write(tx.Data)                               // 交易数据
+
+	return buf.Bytes()
+}
+
+//	返回交易的固有燃料，即每笔交易的基础消耗加上交易数据每字节的消耗。
+//	固有燃料对所有交易都收取，使区块燃料上限同时限制区块中交易的数量和数据的大小。
+func (tx *Transaction) IntrinsicGas() uint64 {
+	return vm.GasTx + vm.GasTxDataByte*uint64(len(tx.Data))
+}
+
+//	返回交易最多消耗的燃料，即固有燃料加上燃料上限，溢出时返回false。
+func (tx *Transaction) MaxGas() (uint64, bool) {
+	gas, carry := bits.Add64(tx.IntrinsicGas(), tx.GasLimit, 0)
+	return gas, carry == 0
+}
+
+//	返回交易最多需要支付的费用，即交易费加上最多消耗的燃料乘以燃料价格，溢出时返回false。
+func (tx *Transaction) MaxCost() (uint64, bool) {
+	gas, ok := tx.MaxGas()
+	if !ok {
+		return 0, false
+	}
+	hi, gasCost := bits.Mul64(gas, tx.GasPrice)
+	if hi != 0 {
+		return 0, false
+	}
+
+	cost, carry := bits.Add64(tx.Fee, gasCost, 0)
+	return cost, carry == 0
+}
+
 //	计算交易的哈希值。如果交易的哈希值已经计算过，则直接返回；否则，使用提供的哈希计算器计算哈希值。
 func (tx *Transaction) Hash(hasher Hasher[*Transaction]) types.Hash {
 	if tx.hash.IsZero() { // 如果交易的哈希值未计算或为零
@@ -34,31 +151,81 @@ func (tx *Transaction) Hash(hasher Hasher[*Transaction]) types.Hash {
 	return tx.hash // 返回交易的哈希值
 }
 
-//	使用私钥对交易进行签名。
+//	使用私钥对交易进行签名。版本1的交易使用可恢复的签名，不设置发送者的公钥。
 func (tx *Transaction) Sign(priKey crypto.PrivateKey) error {
-	sig, err := priKey.Sign(tx.Data) // 使用私钥对交易数据进行签名
-	if err != nil {
-		return err // 如果签名失败，返回错误
+	switch tx.Version {
+	case TxVersionLegacy:
+		sig, err := priKey.Sign(tx.signingBytes()) // 使用私钥对交易内容进行签名
+		if err != nil {
+			return err // 如果签名失败，返回错误
+		}
+
+		tx.From = priKey.PublicKey() // 设置发送者的公钥
+		tx.Signature = sig // 设置签名
+	case TxVersionRecoverable:
+		sig, err := priKey.SignRecoverable(tx.signingBytes()) // 签名方案必须支持恢复公钥
+		if err != nil {
+			return err
+		}
+
+		tx.From = crypto.PublicKey{}
+		tx.sender = priKey.PublicKey()
+		tx.Signature = sig
+	default:
+		return fmt.Errorf("不支持的交易版本(%d)", tx.Version)
 	}
 
-	tx.From = priKey.PublicKey() // 设置发送者的公钥
-	tx.Signature = sig // 设置签名
-
 	return nil // 返回nil表示签名成功
 }
 
-//	验证交易的签名。
+//	验证交易的签名。版本1的交易从签名恢复发送者的公钥，恢复出的公钥由Sender返回。
 func (tx *Transaction) Verify() error {
 	if tx.Signature == nil { // 如果交易没有签名
 		return fmt.Errorf("交易没有签名！") // 返回错误
 	}
 
-	if !tx.Signature.Verify(tx.From, tx.Data) { // 如果签名验证失败
-		return fmt.Errorf("不是交易的签名者") // 返回错误
+	switch tx.Version {
+	case TxVersionLegacy:
+		// 发送者公钥的密钥类型声明了交易使用的签名方案，签名必须使用同一方案
+		if tx.Signature.Type != tx.From.Type {
+			return fmt.Errorf("签名的密钥类型(%s)与发送者公钥的类型(%s)不符", tx.Signature.Type, tx.From.Type)
+		}
+
+		if !tx.Signature.Verify(tx.From, tx.signingBytes()) { // 如果签名验证失败
+			return fmt.Errorf("不是交易的签名者") // 返回错误
+		}
+	case TxVersionRecoverable:
+		if tx.From.Key != nil {
+			return fmt.Errorf("版本%d的交易不应携带发送者的公钥", tx.Version)
+		}
+
+		// 恢复公钥时已经检查了R和S的取值范围（secp256k1还要求S不超过N/2），恢复出的公钥必然能验证签名，不需要再验证一次
+		sender, err := tx.Signature.RecoverPublicKey(tx.signingBytes())
+		if err != nil {
+			return fmt.Errorf("无法从签名恢复发送者：%s", err)
+		}
+		tx.sender = sender
+	default:
+		return fmt.Errorf("不支持的交易版本(%d)", tx.Version)
 	}
 
 	return nil // 返回nil表示验证成功
 }
+
+//	返回交易发送者的公钥。版本0的交易返回From；版本1的交易从签名恢复并缓存，无法恢复时返回空公钥。
+func (tx *Transaction) Sender() crypto.PublicKey {
+	if tx.Version == TxVersionLegacy {
+		return tx.From
+	}
+
+	if tx.sender.Key == nil && tx.Signature != nil {
+		if sender, err := tx.Signature.RecoverPublicKey(tx.signingBytes()); err == nil {
+			tx.sender = sender
+		}
+	}
+	return tx.sender
+}
+
 //	使用提供的编码器对交易进行编码。
 func (tx *Transaction) Encode(dec Encoder[*Transaction]) error {
 	return dec.Encode(tx) // 使用编码器编码交易
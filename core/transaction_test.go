@@ -2,9 +2,11 @@ package core
 
 import (
 	"bytes"
+	"math/big"
 	"testing"
 
 	"github.com/Luboy23/Blockchain_Project/crypto"
+	"github.com/Luboy23/Blockchain_Project/types"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -47,6 +49,111 @@ func TestTxEncodeAndDecode(t *testing.T) {
 	assert.Equal(t, tx, txDecoded) // 断言编码后解码的交易与原交易相等
 }
 
+// 测试使用不同签名方案的交易，验证按发送者公钥的密钥类型进行。
+func TestTransactionSchemes(t *testing.T) {
+	for _, kt := range []crypto.KeyType{crypto.KeyTypeP256, crypto.KeyTypeSecp256k1, crypto.KeyTypeEd25519} {
+		priKey, err := crypto.GenerateKey(kt)
+		assert.Nil(t, err)
+		tx := &Transaction{Type: TxTypeTransfer, Value: 10, Data: []byte("foo")}
+		assert.Nil(t, tx.Sign(priKey))
+		assert.Equal(t, kt, tx.From.Type)
+
+		buf := &bytes.Buffer{}
+		assert.Nil(t, tx.Encode(NewGobTxEncoder(buf)))
+		decoded := new(Transaction)
+		assert.Nil(t, decoded.Decode(NewGobTxDecoder(buf)))
+		assert.Nil(t, decoded.Verify())
+		assert.Equal(t, tx.Hash(TxHasher{}), decoded.Hash(TxHasher{}))
+		assert.Equal(t, priKey.PublicKey().Address(), decoded.From.Address())
+
+		// 签名与发送者公钥的密钥类型不一致
+		decoded.Signature.Type = (kt + 1) % 3
+		assert.NotNil(t, decoded.Verify())
+	}
+}
+
+// 测试版本1的交易：只携带可恢复的签名，发送者从签名恢复。
+func TestRecoverableTransaction(t *testing.T) {
+	for _, kt := range []crypto.KeyType{crypto.KeyTypeP256, crypto.KeyTypeSecp256k1} {
+		priKey, err := crypto.GenerateKey(kt)
+		assert.Nil(t, err)
+
+		legacy := &Transaction{Type: TxTypeTransfer, Value: 10, Data: []byte("foo")}
+		assert.Nil(t, legacy.Sign(priKey))
+		tx := &Transaction{Version: TxVersionRecoverable, Type: TxTypeTransfer, Value: 10, Data: []byte("foo")}
+		assert.Nil(t, tx.Sign(priKey))
+		assert.Nil(t, tx.From.Key)
+		assert.Equal(t, priKey.PublicKey(), tx.Sender())
+		assert.NotEqual(t, legacy.Hash(TxHasher{}), tx.Hash(TxHasher{}))
+
+		// 编码后不包含公钥，解码后可以验证并恢复发送者
+		legacyBuf := &bytes.Buffer{}
+		assert.Nil(t, legacy.Encode(NewGobTxEncoder(legacyBuf)))
+		buf := &bytes.Buffer{}
+		assert.Nil(t, tx.Encode(NewGobTxEncoder(buf)))
+		assert.Less(t, buf.Len(), legacyBuf.Len())
+
+		decoded := new(Transaction)
+		assert.Nil(t, decoded.Decode(NewGobTxDecoder(buf)))
+		assert.Equal(t, TxVersionRecoverable, decoded.Version)
+		assert.Nil(t, decoded.Verify())
+		assert.Equal(t, priKey.PublicKey().Address(), decoded.Sender().Address())
+		assert.Equal(t, tx.Hash(TxHasher{}), decoded.Hash(TxHasher{}))
+
+		data, err := tx.MarshalJSON()
+		assert.Nil(t, err)
+		fromJSON := new(Transaction)
+		assert.Nil(t, fromJSON.UnmarshalJSON(data))
+		assert.Equal(t, priKey.PublicKey(), fromJSON.Sender())
+
+		// 版本1的交易不能同时携带公钥，修改内容后恢复出的不再是原发送者
+		decoded.From = priKey.PublicKey()
+		assert.NotNil(t, decoded.Verify())
+		decoded.From = crypto.PublicKey{}
+		decoded.sender = crypto.PublicKey{}
+		decoded.Value = 11
+		if decoded.Verify() == nil {
+			assert.NotEqual(t, priKey.PublicKey().Address(), decoded.Sender().Address())
+		}
+	}
+
+	// S较大的等价secp256k1签名会被拒绝
+	priKey, err := crypto.GenerateKey(crypto.KeyTypeSecp256k1)
+	assert.Nil(t, err)
+	malleated := &Transaction{Version: TxVersionRecoverable, Data: []byte("foo")}
+	assert.Nil(t, malleated.Sign(priKey))
+	n, _ := new(big.Int).SetString("fffffffffffffffffffffffffffffffebaaedce6af48a03bbfd25e8cd0364141", 16)
+	malleated.Signature.S.Sub(n, malleated.Signature.S)
+	malleated.Signature.V ^= 1
+	assert.NotNil(t, malleated.Verify())
+
+	// Ed25519不支持恢复公钥，未知的版本无法签名
+	edKey, err := crypto.GenerateKey(crypto.KeyTypeEd25519)
+	assert.Nil(t, err)
+	tx := &Transaction{Version: TxVersionRecoverable, Data: []byte("foo")}
+	assert.ErrorIs(t, tx.Sign(edKey), crypto.ErrNotRecoverable)
+	tx.Version = 7
+	assert.NotNil(t, tx.Sign(edKey))
+}
+
+// 测试辅助交易的默认燃料上限，足以执行测试中的字节码和合约。
+const testGasLimit = 1_000_000
+
+// 创建一个由指定私钥签名的交易，燃料上限为testGasLimit，燃料价格为0。
+func signedTx(t *testing.T, priKey crypto.PrivateKey, txType TxType, nonce uint64, to types.Address, value uint64, data []byte) *Transaction {
+	tx := &Transaction{
+		Type:     txType,
+		Nonce:    nonce,
+		To:       to,
+		Value:    value,
+		Data:     data,
+		GasLimit: testGasLimit,
+	}
+	assert.Nil(t, tx.Sign(priKey))
+
+	return tx
+}
+
 // 创建一个已签名的随机交易。
 func randomTxWithSignature(t *testing.T) *Transaction {
 	priKey := crypto.GeneratePrivatekey() // 生成一个私钥
@@ -1,6 +1,13 @@
 package core
 
-import "fmt"
+import (
+	"fmt"
+	"time"
+)
+
+// 区块时间戳允许超前本地时间的最大值。
+// 时间戳还必须严格大于父区块，难度调整读取的时间戳因此只能在这个范围内被矿工调整。
+const MaxBlockTimeDrift = 15 * time.Second
 
 // 定义了一个区块验证器接口，包含一个ValidateBlock方法，用于验证区块。
 type Validator interface {
@@ -20,29 +27,49 @@ func NewBlockValidator(bc *Blockchain) *BlockValidator {
 }
 
 // 实现了Validator接口的ValidateBlock方法，用于验证区块。
+// 只要父区块已知，分叉链上的区块同样可以通过验证，由区块链根据累计工作量决定主链。
 func (v *BlockValidator) ValidateBlock(b *Block) error {
 	// 检查区块是否已经存在于区块链中
-	if v.bc.HashBlock(b.Height) {
+	if v.bc.HasBlockHash(b.Hash(BlockHasher{})) {
 		return fmt.Errorf("区块内已经包含了区块（%d）以及哈希（%s）", b.Height, b.Hash(BlockHasher{}))
 	}
 
+	// 获取前一个区块的头部信息
+	prevHeader, err := v.bc.GetHeaderByHash(b.PrevBlockHash)
+	if err != nil {
+		return fmt.Errorf("前区块哈希(%s)不正确！", b.PrevBlockHash)
+	}
+
 	// 检查区块的高度是否正确
-	if b.Height != v.bc.Height()+1 {
-		return fmt.Errorf("(%s)区块过高", b.Hash(BlockHasher{}))
+	if b.Height != prevHeader.Height+1 {
+		return fmt.Errorf("(%s)区块高度(%d)不正确", b.Hash(BlockHasher{}), b.Height)
 	}
 
-	// 获取前一个区块的头部信息
-	prevHeader, err := v.bc.GetHeader(b.Height - 1)
-	if err != nil {
-		return err // 如果获取失败，返回错误
+	// 时间戳必须晚于父区块，且不能超前本地时间太多
+	if b.Timestamp <= prevHeader.Timestamp {
+		return fmt.Errorf("区块(%s)的时间戳(%d)不晚于父区块的时间戳(%d)", b.Hash(BlockHasher{}), b.Timestamp, prevHeader.Timestamp)
+	}
+	if limit := time.Now().Add(MaxBlockTimeDrift).UnixNano(); b.Timestamp > limit {
+		return fmt.Errorf("区块(%s)的时间戳(%d)超前本地时间超过%s", b.Hash(BlockHasher{}), b.Timestamp, MaxBlockTimeDrift)
 	}
 
-	// 计算前一个区块的哈希值
-	hash := BlockHasher{}.Hash(prevHeader)
+	// 区块燃料上限保持不变
+	if b.GasLimit != prevHeader.GasLimit {
+		return fmt.Errorf("区块(%s)的燃料上限(%d)不正确，应为(%d)", b.Hash(BlockHasher{}), b.GasLimit, prevHeader.GasLimit)
+	}
 
-	// 检查前一个区块的哈希值是否正确
-	if hash != b.PrevBlockHash {
-		return fmt.Errorf("前区块哈希(%s)不正确！", b.PrevBlockHash)
+	// 启用PoW时，检查难度是否符合调整规则以及工作量是否满足目标值
+	if v.bc.PowConfig() != nil {
+		difficulty, err := v.bc.NextDifficulty(prevHeader)
+		if err != nil {
+			return err
+		}
+		if b.Difficulty != difficulty {
+			return fmt.Errorf("区块(%s)的难度(%d)不正确，应为(%d)", b.Hash(BlockHasher{}), b.Difficulty, difficulty)
+		}
+		if err := CheckProofOfWork(b.Header); err != nil {
+			return err
+		}
 	}
 
 	// 验证区块的内容
@@ -50,5 +77,58 @@ func (v *BlockValidator) ValidateBlock(b *Block) error {
 		return err // 如果验证失败，返回错误
 	}
 
+	// 未启用PoW时，只有当前纪元未被监禁的活跃验证者才能出块；启用PoW时出块资格由工作量决定，任何矿工都可以出块
+	if v.bc.PowConfig() == nil {
+		parentState, err := v.bc.StateAt(b.PrevBlockHash)
+		if err != nil {
+			return err
+		}
+		if record, ok := parentState.Validator(b.Validator.Address()); ok && record.Jailed {
+			return fmt.Errorf("验证者(%s)已被监禁，不能出块", b.Validator.Address())
+		}
+		if !parentState.IsActiveValidator(b.Validator.Address()) {
+			return fmt.Errorf("(%s)不是当前纪元的活跃验证者，不能出块", b.Validator.Address())
+		}
+	}
+
+	// 验证区块中的双重签名证据
+	for i := range b.Transactions {
+		if err := v.validateEvidence(b, &b.Transactions[i]); err != nil {
+			return err
+		}
+	}
+
+	// 重新执行区块，检查执行后的状态根，执行结果在添加区块时直接使用
+	state, receipt, err := v.bc.executeBlock(b)
+	if err != nil {
+		return err
+	}
+	if root := state.Root(); root != b.StateRoot {
+		return fmt.Errorf("区块(%s)的状态根(%s)不正确，应为(%s)", b.Hash(BlockHasher{}), b.StateRoot, root)
+	}
+	v.bc.cacheExecution(b.Hash(BlockHasher{}), state, receipt)
+
 	return nil // 如果所有检查都通过，返回nil表示验证成功
 }
+
+// 验证证据交易：证据本身必须有效，且双重签名发生在当前区块之前。
+func (v *BlockValidator) validateEvidence(b *Block, tx *Transaction) error {
+	if tx.Type != TxTypeEvidence {
+		return nil
+	}
+
+	ev, err := tx.Evidence()
+	if err != nil {
+		return err
+	}
+
+	if err := ev.Verify(); err != nil {
+		return fmt.Errorf("无效的双重签名证据：%s", err)
+	}
+
+	if ev.Height() >= b.Height {
+		return fmt.Errorf("双重签名证据的高度(%d)不早于区块高度(%d)", ev.Height(), b.Height)
+	}
+
+	return nil
+}
@@ -0,0 +1,58 @@
+package crypto
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"fmt"
+	"math/big"
+)
+
+// Ed25519签名。私钥是32字节的种子，公钥是32字节，64字节的签名按前后两半分别存放在R和S中。
+// Ed25519内部对消息做SHA-512，因此直接对完整的消息签名。
+type ed25519Scheme struct{}
+
+func (ed25519Scheme) Type() KeyType {
+	return KeyTypeEd25519
+}
+
+func (ed25519Scheme) GenerateKey() ([]byte, error) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return key.Seed(), nil
+}
+
+func (ed25519Scheme) PublicKey(privateKey []byte) ([]byte, error) {
+	if len(privateKey) != ed25519.SeedSize {
+		return nil, fmt.Errorf("私钥的长度应该为%d字节，而不是%d字节", ed25519.SeedSize, len(privateKey))
+	}
+	return ed25519.NewKeyFromSeed(privateKey).Public().(ed25519.PublicKey), nil
+}
+
+func (ed25519Scheme) ValidatePublicKey(publicKey []byte) error {
+	if len(publicKey) != ed25519.PublicKeySize {
+		return fmt.Errorf("公钥的长度应该为%d字节，而不是%d字节", ed25519.PublicKeySize, len(publicKey))
+	}
+	return nil
+}
+
+func (ed25519Scheme) Sign(privateKey, data []byte) (*big.Int, *big.Int, error) {
+	if len(privateKey) != ed25519.SeedSize {
+		return nil, nil, fmt.Errorf("私钥的长度应该为%d字节，而不是%d字节", ed25519.SeedSize, len(privateKey))
+	}
+
+	sig := ed25519.Sign(ed25519.NewKeyFromSeed(privateKey), data)
+	return new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:]), nil
+}
+
+func (ed25519Scheme) Verify(publicKey, data []byte, r, s *big.Int) bool {
+	if len(publicKey) != ed25519.PublicKeySize || r.Sign() < 0 || s.Sign() < 0 || r.BitLen() > 256 || s.BitLen() > 256 {
+		return false
+	}
+
+	sig := make([]byte, ed25519.SignatureSize)
+	r.FillBytes(sig[:32])
+	s.FillBytes(sig[32:])
+	return ed25519.Verify(publicKey, data, sig)
+}
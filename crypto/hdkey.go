@@ -0,0 +1,206 @@
+package crypto
+
+import (
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// 序号不小于HardenedKeyStart的子密钥是强化子密钥，只能由父私钥派生。
+const HardenedKeyStart uint32 = 0x80000000
+
+// 默认的派生路径，按照BIP-44的布局：m/44'/币种'/账户'/找零/地址序号。
+const DefaultDerivationPath = "m/44'/0'/0'/0/0"
+
+// 派生主密钥时HMAC使用的密钥，由SLIP-10为NIST P-256规定。
+var masterKeyHMACKey = []byte("Nist256p1 seed")
+
+// 从只有公钥的扩展密钥派生强化子密钥时返回的错误。
+var ErrHardenedPublicDerivation = errors.New("不能从公钥派生强化子密钥")
+
+// 分层确定性的扩展密钥，由密钥和32字节的链码组成，可以沿路径派生子密钥。
+// 派生方法遵循BIP-32，曲线使用项目的P-256，参数和无效密钥的处理遵循SLIP-10。
+// 只有公钥的扩展密钥只能派生非强化的子公钥，可以在不接触私钥的情况下生成收款地址。
+type ExtendedKey struct {
+	privateKey *PrivateKey // 只有公钥时为nil
+	publicKey  PublicKey
+	chainCode  []byte
+	depth      uint8
+	index      uint32
+}
+
+// 从种子派生主密钥，种子的长度应该在16到64字节之间，通常由MnemonicToSeed得到。
+func NewMasterKey(seed []byte) (*ExtendedKey, error) {
+	if len(seed) < 16 || len(seed) > 64 {
+		return nil, fmt.Errorf("种子的长度应该在16到64字节之间，而不是%d字节", len(seed))
+	}
+
+	data := seed
+	for {
+		il, ir := hmacSHA512(masterKeyHMACKey, data)
+		key, err := PrivateKeyFromBytes(il)
+		if err == nil {
+			return &ExtendedKey{privateKey: &key, publicKey: key.PublicKey(), chainCode: ir}, nil
+		}
+		// IL为0或不小于曲线的阶时，按SLIP-10用整个HMAC结果重新计算
+		data = append(append(make([]byte, 0, 64), il...), ir...)
+	}
+}
+
+// 派生序号为index的子密钥，index不小于HardenedKeyStart时为强化派生。
+func (k *ExtendedKey) Child(index uint32) (*ExtendedKey, error) {
+	if index >= HardenedKeyStart && k.privateKey == nil {
+		return nil, ErrHardenedPublicDerivation
+	}
+	if k.depth == 255 {
+		return nil, fmt.Errorf("派生深度不能超过255")
+	}
+
+	// 强化派生使用0x00||父私钥||序号，非强化派生使用压缩父公钥||序号
+	data := make([]byte, 0, 37)
+	if index >= HardenedKeyStart {
+		data = append(append(data, 0), k.privateKey.Bytes()...)
+	} else {
+		data = append(data, k.publicKey.ToSlice()...)
+	}
+	data = appendUint32(data, index)
+
+	curve := elliptic.P256()
+	n := curve.Params().N
+	for {
+		il, ir := hmacSHA512(k.chainCode, data)
+		child := &ExtendedKey{chainCode: ir, depth: k.depth + 1, index: index}
+		tweak := new(big.Int).SetBytes(il)
+
+		if tweak.Cmp(n) < 0 {
+			if k.privateKey != nil {
+				// 子私钥 = (IL + 父私钥) mod n
+				d := tweak.Add(tweak, new(big.Int).SetBytes(k.privateKey.key))
+				d.Mod(d, n)
+				if d.Sign() != 0 {
+					key, err := PrivateKeyFromBytes(d.FillBytes(make([]byte, signatureScalarSize)))
+					if err != nil {
+						return nil, err
+					}
+					child.privateKey = &key
+					child.publicKey = key.PublicKey()
+					return child, nil
+				}
+			} else {
+				// 子公钥 = IL*G + 父公钥。非强化派生的IL由父公钥和链码计算，不涉及私钥，因此可以使用elliptic.Curve的通用运算
+				px, py := elliptic.UnmarshalCompressed(curve, k.publicKey.Key)
+				x, y := curve.ScalarBaseMult(il)
+				x, y = curve.Add(x, y, px, py)
+				if x.Sign() != 0 || y.Sign() != 0 {
+					child.publicKey = PublicKey{Type: KeyTypeP256, Key: elliptic.MarshalCompressed(curve, x, y)}
+					return child, nil
+				}
+			}
+		}
+		// 得到无效的子密钥时，按SLIP-10用0x01||IR||序号重新计算
+		data = appendUint32(append([]byte{1}, ir...), index)
+	}
+}
+
+// 沿路径派生子密钥，路径的格式见ParseDerivationPath。
+func (k *ExtendedKey) Derive(path string) (*ExtendedKey, error) {
+	indexes, err := ParseDerivationPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	key := k
+	for _, index := range indexes {
+		if key, err = key.Child(index); err != nil {
+			return nil, err
+		}
+	}
+	return key, nil
+}
+
+// 返回只有公钥的扩展密钥，可以交给不应接触私钥的服务派生非强化的子公钥。
+func (k *ExtendedKey) Neuter() *ExtendedKey {
+	return &ExtendedKey{
+		publicKey: k.publicKey,
+		chainCode: k.chainCode,
+		depth:     k.depth,
+		index:     k.index,
+	}
+}
+
+// 返回扩展密钥中的私钥，只有公钥时返回错误。
+func (k *ExtendedKey) PrivateKey() (PrivateKey, error) {
+	if k.privateKey == nil {
+		return PrivateKey{}, fmt.Errorf("扩展密钥中没有私钥")
+	}
+	return *k.privateKey, nil
+}
+
+// 返回扩展密钥中的公钥。
+func (k *ExtendedKey) PublicKey() PublicKey {
+	return k.publicKey
+}
+
+// 返回32字节的链码。
+func (k *ExtendedKey) ChainCode() []byte {
+	return append([]byte{}, k.chainCode...)
+}
+
+// 返回派生深度，主密钥为0。
+func (k *ExtendedKey) Depth() uint8 {
+	return k.depth
+}
+
+// 返回该密钥在父密钥下的序号，主密钥为0。
+func (k *ExtendedKey) Index() uint32 {
+	return k.index
+}
+
+// 解析形如"m/44'/0'/0'/0/0"的派生路径，返回每一级的序号。
+// 序号后面的'、h或H表示强化派生，实际序号为该数加上HardenedKeyStart。
+func ParseDerivationPath(path string) ([]uint32, error) {
+	parts := strings.Split(strings.TrimSpace(path), "/")
+	if parts[0] != "m" {
+		return nil, fmt.Errorf("派生路径(%s)必须以m开头", path)
+	}
+
+	indexes := make([]uint32, 0, len(parts)-1)
+	for _, part := range parts[1:] {
+		hardened := false
+		if strings.HasSuffix(part, "'") || strings.HasSuffix(part, "h") || strings.HasSuffix(part, "H") {
+			hardened = true
+			part = part[:len(part)-1]
+		}
+
+		index, err := strconv.ParseUint(part, 10, 32)
+		if err != nil || index >= uint64(HardenedKeyStart) {
+			return nil, fmt.Errorf("派生路径(%s)中有无效的序号(%s)", path, part)
+		}
+		if hardened {
+			index += uint64(HardenedKeyStart)
+		}
+		indexes = append(indexes, uint32(index))
+	}
+	return indexes, nil
+}
+
+// 把大端字节序的v附加到b后面。
+func appendUint32(b []byte, v uint32) []byte {
+	var buf [4]byte
+	binary.BigEndian.PutUint32(buf[:], v)
+	return append(b, buf[:]...)
+}
+
+// 计算HMAC-SHA512并分成左右两个32字节的部分。
+func hmacSHA512(key, data []byte) ([]byte, []byte) {
+	mac := hmac.New(sha512.New, key)
+	mac.Write(data)
+	sum := mac.Sum(nil)
+	return sum[:32], sum[32:]
+}
@@ -0,0 +1,116 @@
+package crypto
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// 测试派生路径的解析。
+func TestParseDerivationPath(t *testing.T) {
+	indexes, err := ParseDerivationPath("m/44'/0H/1h/2/2147483647")
+	assert.Nil(t, err)
+	assert.Equal(t, []uint32{HardenedKeyStart + 44, HardenedKeyStart, HardenedKeyStart + 1, 2, 2147483647}, indexes)
+
+	indexes, err = ParseDerivationPath("m")
+	assert.Nil(t, err)
+	assert.Empty(t, indexes)
+
+	for _, path := range []string{"", "44'/0'", "m/", "m/-1", "m/2147483648", "m/1''", "m/x"} {
+		_, err := ParseDerivationPath(path)
+		assert.NotNil(t, err, path)
+	}
+}
+
+// 测试分层确定性密钥的派生，向量来自SLIP-10中nist256p1曲线的测试向量，
+// 包括强化派生、非强化派生和得到无效子密钥时的重新计算。
+func TestExtendedKey(t *testing.T) {
+	vectors := []struct {
+		seed string
+		path string
+		// 每一级的链码、私钥和压缩公钥
+		chainCode, private, public string
+	}{
+		{"000102030405060708090a0b0c0d0e0f", "m",
+			"beeb672fe4621673f722f38529c07392fecaa61015c80c34f29ce8b41b3cb6ea",
+			"612091aaa12e22dd2abef664f8a01a82cae99ad7441b7ef8110424915c268bc2",
+			"0266874dc6ade47b3ecd096745ca09bcd29638dd52c2c12117b11ed3e458cfa9e8"},
+		{"000102030405060708090a0b0c0d0e0f", "m/0H",
+			"3460cea53e6a6bb5fb391eeef3237ffd8724bf0a40e94943c98b83825342ee11",
+			"6939694369114c67917a182c59ddb8cafc3004e63ca5d3b84403ba8613debc0c",
+			"0384610f5ecffe8fda089363a41f56a5c7ffc1d81b59a612d0d649b2d22355590c"},
+		{"000102030405060708090a0b0c0d0e0f", "m/0H/1",
+			"4187afff1aafa8445010097fb99d23aee9f599450c7bd140b6826ac22ba21d0c",
+			"284e9d38d07d21e4e281b645089a94f4cf5a5a81369acf151a1c3a57f18b2129",
+			"03526c63f8d0b4bbbf9c80df553fe66742df4676b241dabefdef67733e070f6844"},
+		{"000102030405060708090a0b0c0d0e0f", "m/0H/1/2H/2/1000000000",
+			"b9b7b82d326bb9cb5b5b121066feea4eb93d5241103c9e7a18aad40f1dde8059",
+			"21c4f269ef0a5fd1badf47eeacebeeaa3de22eb8e5b0adcd0f27dd99d34d0119",
+			"02216cd26d31147f72427a453c443ed2cde8a1e53c9cc44e5ddf739725413fe3f4"},
+		{"fffcf9f6f3f0edeae7e4e1dedbd8d5d2cfccc9c6c3c0bdbab7b4b1aeaba8a5a29f9c999693908d8a8784817e7b7875726f6c696663605d5a5754514e4b484542",
+			"m/0/2147483647H/1/2147483646H/2",
+			"3bfb29ee8ac4484f09db09c2079b520ea5616df7820f071a20320366fbe226a7",
+			"bb0a77ba01cc31d77205d51d08bd313b979a71ef4de9b062f8958297e746bd67",
+			"020ee02e18967237cf62672983b253ee62fa4dd431f8243bfeccdf39dbe181387f"},
+		// 派生m/28578H/33941时IL不小于曲线的阶，需要重新计算
+		{"000102030405060708090a0b0c0d0e0f", "m/28578H/33941",
+			"9e87fe95031f14736774cd82f25fd885065cb7c358c1edf813c72af535e83071",
+			"092154eed4af83e078ff9b84322015aefe5769e31270f62c3f66c33888335f3a",
+			"0235bfee614c0d5b2cae260000bb1d0d84b270099ad790022c1ae0b2e782efe120"},
+	}
+
+	for _, v := range vectors {
+		seed, _ := hex.DecodeString(v.seed)
+		master, err := NewMasterKey(seed)
+		assert.Nil(t, err)
+		key, err := master.Derive(v.path)
+		assert.Nil(t, err)
+
+		priKey, err := key.PrivateKey()
+		assert.Nil(t, err)
+		assert.Equal(t, v.chainCode, hex.EncodeToString(key.ChainCode()), v.path)
+		assert.Equal(t, v.private, hex.EncodeToString(priKey.Bytes()), v.path)
+		assert.Equal(t, v.public, hex.EncodeToString(key.PublicKey().ToSlice()), v.path)
+		assert.Equal(t, priKey.PublicKey().Address(), key.PublicKey().Address())
+	}
+
+	// 从公钥派生的非强化子公钥与从私钥派生的一致，但不能派生强化子密钥
+	seed, _ := hex.DecodeString("000102030405060708090a0b0c0d0e0f")
+	master, err := NewMasterKey(seed)
+	assert.Nil(t, err)
+	account, err := master.Derive("m/0H")
+	assert.Nil(t, err)
+	fromPrivate, err := account.Derive("m/1/2")
+	assert.Nil(t, err)
+	fromPublic, err := account.Neuter().Derive("m/1/2")
+	assert.Nil(t, err)
+	assert.Equal(t, fromPrivate.PublicKey().ToSlice(), fromPublic.PublicKey().ToSlice())
+	assert.Equal(t, fromPrivate.ChainCode(), fromPublic.ChainCode())
+	assert.Equal(t, uint8(3), fromPublic.Depth())
+	assert.Equal(t, uint32(2), fromPublic.Index())
+	_, err = fromPublic.PrivateKey()
+	assert.NotNil(t, err)
+	_, err = account.Neuter().Child(HardenedKeyStart)
+	assert.Equal(t, ErrHardenedPublicDerivation, err)
+
+	_, err = NewMasterKey(seed[:8])
+	assert.NotNil(t, err)
+
+	// 同一助记词沿默认路径派生的地址保持不变
+	mnemonicSeed, err := MnemonicToSeed("abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about", "")
+	assert.Nil(t, err)
+	master, err = NewMasterKey(mnemonicSeed)
+	assert.Nil(t, err)
+	key, err := master.Derive(DefaultDerivationPath)
+	assert.Nil(t, err)
+	priKey, err := key.PrivateKey()
+	assert.Nil(t, err)
+	assert.Equal(t, "e38b34854395294d4c9cebdc81b8846a2509a9d8166d113dd99be70a3b2f50cc", hex.EncodeToString(priKey.Bytes()))
+	assert.Equal(t, "e9cee5c2facb66061cd817095559c6d79c2b69d6", hex.EncodeToString(priKey.PublicKey().Address().ToSlice()))
+
+	// 派生的私钥可以正常签名
+	sig, err := priKey.Sign([]byte("hello"))
+	assert.Nil(t, err)
+	assert.True(t, sig.Verify(priKey.PublicKey(), []byte("hello")))
+}
@@ -0,0 +1,24 @@
+package crypto
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/Luboy23/Blockchain_Project/types"
+)
+
+// 读取未加密的私钥文件，文件内容为私钥标量的十六进制字符串。
+// 私钥应保存在加密的密钥库中，该函数只用于把这样的私钥导入密钥库。
+func ReadKeyFile(path string) (PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return PrivateKey{}, err
+	}
+
+	b, err := types.DecodeHex(strings.TrimSpace(string(data)))
+	if err != nil {
+		return PrivateKey{}, fmt.Errorf("读取私钥文件(%s)失败：%s", path, err)
+	}
+	return PrivateKeyFromBytes(b)
+}
@@ -1,65 +1,206 @@
 package crypto
 
 import (
-	"crypto/ecdsa"
-	"crypto/elliptic"
-	"crypto/rand"
 	"crypto/sha256"
+	"fmt"
 	"math/big"
 
 	"github.com/Luboy23/Blockchain_Project/types"
 )
 
-// 定义了一个私钥结构体，包含一个ecdsa.PrivateKey。
+// 定义了一个私钥结构体，包含签名方案和按方案编码的私钥。
 type PrivateKey struct {
-	key *ecdsa.PrivateKey
+	scheme Scheme
+	key    []byte
+	public []byte // 缓存的公钥，避免每次都重新计算
 }
 
-// 定义了一个公钥结构体，包含一个ecdsa.PublicKey。
+// 定义了一个公钥结构体，包含密钥类型和按方案编码的公钥：ECDSA方案为33字节的压缩点，Ed25519为32字节。
 type PublicKey struct {
-	Key *ecdsa.PublicKey
+	Type KeyType
+	Key  []byte
 }
 
-// 定义了一个签名结构体，包含两个大整数R和S。
+// 定义了一个签名结构体，包含密钥类型、两个大整数R和S以及可选的恢复标识。
+// Ed25519的64字节签名按前后两半分别存放在R和S中。
 type Signature struct {
-	R *big.Int
-	S *big.Int
+	Type KeyType
+	R    *big.Int
+	S    *big.Int
+	V    byte // 可恢复签名的恢复标识加上recoveryIDOffset，为0时签名不可恢复
 }
 
-// 使用私钥对数据进行签名，返回一个签名结构体。
+// 可恢复签名中V与恢复标识的差，与比特币和以太坊的紧凑签名一致。
+const recoveryIDOffset = 27
+
+// 使用私钥对数据进行签名，返回一个签名结构体。数据的摘要由签名方案计算。
 func (k PrivateKey) Sign(data []byte) (*Signature, error) {
-	r, s, err := ecdsa.Sign(rand.Reader, k.key, data) // 使用私钥对数据进行签名
+	r, s, err := k.scheme.Sign(k.key, data) // 使用私钥对数据进行签名
 	if err != nil {
 		return nil, err // 如果签名失败，返回错误
 	}
 
 	return &Signature{ // 返回签名结构体
-		R: r,
-		S: s,
+		Type: k.scheme.Type(),
+		R:    r,
+		S:    s,
+	}, nil
+}
+
+// 使用私钥对数据进行可恢复的签名，验证者可以从签名和数据恢复出公钥。
+// 签名方案不支持恢复公钥时返回ErrNotRecoverable。
+func (k PrivateKey) SignRecoverable(data []byte) (*Signature, error) {
+	scheme, ok := k.scheme.(RecoverableScheme)
+	if !ok {
+		return nil, fmt.Errorf("%w(%s)", ErrNotRecoverable, k.scheme.Type())
+	}
+
+	r, s, recoveryID, err := scheme.SignRecoverable(k.key, data)
+	if err != nil {
+		return nil, err
+	}
+	return &Signature{
+		Type: k.scheme.Type(),
+		R:    r,
+		S:    s,
+		V:    recoveryID + recoveryIDOffset,
 	}, nil
 }
 
-// 生成一个新的私钥。
+// 生成一个新的P-256私钥。
 func GeneratePrivatekey() PrivateKey {
-	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader) // 生成一个新的ecdsa私钥
+	key, err := GenerateKey(KeyTypeP256)
 	if err != nil {
 		panic(err) // 如果生成失败，抛出异常
 	}
-	return PrivateKey{ // 返回新生成的私钥
-		key: key,
+	return key
+}
+
+// 生成一个指定类型的新私钥。
+func GenerateKey(t KeyType) (PrivateKey, error) {
+	scheme, err := SchemeOf(t)
+	if err != nil {
+		return PrivateKey{}, err
 	}
+
+	b, err := scheme.GenerateKey()
+	if err != nil {
+		return PrivateKey{}, err
+	}
+	return ParsePrivateKey(t, b)
+}
+
+// 返回私钥的类型。
+func (k PrivateKey) Type() KeyType {
+	return k.scheme.Type()
+}
+
+// 返回按方案编码的私钥：ECDSA方案为32字节大端字节序的标量，Ed25519为32字节的种子。
+func (k PrivateKey) Bytes() []byte {
+	return append([]byte{}, k.key...)
+}
+
+// 从32字节的标量还原P-256私钥。
+func PrivateKeyFromBytes(b []byte) (PrivateKey, error) {
+	return ParsePrivateKey(KeyTypeP256, b)
+}
+
+// 从按方案编码的字节还原指定类型的私钥。
+func ParsePrivateKey(t KeyType, b []byte) (PrivateKey, error) {
+	scheme, err := SchemeOf(t)
+	if err != nil {
+		return PrivateKey{}, err
+	}
+
+	public, err := scheme.PublicKey(b)
+	if err != nil {
+		return PrivateKey{}, err
+	}
+	return PrivateKey{scheme: scheme, key: append([]byte{}, b...), public: public}, nil
 }
 
 // 返回与私钥对应的公钥。
 func (k PrivateKey) PublicKey() PublicKey {
 	return PublicKey{ // 返回公钥结构体
-		Key: &k.key.PublicKey,
+		Type: k.scheme.Type(),
+		Key:  append([]byte{}, k.public...),
 	}
 }
 
-// 将公钥转换为字节切片。
+// 非P-256公钥编码时的标记字节。压缩点总是以0x02或0x03开头，因此以0x00开头的编码不会与P-256公钥混淆。
+const typedKeyMarker = 0x00
+
+// 将公钥转换为字节切片。P-256公钥为压缩格式，与引入其他方案之前的编码相同；
+// 其他方案的公钥为标记字节0x00、密钥类型和公钥的拼接。空公钥返回空切片。
 func (k PublicKey) ToSlice() []byte {
-	return elliptic.MarshalCompressed(k.Key, k.Key.X, k.Key.Y) // 使用椭圆曲线压缩格式将公钥转换为字节切片
+	if len(k.Key) == 0 {
+		return []byte{}
+	}
+	if k.Type == KeyTypeP256 {
+		return append([]byte{}, k.Key...)
+	}
+	return append([]byte{typedKeyMarker, byte(k.Type)}, k.Key...)
+}
+
+// 实现gob.GobEncoder接口，使用ToSlice的编码，避免直接编码椭圆曲线的内部结构。
+func (k PublicKey) GobEncode() ([]byte, error) {
+	return k.ToSlice(), nil // 空公钥编码为空字节切片
+}
+
+// 实现gob.GobDecoder接口，从ToSlice的编码还原公钥。
+func (k *PublicKey) GobDecode(data []byte) error {
+	if len(data) == 0 {
+		*k = PublicKey{}
+		return nil
+	}
+
+	key, err := PublicKeyFromBytes(data)
+	if err != nil {
+		return err
+	}
+
+	*k = key
+	return nil
+}
+
+// 从ToSlice的编码还原公钥，并按密钥类型检查公钥是否有效。
+func PublicKeyFromBytes(data []byte) (PublicKey, error) {
+	key := PublicKey{Type: KeyTypeP256, Key: data}
+	if len(data) > 0 && data[0] == typedKeyMarker {
+		if len(data) < 2 {
+			return PublicKey{}, fmt.Errorf("公钥缺少密钥类型")
+		}
+		key = PublicKey{Type: KeyType(data[1]), Key: data[2:]}
+	}
+
+	scheme, err := SchemeOf(key.Type)
+	if err != nil {
+		return PublicKey{}, err
+	}
+	if err := scheme.ValidatePublicKey(key.Key); err != nil {
+		return PublicKey{}, err
+	}
+
+	key.Key = append([]byte{}, key.Key...)
+	return key, nil
+}
+
+// 实现encoding.TextMarshaler接口，编码为0x开头的ToSlice编码的十六进制字符串，空公钥编码为空字符串。
+func (k PublicKey) MarshalText() ([]byte, error) {
+	if len(k.Key) == 0 {
+		return []byte{}, nil
+	}
+	return []byte(types.EncodeHex(k.ToSlice())), nil
+}
+
+// 实现encoding.TextUnmarshaler接口，从十六进制字符串还原公钥。
+func (k *PublicKey) UnmarshalText(text []byte) error {
+	data, err := types.DecodeHex(string(text))
+	if err != nil {
+		return err
+	}
+
+	return k.GobDecode(data)
 }
 
 // 计算公钥对应的地址。
@@ -69,7 +210,106 @@ func (k PublicKey) Address() types.Address {
 	return types.AddressFromBytes(h[len(h)-20:]) // 返回地址
 }
 
-// 验证签名是否有效。
+// 签名的文本编码中R和S各占的字节数。
+const signatureScalarSize = 32
+
+// 返回签名是否携带恢复标识。
+func (sig *Signature) Recoverable() bool {
+	return sig.V != 0
+}
+
+// 从可恢复的签名和数据恢复签名者的公钥。
+func (sig *Signature) RecoverPublicKey(data []byte) (PublicKey, error) {
+	if sig.R == nil || sig.S == nil {
+		return PublicKey{}, fmt.Errorf("签名不完整")
+	}
+	if sig.V < recoveryIDOffset || sig.V > recoveryIDOffset+3 {
+		return PublicKey{}, fmt.Errorf("签名没有有效的恢复标识(%d)", sig.V)
+	}
+
+	scheme, err := SchemeOf(sig.Type)
+	if err != nil {
+		return PublicKey{}, err
+	}
+	recoverable, ok := scheme.(RecoverableScheme)
+	if !ok {
+		return PublicKey{}, fmt.Errorf("%w(%s)", ErrNotRecoverable, sig.Type)
+	}
+
+	key, err := recoverable.RecoverPublicKey(data, sig.R, sig.S, sig.V-recoveryIDOffset)
+	if err != nil {
+		return PublicKey{}, err
+	}
+	return PublicKey{Type: sig.Type, Key: key}, nil
+}
+
+// 实现encoding.TextMarshaler接口，编码为0x开头的十六进制字符串。
+// 不可恢复的P-256签名的内容为定长的R和S拼接，其他方案的签名在前面加上一个字节的密钥类型，
+// 可恢复的签名总是带有密钥类型，并在最后附加一个字节的V。
+func (sig Signature) MarshalText() ([]byte, error) {
+	if sig.R == nil || sig.S == nil {
+		return nil, fmt.Errorf("签名不完整")
+	}
+	if sig.R.Sign() < 0 || sig.S.Sign() < 0 || sig.R.BitLen() > signatureScalarSize*8 || sig.S.BitLen() > signatureScalarSize*8 {
+		return nil, fmt.Errorf("签名的R或S超过%d字节", signatureScalarSize)
+	}
+
+	var prefix []byte
+	if sig.Type != KeyTypeP256 || sig.Recoverable() {
+		prefix = []byte{byte(sig.Type)}
+	}
+	b := make([]byte, len(prefix)+2*signatureScalarSize)
+	copy(b, prefix)
+	sig.R.FillBytes(b[len(prefix) : len(prefix)+signatureScalarSize])
+	sig.S.FillBytes(b[len(prefix)+signatureScalarSize:])
+	if sig.Recoverable() {
+		b = append(b, sig.V)
+	}
+
+	return []byte(types.EncodeHex(b)), nil
+}
+
+// 实现encoding.TextUnmarshaler接口，从十六进制字符串还原签名。
+func (sig *Signature) UnmarshalText(text []byte) error {
+	b, err := types.DecodeHex(string(text))
+	if err != nil {
+		return err
+	}
+
+	t, v := KeyTypeP256, byte(0)
+	switch len(b) {
+	case 2 * signatureScalarSize:
+	case 1 + 2*signatureScalarSize:
+		t, b = KeyType(b[0]), b[1:]
+	case 2 + 2*signatureScalarSize:
+		t, v, b = KeyType(b[0]), b[len(b)-1], b[1:len(b)-1]
+		if v < recoveryIDOffset || v > recoveryIDOffset+3 {
+			return fmt.Errorf("签名没有有效的恢复标识(%d)", v)
+		}
+	default:
+		return fmt.Errorf("签名的长度应该为%d到%d字节，而不是%d字节", 2*signatureScalarSize, 2+2*signatureScalarSize, len(b))
+	}
+	if _, err := SchemeOf(t); err != nil {
+		return err
+	}
+
+	sig.Type = t
+	sig.R = new(big.Int).SetBytes(b[:signatureScalarSize])
+	sig.S = new(big.Int).SetBytes(b[signatureScalarSize:])
+	sig.V = v
+
+	return nil
+}
+
+// 验证签名是否有效。签名和公钥的密钥类型必须相同，验证由该类型的签名方案完成，恢复标识不参与验证。
 func (sig *Signature) Verify(pubKey PublicKey, data []byte) bool {
-	return ecdsa.Verify(pubKey.Key, data, sig.R, sig.S) // 使用公钥和数据验证签名
+	if sig.R == nil || sig.S == nil || sig.Type != pubKey.Type {
+		return false
+	}
+
+	scheme, err := SchemeOf(sig.Type)
+	if err != nil {
+		return false
+	}
+	return scheme.Verify(pubKey.Key, data, sig.R, sig.S)
 }
@@ -2,8 +2,11 @@ package crypto
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
 	"testing"
 
+	"github.com/Luboy23/Blockchain_Project/types"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -52,3 +55,69 @@ func TestKeypairSignVerifyFail(t *testing.T) {
 
 	assert.False(t, sig1.Verify(pubKey1, []byte("ashdjkadhjsahdakjs"))) // 断言使用不同的消息验证第一个签名失败
 }
+
+// 测试签名覆盖整个消息，而不仅仅是前32个字节。
+func TestKeypairSignLongMessage(t *testing.T) {
+	priKey := GeneratePrivatekey() // 生成一个新的私钥
+	pubKey := priKey.PublicKey() // 获取私钥对应的公钥
+
+	msg := make([]byte, 64) // 定义一个长度超过32字节的消息
+	sig, err := priKey.Sign(msg)
+	assert.Nil(t, err)
+	assert.True(t, sig.Verify(pubKey, msg))
+
+	msg[63] = 1 // 修改消息的最后一个字节
+	assert.False(t, sig.Verify(pubKey, msg)) // 断言签名验证失败
+}
+
+// 测试公钥和签名的十六进制文本编码。
+func TestKeypairTextEncoding(t *testing.T) {
+	priKey := GeneratePrivatekey()
+	pubKey := priKey.PublicKey()
+	sig, err := priKey.Sign([]byte("hello,world"))
+	assert.Nil(t, err)
+
+	text, err := pubKey.MarshalText()
+	assert.Nil(t, err)
+	decodedKey := PublicKey{}
+	assert.Nil(t, decodedKey.UnmarshalText(text))
+	assert.Equal(t, pubKey.Address(), decodedKey.Address())
+
+	text, err = sig.MarshalText()
+	assert.Nil(t, err)
+	assert.Len(t, text, 2+2*2*signatureScalarSize) // 0x加上定长的R和S
+	decodedSig := Signature{}
+	assert.Nil(t, decodedSig.UnmarshalText(text))
+	assert.True(t, decodedSig.Verify(decodedKey, []byte("hello,world")))
+
+	assert.NotNil(t, decodedKey.UnmarshalText([]byte("0x1234")))
+	assert.NotNil(t, decodedSig.UnmarshalText([]byte("0x1234")))
+}
+
+// 测试私钥的字节表示可以还原出相同的私钥。
+func TestPrivateKeyFromBytes(t *testing.T) {
+	priKey := GeneratePrivatekey()
+	restored, err := PrivateKeyFromBytes(priKey.Bytes())
+	assert.Nil(t, err)
+	assert.Equal(t, priKey.PublicKey().Address(), restored.PublicKey().Address())
+
+	sig, err := restored.Sign([]byte("hello,world"))
+	assert.Nil(t, err)
+	assert.True(t, sig.Verify(priKey.PublicKey(), []byte("hello,world")))
+
+	_, err = PrivateKeyFromBytes(make([]byte, 32))
+	assert.NotNil(t, err)
+	_, err = PrivateKeyFromBytes(make([]byte, 31))
+	assert.NotNil(t, err)
+}
+
+// 测试读取未加密的私钥文件。
+func TestReadKeyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "key")
+	priKey := GeneratePrivatekey()
+	assert.Nil(t, os.WriteFile(path, []byte(types.EncodeHex(priKey.Bytes())+"\n"), 0600))
+
+	restored, err := ReadKeyFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, priKey.PublicKey().Address(), restored.PublicKey().Address())
+}
@@ -0,0 +1,213 @@
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/Luboy23/Blockchain_Project/types"
+	"golang.org/x/crypto/scrypt"
+)
+
+// 密钥库文件格式的版本号。
+const keystoreVersion = 1
+
+// 密钥库使用的加密算法和密钥派生函数。
+const (
+	keystoreCipher = "aes-256-gcm"
+	keystoreKDF    = "scrypt"
+)
+
+// 解密密钥库时密码错误或文件被篡改时返回的错误。
+var ErrKeystorePassword = errors.New("密码错误或密钥库文件已损坏")
+
+// 派生加密密钥使用的scrypt参数。
+type ScryptParams struct {
+	N      int            `json:"n"` // CPU和内存开销，必须是2的幂
+	R      int            `json:"r"` // 块大小
+	P      int            `json:"p"` // 并行度
+	KeyLen int            `json:"keyLen"`
+	Salt   types.HexBytes `json:"salt"`
+}
+
+// 标准强度的scrypt参数，派生一次约需256MB内存。
+var StandardScryptParams = ScryptParams{N: 1 << 18, R: 8, P: 1, KeyLen: 32}
+
+// 较弱的scrypt参数，派生一次约需4MB内存，用于测试或资源受限的环境。
+var LightScryptParams = ScryptParams{N: 1 << 12, R: 8, P: 6, KeyLen: 32}
+
+// scrypt参数的上限：N和R不超过标准参数，P不超过maxScryptP，因此解密不可信的密钥库文件时内存和耗时都有上限。
+const maxScryptP = 16
+
+// 密钥库使用的盐的字节数。
+const keystoreSaltSize = 32
+
+// 密钥库中加密的部分。
+type KeystoreCrypto struct {
+	Cipher     string         `json:"cipher"`
+	CipherText types.HexBytes `json:"ciphertext"`
+	Nonce      types.HexBytes `json:"nonce"`
+	KDF        string         `json:"kdf"`
+	KDFParams  ScryptParams   `json:"kdfparams"`
+}
+
+// 以JSON保存的加密私钥。私钥用scrypt从密码派生的密钥以AES-256-GCM加密，
+// 版本号和地址作为附加数据参与认证，修改其中任何一个都会导致解密失败。
+// 地址由带密钥类型的公钥计算，修改密钥类型会导致解密出的私钥与地址不符。
+type Keystore struct {
+	Version int            `json:"version"`
+	KeyType KeyType        `json:"keyType,omitempty"` // P-256时省略，与引入其他方案之前的文件相同
+	Address types.Address  `json:"address"`
+	Crypto  KeystoreCrypto `json:"crypto"`
+}
+
+// 使用密码和scrypt参数加密私钥，每次加密使用新的随机盐和随机数。
+func EncryptKey(key PrivateKey, password string, params ScryptParams) (*Keystore, error) {
+	params.Salt = make([]byte, keystoreSaltSize)
+	if _, err := rand.Read(params.Salt); err != nil {
+		return nil, err
+	}
+
+	ks := &Keystore{
+		Version: keystoreVersion,
+		KeyType: key.Type(),
+		Address: key.PublicKey().Address(),
+		Crypto: KeystoreCrypto{
+			Cipher:    keystoreCipher,
+			KDF:       keystoreKDF,
+			KDFParams: params,
+		},
+	}
+
+	aead, err := ks.aead(password)
+	if err != nil {
+		return nil, err
+	}
+	ks.Crypto.Nonce = make([]byte, aead.NonceSize())
+	if _, err := rand.Read(ks.Crypto.Nonce); err != nil {
+		return nil, err
+	}
+	ks.Crypto.CipherText = aead.Seal(nil, ks.Crypto.Nonce, key.Bytes(), ks.additionalData())
+
+	return ks, nil
+}
+
+// 使用密码解密私钥。密码错误或内容被篡改时返回ErrKeystorePassword。
+func DecryptKey(ks *Keystore, password string) (PrivateKey, error) {
+	if ks.Version != keystoreVersion {
+		return PrivateKey{}, fmt.Errorf("不支持的密钥库版本(%d)", ks.Version)
+	}
+	if ks.Crypto.Cipher != keystoreCipher {
+		return PrivateKey{}, fmt.Errorf("不支持的加密算法(%s)", ks.Crypto.Cipher)
+	}
+	if ks.Crypto.KDF != keystoreKDF {
+		return PrivateKey{}, fmt.Errorf("不支持的密钥派生函数(%s)", ks.Crypto.KDF)
+	}
+
+	aead, err := ks.aead(password)
+	if err != nil {
+		return PrivateKey{}, err
+	}
+	if len(ks.Crypto.Nonce) != aead.NonceSize() {
+		return PrivateKey{}, fmt.Errorf("随机数的长度应该为%d字节，而不是%d字节", aead.NonceSize(), len(ks.Crypto.Nonce))
+	}
+	plain, err := aead.Open(nil, ks.Crypto.Nonce, ks.Crypto.CipherText, ks.additionalData())
+	if err != nil {
+		return PrivateKey{}, ErrKeystorePassword
+	}
+
+	key, err := ParsePrivateKey(ks.KeyType, plain)
+	if err != nil {
+		return PrivateKey{}, err
+	}
+	if key.PublicKey().Address() != ks.Address {
+		return PrivateKey{}, fmt.Errorf("私钥与密钥库中的地址(%s)不符", ks.Address)
+	}
+	return key, nil
+}
+
+// 从密码派生密钥并创建AES-GCM。
+func (ks *Keystore) aead(password string) (cipher.AEAD, error) {
+	p := ks.Crypto.KDFParams
+	if err := p.validate(); err != nil {
+		return nil, err
+	}
+	derived, err := scrypt.Key([]byte(password), p.Salt, p.N, p.R, p.P, p.KeyLen)
+	if err != nil {
+		return nil, fmt.Errorf("派生密钥失败：%s", err)
+	}
+
+	block, err := aes.NewCipher(derived)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// 检查scrypt参数，在派生密钥之前拒绝会导致分配大量内存的参数。
+func (p ScryptParams) validate() error {
+	if p.KeyLen != 32 {
+		return fmt.Errorf("AES-256需要32字节的密钥，而不是%d字节", p.KeyLen)
+	}
+	if len(p.Salt) != keystoreSaltSize {
+		return fmt.Errorf("盐的长度应该为%d字节，而不是%d字节", keystoreSaltSize, len(p.Salt))
+	}
+	if p.N < 2 || p.N > StandardScryptParams.N || p.N&(p.N-1) != 0 {
+		return fmt.Errorf("scrypt参数N(%d)必须是不超过%d的2的幂", p.N, StandardScryptParams.N)
+	}
+	if p.R < 1 || p.R > StandardScryptParams.R {
+		return fmt.Errorf("scrypt参数R(%d)必须在1到%d之间", p.R, StandardScryptParams.R)
+	}
+	if p.P < 1 || p.P > maxScryptP {
+		return fmt.Errorf("scrypt参数P(%d)必须在1到%d之间", p.P, maxScryptP)
+	}
+	return nil
+}
+
+// 参与认证的附加数据：版本号和地址。
+func (ks *Keystore) additionalData() []byte {
+	ad := make([]byte, 4, 4+len(ks.Address))
+	binary.BigEndian.PutUint32(ad, uint32(ks.Version))
+	return append(ad, ks.Address[:]...)
+}
+
+// 使用密码加密私钥并写入新的密钥库文件，只有所有者可以读写。文件已存在时返回错误，避免覆盖已有的私钥。
+func WriteKeystore(path string, key PrivateKey, password string, params ScryptParams) error {
+	ks, err := EncryptKey(key, password, params)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(ks, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// 读取密钥库文件并使用密码解密私钥。
+func ReadKeystore(path, password string) (PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return PrivateKey{}, err
+	}
+
+	ks := &Keystore{}
+	if err := json.Unmarshal(data, ks); err != nil {
+		return PrivateKey{}, fmt.Errorf("解析密钥库文件(%s)失败：%s", path, err)
+	}
+	return DecryptKey(ks, password)
+}
@@ -0,0 +1,84 @@
+package crypto
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// 测试密钥库的加密和解密，以及密码错误、内容被篡改和文件已存在的情况。
+func TestKeystore(t *testing.T) {
+	priKey := GeneratePrivatekey()
+	ks, err := EncryptKey(priKey, "password", LightScryptParams)
+	assert.Nil(t, err)
+	assert.Equal(t, priKey.PublicKey().Address(), ks.Address)
+
+	decrypted, err := DecryptKey(ks, "password")
+	assert.Nil(t, err)
+	assert.Equal(t, priKey.Bytes(), decrypted.Bytes())
+
+	_, err = DecryptKey(ks, "wrong")
+	assert.Equal(t, ErrKeystorePassword, err)
+
+	// JSON编解码后仍然可以解密，修改地址后认证失败
+	data, err := json.Marshal(ks)
+	assert.Nil(t, err)
+	decoded := &Keystore{}
+	assert.Nil(t, json.Unmarshal(data, decoded))
+	_, err = DecryptKey(decoded, "password")
+	assert.Nil(t, err)
+	decoded.Address[0] ^= 1
+	_, err = DecryptKey(decoded, "password")
+	assert.Equal(t, ErrKeystorePassword, err)
+
+	decoded.Version = 2
+	_, err = DecryptKey(decoded, "password")
+	assert.NotNil(t, err)
+
+	path := filepath.Join(t.TempDir(), "keystore.json")
+	assert.Nil(t, WriteKeystore(path, priKey, "password", LightScryptParams))
+	assert.NotNil(t, WriteKeystore(path, GeneratePrivatekey(), "password", LightScryptParams))
+	restored, err := ReadKeystore(path, "password")
+	assert.Nil(t, err)
+	assert.Equal(t, priKey.PublicKey().Address(), restored.PublicKey().Address())
+
+	// 其他方案的私钥保留密钥类型，修改密钥类型后私钥与地址不符
+	edKey, err := GenerateKey(KeyTypeEd25519)
+	assert.Nil(t, err)
+	ks, err = EncryptKey(edKey, "password", LightScryptParams)
+	assert.Nil(t, err)
+	assert.Equal(t, KeyTypeEd25519, ks.KeyType)
+	decrypted, err = DecryptKey(ks, "password")
+	assert.Nil(t, err)
+	assert.Equal(t, edKey.PublicKey(), decrypted.PublicKey())
+	ks.KeyType = KeyTypeSecp256k1
+	_, err = DecryptKey(ks, "password")
+	assert.NotNil(t, err)
+}
+
+// 测试解密前拒绝超出上限的scrypt参数和长度不正确的盐。
+func TestKeystoreScryptLimits(t *testing.T) {
+	ks, err := EncryptKey(GeneratePrivatekey(), "password", LightScryptParams)
+	assert.Nil(t, err)
+
+	for _, modify := range []func(p *ScryptParams){
+		func(p *ScryptParams) { p.N = StandardScryptParams.N << 1 },
+		func(p *ScryptParams) { p.N = 1<<12 + 1 },
+		func(p *ScryptParams) { p.R = StandardScryptParams.R + 1 },
+		func(p *ScryptParams) { p.P = maxScryptP + 1 },
+		func(p *ScryptParams) { p.P = 0 },
+		func(p *ScryptParams) { p.Salt = nil },
+		func(p *ScryptParams) { p.Salt = p.Salt[:16] },
+	} {
+		modified := *ks
+		modify(&modified.Crypto.KDFParams)
+		_, err := DecryptKey(&modified, "password")
+		assert.NotNil(t, err)
+		assert.NotEqual(t, ErrKeystorePassword, err)
+	}
+
+	_, err = EncryptKey(GeneratePrivatekey(), "password", ScryptParams{N: 1 << 30, R: 8, P: 1, KeyLen: 32})
+	assert.NotNil(t, err)
+}
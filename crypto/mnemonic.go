@@ -0,0 +1,120 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// 助记词中有不在词表中的单词时返回的错误。
+var ErrMnemonicWord = errors.New("助记词中有无效的单词")
+
+// 助记词的校验和不正确时返回的错误，通常是抄错或顺序错了单词。
+var ErrMnemonicChecksum = errors.New("助记词的校验和不正确")
+
+// 从助记词派生种子时PBKDF2的迭代次数，由BIP-39规定。
+const mnemonicSeedIterations = 2048
+
+// 助记词单词到词表序号的映射。
+var mnemonicIndex = func() map[string]int {
+	index := make(map[string]int, len(mnemonicWords))
+	for i, w := range mnemonicWords {
+		index[w] = i
+	}
+	return index
+}()
+
+// 生成新的助记词，bits是熵的位数，必须是128到256之间32的倍数，对应12到24个单词。
+func NewMnemonic(bits int) (string, error) {
+	if err := checkEntropyBits(bits); err != nil {
+		return "", err
+	}
+
+	entropy := make([]byte, bits/8)
+	if _, err := rand.Read(entropy); err != nil {
+		return "", err
+	}
+	return MnemonicFromEntropy(entropy)
+}
+
+// 按BIP-39把熵编码为助记词：熵后面附加SHA-256的前len(entropy)/4位作为校验和，每11位对应一个单词。
+func MnemonicFromEntropy(entropy []byte) (string, error) {
+	if err := checkEntropyBits(len(entropy) * 8); err != nil {
+		return "", err
+	}
+
+	checksum := sha256.Sum256(entropy)
+	data := append(append([]byte{}, entropy...), checksum[0])
+	total := len(entropy)*8 + len(entropy)/4
+
+	words := make([]string, total/11)
+	for i := range words {
+		index := 0
+		for bit := i * 11; bit < (i+1)*11; bit++ {
+			index = index<<1 | int(data[bit/8]>>(7-bit%8)&1)
+		}
+		words[i] = mnemonicWords[index]
+	}
+	return strings.Join(words, " "), nil
+}
+
+// 把助记词还原为熵，同时检查单词和校验和。单词之间可以有任意空白。
+func MnemonicToEntropy(mnemonic string) ([]byte, error) {
+	words := strings.Fields(mnemonic)
+	if len(words) < 12 || len(words) > 24 || len(words)%3 != 0 {
+		return nil, fmt.Errorf("助记词应该有12、15、18、21或24个单词，而不是%d个", len(words))
+	}
+
+	total := len(words) * 11
+	data := make([]byte, (total+7)/8)
+	for i, w := range words {
+		index, ok := mnemonicIndex[w]
+		if !ok {
+			return nil, fmt.Errorf("%w(%s)", ErrMnemonicWord, w)
+		}
+		for j := 0; j < 11; j++ {
+			if index>>(10-j)&1 == 1 {
+				bit := i*11 + j
+				data[bit/8] |= 1 << (7 - bit%8)
+			}
+		}
+	}
+
+	entropy := data[:total*32/33/8]
+	checksumBits := uint(total - len(entropy)*8)
+	checksum := sha256.Sum256(entropy)
+	if data[len(entropy)]>>(8-checksumBits) != checksum[0]>>(8-checksumBits) {
+		return nil, ErrMnemonicChecksum
+	}
+	return entropy, nil
+}
+
+// 检查助记词是否有效。
+func ValidateMnemonic(mnemonic string) error {
+	_, err := MnemonicToEntropy(mnemonic)
+	return err
+}
+
+// 按BIP-39从助记词和可选的口令派生64字节的种子，派生前先检查助记词。
+// 口令按原样的UTF-8字节参与派生，不做NFKD规范化，只包含ASCII字符的口令与其他钱包的结果一致。
+func MnemonicToSeed(mnemonic, passphrase string) ([]byte, error) {
+	if err := ValidateMnemonic(mnemonic); err != nil {
+		return nil, err
+	}
+
+	normalized := strings.Join(strings.Fields(mnemonic), " ")
+	return pbkdf2.Key([]byte(normalized), []byte("mnemonic"+passphrase), mnemonicSeedIterations, 64, sha512.New), nil
+}
+
+// 检查熵的位数。
+func checkEntropyBits(bits int) error {
+	if bits < 128 || bits > 256 || bits%32 != 0 {
+		return fmt.Errorf("熵的位数应该是128到256之间32的倍数，而不是%d", bits)
+	}
+	return nil
+}
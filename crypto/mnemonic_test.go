@@ -0,0 +1,87 @@
+package crypto
+
+import (
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// 测试BIP-39的助记词编码和种子派生，向量来自Trezor的参考实现，口令为TREZOR。
+func TestMnemonic(t *testing.T) {
+	assert.Equal(t, 2048, len(mnemonicWords))
+	assert.Equal(t, 2048, len(mnemonicIndex))
+
+	vectors := []struct {
+		entropy  string
+		mnemonic string
+		seed     string
+	}{
+		{
+			"00000000000000000000000000000000",
+			"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about",
+			"c55257c360c07c72029aebc1b53c05ed0362ada38ead3e3e9efa3708e53495531f09a6987599d18264c1e1c92f2cf141630c7a3c4ab7c81b2f001698e7463b04",
+		},
+		{
+			"ffffffffffffffffffffffffffffffff",
+			"zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo wrong",
+			"ac27495480225222079d7be181583751e86f571027b0497b5b5d11218e0a8a13332572917f0f8e5a589620c6f15b11c61dee327651a14c34e18231052e48c069",
+		},
+		{
+			"808080808080808080808080808080808080808080808080",
+			"letter advice cage absurd amount doctor acoustic avoid letter advice cage absurd amount doctor acoustic avoid letter always",
+			"107d7c02a5aa6f38c58083ff74f04c607c2d2c0ecc55501dadd72d025b751bc27fe913ffb796f841c49b1d33b610cf0e91d3aa239027f5e99fe4ce9e5088cd65",
+		},
+		{
+			"7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f",
+			"legal winner thank year wave sausage worth useful legal winner thank year wave sausage worth useful legal winner thank year wave sausage worth title",
+			"bc09fca1804f7e69da93c2f2028eb238c227f2e9dda30cd63699232578480a4021b146ad717fbb7e451ce9eb835f43620bf5c514db0f8add49f5d121449d3e87",
+		},
+		{
+			"b63a9c59a6e641f288ebc103017f1da9f8290b3da6bdef7b",
+			"renew stay biology evidence goat welcome casual join adapt armor shuffle fault little machine walk stumble urge swap",
+			"9248d83e06f4cd98debf5b6f010542760df925ce46cf38a1bdb4e4de7d21f5c39366941c69e1bdbf2966e0f6e6dbece898a0e2f0a4c2b3e640953dfe8b7bbdc5",
+		},
+		{
+			"15da872c95a13dd738fbf50e427583ad61f18fd99f628c417a61cf8343c90419",
+			"beyond stage sleep clip because twist token leaf atom beauty genius food business side grid unable middle armed observe pair crouch tonight away coconut",
+			"b15509eaa2d09d3efd3e006ef42151b30367dc6e3aa5e44caba3fe4d3e352e65101fbdb86a96776b91946ff06f8eac594dc6ee1d3e82a42dfe1b40fef6bcc3fd",
+		},
+	}
+
+	for _, v := range vectors {
+		entropy, _ := hex.DecodeString(v.entropy)
+		mnemonic, err := MnemonicFromEntropy(entropy)
+		assert.Nil(t, err)
+		assert.Equal(t, v.mnemonic, mnemonic)
+
+		decoded, err := MnemonicToEntropy(v.mnemonic)
+		assert.Nil(t, err)
+		assert.Equal(t, entropy, decoded)
+
+		seed, err := MnemonicToSeed(v.mnemonic, "TREZOR")
+		assert.Nil(t, err)
+		assert.Equal(t, v.seed, hex.EncodeToString(seed))
+	}
+
+	// 新生成的助记词可以通过检查
+	for _, bits := range []int{128, 160, 192, 224, 256} {
+		mnemonic, err := NewMnemonic(bits)
+		assert.Nil(t, err)
+		entropy, err := MnemonicToEntropy(mnemonic)
+		assert.Nil(t, err)
+		assert.Equal(t, bits/8, len(entropy))
+	}
+	_, err := NewMnemonic(100)
+	assert.NotNil(t, err)
+
+	// 单词错误、校验和错误和单词数量错误
+	err = ValidateMnemonic("jello better achieve collect unaware mountain thought cargo oxygen act hood bridge")
+	assert.True(t, errors.Is(err, ErrMnemonicWord))
+	err = ValidateMnemonic("abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon letter")
+	assert.Equal(t, ErrMnemonicChecksum, err)
+	assert.NotNil(t, ValidateMnemonic("dignity pass list indicate nasty"))
+	_, err = MnemonicToSeed("abandon abandon abandon", "")
+	assert.NotNil(t, err)
+}
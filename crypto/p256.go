@@ -0,0 +1,129 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"math/big"
+)
+
+// NIST P-256上的ECDSA。私钥是32字节的标量，公钥是33字节的压缩点，签名前先对消息做SHA-256。
+type p256Scheme struct{}
+
+func (p256Scheme) Type() KeyType {
+	return KeyTypeP256
+}
+
+func (p256Scheme) GenerateKey() ([]byte, error) {
+	key, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return key.Bytes(), nil
+}
+
+func (s p256Scheme) PublicKey(privateKey []byte) ([]byte, error) {
+	public, err := s.uncompressedPublicKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	compressed := make([]byte, 1+signatureScalarSize)
+	compressed[0] = 2 + public[len(public)-1]&1
+	copy(compressed[1:], public[1:1+signatureScalarSize])
+	return compressed, nil
+}
+
+func (p256Scheme) ValidatePublicKey(publicKey []byte) error {
+	if x, _ := elliptic.UnmarshalCompressed(elliptic.P256(), publicKey); x == nil {
+		return fmt.Errorf("无效的压缩公钥")
+	}
+	return nil
+}
+
+// ECDSA只会使用输入的前32个字节，因此先对数据做SHA-256，保证签名覆盖全部数据。
+func (s p256Scheme) Sign(privateKey, data []byte) (*big.Int, *big.Int, error) {
+	key, err := s.ecdsaKey(privateKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	digest := sha256.Sum256(data)
+	return ecdsa.Sign(rand.Reader, key, digest[:])
+}
+
+func (p256Scheme) Verify(publicKey, data []byte, r, s *big.Int) bool {
+	x, y := elliptic.UnmarshalCompressed(elliptic.P256(), publicKey)
+	if x == nil {
+		return false
+	}
+
+	digest := sha256.Sum256(data)
+	return ecdsa.Verify(&ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, digest[:], r, s)
+}
+
+// 从标量还原ecdsa.PrivateKey，标量必须在1到N-1之间。
+func (s p256Scheme) ecdsaKey(privateKey []byte) (*ecdsa.PrivateKey, error) {
+	public, err := s.uncompressedPublicKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	key := &ecdsa.PrivateKey{D: new(big.Int).SetBytes(privateKey)}
+	key.PublicKey.Curve = elliptic.P256()
+	key.PublicKey.X = new(big.Int).SetBytes(public[1 : 1+signatureScalarSize])
+	key.PublicKey.Y = new(big.Int).SetBytes(public[1+signatureScalarSize:])
+	return key, nil
+}
+
+// 用crypto/ecdh计算65字节的未压缩公钥，标量乘法是常数时间的，标量必须在1到N-1之间。
+func (p256Scheme) uncompressedPublicKey(privateKey []byte) ([]byte, error) {
+	if len(privateKey) != signatureScalarSize {
+		return nil, fmt.Errorf("私钥的长度应该为%d字节，而不是%d字节", signatureScalarSize, len(privateKey))
+	}
+
+	key, err := ecdh.P256().NewPrivateKey(privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("私钥超出了曲线的范围")
+	}
+	return key.PublicKey().Bytes(), nil
+}
+
+// 使用ecdsa.Sign签名，再逐个尝试恢复标识，找到能恢复出自己公钥的那一个。
+func (s p256Scheme) SignRecoverable(privateKey, data []byte) (*big.Int, *big.Int, byte, error) {
+	public, err := s.PublicKey(privateKey)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	r, sig, err := s.Sign(privateKey, data)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	for id := byte(0); id < 4; id++ {
+		recovered, err := s.RecoverPublicKey(data, r, sig, id)
+		if err == nil && bytes.Equal(recovered, public) {
+			return r, sig, id, nil
+		}
+	}
+	return nil, nil, 0, fmt.Errorf("无法计算签名的恢复标识")
+}
+
+// 恢复公钥只处理签名、消息和公钥这些公开的数据，因此可以使用elliptic.Curve的通用运算。
+func (p256Scheme) RecoverPublicKey(data []byte, r, s *big.Int, recoveryID byte) ([]byte, error) {
+	curve := elliptic.P256()
+	decompress := func(b []byte) (*big.Int, *big.Int) {
+		return elliptic.UnmarshalCompressed(curve, b)
+	}
+
+	digest := sha256.Sum256(data)
+	x, y, err := recoverECDSA(curve, curve.Params().P, curve.Params().N, decompress, digest[:], r, s, recoveryID)
+	if err != nil {
+		return nil, err
+	}
+	return elliptic.MarshalCompressed(curve, x, y), nil
+}
@@ -0,0 +1,56 @@
+package crypto
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// 恢复公钥需要的曲线运算，elliptic.Curve实现了这些方法。
+// 这些运算不是常数时间的，只能用于签名、消息和公钥这些公开的数据，不能用于私钥。
+type recoveryCurve interface {
+	ScalarBaseMult(k []byte) (x, y *big.Int)
+	ScalarMult(x, y *big.Int, k []byte) (*big.Int, *big.Int)
+	Add(x1, y1, x2, y2 *big.Int) (*big.Int, *big.Int)
+}
+
+// 从ECDSA签名恢复公钥：由R和恢复标识还原签名时的随机点R'，公钥Q = r⁻¹(s*R' - e*G)。
+// p和n是曲线的域和阶，decompress从压缩格式还原点。
+func recoverECDSA(curve recoveryCurve, p, n *big.Int, decompress func([]byte) (*big.Int, *big.Int), digest []byte, r, s *big.Int, recoveryID byte) (*big.Int, *big.Int, error) {
+	if recoveryID > 3 {
+		return nil, nil, fmt.Errorf("无效的恢复标识(%d)", recoveryID)
+	}
+	if r.Sign() <= 0 || r.Cmp(n) >= 0 || s.Sign() <= 0 || s.Cmp(n) >= 0 {
+		return nil, nil, fmt.Errorf("签名的R或S超出了曲线的范围")
+	}
+
+	// 随机点的横坐标为r或r+n
+	x := new(big.Int).Set(r)
+	if recoveryID&2 != 0 {
+		x.Add(x, n)
+	}
+	if x.Cmp(p) >= 0 {
+		return nil, nil, fmt.Errorf("无法从签名还原随机点")
+	}
+	compressed := make([]byte, 1+signatureScalarSize)
+	compressed[0] = 2 + recoveryID&1
+	x.FillBytes(compressed[1:])
+	rx, ry := decompress(compressed)
+	if rx == nil {
+		return nil, nil, fmt.Errorf("无法从签名还原随机点")
+	}
+
+	// u1 = -e*r⁻¹ mod n，u2 = s*r⁻¹ mod n，Q = u1*G + u2*R'
+	rInv := new(big.Int).ModInverse(r, n)
+	e := new(big.Int).SetBytes(digest)
+	u1 := e.Neg(e).Mul(e, rInv).Mod(e, n)
+	u2 := new(big.Int).Mul(s, rInv)
+	u2.Mod(u2, n)
+
+	x1, y1 := curve.ScalarBaseMult(u1.FillBytes(make([]byte, signatureScalarSize)))
+	x2, y2 := curve.ScalarMult(rx, ry, u2.FillBytes(make([]byte, signatureScalarSize)))
+	qx, qy := curve.Add(x1, y1, x2, y2)
+	if qx.Sign() == 0 && qy.Sign() == 0 {
+		return nil, nil, fmt.Errorf("恢复出的公钥是无穷远点")
+	}
+	return qx, qy, nil
+}
@@ -0,0 +1,109 @@
+package crypto
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// 密钥类型，标识公钥、私钥和签名使用的签名方案。
+type KeyType byte
+
+const (
+	KeyTypeP256      KeyType = iota // NIST P-256上的ECDSA，项目最初使用的方案，也是零值
+	KeyTypeSecp256k1                // secp256k1上的ECDSA，与以太坊等工具兼容
+	KeyTypeEd25519                  // Ed25519，用于与基于HSM的服务互通
+)
+
+// 密钥类型的名称，用于文本编码和命令行参数。
+var keyTypeNames = map[KeyType]string{
+	KeyTypeP256:      "p256",
+	KeyTypeSecp256k1: "secp256k1",
+	KeyTypeEd25519:   "ed25519",
+}
+
+// 密钥类型没有对应的签名方案时返回的错误。
+var ErrUnknownKeyType = errors.New("未知的密钥类型")
+
+// 签名方案，私钥和公钥都以方案自己的定长字节表示，签名统一表示为两个不超过32字节的整数R和S。
+// 签名和验证的输入是完整的消息，方案按自己的规则计算摘要。
+type Scheme interface {
+	// 返回方案的密钥类型。
+	Type() KeyType
+	// 生成新的私钥。
+	GenerateKey() ([]byte, error)
+	// 检查私钥并计算对应的公钥。
+	PublicKey(privateKey []byte) ([]byte, error)
+	// 检查公钥是否有效。
+	ValidatePublicKey(publicKey []byte) error
+	// 使用私钥对消息签名，返回R和S。
+	Sign(privateKey, data []byte) (r, s *big.Int, err error)
+	// 使用公钥验证消息的签名。
+	Verify(publicKey, data []byte, r, s *big.Int) bool
+}
+
+// 支持从签名恢复公钥的签名方案。恢复标识为0到3，最低位是签名时随机点纵坐标的奇偶性，
+// 第二位表示随机点的横坐标是否不小于曲线的阶。
+type RecoverableScheme interface {
+	Scheme
+	// 使用私钥对消息签名，返回R、S和恢复标识。
+	SignRecoverable(privateKey, data []byte) (r, s *big.Int, recoveryID byte, err error)
+	// 从签名和消息恢复签名者的公钥。
+	RecoverPublicKey(data []byte, r, s *big.Int, recoveryID byte) ([]byte, error)
+}
+
+// 签名方案不支持从签名恢复公钥时返回的错误。
+var ErrNotRecoverable = errors.New("签名方案不支持恢复公钥")
+
+// 所有支持的签名方案。
+var schemes = map[KeyType]Scheme{
+	KeyTypeP256:      p256Scheme{},
+	KeyTypeSecp256k1: secp256k1Scheme{},
+	KeyTypeEd25519:   ed25519Scheme{},
+}
+
+// 返回密钥类型对应的签名方案。
+func SchemeOf(t KeyType) (Scheme, error) {
+	s, ok := schemes[t]
+	if !ok {
+		return nil, fmt.Errorf("%w(%d)", ErrUnknownKeyType, t)
+	}
+	return s, nil
+}
+
+// 返回密钥类型的名称。
+func (t KeyType) String() string {
+	if name, ok := keyTypeNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("KeyType(%d)", t)
+}
+
+// 按名称解析密钥类型。
+func ParseKeyType(name string) (KeyType, error) {
+	for t, n := range keyTypeNames {
+		if n == name {
+			return t, nil
+		}
+	}
+	return 0, fmt.Errorf("%w(%s)", ErrUnknownKeyType, name)
+}
+
+// 实现encoding.TextMarshaler接口，编码为密钥类型的名称。
+func (t KeyType) MarshalText() ([]byte, error) {
+	if _, ok := keyTypeNames[t]; !ok {
+		return nil, fmt.Errorf("%w(%d)", ErrUnknownKeyType, t)
+	}
+	return []byte(t.String()), nil
+}
+
+// 实现encoding.TextUnmarshaler接口，从密钥类型的名称解析。
+func (t *KeyType) UnmarshalText(text []byte) error {
+	parsed, err := ParseKeyType(string(text))
+	if err != nil {
+		return err
+	}
+
+	*t = parsed
+	return nil
+}
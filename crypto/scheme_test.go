@@ -0,0 +1,202 @@
+package crypto
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// 测试secp256k1的公钥计算和RFC 6979确定性签名，向量来自python-ecdsa和Trezor的测试。
+func TestSecp256k1Vectors(t *testing.T) {
+	scalar := func(s string) []byte {
+		b, _ := hex.DecodeString(s)
+		return append(make([]byte, 32-len(b)), b...)
+	}
+
+	for k, pub := range map[string]string{
+		"01": "0279be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798",
+		"02": "02c6047f9441ed7d6d3045406e95c07cd85c778e4b8cef3ca7abac09b95c709ee5",
+		"03": "02f9308a019258c31049344f85f89d5229b531c845836f99b08601f113bce036f9",
+	} {
+		key, err := ParsePrivateKey(KeyTypeSecp256k1, scalar(k))
+		assert.Nil(t, err)
+		assert.Equal(t, pub, hex.EncodeToString(key.PublicKey().Key))
+	}
+
+	vectors := []struct {
+		key, msg, sig string
+	}{
+		{"01", "Satoshi Nakamoto",
+			"934b1ea10a4b3c1757e2b0c017d0b6143ce3c9a7e6a4a49860d7a6ab210ee3d82442ce9d2b916064108014783e923ec36b49743e2ffa1c4496f01a512aafd9e5"},
+		{"fffffffffffffffffffffffffffffffebaaedce6af48a03bbfd25e8cd0364140", "Satoshi Nakamoto",
+			"fd567d121db66e382991534ada77a6bd3106f0a1098c231e47993447cd6af2d06b39cd0eb1bc8603e159ef5c20a5c8ad685a45b06ce9bebed3f153d10d93bed5"},
+		{"01", "All those moments will be lost in time, like tears in rain. Time to die...",
+			"8600dbd41e348fe5c9465ab92d23e3db8b98b873beecd930736488696438cb6b547fe64427496db33bf66019dacbf0039c04199abb0122918601db38a72cfc21"},
+		{"f8b8af8ce3c7cca5e300d33939540c10d45ce001b8f252bfbc57ba0342904181", "Alan Turing",
+			"7063ae83e7f62bbb171798131b4a0564b956930092b33b07b395615d9ec7e15c58dfcc1e00a35e1572f366ffe34ba0fc47db1e7189759b9fb233c5b05ab388ea"},
+	}
+	for _, v := range vectors {
+		key, err := ParsePrivateKey(KeyTypeSecp256k1, scalar(v.key))
+		assert.Nil(t, err)
+		sig, err := key.Sign([]byte(v.msg))
+		assert.Nil(t, err)
+
+		text, err := sig.MarshalText()
+		assert.Nil(t, err)
+		assert.Equal(t, "0x01"+v.sig, string(text))
+		assert.True(t, sig.Verify(key.PublicKey(), []byte(v.msg)))
+
+		// S较大的等价签名会被拒绝
+		sig.S.Sub(secp256k1N, sig.S)
+		assert.False(t, sig.Verify(key.PublicKey(), []byte(v.msg)))
+	}
+
+	_, err := ParsePrivateKey(KeyTypeSecp256k1, scalar("fffffffffffffffffffffffffffffffebaaedce6af48a03bbfd25e8cd0364141"))
+	assert.NotNil(t, err)
+}
+
+// 测试Ed25519的签名，向量来自RFC 8032的测试1。
+func TestEd25519Vector(t *testing.T) {
+	seed, _ := hex.DecodeString("9d61b19deffd5a60ba844af492ec2cc44449c5697b326919703bac031cae7f60")
+	key, err := ParsePrivateKey(KeyTypeEd25519, seed)
+	assert.Nil(t, err)
+	assert.Equal(t, "d75a980182b10ab7d54bfed3c964073a0ee172f3daa62325af021a68f707511a", hex.EncodeToString(key.PublicKey().Key))
+
+	sig, err := key.Sign(nil)
+	assert.Nil(t, err)
+	text, err := sig.MarshalText()
+	assert.Nil(t, err)
+	assert.Equal(t, "0x02e5564300c360ac729086e2cc806e828a84877f1eb8e5d974d873e065224901555fb8821590a33bacc61e39701cf9b46bd25bf5f0595bbe24655141438e7a100b", string(text))
+	assert.True(t, sig.Verify(key.PublicKey(), nil))
+}
+
+// 测试各签名方案的签名、验证和编码，以及密钥类型不一致时验证失败。
+func TestSchemes(t *testing.T) {
+	msg := []byte("hello,world")
+	keys := map[KeyType]PrivateKey{}
+	for _, kt := range []KeyType{KeyTypeP256, KeyTypeSecp256k1, KeyTypeEd25519} {
+		name, err := kt.MarshalText()
+		assert.Nil(t, err)
+		var parsed KeyType
+		assert.Nil(t, parsed.UnmarshalText(name))
+		assert.Equal(t, kt, parsed)
+
+		key, err := GenerateKey(kt)
+		assert.Nil(t, err)
+		assert.Equal(t, kt, key.Type())
+		keys[kt] = key
+
+		restored, err := ParsePrivateKey(kt, key.Bytes())
+		assert.Nil(t, err)
+		assert.Equal(t, key.PublicKey(), restored.PublicKey())
+
+		sig, err := key.Sign(msg)
+		assert.Nil(t, err)
+		assert.Equal(t, kt, sig.Type)
+		assert.True(t, sig.Verify(key.PublicKey(), msg))
+		assert.False(t, sig.Verify(key.PublicKey(), []byte("hello,world!")))
+
+		// 公钥和签名的文本编码和gob编码保留密钥类型
+		pubText, err := key.PublicKey().MarshalText()
+		assert.Nil(t, err)
+		pub := PublicKey{}
+		assert.Nil(t, pub.UnmarshalText(pubText))
+		assert.Equal(t, key.PublicKey(), pub)
+		assert.Equal(t, key.PublicKey().Address(), pub.Address())
+
+		sigText, err := sig.MarshalText()
+		assert.Nil(t, err)
+		decodedSig := &Signature{}
+		assert.Nil(t, decodedSig.UnmarshalText(sigText))
+		assert.True(t, decodedSig.Verify(pub, msg))
+
+		buf := &bytes.Buffer{}
+		assert.Nil(t, gob.NewEncoder(buf).Encode(struct {
+			From      PublicKey
+			Signature *Signature
+		}{pub, sig}))
+		var decoded struct {
+			From      PublicKey
+			Signature *Signature
+		}
+		assert.Nil(t, gob.NewDecoder(buf).Decode(&decoded))
+		assert.Equal(t, pub, decoded.From)
+		assert.True(t, decoded.Signature.Verify(decoded.From, msg))
+	}
+
+	// P-256公钥的编码与引入其他方案之前相同，其他方案带有标记字节和密钥类型
+	assert.Equal(t, 33, len(keys[KeyTypeP256].PublicKey().ToSlice()))
+	assert.Equal(t, []byte{typedKeyMarker, byte(KeyTypeSecp256k1)}, keys[KeyTypeSecp256k1].PublicKey().ToSlice()[:2])
+
+	// 签名只能由同一类型的公钥验证
+	sig, err := keys[KeyTypeSecp256k1].Sign(msg)
+	assert.Nil(t, err)
+	mismatched := PublicKey{Type: KeyTypeP256, Key: keys[KeyTypeSecp256k1].PublicKey().Key}
+	assert.False(t, sig.Verify(mismatched, msg))
+	sig.Type = KeyTypeP256
+	assert.False(t, sig.Verify(mismatched, msg))
+
+	_, err = GenerateKey(KeyType(9))
+	assert.ErrorIs(t, err, ErrUnknownKeyType)
+	_, err = PublicKeyFromBytes([]byte{typedKeyMarker, 9, 1, 2})
+	assert.ErrorIs(t, err, ErrUnknownKeyType)
+	_, err = PublicKeyFromBytes([]byte{typedKeyMarker, byte(KeyTypeEd25519), 1, 2})
+	assert.NotNil(t, err)
+}
+
+// 测试从可恢复的签名恢复公钥，以及可恢复签名的文本编码。
+func TestRecoverPublicKey(t *testing.T) {
+	msg := []byte("hello,world")
+	for _, kt := range []KeyType{KeyTypeP256, KeyTypeSecp256k1} {
+		for i := 0; i < 8; i++ {
+			key, err := GenerateKey(kt)
+			assert.Nil(t, err)
+			sig, err := key.SignRecoverable(msg)
+			assert.Nil(t, err)
+			assert.True(t, sig.Recoverable())
+			assert.True(t, sig.Verify(key.PublicKey(), msg))
+
+			recovered, err := sig.RecoverPublicKey(msg)
+			assert.Nil(t, err)
+			assert.Equal(t, key.PublicKey(), recovered)
+
+			text, err := sig.MarshalText()
+			assert.Nil(t, err)
+			decoded := &Signature{}
+			assert.Nil(t, decoded.UnmarshalText(text))
+			assert.Equal(t, sig.V, decoded.V)
+			recovered, err = decoded.RecoverPublicKey(msg)
+			assert.Nil(t, err)
+			assert.Equal(t, key.PublicKey().Address(), recovered.Address())
+
+			// 消息不同时恢复出的是另一个公钥
+			other, err := sig.RecoverPublicKey([]byte("hello,world!"))
+			if err == nil {
+				assert.NotEqual(t, key.PublicKey(), other)
+			}
+		}
+	}
+
+	// secp256k1的签名是确定性的，恢复标识与参考实现一致
+	scalar := make([]byte, 32)
+	scalar[31] = 1
+	key, err := ParsePrivateKey(KeyTypeSecp256k1, scalar)
+	assert.Nil(t, err)
+	sig, err := key.SignRecoverable([]byte("Satoshi Nakamoto"))
+	assert.Nil(t, err)
+	assert.Equal(t, byte(28), sig.V)
+
+	// 不可恢复的签名和不支持恢复的方案
+	sig, err = key.Sign(msg)
+	assert.Nil(t, err)
+	_, err = sig.RecoverPublicKey(msg)
+	assert.NotNil(t, err)
+
+	edKey, err := GenerateKey(KeyTypeEd25519)
+	assert.Nil(t, err)
+	_, err = edKey.SignRecoverable(msg)
+	assert.ErrorIs(t, err, ErrNotRecoverable)
+}
@@ -0,0 +1,131 @@
+package crypto
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"math/big"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+)
+
+var (
+	secp256k1N     = secp256k1.S256().N
+	secp256k1HalfN = new(big.Int).Rsh(secp256k1N, 1) // N/2，签名的S不超过它
+)
+
+// 紧凑签名首字节的偏移：27加上恢复标识，公钥为压缩格式时再加4。
+const compactSigOffset = 27 + 4
+
+// secp256k1上的ECDSA。私钥是32字节的标量，公钥是33字节的压缩点，签名前先对消息做SHA-256。
+// 随机数按RFC 6979确定性地生成，签名的S总是不超过N/2，验证时拒绝S较大的签名以避免延展性。
+// 曲线运算和签名使用github.com/decred/dcrd/dcrec/secp256k1，与私钥有关的运算是常数时间的。
+type secp256k1Scheme struct{}
+
+func (secp256k1Scheme) Type() KeyType {
+	return KeyTypeSecp256k1
+}
+
+func (secp256k1Scheme) GenerateKey() ([]byte, error) {
+	key, err := secp256k1.GeneratePrivateKey()
+	if err != nil {
+		return nil, err
+	}
+	return key.Serialize(), nil
+}
+
+func (s secp256k1Scheme) PublicKey(privateKey []byte) ([]byte, error) {
+	if err := s.checkPrivateKey(privateKey); err != nil {
+		return nil, err
+	}
+
+	return secp256k1.PrivKeyFromBytes(privateKey).PubKey().SerializeCompressed(), nil
+}
+
+func (secp256k1Scheme) ValidatePublicKey(publicKey []byte) error {
+	if _, err := parseSecp256k1PublicKey(publicKey); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s secp256k1Scheme) Sign(privateKey, data []byte) (*big.Int, *big.Int, error) {
+	r, sig, _, err := s.SignRecoverable(privateKey, data)
+	return r, sig, err
+}
+
+func (s secp256k1Scheme) SignRecoverable(privateKey, data []byte) (*big.Int, *big.Int, byte, error) {
+	if err := s.checkPrivateKey(privateKey); err != nil {
+		return nil, nil, 0, err
+	}
+
+	digest := sha256.Sum256(data)
+	compact := ecdsa.SignCompact(secp256k1.PrivKeyFromBytes(privateKey), digest[:], true)
+	r := new(big.Int).SetBytes(compact[1 : 1+signatureScalarSize])
+	sig := new(big.Int).SetBytes(compact[1+signatureScalarSize:])
+	return r, sig, compact[0] - compactSigOffset, nil
+}
+
+func (secp256k1Scheme) Verify(publicKey, data []byte, r, s *big.Int) bool {
+	if r.Sign() <= 0 || r.Cmp(secp256k1N) >= 0 || s.Sign() <= 0 || s.Cmp(secp256k1HalfN) > 0 {
+		return false
+	}
+	pub, err := parseSecp256k1PublicKey(publicKey)
+	if err != nil {
+		return false
+	}
+
+	var rs, ss secp256k1.ModNScalar
+	rs.SetByteSlice(r.Bytes())
+	ss.SetByteSlice(s.Bytes())
+	digest := sha256.Sum256(data)
+	return ecdsa.NewSignature(&rs, &ss).Verify(digest[:], pub)
+}
+
+func (secp256k1Scheme) RecoverPublicKey(data []byte, r, s *big.Int, recoveryID byte) ([]byte, error) {
+	if recoveryID > 3 {
+		return nil, fmt.Errorf("无效的恢复标识(%d)", recoveryID)
+	}
+	if r.Sign() <= 0 || r.Cmp(secp256k1N) >= 0 || s.Sign() <= 0 || s.Cmp(secp256k1N) >= 0 {
+		return nil, fmt.Errorf("签名的R或S超出了曲线的范围")
+	}
+	if s.Cmp(secp256k1HalfN) > 0 {
+		return nil, fmt.Errorf("签名的S超过N/2")
+	}
+
+	compact := make([]byte, 1+2*signatureScalarSize)
+	compact[0] = compactSigOffset + recoveryID
+	r.FillBytes(compact[1 : 1+signatureScalarSize])
+	s.FillBytes(compact[1+signatureScalarSize:])
+
+	digest := sha256.Sum256(data)
+	pub, _, err := ecdsa.RecoverCompact(compact, digest[:])
+	if err != nil {
+		return nil, fmt.Errorf("无法从签名恢复公钥：%s", err)
+	}
+	return pub.SerializeCompressed(), nil
+}
+
+// 检查私钥的长度和范围。
+func (secp256k1Scheme) checkPrivateKey(privateKey []byte) error {
+	if len(privateKey) != signatureScalarSize {
+		return fmt.Errorf("私钥的长度应该为%d字节，而不是%d字节", signatureScalarSize, len(privateKey))
+	}
+	var d secp256k1.ModNScalar
+	if overflow := d.SetByteSlice(privateKey); overflow || d.IsZero() {
+		return fmt.Errorf("私钥超出了曲线的范围")
+	}
+	return nil
+}
+
+// 解析33字节的压缩公钥，拒绝其他格式。
+func parseSecp256k1PublicKey(publicKey []byte) (*secp256k1.PublicKey, error) {
+	if len(publicKey) != secp256k1.PubKeyBytesLenCompressed {
+		return nil, fmt.Errorf("无效的压缩公钥")
+	}
+	pub, err := secp256k1.ParsePubKey(publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("无效的压缩公钥")
+	}
+	return pub, nil
+}
@@ -1,12 +1,18 @@
 module github.com/Luboy23/Blockchain_Project
 
-go 1.18
+go 1.20
+
+require (
+	github.com/decred/dcrd/dcrec/secp256k1/v4 v4.2.0
+	github.com/sirupsen/logrus v1.9.3
+	github.com/stretchr/testify v1.9.0
+	golang.org/x/crypto v0.21.0
+	golang.org/x/sys v0.19.0
+	golang.org/x/term v0.18.0
+)
 
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
-	github.com/sirupsen/logrus v1.9.3 // indirect
-	github.com/stretchr/testify v1.9.0 // indirect
-	golang.org/x/sys v0.19.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
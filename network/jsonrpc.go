@@ -0,0 +1,540 @@
+package network
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Luboy23/Blockchain_Project/core"
+	"github.com/Luboy23/Blockchain_Project/types"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	maxJSONRPCRequestSize = 1 << 20 // 单个HTTP请求体的最大字节数
+	maxJSONRPCBatchSize   = 100     // 批量请求中最多包含的请求数
+)
+
+// JSON-RPC 2.0规范定义的错误码，以及本节点使用的服务端错误码（-32000到-32099）。
+const (
+	ErrCodeParse          = -32700 // 请求不是合法的JSON
+	ErrCodeInvalidRequest = -32600 // 请求不是合法的JSON-RPC请求对象
+	ErrCodeMethodNotFound = -32601 // 方法不存在
+	ErrCodeInvalidParams  = -32602 // 参数无效
+	ErrCodeInternal       = -32603 // 内部错误
+	ErrCodeNotFound       = -32001 // 查询的区块、区块头或交易不存在
+	ErrCodeTxRejected     = -32002 // 交易被拒绝
+	ErrCodePruned         = -32003 // 查询的数据已被裁剪
+)
+
+// JSON-RPC请求对象。
+type JSONRPCRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"` // 为空表示通知，服务端不返回响应
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+// JSON-RPC响应对象。
+type JSONRPCResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  any             `json:"result,omitempty"`
+	Error   *JSONRPCError   `json:"error,omitempty"`
+}
+
+// JSON-RPC错误对象。
+type JSONRPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// 实现error接口。
+func (e *JSONRPCError) Error() string {
+	return fmt.Sprintf("JSON-RPC错误(%d)：%s", e.Code, e.Message)
+}
+
+// 创建一个JSON-RPC错误。
+func newJSONRPCError(code int, format string, args ...any) *JSONRPCError {
+	return &JSONRPCError{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// JSON-RPC方法，参数为按位置排列的原始JSON参数。
+type jsonrpcMethod func(params []json.RawMessage) (any, *JSONRPCError)
+
+// 调用请求的方法并返回结果。
+type jsonrpcCaller func(req *JSONRPCRequest) (any, *JSONRPCError)
+
+// 为Server提供JSON-RPC 2.0接口的HTTP处理器，支持批量请求。
+type JSONRPCHandler struct {
+	server  *Server
+	methods map[string]jsonrpcMethod
+
+	wsLock     sync.Mutex // 保护WebSocket连接数和订阅数
+	wsConns    int        // 当前的WebSocket连接数
+	wsSubs     int        // 所有WebSocket连接当前的订阅总数
+	maxWSConns int        // WebSocket连接数的上限
+	maxWSSubs  int        // 所有WebSocket连接订阅总数的上限
+}
+
+// 创建一个JSON-RPC处理器。
+func NewJSONRPCHandler(s *Server) *JSONRPCHandler {
+	h := &JSONRPCHandler{
+		server:     s,
+		maxWSConns: maxWSConnections,
+		maxWSSubs:  maxWSTotalSubscriptions,
+	}
+	h.methods = map[string]jsonrpcMethod{
+		"chain_height":           h.chainHeight,
+		"chain_getBlockByHeight": h.chainGetBlockByHeight,
+		"chain_getBlockByHash":   h.chainGetBlockByHash,
+		"chain_getHeader":        h.chainGetHeader,
+		"chain_addressPrefix":    h.chainAddressPrefix,
+		"tx_send":                h.txSend,
+		"tx_get":                 h.txGet,
+		"txpool_status":          h.txpoolStatus,
+		"account_getBalance":     h.accountGetBalance,
+		"account_getNonce":       h.accountGetNonce,
+	}
+
+	return h
+}
+
+// 实现http.Handler接口。请求体为单个请求对象或请求对象数组，全部是通知时返回204。
+// WebSocket升级请求交给serveWebSocket处理。
+func (h *JSONRPCHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if isWebSocketUpgrade(r) {
+		h.serveWebSocket(w, r)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "只支持POST请求", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxJSONRPCRequestSize+1))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(body) > maxJSONRPCRequestSize {
+		http.Error(w, "请求体过大", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	result := h.handleBody(body, h.call)
+	if result == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		logrus.Error(err)
+	}
+}
+
+// 处理请求体，返回需要写回的响应（单个响应或响应数组），没有需要返回的响应时返回nil。
+// call用于调用请求的方法，WebSocket连接通过它加入订阅相关的方法。
+func (h *JSONRPCHandler) handleBody(body []byte, call jsonrpcCaller) any {
+	body = bytes.TrimSpace(body)
+	if len(body) == 0 || body[0] != '[' {
+		var raw json.RawMessage
+		if err := json.Unmarshal(body, &raw); err != nil {
+			return errorResponse(nil, newJSONRPCError(ErrCodeParse, "无法解析请求：%s", err))
+		}
+		if resp := h.handle(raw, call); resp != nil {
+			return resp
+		}
+		return nil
+	}
+
+	var batch []json.RawMessage
+	if err := json.Unmarshal(body, &batch); err != nil {
+		return errorResponse(nil, newJSONRPCError(ErrCodeParse, "无法解析请求：%s", err))
+	}
+	if len(batch) == 0 {
+		return errorResponse(nil, newJSONRPCError(ErrCodeInvalidRequest, "批量请求不能为空"))
+	}
+	if len(batch) > maxJSONRPCBatchSize {
+		return errorResponse(nil, newJSONRPCError(ErrCodeInvalidRequest, "批量请求最多包含%d个请求", maxJSONRPCBatchSize))
+	}
+
+	responses := []*JSONRPCResponse{}
+	for _, raw := range batch {
+		if resp := h.handle(raw, call); resp != nil {
+			responses = append(responses, resp)
+		}
+	}
+	if len(responses) == 0 {
+		return nil
+	}
+
+	return responses
+}
+
+// 处理单个请求对象，通知返回nil。
+func (h *JSONRPCHandler) handle(raw json.RawMessage, call jsonrpcCaller) *JSONRPCResponse {
+	req := &JSONRPCRequest{}
+	if err := json.Unmarshal(raw, req); err != nil {
+		return errorResponse(nil, newJSONRPCError(ErrCodeInvalidRequest, "无效的请求对象：%s", err))
+	}
+	if req.JSONRPC != "2.0" || req.Method == "" {
+		return errorResponse(req.ID, newJSONRPCError(ErrCodeInvalidRequest, "无效的请求对象：jsonrpc必须为2.0且method不能为空"))
+	}
+
+	result, rpcErr := call(req)
+	if req.ID == nil {
+		return nil // 通知不需要响应
+	}
+	if rpcErr != nil {
+		return errorResponse(req.ID, rpcErr)
+	}
+
+	return &JSONRPCResponse{JSONRPC: "2.0", ID: req.ID, Result: result}
+}
+
+// 调用请求的方法。
+func (h *JSONRPCHandler) call(req *JSONRPCRequest) (any, *JSONRPCError) {
+	method, ok := h.methods[req.Method]
+	if !ok {
+		return nil, newJSONRPCError(ErrCodeMethodNotFound, "方法(%s)不存在", req.Method)
+	}
+
+	params, rpcErr := req.params()
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+
+	return method(params)
+}
+
+// 返回按位置排列的参数。
+func (req *JSONRPCRequest) params() ([]json.RawMessage, *JSONRPCError) {
+	params := []json.RawMessage{}
+	if len(req.Params) > 0 && string(req.Params) != "null" {
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, newJSONRPCError(ErrCodeInvalidParams, "参数必须是数组")
+		}
+	}
+
+	return params, nil
+}
+
+// 创建一个错误响应。
+func errorResponse(id json.RawMessage, err *JSONRPCError) *JSONRPCResponse {
+	if id == nil {
+		id = json.RawMessage("null")
+	}
+
+	return &JSONRPCResponse{JSONRPC: "2.0", ID: id, Error: err}
+}
+
+// tx_get的返回值，交易尚未打包时状态为pending，已打包时包含所在区块和执行结果。
+type RPCTxStatus struct {
+	Status      string            `json:"status"` // pending或included
+	Transaction *core.Transaction `json:"transaction"`
+	BlockHash   *types.Hash       `json:"blockHash,omitempty"`
+	BlockHeight uint32            `json:"blockHeight,omitempty"`
+	Index       uint32            `json:"index"`
+	Success     bool              `json:"success"`
+	GasUsed     uint64            `json:"gasUsed"`
+	Error       string            `json:"error,omitempty"`
+}
+
+// txpool_status的返回值。
+type RPCTxPoolStatus struct {
+	Pending int `json:"pending"`
+}
+
+// 检查参数个数。
+func checkParams(params []json.RawMessage, n int) *JSONRPCError {
+	if len(params) != n {
+		return newJSONRPCError(ErrCodeInvalidParams, "需要%d个参数，实际为%d个", n, len(params))
+	}
+	return nil
+}
+
+// 解析十六进制字符串参数。
+func hexParam(param json.RawMessage) ([]byte, *JSONRPCError) {
+	var s string
+	if err := json.Unmarshal(param, &s); err != nil {
+		return nil, newJSONRPCError(ErrCodeInvalidParams, "参数必须是十六进制字符串")
+	}
+	b, err := types.DecodeHex(s)
+	if err != nil {
+		return nil, newJSONRPCError(ErrCodeInvalidParams, "%s", err)
+	}
+
+	return b, nil
+}
+
+// 解析哈希参数。
+func hashParam(param json.RawMessage) (types.Hash, *JSONRPCError) {
+	var hash types.Hash
+	if err := json.Unmarshal(param, &hash); err != nil {
+		return types.Hash{}, newJSONRPCError(ErrCodeInvalidParams, "无效的哈希：%s", err)
+	}
+
+	return hash, nil
+}
+
+// 解析地址参数，地址可以是0x开头的十六进制字符串，或者使用本链前缀的Bech32字符串。
+func (h *JSONRPCHandler) addressParam(param json.RawMessage) (types.Address, *JSONRPCError) {
+	var s string
+	if err := json.Unmarshal(param, &s); err != nil {
+		return types.Address{}, newJSONRPCError(ErrCodeInvalidParams, "地址必须是字符串")
+	}
+
+	var addr types.Address
+	var err error
+	if strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X") {
+		addr, err = types.AddressFromHex(s)
+	} else {
+		addr, err = types.ParseAddress(s, h.server.chain.Config().AddressHRP())
+	}
+	if err != nil {
+		return types.Address{}, newJSONRPCError(ErrCodeInvalidParams, "无效的地址：%s", err)
+	}
+
+	return addr, nil
+}
+
+// 解析区块高度参数。
+func heightParam(param json.RawMessage) (uint32, *JSONRPCError) {
+	var height uint32
+	if err := json.Unmarshal(param, &height); err != nil {
+		return 0, newJSONRPCError(ErrCodeInvalidParams, "区块高度必须是非负整数")
+	}
+
+	return height, nil
+}
+
+// 将查询区块链时的错误转换为JSON-RPC错误。
+func chainError(err error) *JSONRPCError {
+	if errors.Is(err, core.ErrBlockPruned) || errors.Is(err, core.ErrStatePruned) {
+		return newJSONRPCError(ErrCodePruned, "%s", err)
+	}
+
+	return newJSONRPCError(ErrCodeNotFound, "%s", err)
+}
+
+// chain_height：返回主链的高度。
+func (h *JSONRPCHandler) chainHeight(params []json.RawMessage) (any, *JSONRPCError) {
+	if rpcErr := checkParams(params, 0); rpcErr != nil {
+		return nil, rpcErr
+	}
+
+	return h.server.chain.Height(), nil
+}
+
+// chain_addressPrefix：返回本链地址Bech32编码的人类可读前缀。
+func (h *JSONRPCHandler) chainAddressPrefix(params []json.RawMessage) (any, *JSONRPCError) {
+	if rpcErr := checkParams(params, 0); rpcErr != nil {
+		return nil, rpcErr
+	}
+
+	return h.server.chain.Config().AddressHRP(), nil
+}
+
+// chain_getBlockByHeight：按高度返回主链区块。
+func (h *JSONRPCHandler) chainGetBlockByHeight(params []json.RawMessage) (any, *JSONRPCError) {
+	if rpcErr := checkParams(params, 1); rpcErr != nil {
+		return nil, rpcErr
+	}
+	height, rpcErr := heightParam(params[0])
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+
+	header, err := h.server.chain.GetHeader(height)
+	if err != nil {
+		return nil, chainError(err)
+	}
+
+	return h.getBlock(core.BlockHasher{}.Hash(header))
+}
+
+// chain_getBlockByHash：按哈希返回区块（包括分叉链上的区块）。
+func (h *JSONRPCHandler) chainGetBlockByHash(params []json.RawMessage) (any, *JSONRPCError) {
+	if rpcErr := checkParams(params, 1); rpcErr != nil {
+		return nil, rpcErr
+	}
+	hash, rpcErr := hashParam(params[0])
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+
+	return h.getBlock(hash)
+}
+
+// 按哈希获取区块。
+func (h *JSONRPCHandler) getBlock(hash types.Hash) (any, *JSONRPCError) {
+	b, err := h.server.chain.GetBlock(hash)
+	if err != nil {
+		return nil, chainError(err)
+	}
+
+	return b, nil
+}
+
+// chain_getHeader：按高度（数字）或哈希（字符串）返回区块头。
+func (h *JSONRPCHandler) chainGetHeader(params []json.RawMessage) (any, *JSONRPCError) {
+	if rpcErr := checkParams(params, 1); rpcErr != nil {
+		return nil, rpcErr
+	}
+
+	var header *core.Header
+	var err error
+	if height, rpcErr := heightParam(params[0]); rpcErr == nil {
+		header, err = h.server.chain.GetHeader(height)
+	} else {
+		hash, rpcErr := hashParam(params[0])
+		if rpcErr != nil {
+			return nil, newJSONRPCError(ErrCodeInvalidParams, "参数必须是区块高度或区块哈希")
+		}
+		header, err = h.server.chain.GetHeaderByHash(hash)
+	}
+	if err != nil {
+		return nil, chainError(err)
+	}
+
+	return header, nil
+}
+
+// tx_send：提交一笔已签名的交易，参数为gob编码的交易的十六进制字符串，返回交易哈希。
+func (h *JSONRPCHandler) txSend(params []json.RawMessage) (any, *JSONRPCError) {
+	if rpcErr := checkParams(params, 1); rpcErr != nil {
+		return nil, rpcErr
+	}
+	raw, rpcErr := hexParam(params[0])
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+
+	tx := new(core.Transaction)
+	if err := tx.Decode(core.NewGobTxDecoder(bytes.NewReader(raw))); err != nil {
+		return nil, newJSONRPCError(ErrCodeInvalidParams, "无法解码交易：%s", err)
+	}
+	if err := h.server.processTransaction(tx); err != nil {
+		return nil, newJSONRPCError(ErrCodeTxRejected, "%s", err)
+	}
+
+	return tx.Hash(core.TxHasher{}), nil
+}
+
+// tx_get：按哈希返回交易及其状态。
+func (h *JSONRPCHandler) txGet(params []json.RawMessage) (any, *JSONRPCError) {
+	if rpcErr := checkParams(params, 1); rpcErr != nil {
+		return nil, rpcErr
+	}
+	hash, rpcErr := hashParam(params[0])
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+
+	if tx, ok := h.server.memPool.Get(hash); ok {
+		return &RPCTxStatus{Status: "pending", Transaction: tx}, nil
+	}
+
+	receipt, err := h.server.chain.GetReceipt(hash)
+	if err != nil {
+		return nil, chainError(err)
+	}
+	b, err := h.server.chain.GetBlock(receipt.BlockHash)
+	if err != nil {
+		return nil, chainError(err)
+	}
+
+	return &RPCTxStatus{
+		Status:      "included",
+		Transaction: &b.Transactions[receipt.Index],
+		BlockHash:   &receipt.BlockHash,
+		BlockHeight: receipt.BlockHeight,
+		Index:       receipt.Index,
+		Success:     receipt.Status == core.ReceiptStatusSuccessful,
+		GasUsed:     receipt.GasUsed,
+		Error:       receipt.Error,
+	}, nil
+}
+
+// txpool_status：返回交易池的状态。
+func (h *JSONRPCHandler) txpoolStatus(params []json.RawMessage) (any, *JSONRPCError) {
+	if rpcErr := checkParams(params, 0); rpcErr != nil {
+		return nil, rpcErr
+	}
+
+	return &RPCTxPoolStatus{Pending: h.server.memPool.Len()}, nil
+}
+
+// account_getBalance：返回账户在主链链头状态下的余额。
+func (h *JSONRPCHandler) accountGetBalance(params []json.RawMessage) (any, *JSONRPCError) {
+	if rpcErr := checkParams(params, 1); rpcErr != nil {
+		return nil, rpcErr
+	}
+	addr, rpcErr := h.addressParam(params[0])
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+
+	return h.server.chain.State().Balance(addr), nil
+}
+
+// account_getNonce：返回账户下一笔交易应使用的Nonce。
+// 交易池中该账户从链头状态的Nonce开始连续的交易也计算在内，这样可以连续提交多笔交易而不必等待打包。
+func (h *JSONRPCHandler) accountGetNonce(params []json.RawMessage) (any, *JSONRPCError) {
+	if rpcErr := checkParams(params, 1); rpcErr != nil {
+		return nil, rpcErr
+	}
+	addr, rpcErr := h.addressParam(params[0])
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+
+	pending := make(map[uint64]bool)
+	for _, tx := range h.server.memPool.Transactions() {
+		if sender := tx.Sender(); sender.Key != nil && sender.Address() == addr {
+			pending[tx.Nonce] = true
+		}
+	}
+
+	nonce := h.server.chain.State().Nonce(addr)
+	for pending[nonce] {
+		nonce++
+	}
+
+	return nonce, nil
+}
+
+// 在ServerOpts.RPCAddr上启动JSON-RPC HTTP服务。
+func (s *Server) startJSONRPC() error {
+	ln, err := net.Listen("tcp", s.RPCAddr)
+	if err != nil {
+		return err
+	}
+
+	s.rpcServer = &http.Server{
+		Handler:           NewJSONRPCHandler(s),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		if err := s.rpcServer.Serve(ln); err != nil && err != http.ErrServerClosed {
+			logrus.Error(err)
+		}
+	}()
+
+	logrus.WithFields(logrus.Fields{
+		"地址": ln.Addr(),
+	}).Info("JSON-RPC服务已启动")
+
+	return nil
+}
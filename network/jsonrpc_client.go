@@ -0,0 +1,88 @@
+package network
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// JSON-RPC 2.0的HTTP客户端，供命令行工具调用节点的接口。
+type JSONRPCClient struct {
+	url    string
+	client *http.Client
+
+	lock   sync.Mutex
+	nextID uint64
+}
+
+// 客户端收到的响应，结果保留为原始JSON以便解码为调用方需要的类型。
+type jsonrpcClientResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      uint64          `json:"id"`
+	Result  json.RawMessage `json:"result"`
+	Error   *JSONRPCError   `json:"error"`
+}
+
+// 创建一个访问url上JSON-RPC服务的客户端。
+func NewJSONRPCClient(url string) *JSONRPCClient {
+	return &JSONRPCClient{
+		url:    url,
+		client: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// 调用method并把结果解码到result，result为nil时丢弃结果。
+// 服务端返回错误对象时，返回的错误为*JSONRPCError。
+func (c *JSONRPCClient) Call(result any, method string, params ...any) error {
+	c.lock.Lock()
+	c.nextID++
+	id := c.nextID
+	c.lock.Unlock()
+
+	if params == nil {
+		params = []any{}
+	}
+	body, err := json.Marshal(map[string]any{
+		"jsonrpc": "2.0",
+		"id":      id,
+		"method":  method,
+		"params":  params,
+	})
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.client.Post(c.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxJSONRPCRequestSize*16))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("JSON-RPC请求失败：HTTP %s", resp.Status)
+	}
+
+	r := &jsonrpcClientResponse{}
+	if err := json.Unmarshal(data, r); err != nil {
+		return fmt.Errorf("无法解析JSON-RPC响应：%s", err)
+	}
+	if r.Error != nil {
+		return r.Error
+	}
+	if r.ID != id {
+		return fmt.Errorf("JSON-RPC响应的ID(%d)与请求(%d)不符", r.ID, id)
+	}
+
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(r.Result, result)
+}
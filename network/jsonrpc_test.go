@@ -0,0 +1,201 @@
+package network
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Luboy23/Blockchain_Project/core"
+	"github.com/Luboy23/Blockchain_Project/crypto"
+	"github.com/Luboy23/Blockchain_Project/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// 创建一个带有一个区块的服务器和对应的JSON-RPC测试服务，同时返回用户和验证者的私钥。
+func jsonrpcTestServer(t *testing.T) (*Server, *httptest.Server, *crypto.PrivateKey, *crypto.PrivateKey) {
+	validatorKey := crypto.GeneratePrivatekey()
+	userKey := crypto.GeneratePrivatekey()
+	s, err := NewServer(ServerOpts{
+		BlockTime: time.Hour,
+		Genesis: &core.Genesis{
+			Alloc: map[types.Address]uint64{userKey.PublicKey().Address(): 1000},
+			Validators: []core.GenesisValidator{
+				{PublicKey: validatorKey.PublicKey(), Stake: 100},
+			},
+		},
+	})
+	assert.Nil(t, err)
+
+	tx := &core.Transaction{Type: core.TxTypeTransfer, To: validatorKey.PublicKey().Address(), Value: 10}
+	assert.Nil(t, tx.Sign(userKey))
+	b, _, err := s.chain.BuildBlock(s.chain.CurrentHeader(), validatorKey.PublicKey(), []*core.Transaction{tx})
+	assert.Nil(t, err)
+	assert.Nil(t, b.Sign(validatorKey))
+	assert.Nil(t, s.chain.AddBlock(b))
+
+	return s, httptest.NewServer(NewJSONRPCHandler(s)), &userKey, &validatorKey
+}
+
+// 发送JSON-RPC请求并返回HTTP状态码和响应体。
+func postJSONRPC(t *testing.T, url string, body string) (int, []byte) {
+	resp, err := http.Post(url, "application/json", bytes.NewBufferString(body))
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+
+	buf := &bytes.Buffer{}
+	_, err = buf.ReadFrom(resp.Body)
+	assert.Nil(t, err)
+
+	return resp.StatusCode, buf.Bytes()
+}
+
+// 测试查询方法以及提交交易。
+func TestJSONRPCMethods(t *testing.T) {
+	s, ts, userKey, _ := jsonrpcTestServer(t)
+	defer ts.Close()
+
+	call := func(method string, params ...any) *JSONRPCResponse {
+		req, err := json.Marshal(map[string]any{"jsonrpc": "2.0", "id": 1, "method": method, "params": params})
+		assert.Nil(t, err)
+		code, body := postJSONRPC(t, ts.URL, string(req))
+		assert.Equal(t, http.StatusOK, code)
+
+		resp := &JSONRPCResponse{}
+		assert.Nil(t, json.Unmarshal(body, resp))
+		return resp
+	}
+
+	assert.Equal(t, float64(1), call("chain_height").Result)
+
+	header, err := s.chain.GetHeader(1)
+	assert.Nil(t, err)
+	blockHash := core.BlockHasher{}.Hash(header)
+	hash := types.EncodeHex(blockHash[:])
+
+	block := call("chain_getBlockByHeight", 1).Result.(map[string]any)
+	assert.Equal(t, hash, block["hash"])
+	txx := block["transactions"].([]any)
+	assert.Len(t, txx, 1)
+	txHash := txx[0].(map[string]any)["hash"].(string)
+
+	assert.Equal(t, hash, call("chain_getBlockByHash", hash).Result.(map[string]any)["hash"])
+	assert.Equal(t, float64(1), call("chain_getHeader", hash).Result.(map[string]any)["height"])
+	assert.Equal(t, hash, call("chain_getHeader", 1).Result.(map[string]any)["hash"])
+
+	status := call("tx_get", txHash).Result.(map[string]any)
+	assert.Equal(t, "included", status["status"])
+	assert.Equal(t, hash, status["blockHash"])
+
+	assert.Equal(t, float64(1000-10), call("account_getBalance", userKey.PublicKey().Address()).Result)
+	bech32, err := userKey.PublicKey().Address().Bech32(types.DefaultAddressPrefix)
+	assert.Nil(t, err)
+	assert.Equal(t, types.DefaultAddressPrefix, call("chain_addressPrefix").Result)
+	assert.Equal(t, float64(1000-10), call("account_getBalance", bech32).Result)
+	typo := []byte(bech32)
+	typo[len(typo)-1] ^= 'q' ^ 'p' // 最后一个字符在q和p之间互换，或者变成字符集外的字符
+	assert.Equal(t, ErrCodeInvalidParams, call("account_getBalance", string(typo)).Error.Code)
+
+	// 提交一笔新交易
+	tx := &core.Transaction{Type: core.TxTypeTransfer, Nonce: 1, Value: 1}
+	assert.Nil(t, tx.Sign(*userKey))
+	buf := &bytes.Buffer{}
+	assert.Nil(t, tx.Encode(core.NewGobTxEncoder(buf)))
+	sent := call("tx_send", types.HexBytes(buf.Bytes()))
+	assert.Nil(t, sent.Error)
+	assert.Equal(t, "0x"+tx.Hash(core.TxHasher{}).String(), sent.Result)
+
+	assert.Equal(t, float64(1), call("txpool_status").Result.(map[string]any)["pending"])
+	assert.Equal(t, "pending", call("tx_get", sent.Result).Result.(map[string]any)["status"])
+
+	// 错误码
+	assert.Equal(t, ErrCodeNotFound, call("chain_getBlockByHeight", 100).Error.Code)
+	assert.Equal(t, ErrCodeNotFound, call("tx_get", types.RandomHash()).Error.Code)
+	assert.Equal(t, ErrCodeInvalidParams, call("chain_getBlockByHash", "0x1234").Error.Code)
+	assert.Equal(t, ErrCodeInvalidParams, call("chain_height", 1).Error.Code)
+	assert.Equal(t, ErrCodeInvalidParams, call("tx_send", "0xzz").Error.Code)
+	assert.Equal(t, ErrCodeMethodNotFound, call("chain_unknown").Error.Code)
+}
+
+// 测试批量请求、通知以及无效请求的处理。
+func TestJSONRPCBatch(t *testing.T) {
+	_, ts, _, _ := jsonrpcTestServer(t)
+	defer ts.Close()
+
+	code, body := postJSONRPC(t, ts.URL, `[
+		{"jsonrpc":"2.0","id":1,"method":"chain_height"},
+		{"jsonrpc":"2.0","method":"chain_height"},
+		{"jsonrpc":"2.0","id":"b","method":"nope"},
+		1
+	]`)
+	assert.Equal(t, http.StatusOK, code)
+	responses := []*JSONRPCResponse{}
+	assert.Nil(t, json.Unmarshal(body, &responses))
+	assert.Len(t, responses, 3) // 通知没有响应
+	assert.Equal(t, json.RawMessage("1"), responses[0].ID)
+	assert.Equal(t, float64(1), responses[0].Result)
+	assert.Equal(t, json.RawMessage(`"b"`), responses[1].ID)
+	assert.Equal(t, ErrCodeMethodNotFound, responses[1].Error.Code)
+	assert.Equal(t, json.RawMessage("null"), responses[2].ID)
+	assert.Equal(t, ErrCodeInvalidRequest, responses[2].Error.Code)
+
+	code, _ = postJSONRPC(t, ts.URL, `[{"jsonrpc":"2.0","method":"chain_height"}]`)
+	assert.Equal(t, http.StatusNoContent, code)
+
+	for body, errCode := range map[string]int{
+		`{"jsonrpc":"2.0","id":1`: ErrCodeParse,
+		`[]`:                      ErrCodeInvalidRequest,
+		`{"jsonrpc":"1.0","id":1,"method":"chain_height"}`:             ErrCodeInvalidRequest,
+		`{"jsonrpc":"2.0","id":1,"method":"chain_height","params":{}}`: ErrCodeInvalidParams,
+	} {
+		code, respBody := postJSONRPC(t, ts.URL, body)
+		assert.Equal(t, http.StatusOK, code)
+		resp := &JSONRPCResponse{}
+		assert.Nil(t, json.Unmarshal(respBody, resp))
+		assert.Equal(t, errCode, resp.Error.Code, body)
+	}
+
+	resp, err := http.Get(ts.URL)
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+}
+
+// 测试JSON-RPC客户端，以及account_getNonce把交易池中连续的交易计算在内。
+func TestJSONRPCClient(t *testing.T) {
+	s, ts, userKey, _ := jsonrpcTestServer(t)
+	defer ts.Close()
+
+	client := NewJSONRPCClient(ts.URL)
+	addr := userKey.PublicKey().Address()
+
+	var nonce uint64
+	assert.Nil(t, client.Call(&nonce, "account_getNonce", addr))
+	assert.Equal(t, uint64(1), nonce)
+
+	for i := uint64(1); i <= 2; i++ {
+		tx := &core.Transaction{Type: core.TxTypeTransfer, Nonce: i, Value: 1}
+		assert.Nil(t, tx.Sign(*userKey))
+		assert.Nil(t, s.processTransaction(tx))
+	}
+	gap := &core.Transaction{Type: core.TxTypeTransfer, Nonce: 5, Value: 1} // 不连续的交易不计算在内
+	assert.Nil(t, gap.Sign(*userKey))
+	assert.Nil(t, s.processTransaction(gap))
+
+	bech32, err := addr.Bech32(types.DefaultAddressPrefix)
+	assert.Nil(t, err)
+	assert.Nil(t, client.Call(&nonce, "account_getNonce", bech32))
+	assert.Equal(t, uint64(3), nonce)
+
+	status := &RPCTxStatus{}
+	assert.Nil(t, client.Call(status, "tx_get", gap.Hash(core.TxHasher{})))
+	assert.Equal(t, "pending", status.Status)
+	assert.Equal(t, gap.Hash(core.TxHasher{}), status.Transaction.Hash(core.TxHasher{}))
+
+	err = client.Call(nil, "tx_get", types.RandomHash())
+	rpcErr, ok := err.(*JSONRPCError)
+	assert.True(t, ok)
+	assert.Equal(t, ErrCodeNotFound, rpcErr.Code)
+}
@@ -7,6 +7,7 @@ import (
 	"io" 
 
 	"github.com/Luboy23/Blockchain_Project/core"
+	"github.com/Luboy23/Blockchain_Project/types"
 	"github.com/sirupsen/logrus" 
 )
 
@@ -16,7 +17,12 @@ type MessageType byte
 // 定义了消息类型的常量
 const (
 	MessageTypeTx MessageType = 0x1 // 定义了一个表示交易消息的常量
-	MessageTypeBlock // 定义了一个表示区块消息的常量
+	MessageTypeBlock MessageType = 0x2 // 定义了一个表示区块消息的常量
+	MessageTypeGetSnapshot MessageType = 0x3 // 请求状态快照清单
+	MessageTypeSnapshot MessageType = 0x4 // 状态快照清单
+	MessageTypeGetSnapshotChunk MessageType = 0x5 // 请求状态快照分片
+	MessageTypeSnapshotChunk MessageType = 0x6 // 状态快照分片
+	MessageTypeGetBlocks MessageType = 0x7 // 请求从指定高度开始的区块
 )
 
 // 定义了一个RPC结构体，包含发送者和消息负载，用于表示一个远程过程调用
@@ -78,6 +84,43 @@ func DefaultRPCDecodeFunc (rpc RPC) (*DecodeMessage, error) {
 			From :NetAddr(rpc.From),
 			Data: tx,
 		}, nil
+	case MessageTypeBlock: // 如果是区块消息
+		block := new(core.Block) // 创建一个新的区块结构体
+		r := bytes.NewReader(msg.Data)
+		if err := block.Decode(r, core.NewGobBlockDecoder(r)); err != nil { // 使用gob解码器解码区块数据
+			return nil, err // 如果解码失败，返回错误
+		}
+
+		return &DecodeMessage{ // 返回解码后的消息
+			From: NetAddr(rpc.From),
+			Data: block,
+		}, nil
+	case MessageTypeSnapshotChunk: // 快照分片消息由快照的区块哈希和分片组成，分片中包含公钥，使用core提供的解码器
+		if len(msg.Data) < hashLength {
+			return nil, fmt.Errorf("从 %s 收到的快照分片消息过短", rpc.From)
+		}
+		chunk := new(core.SnapshotChunk)
+		if err := chunk.Decode(core.NewGobSnapshotChunkDecoder(bytes.NewReader(msg.Data[hashLength:]))); err != nil {
+			return nil, err
+		}
+
+		return &DecodeMessage{
+			From: NetAddr(rpc.From),
+			Data: &SnapshotChunkMessage{
+				BlockHash: types.HashFromBytes(msg.Data[:hashLength]),
+				Chunk:     chunk,
+			},
+		}, nil
+	case MessageTypeGetSnapshot, MessageTypeSnapshot, MessageTypeGetSnapshotChunk, MessageTypeGetBlocks: // 快照同步的其他消息
+		data, err := decodeSyncMessage(msg)
+		if err != nil {
+			return nil, fmt.Errorf("从 %s 解码信息失败： %s", rpc.From, err)
+		}
+
+		return &DecodeMessage{
+			From: NetAddr(rpc.From),
+			Data: data,
+		}, nil
 	default: // 如果是其他类型的消息
 		return nil, fmt.Errorf("不正确的消息类型 % x", msg.Header) // 返回错误
 	}
@@ -3,15 +3,20 @@ package network
 import (
 	"bytes"
 	"fmt"
+	"net/http"
+	"sync"
 	"time"
 
 	"github.com/Luboy23/Blockchain_Project/core"
 	"github.com/Luboy23/Blockchain_Project/crypto"
+	"github.com/Luboy23/Blockchain_Project/types"
 	"github.com/sirupsen/logrus"
 )
 
 var defaultBlockTime = 5 * time.Second // 定义了默认的区块生成时间间隔
 
+const maxEquivocationAge = 1000 // 双重签名检测器只记录与链头相差不超过该值的高度的区块头
+
 // 定义了一个服务器的配置选项。
 // 它包含一个名为Transports的切片，用于存储服务器可以使用的传输方式。
 type ServerOpts struct {
@@ -20,6 +25,15 @@ type ServerOpts struct {
 	Transports []Transport // 传输方式
 	BlockTime time.Duration // 区块生成时间间隔
 	PrivateKey *crypto.PrivateKey // 私钥，用于验证交易
+	PowConfig *core.PowConfig // 工作量证明配置，为nil时不启用PoW挖矿
+	MinerWorkers int // 挖矿使用的协程数量，0表示使用CPU核数
+	SignGuardFile string // 记录最后签名高度的文件，用于防止重启或多实例导致的双重签名，为空时只保存在内存中
+	Genesis *core.Genesis // 创世配置，所有节点必须一致，为nil时使用默认配置
+	SnapshotInterval uint32 // 每隔多少个区块生成一次状态快照供其他节点同步，0表示不生成
+	TrustedHeader *core.Header // 可信的区块头，设置后节点启动时从其他节点下载该区块的状态快照，而不是从创世区块重放
+	Storage core.StorageConfig // 存储模式，零值为归档模式，保留所有区块和历史状态
+	TxIndex bool // 是否维护交易和地址索引
+	RPCAddr string // JSON-RPC HTTP服务的监听地址，例如"127.0.0.1:8545"，为空时不启动
 }
 
 // 定义了一个服务器的抽象。
@@ -27,13 +41,42 @@ type ServerOpts struct {
 type Server struct {
 	ServerOpts // 服务器配置选项
 	memPool *TxPool // 内存池，用于存储待处理的交易
+	chain *core.Blockchain // 服务器维护的区块链
 	isValidator bool // 是否是验证者
 	rpcCh chan RPC // RPC通道，用于接收RPC请求
 	quitCh chan struct{} // 退出通道，用于接收退出信号
+
+	miner *core.Miner // PoW矿工
+	mining *miningJob // 当前正在进行的挖矿任务，为nil表示没有在挖矿
+	minedBlockCh chan *core.Block // 挖矿协程通过该通道交回挖到的区块，中止时交回nil
+
+	signGuard *core.SignGuard // 验证者签名区块时经过的双重签名守卫
+	detector *core.EquivocationDetector // 检测其他验证者双重签名的检测器
+
+	snapshotSync *snapshotSync // 正在进行的快照同步，为nil表示没有在同步
+	blockSync *blockSync // 快照同步之后正在进行的区块同步，为nil表示没有在同步
+
+	headSub *core.Subscription[core.NewHeadEvent] // 主链链头变化的订阅，用于维护内存池和中止过时的挖矿
+	indexer *core.Indexer // 交易和地址索引器，未启用索引时为nil
+	rpcServer *http.Server // JSON-RPC HTTP服务，未启动时为nil
+}
+
+// 表示一次正在进行的挖矿任务。
+type miningJob struct {
+	parent types.Hash // 挖矿所基于的父区块哈希
+	quitCh chan struct{} // 关闭该通道即可中止挖矿
+	once sync.Once // 保证quitCh只被关闭一次
+}
+
+// 中止挖矿任务。
+func (j *miningJob) abort() {
+	j.once.Do(func() {
+		close(j.quitCh)
+	})
 }
 
 // 创建一个新的服务器实例
-func NewServer(opts ServerOpts) *Server {
+func NewServer(opts ServerOpts) (*Server, error) {
 	// 如果没有指定区块生成时间间隔，则使用默认值
 	if opts.BlockTime == time.Duration(0) {
 		opts.BlockTime = defaultBlockTime
@@ -44,13 +87,51 @@ func NewServer(opts ServerOpts) *Server {
 		opts.RPCDecodeFunc = DefaultRPCDecodeFunc
 	}
 
+	// 使用创世区块创建区块链
+	// 如果没有指定创世配置，则使用默认配置
+	if opts.Genesis == nil {
+		opts.Genesis = defaultGenesis()
+	}
+
+	// 使用创世配置创建区块链
+	chain, err := core.NewBlockchainFromGenesis(opts.Genesis)
+	if err != nil {
+		return nil, err
+	}
+	if opts.PowConfig != nil {
+		chain.SetPowConfig(opts.PowConfig) // 启用工作量证明模式
+	}
+	chain.SetSnapshotInterval(opts.SnapshotInterval)
+	if err := chain.SetStorageConfig(opts.Storage); err != nil {
+		return nil, err
+	}
+
+	// 创建双重签名守卫，如果记录文件存在则恢复最后签名的高度
+	signGuard, err := core.NewSignGuard(opts.SignGuardFile)
+	if err != nil {
+		return nil, err
+	}
+
 	// 创建一个新的服务器实例
 	s := &Server{
 		ServerOpts: opts,
 		memPool: NewTxPool( ),
+		chain: chain,
 		isValidator: opts.PrivateKey != nil,
 		rpcCh: make(chan RPC),
 		quitCh: make(chan struct{}, 1),
+		miner: core.NewMiner(opts.MinerWorkers),
+		minedBlockCh: make(chan *core.Block, 1),
+		signGuard: signGuard,
+		detector: core.NewEquivocationDetector(maxEquivocationAge),
+		headSub: chain.Events().NewHead.Subscribe(core.DefaultEventBuffer, core.DropOldest),
+	}
+
+	if opts.TxIndex {
+		if s.indexer, err = core.NewIndexer(chain); err != nil {
+			signGuard.Close()
+			return nil, err
+		}
 	}
 
 	// 如果没有指定RPC处理器，则使用服务器自身作为处理器
@@ -58,13 +139,46 @@ func NewServer(opts ServerOpts) *Server {
 		s.RPCProcessor = s
 	}
 
-	 return s
+	 return s, nil
+}
+
+// 返回服务器维护的区块链。
+func (s *Server) Chain() *core.Blockchain {
+	return s.chain
+}
+
+// 返回服务器的交易和地址索引器，未启用索引时返回nil。
+func (s *Server) Indexer() *core.Indexer {
+	return s.indexer
 }
 
 // 启动服务器
 func (s *Server) Start() {
 	s.initTransports() // 初始化传输方式
 
+	if s.indexer != nil {
+		s.indexer.Start()
+		defer s.indexer.Stop()
+	}
+
+	if s.RPCAddr != "" {
+		if err := s.startJSONRPC(); err != nil {
+			logrus.Error(err)
+		} else {
+			defer s.rpcServer.Close()
+		}
+	}
+
+	var syncTick <-chan time.Time // 检查快照同步是否超时，没有在同步时为nil
+	if s.TrustedHeader != nil { // 从可信区块头的状态快照开始同步
+		if err := s.startSnapshotSync(); err != nil {
+			logrus.Error(err)
+		}
+		syncTicker := time.NewTicker(snapshotPeerTimeout / 4)
+		defer syncTicker.Stop()
+		syncTick = syncTicker.C
+	}
+
 	ticker := time.NewTicker(s.BlockTime) // 创建一个定时器，用于定时生成新的区块
 
 free:
@@ -74,6 +188,7 @@ free:
 			msg, err := s.RPCDecodeFunc(rpc) // 解码RPC请求
 			if err != nil {
 				logrus.Error(err) // 如果解码失败，记录错误
+				continue
 			}
 
 			if err := s.RPCProcessor.ProcessMessage(msg) // 处理解码后的消息
@@ -81,6 +196,22 @@ free:
 				logrus.Error(err) // 如果处理失败，记录错误
 			}
 
+		case b := <-s.minedBlockCh: // 接收挖矿协程交回的区块
+			s.mining = nil
+			if b != nil {
+				if err := s.processMinedBlock(b); err != nil {
+					logrus.Error(err)
+				}
+			}
+
+		case ev := <-s.headSub.Chan(): // 主链链头发生变化
+			s.processNewHead(ev)
+
+		case now := <-syncTick:
+			if err := s.checkSnapshotSync(now); err != nil {
+				logrus.Error(err)
+			}
+
 		case <-s.quitCh: // 接收退出信号
 			break free
 		case <- ticker.C: // 接收定时器的信号
@@ -90,14 +221,38 @@ free:
 		}
 	}
 
+	s.headSub.Unsubscribe()
+	if err := s.signGuard.Close(); err != nil { // 释放签名记录文件，之后其他实例才能使用
+		logrus.Error(err)
+	}
 	fmt.Println("服务器关闭") // 服务器关闭时打印消息
 }
 
+// 停止服务器，Start处理完当前的消息后返回。
+func (s *Server) Stop() {
+	select {
+	case s.quitCh <- struct{}{}:
+	default: // 已经请求过停止
+	}
+}
+
 // 处理解码后的消息
 func (s *Server) ProcessMessage(msg *DecodeMessage) error { 
 	switch t := msg.Data.(type) { // 根据消息数据的类型进行处理
 	case *core.Transaction : // 如果是交易
 			return s.processTransaction(t) // 处理交易
+	case *core.Block: // 如果是区块
+			return s.processBlock(t) // 处理区块
+	case *GetSnapshotMessage:
+			return s.processGetSnapshot(msg.From, t)
+	case *SnapshotManifestMessage:
+			return s.processSnapshotManifest(msg.From, t)
+	case *GetSnapshotChunkMessage:
+			return s.processGetSnapshotChunk(msg.From, t)
+	case *SnapshotChunkMessage:
+			return s.processSnapshotChunk(msg.From, t)
+	case *GetBlocksMessage:
+			return s.processGetBlocks(msg.From, t)
 	}
 	return nil 
 }
@@ -145,8 +300,13 @@ func (s *Server) processTransaction(tx *core.Transaction) error {
 	go s.broadcastTx(tx)
 
 	// 将交易添加到内存池。
-	// 如果添加成功，返回nil。
-	return s.memPool.Add(tx)
+	// 如果添加成功，通知订阅者并返回nil。
+	if err := s.memPool.Add(tx); err != nil {
+		return err
+	}
+	s.chain.Events().TxAdded.Send(core.TxAddedEvent{Tx: tx})
+
+	return nil
 }
 
 // 广播交易的函数。
@@ -166,16 +326,188 @@ func (s *Server) broadcastTx(tx *core.Transaction) error {
 	return s.broadcast(msg.Bytes())
 }
 
+// 处理从网络收到的区块。
+// 区块被接受后，将其中的交易移出内存池并继续广播；如果主链链头发生变化，中止当前基于旧链头的挖矿。
+func (s *Server) processBlock(b *core.Block) error {
+	if s.snapshotSync != nil {
+		return fmt.Errorf("正在进行快照同步，暂不处理区块(%d)", b.Height)
+	}
+
+	// 无论区块能否上链，只要签名有效就检查是否存在双重签名
+	if ev := s.detector.Check(b, s.chain.Height(), s.chain.State()); ev != nil {
+		logrus.WithFields(logrus.Fields{
+			"验证者": ev.Offender(),
+			"区块高度": ev.Height(),
+		}).Warn("检测到双重签名")
+
+		if err := s.reportEvidence(ev); err != nil {
+			logrus.Error(err)
+		}
+	}
+
+	if err := s.chain.AddBlock(b); err != nil {
+		return err
+	}
+
+	s.drainNewHeads()
+
+	if err := s.continueBlockSync(b); err != nil {
+		logrus.Error(err)
+	}
+
+	if height := s.chain.Height(); height > maxEquivocationAge {
+		s.detector.Prune(height - maxEquivocationAge) // 丢弃过旧的已见区块头
+	}
+
+	go s.broadcastBlock(b)
+
+	return nil
+}
+
+// 广播区块的函数。
+func (s *Server) broadcastBlock(b *core.Block) error {
+	buf := &bytes.Buffer{}
+	if err := b.Encode(buf, core.NewGobBlockEncoder(buf)); err != nil {
+		return err
+	}
+
+	msg := NewMessage(MessageTypeBlock, buf.Bytes())
+
+	return s.broadcast(msg.Bytes())
+}
+
+// 处理主链链头的变化：离开主链的区块中的交易放回内存池，加入主链的区块中的交易移出内存池；
+// 如果链头不再是当前挖矿任务的父区块（例如收到了竞争区块），中止挖矿。
+func (s *Server) processNewHead(ev core.NewHeadEvent) {
+	if s.mining != nil && s.mining.parent != (core.BlockHasher{}).Hash(ev.Block.Header) {
+		s.mining.abort()
+	}
+
+	for _, b := range ev.Reverted {
+		for i := range b.Transactions {
+			tx := &b.Transactions[i]
+			if err := s.memPool.Add(tx); err == nil {
+				s.chain.Events().TxAdded.Send(core.TxAddedEvent{Tx: tx})
+			}
+		}
+	}
+
+	for _, b := range ev.Applied {
+		for i := range b.Transactions {
+			s.memPool.Remove(b.Transactions[i].Hash(core.TxHasher{}))
+		}
+	}
+}
+
+// 处理所有已经到达的链头事件，区块上链后立即调用，保证之后出块时内存池是最新的。
+func (s *Server) drainNewHeads() {
+	for {
+		select {
+		case ev := <-s.headSub.Chan():
+			s.processNewHead(ev)
+		default:
+			return
+		}
+	}
+}
+
 // 创建新的区块的函数。
-// 目前这个函数只是打印一条消息，表示正在创建新的区块。
+// 它打包内存池中的交易；未启用PoW时直接签名并上链，启用PoW时在后台协程中挖矿。
 func (s *Server) createNewBlock() error {
-	// 打印一条消息，表示正在创建新的区块。
-	fmt.Println("创建一个新的区块")
+	if s.mining != nil {
+		return nil // 上一个区块仍在挖矿中
+	}
+	if s.snapshotSync != nil {
+		return nil // 快照同步完成之前不出块
+	}
+
+	currentHeader := s.chain.CurrentHeader()
+
+	// 打包内存池中的交易，无法执行的交易直接移出内存池，Nonce超前的交易留在内存池中等待空缺被填补
+	block, invalid, err := s.chain.BuildBlock(currentHeader, s.PrivateKey.PublicKey(), s.memPool.Transactions())
+	if err != nil {
+		return err
+	}
+	for _, tx := range invalid {
+		s.memPool.Remove(tx.Hash(core.TxHasher{}))
+		s.chain.Events().TxDropped.Send(core.TxDroppedEvent{Tx: tx, Reason: "交易无法在当前链头的状态上执行"})
+	}
+
+	if s.chain.PowConfig() == nil {
+		return s.processMinedBlock(block)
+	}
+
+	difficulty, err := s.chain.NextDifficulty(currentHeader)
+	if err != nil {
+		return err
+	}
+	block.Difficulty = difficulty
+
+	job := &miningJob{
+		parent: block.PrevBlockHash,
+		quitCh: make(chan struct{}),
+	}
+	s.mining = job
+
+	go func() {
+		if err := s.miner.Mine(block.Header, job.quitCh); err != nil {
+			logrus.WithFields(logrus.Fields{
+				"区块高度": block.Height,
+			}).Info(err)
+			s.minedBlockCh <- nil
+			return
+		}
+		s.minedBlockCh <- block
+	}()
+
+	return nil
+}
+
+// 为本地产生（挖出）的区块签名，添加到区块链并广播。
+func (s *Server) processMinedBlock(b *core.Block) error {
+	// 通过守卫签名，拒绝在已签名的高度上签出不同的区块
+	if err := s.signGuard.SignBlock(b, 0, *s.PrivateKey); err != nil {
+		return err
+	}
+
+	if err := s.chain.AddBlock(b); err != nil {
+		return err
+	}
+
+	s.drainNewHeads()
+
+	go s.broadcastBlock(b)
 
-	// 返回nil，表示函数执行成功。
 	return nil
 }
 
+// 验证者将检测到的双重签名证据作为证据交易提交，交易被打包后作恶者将受到处罚。
+func (s *Server) reportEvidence(ev *core.DoubleSignEvidence) error {
+	if !s.isValidator {
+		return nil
+	}
+
+	tx, err := core.NewEvidenceTransaction(ev)
+	if err != nil {
+		return err
+	}
+	// 证据交易排在本验证者已经在内存池中的交易之后
+	from := s.PrivateKey.PublicKey().Address()
+	tx.Nonce = s.chain.State().Nonce(from) + uint64(s.memPool.CountFrom(from))
+	if err := tx.Sign(*s.PrivateKey); err != nil {
+		return err
+	}
+
+	return s.processTransaction(tx)
+}
+
+// 返回所有节点共享的默认创世配置。
+func defaultGenesis() *core.Genesis {
+	return &core.Genesis{
+		Timestamp: 000000,
+	}
+}
+
 // 初始化传输方式的函数。
 // 它遍历服务器配置中的所有传输方式，并为每个传输方式启动一个goroutine来消费RPC请求。
 func (s *Server) initTransports() {
@@ -0,0 +1,104 @@
+package network
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Luboy23/Blockchain_Project/core"
+	"github.com/Luboy23/Blockchain_Project/crypto"
+	"github.com/Luboy23/Blockchain_Project/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// 创建一个由validatorKey出块的验证者节点，创世状态中给每个账户分配1000的余额，并注册给定的验证者。
+func validatorTestServer(t *testing.T, validatorKey crypto.PrivateKey, accounts []crypto.PrivateKey, validators ...crypto.PrivateKey) *Server {
+	genesis := &core.Genesis{
+		Alloc: map[types.Address]uint64{},
+		Validators: []core.GenesisValidator{
+			{PublicKey: validatorKey.PublicKey(), Stake: 100},
+		},
+	}
+	for _, key := range accounts {
+		genesis.Alloc[key.PublicKey().Address()] = 1000
+	}
+	for _, key := range validators {
+		genesis.Validators = append(genesis.Validators, core.GenesisValidator{PublicKey: key.PublicKey(), Stake: 100})
+	}
+
+	s, err := NewServer(ServerOpts{
+		BlockTime:  time.Hour,
+		PrivateKey: &validatorKey,
+		Genesis:    genesis,
+	})
+	assert.Nil(t, err)
+
+	return s
+}
+
+// 创建一个由指定私钥签名的转账交易。
+func transferTx(t *testing.T, priKey crypto.PrivateKey, nonce uint64, value uint64) *core.Transaction {
+	tx := &core.Transaction{
+		Type:  core.TxTypeTransfer,
+		Nonce: nonce,
+		To:    types.Address{1},
+		Value: value,
+	}
+	assert.Nil(t, tx.Sign(priKey))
+
+	return tx
+}
+
+// 测试验证者已经发送过交易、并且还有交易在内存池中时，提交的证据交易仍然可以被打包。
+func TestReportEvidenceAfterSending(t *testing.T) {
+	validatorKey := crypto.GeneratePrivatekey()
+	offenderKey := crypto.GeneratePrivatekey()
+	s := validatorTestServer(t, validatorKey, []crypto.PrivateKey{validatorKey}, offenderKey)
+
+	assert.Nil(t, s.processTransaction(transferTx(t, validatorKey, 0, 10)))
+	assert.Nil(t, s.createNewBlock())
+	assert.Equal(t, uint64(1), s.chain.State().Nonce(validatorKey.PublicKey().Address()))
+	assert.Nil(t, s.processTransaction(transferTx(t, validatorKey, 1, 10)))
+
+	// 作恶的验证者在高度1签名了两个不同的区块
+	genesis, err := s.chain.GetHeader(0)
+	assert.Nil(t, err)
+	a := core.NewBlockFromPrevHeader(genesis, nil)
+	assert.Nil(t, a.Sign(offenderKey))
+	b := core.NewBlockFromPrevHeader(genesis, nil)
+	b.Timestamp = a.Timestamp + 1
+	assert.Nil(t, b.Sign(offenderKey))
+	assert.Nil(t, s.reportEvidence(&core.DoubleSignEvidence{A: core.NewSignedHeader(a), B: core.NewSignedHeader(b)}))
+
+	assert.Nil(t, s.createNewBlock())
+	assert.Equal(t, 0, s.memPool.Len())
+	assert.Len(t, s.chain.OffencesOf(offenderKey.PublicKey().Address()), 1)
+	assert.Equal(t, uint64(3), s.chain.State().Nonce(validatorKey.PublicKey().Address()))
+}
+
+// 测试Nonce超前的交易留在内存池中，空缺被填补后与之前的交易一起打包；Nonce已被使用的交易被移出内存池。
+func TestNonceGapStaysPooled(t *testing.T) {
+	validatorKey := crypto.GeneratePrivatekey()
+	userKey := crypto.GeneratePrivatekey()
+	s := validatorTestServer(t, validatorKey, []crypto.PrivateKey{userKey})
+
+	dropped := s.chain.Events().TxDropped.Subscribe(10, core.DropOldest)
+	defer dropped.Unsubscribe()
+
+	gapped := transferTx(t, userKey, 1, 10)
+	assert.Nil(t, s.processTransaction(gapped))
+	assert.Nil(t, s.createNewBlock())
+	assert.Equal(t, uint32(1), s.chain.Height())
+	assert.True(t, s.memPool.Has(gapped.Hash(core.TxHasher{})))
+	assert.Len(t, dropped.Chan(), 0)
+
+	assert.Nil(t, s.processTransaction(transferTx(t, userKey, 0, 10)))
+	assert.Nil(t, s.createNewBlock())
+	assert.Equal(t, uint64(2), s.chain.State().Nonce(userKey.PublicKey().Address()))
+	assert.Equal(t, 0, s.memPool.Len())
+
+	stale := transferTx(t, userKey, 0, 20)
+	assert.Nil(t, s.processTransaction(stale))
+	assert.Nil(t, s.createNewBlock())
+	assert.False(t, s.memPool.Has(stale.Hash(core.TxHasher{})))
+	assert.Len(t, dropped.Chan(), 1)
+}
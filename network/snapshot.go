@@ -0,0 +1,315 @@
+package network
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"time"
+
+	"github.com/Luboy23/Blockchain_Project/core"
+	"github.com/Luboy23/Blockchain_Project/types"
+	"github.com/sirupsen/logrus"
+)
+
+const hashLength = len(types.Hash{}) // 哈希的字节数
+
+const (
+	maxSnapshotChunks    = 1 << 16          // 快照清单中分片数量的上限，按默认分片大小可以容纳约八百万个账户
+	maxBlocksPerResponse = 128              // 一次区块请求最多回复的区块数量
+	snapshotPeerTimeout  = 30 * time.Second // 提供快照的节点超过该时间没有回复时被放弃
+)
+
+// 请求指定区块的状态快照清单。
+type GetSnapshotMessage struct {
+	BlockHash types.Hash // 快照对应的区块哈希
+}
+
+// 状态快照清单，告知请求者快照对应的区块头和分片数量。
+type SnapshotManifestMessage struct {
+	Header *core.Header // 快照对应的区块头
+	Chunks uint32       // 分片数量
+}
+
+// 请求状态快照的一个分片。
+type GetSnapshotChunkMessage struct {
+	BlockHash types.Hash // 快照对应的区块哈希
+	Index     uint32     // 分片序号
+}
+
+// 状态快照的一个分片。
+type SnapshotChunkMessage struct {
+	BlockHash types.Hash          // 快照对应的区块哈希
+	Chunk     *core.SnapshotChunk // 分片内容
+}
+
+// 请求从指定高度开始的主链区块，对方逐个以区块消息回复。
+type GetBlocksMessage struct {
+	From uint32 // 起始高度
+}
+
+// 一次正在进行的快照同步。
+type snapshotSync struct {
+	header   *core.Header          // 可信的区块头
+	peer     NetAddr               // 提供快照的节点，收到清单之前为空
+	chunks   []*core.SnapshotChunk // 已收到的分片，按序号存放
+	received int                   // 已收到的分片数量
+	deadline time.Time             // 在该时间之前没有收到清单或新的分片时放弃当前节点并重新请求
+	dropped  map[NetAddr]struct{}  // 因超时被放弃的节点，不再接受它们的清单
+}
+
+// 快照同步完成后正在进行的区块同步，每批最多请求maxBlocksPerResponse个区块。
+type blockSync struct {
+	peer NetAddr // 提供区块的节点
+	end  uint32  // 本批请求的区块高度上界（不含），收到高度为end-1的区块后请求下一批
+}
+
+// 开始快照同步：向所有节点请求可信区块头对应的快照清单，由最先回复的节点提供快照。
+func (s *Server) startSnapshotSync() error {
+	dropped := make(map[NetAddr]struct{})
+	if s.snapshotSync != nil { // 重新开始同步时仍然不接受已被放弃的节点
+		dropped = s.snapshotSync.dropped
+	}
+	s.snapshotSync = &snapshotSync{
+		header:   s.TrustedHeader,
+		deadline: time.Now().Add(snapshotPeerTimeout),
+		dropped:  dropped,
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"区块高度": s.TrustedHeader.Height,
+	}).Info("开始快照同步")
+
+	msg, err := encodeMessage(MessageTypeGetSnapshot, &GetSnapshotMessage{
+		BlockHash: core.BlockHasher{}.Hash(s.TrustedHeader),
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.broadcast(msg.Bytes())
+}
+
+// 回复快照清单请求。
+func (s *Server) processGetSnapshot(from NetAddr, m *GetSnapshotMessage) error {
+	snapshot, err := s.chain.GetSnapshot(m.BlockHash)
+	if err != nil {
+		return err
+	}
+
+	return s.sendMessage(from, MessageTypeSnapshot, &SnapshotManifestMessage{
+		Header: snapshot.Header,
+		Chunks: uint32(len(snapshot.Chunks)),
+	})
+}
+
+// 处理快照清单：清单必须对应可信的区块头，之后向该节点请求所有分片。
+func (s *Server) processSnapshotManifest(from NetAddr, m *SnapshotManifestMessage) error {
+	sync := s.snapshotSync
+	if sync == nil || sync.peer != "" {
+		return nil // 没有在同步，或者已经选定了提供快照的节点
+	}
+	if _, ok := sync.dropped[from]; ok {
+		return nil
+	}
+
+	hash := core.BlockHasher{}.Hash(sync.header)
+	if m.Header == nil || (core.BlockHasher{}).Hash(m.Header) != hash {
+		return fmt.Errorf("节点(%s)的快照清单与可信区块头(%s)不符", from, hash)
+	}
+	if m.Chunks == 0 {
+		return fmt.Errorf("节点(%s)的快照清单没有分片", from)
+	}
+	if m.Chunks > maxSnapshotChunks {
+		return fmt.Errorf("节点(%s)的快照清单的分片数量(%d)超过上限(%d)", from, m.Chunks, maxSnapshotChunks)
+	}
+
+	sync.peer = from
+	sync.deadline = time.Now().Add(snapshotPeerTimeout)
+	sync.chunks = make([]*core.SnapshotChunk, m.Chunks)
+	for i := uint32(0); i < m.Chunks; i++ {
+		if err := s.sendMessage(from, MessageTypeGetSnapshotChunk, &GetSnapshotChunkMessage{BlockHash: hash, Index: i}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// 回复快照分片请求。
+func (s *Server) processGetSnapshotChunk(from NetAddr, m *GetSnapshotChunkMessage) error {
+	snapshot, err := s.chain.GetSnapshot(m.BlockHash)
+	if err != nil {
+		return err
+	}
+	if int(m.Index) >= len(snapshot.Chunks) {
+		return fmt.Errorf("快照(%s)没有分片(%d)", m.BlockHash, m.Index)
+	}
+
+	buf := &bytes.Buffer{}
+	buf.Write(m.BlockHash.ToSlice()) // 消息数据以快照的区块哈希开头
+	if err := snapshot.Chunks[m.Index].Encode(core.NewGobSnapshotChunkEncoder(buf)); err != nil {
+		return err
+	}
+	msg := NewMessage(MessageTypeSnapshotChunk, buf.Bytes())
+
+	return s.send(from, msg.Bytes())
+}
+
+// 处理快照分片：每个分片收到后立即根据可信区块头的状态根验证，无效的分片被丢弃并重新请求。
+// 收到所有分片后重建状态并重置区块链，然后从快照之后的高度开始请求区块。
+func (s *Server) processSnapshotChunk(from NetAddr, m *SnapshotChunkMessage) error {
+	sync := s.snapshotSync
+	if sync == nil || from != sync.peer || m.BlockHash != (core.BlockHasher{}).Hash(sync.header) {
+		return nil // 不是本次同步请求的分片
+	}
+
+	c := m.Chunk
+	if int(c.Index) >= len(sync.chunks) || sync.chunks[c.Index] != nil {
+		return nil
+	}
+	if err := c.Verify(sync.header.StateRoot); err != nil {
+		if err := s.sendMessage(from, MessageTypeGetSnapshotChunk, &GetSnapshotChunkMessage{BlockHash: m.BlockHash, Index: c.Index}); err != nil {
+			logrus.Error(err)
+		}
+		return err
+	}
+	sync.chunks[c.Index] = c
+	sync.received++
+	sync.deadline = time.Now().Add(snapshotPeerTimeout)
+
+	if sync.received < len(sync.chunks) {
+		return nil
+	}
+
+	if err := s.chain.ImportSnapshot(sync.header, sync.chunks); err != nil {
+		if err := s.startSnapshotSync(); err != nil { // 重建失败，重新开始同步
+			logrus.Error(err)
+		}
+		return err
+	}
+	s.snapshotSync = nil
+
+	return s.requestBlocks(from, sync.header.Height+1)
+}
+
+// 检查快照同步是否超时：选定的节点没有按时回复分片时放弃该节点，重新向其他节点请求快照清单；
+// 还没有节点回复清单时重新广播请求。
+func (s *Server) checkSnapshotSync(now time.Time) error {
+	sync := s.snapshotSync
+	if sync == nil || now.Before(sync.deadline) {
+		return nil
+	}
+
+	if sync.peer != "" {
+		logrus.WithFields(logrus.Fields{
+			"节点":    sync.peer,
+			"已收到分片": sync.received,
+		}).Warn("提供快照的节点没有回复，放弃该节点")
+		sync.dropped[sync.peer] = struct{}{}
+	}
+
+	return s.startSnapshotSync()
+}
+
+// 向指定节点请求从指定高度开始的一批区块。
+func (s *Server) requestBlocks(peer NetAddr, from uint32) error {
+	s.blockSync = &blockSync{peer: peer, end: from + maxBlocksPerResponse}
+
+	return s.sendMessage(peer, MessageTypeGetBlocks, &GetBlocksMessage{From: from})
+}
+
+// 区块上链后检查是否收到了本批请求的最后一个区块，如果是则继续请求下一批。
+func (s *Server) continueBlockSync(b *core.Block) error {
+	if s.blockSync == nil || b.Height+1 != s.blockSync.end {
+		return nil
+	}
+
+	return s.requestBlocks(s.blockSync.peer, s.blockSync.end)
+}
+
+// 回复区块请求：从指定高度开始逐个发送主链区块，一次最多发送maxBlocksPerResponse个。
+func (s *Server) processGetBlocks(from NetAddr, m *GetBlocksMessage) error {
+	last := m.From + maxBlocksPerResponse - 1
+	if tip := s.chain.Height(); last < m.From || last > tip {
+		last = tip
+	}
+
+	for height := m.From; height <= last; height++ {
+		header, err := s.chain.GetHeader(height)
+		if err != nil {
+			return err
+		}
+		b, err := s.chain.GetBlock(core.BlockHasher{}.Hash(header))
+		if err != nil {
+			return err
+		}
+
+		buf := &bytes.Buffer{}
+		if err := b.Encode(buf, core.NewGobBlockEncoder(buf)); err != nil {
+			return err
+		}
+		if err := s.send(from, NewMessage(MessageTypeBlock, buf.Bytes()).Bytes()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// 解码快照同步中除分片以外的消息。
+func decodeSyncMessage(msg Message) (any, error) {
+	var v any
+	switch msg.Header {
+	case MessageTypeGetSnapshot:
+		v = new(GetSnapshotMessage)
+	case MessageTypeSnapshot:
+		v = new(SnapshotManifestMessage)
+	case MessageTypeGetSnapshotChunk:
+		v = new(GetSnapshotChunkMessage)
+	case MessageTypeGetBlocks:
+		v = new(GetBlocksMessage)
+	default:
+		return nil, fmt.Errorf("不是快照同步消息 % x", msg.Header)
+	}
+
+	if err := gob.NewDecoder(bytes.NewReader(msg.Data)).Decode(v); err != nil {
+		return nil, err
+	}
+
+	return v, nil
+}
+
+// 使用gob编码消息数据并创建消息。
+func encodeMessage(t MessageType, v any) (*Message, error) {
+	buf := &bytes.Buffer{}
+	if err := gob.NewEncoder(buf).Encode(v); err != nil {
+		return nil, err
+	}
+
+	return NewMessage(t, buf.Bytes()), nil
+}
+
+// 编码消息数据并发送给指定节点。
+func (s *Server) sendMessage(to NetAddr, t MessageType, v any) error {
+	msg, err := encodeMessage(t, v)
+	if err != nil {
+		return err
+	}
+
+	return s.send(to, msg.Bytes())
+}
+
+// 通过第一个连接了该节点的传输方式发送消息。
+func (s *Server) send(to NetAddr, payload []byte) error {
+	var err error
+	for _, tr := range s.Transports {
+		if err = tr.SendMessage(to, payload); err == nil {
+			return nil
+		}
+	}
+	if err == nil {
+		err = fmt.Errorf("没有可以发送消息至(%s)的传输方式", to)
+	}
+
+	return err
+}
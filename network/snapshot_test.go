@@ -0,0 +1,179 @@
+package network
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Luboy23/Blockchain_Project/core"
+	"github.com/Luboy23/Blockchain_Project/crypto"
+	"github.com/Luboy23/Blockchain_Project/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// 测试新节点通过本地传输从可信区块头的状态快照同步，然后继续同步快照之后的区块。
+func TestSnapshotSync(t *testing.T) {
+	validatorKey := crypto.GeneratePrivatekey()
+	userKey := crypto.GeneratePrivatekey()
+	genesis := &core.Genesis{
+		Alloc: map[types.Address]uint64{userKey.PublicKey().Address(): 1000},
+		Validators: []core.GenesisValidator{
+			{PublicKey: validatorKey.PublicKey(), Stake: 100},
+		},
+	}
+
+	tra := NewLocalTransport("A")
+	trb := NewLocalTransport("B")
+	tra.Connect(trb)
+	trb.Connect(tra)
+
+	a, err := NewServer(ServerOpts{
+		Transports:       []Transport{tra},
+		BlockTime:        time.Hour,
+		Genesis:          genesis,
+		SnapshotInterval: 4,
+	})
+	assert.Nil(t, err)
+
+	// A上有6个区块，每个区块都向一个新账户转账
+	for i := 0; i < 6; i++ {
+		tx := &core.Transaction{
+			Type:  core.TxTypeTransfer,
+			Nonce: uint64(i),
+			To:    crypto.GeneratePrivatekey().PublicKey().Address(),
+			Value: 10,
+		}
+		assert.Nil(t, tx.Sign(userKey))
+
+		b, _, err := a.chain.BuildBlock(a.chain.CurrentHeader(), validatorKey.PublicKey(), []*core.Transaction{tx})
+		assert.Nil(t, err)
+		assert.Nil(t, b.Sign(validatorKey))
+		assert.Nil(t, a.chain.AddBlock(b))
+	}
+
+	trusted, err := a.chain.GetHeader(4)
+	assert.Nil(t, err)
+
+	b, err := NewServer(ServerOpts{
+		Transports:    []Transport{trb},
+		BlockTime:     time.Hour,
+		Genesis:       genesis,
+		TrustedHeader: trusted,
+	})
+	assert.Nil(t, err)
+
+	go a.Start()
+	go b.Start()
+	defer func() {
+		a.quitCh <- struct{}{}
+		b.quitCh <- struct{}{}
+	}()
+
+	assert.Eventually(t, func() bool {
+		return b.chain.Height() == a.chain.Height()
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, a.chain.CurrentHeader(), b.chain.CurrentHeader())
+	assert.Equal(t, a.chain.State().Root(), b.chain.State().Root())
+	assert.Equal(t, uint64(940), b.chain.State().Balance(userKey.PublicKey().Address()))
+
+	// 快照之前的区块没有下载
+	_, err = b.chain.GetHeader(3)
+	assert.NotNil(t, err)
+}
+
+// 测试分片数量超过上限的快照清单被拒绝，选定的节点超时没有回复时被放弃，之后不再接受它的清单。
+func TestSnapshotSyncPeerTimeout(t *testing.T) {
+	genesis := &core.Genesis{}
+	trusted := &core.Header{Height: 4, Timestamp: time.Now().UnixNano()}
+
+	tra := NewLocalTransport("A")
+	trb := NewLocalTransport("B")
+	trc := NewLocalTransport("C")
+	assert.Nil(t, trb.Connect(tra))
+	assert.Nil(t, trb.Connect(trc))
+
+	b, err := NewServer(ServerOpts{
+		Transports:    []Transport{trb},
+		BlockTime:     time.Hour,
+		Genesis:       genesis,
+		TrustedHeader: trusted,
+	})
+	assert.Nil(t, err)
+	assert.Nil(t, b.startSnapshotSync())
+
+	assert.NotNil(t, b.processSnapshotManifest("A", &SnapshotManifestMessage{Header: trusted, Chunks: maxSnapshotChunks + 1}))
+	assert.Equal(t, NetAddr(""), b.snapshotSync.peer)
+
+	assert.Nil(t, b.processSnapshotManifest("A", &SnapshotManifestMessage{Header: trusted, Chunks: 2}))
+	assert.Equal(t, NetAddr("A"), b.snapshotSync.peer)
+
+	now := time.Now()
+	assert.Nil(t, b.checkSnapshotSync(now))
+	assert.Equal(t, NetAddr("A"), b.snapshotSync.peer)
+
+	assert.Nil(t, b.checkSnapshotSync(now.Add(2*snapshotPeerTimeout)))
+	assert.Equal(t, NetAddr(""), b.snapshotSync.peer)
+	assert.Nil(t, b.processSnapshotManifest("A", &SnapshotManifestMessage{Header: trusted, Chunks: 2}))
+	assert.Equal(t, NetAddr(""), b.snapshotSync.peer)
+
+	assert.Nil(t, b.processSnapshotManifest("C", &SnapshotManifestMessage{Header: trusted, Chunks: 2}))
+	assert.Equal(t, NetAddr("C"), b.snapshotSync.peer)
+}
+
+// 测试区块请求的回复数量有上限，快照同步之后分批请求区块直到追上对方。
+func TestBlockSyncInBatches(t *testing.T) {
+	validatorKey := crypto.GeneratePrivatekey()
+	genesis := &core.Genesis{
+		Validators: []core.GenesisValidator{
+			{PublicKey: validatorKey.PublicKey(), Stake: 100},
+		},
+	}
+
+	tra := NewLocalTransport("A")
+	trb := NewLocalTransport("B")
+	assert.Nil(t, tra.Connect(trb))
+	assert.Nil(t, trb.Connect(tra))
+
+	a, err := NewServer(ServerOpts{
+		Transports:       []Transport{tra},
+		BlockTime:        time.Hour,
+		Genesis:          genesis,
+		SnapshotInterval: 4,
+	})
+	assert.Nil(t, err)
+
+	for i := 0; i < maxBlocksPerResponse+20; i++ {
+		b, _, err := a.chain.BuildBlock(a.chain.CurrentHeader(), validatorKey.PublicKey(), nil)
+		assert.Nil(t, err)
+		assert.Nil(t, b.Sign(validatorKey))
+		assert.Nil(t, a.chain.AddBlock(b))
+	}
+
+	// 一次请求最多回复maxBlocksPerResponse个区块
+	assert.Nil(t, a.processGetBlocks("B", &GetBlocksMessage{From: 1}))
+	assert.Len(t, trb.consumeCh, maxBlocksPerResponse)
+	for len(trb.consumeCh) > 0 {
+		<-trb.consumeCh
+	}
+
+	trusted, err := a.chain.GetHeader(4)
+	assert.Nil(t, err)
+	b, err := NewServer(ServerOpts{
+		Transports:    []Transport{trb},
+		BlockTime:     time.Hour,
+		Genesis:       genesis,
+		TrustedHeader: trusted,
+	})
+	assert.Nil(t, err)
+
+	go a.Start()
+	go b.Start()
+	defer func() {
+		a.quitCh <- struct{}{}
+		b.quitCh <- struct{}{}
+	}()
+
+	assert.Eventually(t, func() bool {
+		return b.chain.Height() == a.chain.Height()
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, a.chain.CurrentHeader(), b.chain.CurrentHeader())
+}
@@ -0,0 +1,447 @@
+package network
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/Luboy23/Blockchain_Project/core"
+	"github.com/Luboy23/Blockchain_Project/types"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	maxWSConnections        = 256  // 每个JSON-RPC处理器最多同时保持的WebSocket连接数
+	maxWSSubscriptions      = 32   // 每个WebSocket连接最多同时拥有的订阅数
+	maxWSTotalSubscriptions = 4096 // 每个JSON-RPC处理器的所有WebSocket连接合计最多拥有的订阅数
+	wsSendQueueSize         = 256  // 每个WebSocket连接待发送消息队列的长度，队列满时断开连接
+)
+
+// 订阅相关的错误码。
+const (
+	ErrCodeSubscriptionLimit = -32004 // 订阅数量超过上限
+)
+
+// 可以订阅的事件类型。
+const (
+	SubscriptionNewHeads            = "newHeads"            // 主链的新链头，推送区块头
+	SubscriptionPendingTransactions = "pendingTransactions" // 进入交易池的交易，推送交易哈希
+	SubscriptionReorgs              = "reorgs"              // 主链重组
+	SubscriptionLogs                = "logs"                // 符合过滤条件的合约日志
+)
+
+// 订阅推送的通知，method为"subscription"。
+type RPCSubscriptionNotification struct {
+	JSONRPC string                      `json:"jsonrpc"`
+	Method  string                      `json:"method"`
+	Params  RPCSubscriptionNotifyParams `json:"params"`
+}
+
+// 订阅通知的参数。
+type RPCSubscriptionNotifyParams struct {
+	Subscription string `json:"subscription"`
+	Result       any    `json:"result"`
+}
+
+// 主链重组通知。
+type RPCReorg struct {
+	OldHead  *core.Header `json:"oldHead"`
+	NewHead  *core.Header `json:"newHead"`
+	Reverted []types.Hash `json:"reverted"` // 离开主链的区块哈希，从旧链头开始倒序
+	Applied  []types.Hash `json:"applied"`  // 加入主链的区块哈希，按高度升序
+}
+
+// 合约日志通知。区块离开主链时，其中的日志会以Removed为true再推送一次。
+type RPCLog struct {
+	Address     types.Address  `json:"address"`
+	Topic       types.HexBytes `json:"topic"`
+	Data        types.HexBytes `json:"data"`
+	TxHash      types.Hash     `json:"txHash"`
+	BlockHash   types.Hash     `json:"blockHash"`
+	BlockHeight uint32         `json:"blockHeight"`
+	Removed     bool           `json:"removed"`
+}
+
+// 日志过滤条件，列表为空表示不限制。
+type LogFilter struct {
+	Addresses []types.Address  `json:"addresses"` // 合约地址
+	Topics    []types.HexBytes `json:"topics"`    // 日志主题
+}
+
+// 解析后的日志过滤条件。
+type logFilter struct {
+	addresses map[types.Address]bool
+	topics    map[string]bool
+}
+
+// 将日志过滤条件转换为便于匹配的形式。
+func newLogFilter(f *LogFilter) *logFilter {
+	lf := &logFilter{
+		addresses: make(map[types.Address]bool),
+		topics:    make(map[string]bool),
+	}
+	for _, addr := range f.Addresses {
+		lf.addresses[addr] = true
+	}
+	for _, topic := range f.Topics {
+		lf.topics[string(topic)] = true
+	}
+
+	return lf
+}
+
+// 检查日志是否符合过滤条件。
+func (f *logFilter) match(addr types.Address, topic []byte) bool {
+	if len(f.addresses) > 0 && !f.addresses[addr] {
+		return false
+	}
+	if len(f.topics) > 0 && !f.topics[string(topic)] {
+		return false
+	}
+	return true
+}
+
+// 一个WebSocket连接上的会话：处理JSON-RPC请求以及subscribe/unsubscribe，并推送订阅的事件。
+// 所有待发送的消息进入有界队列，客户端读取过慢导致队列已满时断开连接。
+type wsSession struct {
+	handler *JSONRPCHandler
+	conn    *wsConn
+	sendCh  chan []byte
+	quitCh  chan struct{}
+	once    sync.Once
+
+	lock   sync.Mutex
+	subs   map[string]chan struct{} // 订阅ID到用于取消订阅的通道
+	nextID uint64
+}
+
+// 处理WebSocket连接，直到连接关闭。连接数已达上限时拒绝升级。
+func (h *JSONRPCHandler) serveWebSocket(w http.ResponseWriter, r *http.Request) {
+	h.wsLock.Lock()
+	if h.wsConns >= h.maxWSConns {
+		h.wsLock.Unlock()
+		http.Error(w, fmt.Sprintf("WebSocket连接数已达上限(%d)", h.maxWSConns), http.StatusServiceUnavailable)
+		return
+	}
+	h.wsConns++
+	h.wsLock.Unlock()
+
+	conn, err := upgradeWebSocket(w, r)
+	if err != nil {
+		h.releaseWebSocket(0)
+		logrus.Warn(err)
+		return
+	}
+
+	s := &wsSession{
+		handler: h,
+		conn:    conn,
+		sendCh:  make(chan []byte, wsSendQueueSize),
+		quitCh:  make(chan struct{}),
+		subs:    make(map[string]chan struct{}),
+	}
+	go s.writeLoop()
+	s.readLoop()
+
+	s.lock.Lock()
+	subs := len(s.subs) // 读循环退出后不会再有新的订阅，剩余的订阅随会话一起结束
+	s.lock.Unlock()
+	h.releaseWebSocket(subs)
+}
+
+// 释放一个WebSocket连接及其剩余的订阅占用的名额。
+func (h *JSONRPCHandler) releaseWebSocket(subs int) {
+	h.wsLock.Lock()
+	defer h.wsLock.Unlock()
+
+	h.wsConns--
+	h.wsSubs -= subs
+}
+
+// 占用一个订阅名额，所有连接的订阅总数已达上限时返回false。
+func (h *JSONRPCHandler) acquireSubscription() bool {
+	h.wsLock.Lock()
+	defer h.wsLock.Unlock()
+
+	if h.wsSubs >= h.maxWSSubs {
+		return false
+	}
+	h.wsSubs++
+	return true
+}
+
+// 释放一个订阅名额。
+func (h *JSONRPCHandler) releaseSubscription() {
+	h.wsLock.Lock()
+	defer h.wsLock.Unlock()
+
+	h.wsSubs--
+}
+
+// 读取并处理客户端的请求。
+func (s *wsSession) readLoop() {
+	defer s.close(wsCloseNormal, "")
+
+	for {
+		_, message, err := s.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		if resp := s.handler.handleBody(message, s.call); resp != nil {
+			if !s.send(resp) {
+				return
+			}
+		}
+	}
+}
+
+// 将队列中的消息写入连接。
+func (s *wsSession) writeLoop() {
+	for {
+		select {
+		case msg := <-s.sendCh:
+			if err := s.conn.WriteText(msg); err != nil {
+				s.close(wsCloseNormal, "")
+				return
+			}
+		case <-s.quitCh:
+			return
+		}
+	}
+}
+
+// 把消息放入发送队列，队列已满时断开连接并返回false。
+func (s *wsSession) send(v any) bool {
+	msg, err := json.Marshal(v)
+	if err != nil {
+		logrus.Error(err)
+		return true
+	}
+
+	select {
+	case <-s.quitCh:
+		return false
+	default:
+	}
+
+	select {
+	case s.sendCh <- msg:
+		return true
+	default:
+		s.close(wsClosePolicy, "客户端读取过慢")
+		return false
+	}
+}
+
+// 推送订阅通知。
+func (s *wsSession) notify(id string, result any) bool {
+	return s.send(&RPCSubscriptionNotification{
+		JSONRPC: "2.0",
+		Method:  "subscription",
+		Params:  RPCSubscriptionNotifyParams{Subscription: id, Result: result},
+	})
+}
+
+// 关闭会话和连接，取消所有订阅。
+func (s *wsSession) close(code uint16, reason string) {
+	s.once.Do(func() {
+		close(s.quitCh)
+		s.conn.Close(code, reason)
+	})
+}
+
+// 调用请求的方法，在普通JSON-RPC方法之外加入subscribe和unsubscribe。
+func (s *wsSession) call(req *JSONRPCRequest) (any, *JSONRPCError) {
+	switch req.Method {
+	case "subscribe":
+		return s.subscribe(req)
+	case "unsubscribe":
+		return s.unsubscribe(req)
+	default:
+		return s.handler.call(req)
+	}
+}
+
+// subscribe：参数为订阅类型，订阅logs时第二个参数为LogFilter，返回订阅ID。
+func (s *wsSession) subscribe(req *JSONRPCRequest) (any, *JSONRPCError) {
+	params, rpcErr := req.params()
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+	if len(params) < 1 || len(params) > 2 {
+		return nil, newJSONRPCError(ErrCodeInvalidParams, "需要订阅类型以及可选的过滤条件")
+	}
+	var kind string
+	if err := json.Unmarshal(params[0], &kind); err != nil {
+		return nil, newJSONRPCError(ErrCodeInvalidParams, "订阅类型必须是字符串")
+	}
+
+	var filter *logFilter
+	if kind == SubscriptionLogs {
+		f := &LogFilter{}
+		if len(params) == 2 {
+			if err := json.Unmarshal(params[1], f); err != nil {
+				return nil, newJSONRPCError(ErrCodeInvalidParams, "无效的日志过滤条件：%s", err)
+			}
+		}
+		filter = newLogFilter(f)
+	} else if len(params) == 2 {
+		return nil, newJSONRPCError(ErrCodeInvalidParams, "订阅(%s)不需要过滤条件", kind)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if len(s.subs) >= maxWSSubscriptions {
+		return nil, newJSONRPCError(ErrCodeSubscriptionLimit, "每个连接最多%d个订阅", maxWSSubscriptions)
+	}
+	if !s.handler.acquireSubscription() {
+		return nil, newJSONRPCError(ErrCodeSubscriptionLimit, "节点的订阅总数已达上限(%d)", s.handler.maxWSSubs)
+	}
+
+	s.nextID++
+	id := fmt.Sprintf("0x%x", s.nextID)
+	done := make(chan struct{})
+
+	events := s.handler.server.chain.Events()
+	switch kind {
+	case SubscriptionNewHeads:
+		sub := events.NewHead.Subscribe(core.DefaultEventBuffer, core.Disconnect)
+		go forward(s, sub, done, func(ev core.NewHeadEvent) bool {
+			return s.notify(id, ev.Block.Header)
+		})
+	case SubscriptionPendingTransactions:
+		sub := events.TxAdded.Subscribe(core.DefaultEventBuffer, core.Disconnect)
+		go forward(s, sub, done, func(ev core.TxAddedEvent) bool {
+			return s.notify(id, ev.Tx.Hash(core.TxHasher{}))
+		})
+	case SubscriptionReorgs:
+		sub := events.Reorg.Subscribe(core.DefaultEventBuffer, core.Disconnect)
+		go forward(s, sub, done, func(ev core.ReorgEvent) bool {
+			return s.notify(id, newRPCReorg(ev))
+		})
+	case SubscriptionLogs:
+		sub := events.NewHead.Subscribe(core.DefaultEventBuffer, core.Disconnect)
+		go forward(s, sub, done, func(ev core.NewHeadEvent) bool {
+			for _, b := range ev.Reverted {
+				if !s.notifyLogs(id, filter, b, true) {
+					return false
+				}
+			}
+			for _, b := range ev.Applied {
+				if !s.notifyLogs(id, filter, b, false) {
+					return false
+				}
+			}
+			return true
+		})
+	default:
+		s.handler.releaseSubscription()
+		return nil, newJSONRPCError(ErrCodeInvalidParams, "未知的订阅类型(%s)", kind)
+	}
+	s.subs[id] = done
+
+	return id, nil
+}
+
+// unsubscribe：参数为订阅ID，返回订阅是否存在。
+func (s *wsSession) unsubscribe(req *JSONRPCRequest) (any, *JSONRPCError) {
+	params, rpcErr := req.params()
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+	if rpcErr := checkParams(params, 1); rpcErr != nil {
+		return nil, rpcErr
+	}
+	var id string
+	if err := json.Unmarshal(params[0], &id); err != nil {
+		return nil, newJSONRPCError(ErrCodeInvalidParams, "订阅ID必须是字符串")
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	done, ok := s.subs[id]
+	if ok {
+		close(done)
+		delete(s.subs, id)
+		s.handler.releaseSubscription()
+	}
+
+	return ok, nil
+}
+
+// 推送区块中符合过滤条件的日志。
+func (s *wsSession) notifyLogs(id string, filter *logFilter, b *core.Block, removed bool) bool {
+	hash := b.Hash(core.BlockHasher{})
+	receipts, err := s.handler.server.chain.GetReceipts(hash)
+	if err != nil {
+		logrus.Warn(err)
+		return true
+	}
+
+	for _, r := range receipts {
+		for _, l := range r.Logs {
+			if !filter.match(l.Address, l.Topic) {
+				continue
+			}
+			ok := s.notify(id, &RPCLog{
+				Address:     l.Address,
+				Topic:       l.Topic,
+				Data:        l.Data,
+				TxHash:      r.TxHash,
+				BlockHash:   hash,
+				BlockHeight: b.Height,
+				Removed:     removed,
+			})
+			if !ok {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// 将主链重组事件转换为通知。
+func newRPCReorg(ev core.ReorgEvent) *RPCReorg {
+	reorg := &RPCReorg{
+		OldHead:  ev.OldHead,
+		NewHead:  ev.NewHead,
+		Reverted: []types.Hash{},
+		Applied:  []types.Hash{},
+	}
+	for _, b := range ev.Reverted {
+		reorg.Reverted = append(reorg.Reverted, b.Hash(core.BlockHasher{}))
+	}
+	for _, b := range ev.Applied {
+		reorg.Applied = append(reorg.Applied, b.Hash(core.BlockHasher{}))
+	}
+
+	return reorg
+}
+
+// 把链事件转发给会话，直到取消订阅或会话关闭。
+// 事件总线因会话处理过慢取消订阅，或者handle因发送队列已满返回false时，断开连接。
+func forward[T any](s *wsSession, sub *core.Subscription[T], done chan struct{}, handle func(T) bool) {
+	defer sub.Unsubscribe()
+
+	for {
+		select {
+		case ev, ok := <-sub.Chan():
+			if !ok {
+				s.close(wsClosePolicy, "客户端读取过慢")
+				return
+			}
+			if !handle(ev) {
+				return
+			}
+		case <-done:
+			return
+		case <-s.quitCh:
+			return
+		}
+	}
+}
@@ -0,0 +1,367 @@
+package network
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	maxTCPMessageSize  = 8 << 20          // 单条消息的最大字节数，略大于按默认燃料上限打满交易的区块（约3MB），区块同步时每条消息只包含一个区块
+	maxTCPInboundPeers = 64               // 最多同时接受的入站连接数，超过时直接关闭新连接
+	tcpDialTimeout     = 5 * time.Second  // 连接对等节点的超时时间
+	tcpWriteTimeout    = 10 * time.Second // 写入一条消息的超时时间
+	tcpRedialInterval  = 10 * time.Second // 重新连接断开的静态对等节点的间隔
+)
+
+var errTCPTransportClosed = errors.New("TCP传输已关闭")
+
+// 基于TCP的传输实现，每条消息以4字节大端长度开头。
+// 主动建立的连接以拨号的地址为键，接受的连接以对方的实际地址为键，而不是对方自称的、无法验证的监听地址，
+// 收到的消息都以该地址作为发送者，这样可以直接用RPC.From通过同一条连接回复对方。
+type TCPTransport struct {
+	addr      NetAddr
+	consumeCh chan RPC
+
+	lock         sync.RWMutex
+	listener     net.Listener
+	peers        map[NetAddr]*tcpPeer // 已建立的连接
+	staticPeers  map[NetAddr]bool     // 断开后需要自动重新连接的对等节点
+	inboundSlots chan struct{}        // 入站连接的名额，每个入站连接占用一个，连接关闭时释放
+	quitCh       chan struct{}
+	closed       bool
+}
+
+// 一条到对等节点的TCP连接。
+type tcpPeer struct {
+	addr      NetAddr
+	conn      net.Conn
+	inbound   bool       // 是否是接受的连接
+	writeLock sync.Mutex // 保证消息不会交错写入
+	closeOnce sync.Once
+}
+
+// 创建一个TCP传输，addr为监听地址。
+func NewTCPTransport(addr NetAddr) *TCPTransport {
+	return &TCPTransport{
+		addr:         addr,
+		consumeCh:    make(chan RPC, 1024),
+		peers:        make(map[NetAddr]*tcpPeer),
+		staticPeers:  make(map[NetAddr]bool),
+		inboundSlots: make(chan struct{}, maxTCPInboundPeers),
+		quitCh:       make(chan struct{}),
+	}
+}
+
+// 开始监听并接受其他节点的连接，同时定期重新连接断开的静态对等节点。
+// 监听地址的端口为0时，Addr返回实际监听的地址。
+func (t *TCPTransport) Listen() error {
+	ln, err := net.Listen("tcp", string(t.addr))
+	if err != nil {
+		return err
+	}
+
+	t.lock.Lock()
+	t.listener = ln
+	if _, port, _ := net.SplitHostPort(string(t.addr)); port == "0" {
+		t.addr = NetAddr(ln.Addr().String())
+	}
+	t.lock.Unlock()
+
+	go t.acceptLoop(ln)
+	go t.redialLoop()
+
+	return nil
+}
+
+// 返回接收RPC的通道。
+func (t *TCPTransport) Consume() <-chan RPC {
+	return t.consumeCh
+}
+
+// 连接到另一个传输的地址。
+func (t *TCPTransport) Connect(tr Transport) error {
+	return t.Dial(tr.Addr())
+}
+
+// 将addr加入静态对等节点并连接它，连接断开后会自动重新连接。
+func (t *TCPTransport) AddPeer(addr NetAddr) error {
+	t.lock.Lock()
+	t.staticPeers[addr] = true
+	t.lock.Unlock()
+
+	return t.Dial(addr)
+}
+
+// 连接到addr上的节点，已经连接时什么都不做。
+func (t *TCPTransport) Dial(addr NetAddr) error {
+	if _, err := t.peer(addr); err != nil {
+		return err
+	}
+	return nil
+}
+
+// 向指定地址发送消息，尚未连接时先建立连接。
+func (t *TCPTransport) SendMessage(to NetAddr, payload []byte) error {
+	peer, err := t.peer(to)
+	if err != nil {
+		return fmt.Errorf("%s: 无法发送消息至： %s：%s", t.Addr(), to, err)
+	}
+
+	if err := peer.write(payload); err != nil {
+		t.removePeer(peer)
+		return fmt.Errorf("%s: 无法发送消息至： %s：%s", t.Addr(), to, err)
+	}
+	return nil
+}
+
+// 向所有已连接的节点广播消息，返回遇到的第一个错误。
+func (t *TCPTransport) Broadcast(payload []byte) error {
+	t.lock.RLock()
+	peers := make([]*tcpPeer, 0, len(t.peers))
+	for _, peer := range t.peers {
+		peers = append(peers, peer)
+	}
+	t.lock.RUnlock()
+
+	var firstErr error
+	for _, peer := range peers {
+		if err := peer.write(payload); err != nil {
+			t.removePeer(peer)
+			if firstErr == nil {
+				firstErr = fmt.Errorf("%s: 无法发送消息至： %s：%s", t.Addr(), peer.addr, err)
+			}
+		}
+	}
+	return firstErr
+}
+
+// 返回监听地址。
+func (t *TCPTransport) Addr() NetAddr {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	return t.addr
+}
+
+// 返回已连接的对等节点的地址。
+func (t *TCPTransport) Peers() []NetAddr {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	addrs := make([]NetAddr, 0, len(t.peers))
+	for addr := range t.peers {
+		addrs = append(addrs, addr)
+	}
+	return addrs
+}
+
+// 停止监听并关闭所有连接。
+func (t *TCPTransport) Close() error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.closed {
+		return nil
+	}
+	t.closed = true
+	close(t.quitCh)
+
+	for _, peer := range t.peers {
+		t.closePeer(peer)
+	}
+	t.peers = make(map[NetAddr]*tcpPeer)
+
+	if t.listener != nil {
+		return t.listener.Close()
+	}
+	return nil
+}
+
+// 返回到addr的连接，没有连接时建立一个新连接。
+func (t *TCPTransport) peer(addr NetAddr) (*tcpPeer, error) {
+	t.lock.RLock()
+	peer, ok := t.peers[addr]
+	closed := t.closed
+	t.lock.RUnlock()
+
+	if closed {
+		return nil, errTCPTransportClosed
+	}
+	if ok {
+		return peer, nil
+	}
+
+	conn, err := net.DialTimeout("tcp", string(addr), tcpDialTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	return t.addPeer(&tcpPeer{addr: addr, conn: conn}), nil
+}
+
+// 接受其他节点的连接。
+func (t *TCPTransport) acceptLoop(ln net.Listener) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			select {
+			case <-t.quitCh:
+			default:
+				logrus.WithError(err).Error("接受TCP连接失败")
+			}
+			return
+		}
+
+		select {
+		case t.inboundSlots <- struct{}{}:
+		default:
+			logrus.WithField("地址", conn.RemoteAddr()).Warn("入站连接数已达上限，拒绝连接")
+			conn.Close()
+			continue
+		}
+
+		t.addPeer(&tcpPeer{addr: NetAddr(conn.RemoteAddr().String()), conn: conn, inbound: true})
+	}
+}
+
+// 登记连接并开始读取消息。已有到同一地址的连接时（例如同时拨号同一个地址）保留已有的连接。
+func (t *TCPTransport) addPeer(peer *tcpPeer) *tcpPeer {
+	t.lock.Lock()
+	if t.closed {
+		t.lock.Unlock()
+		t.closePeer(peer)
+		return peer
+	}
+	if existing, ok := t.peers[peer.addr]; ok {
+		t.lock.Unlock()
+		t.closePeer(peer)
+		return existing
+	}
+	t.peers[peer.addr] = peer
+	t.lock.Unlock()
+
+	logrus.WithField("地址", peer.addr).Info("连接到对等节点")
+	go t.readLoop(peer)
+
+	return peer
+}
+
+// 关闭并移除连接，连接已经被替换时只关闭连接。
+func (t *TCPTransport) removePeer(peer *tcpPeer) {
+	t.closePeer(peer)
+
+	t.lock.Lock()
+	if t.peers[peer.addr] == peer {
+		delete(t.peers, peer.addr)
+	}
+	t.lock.Unlock()
+}
+
+// 关闭连接，入站连接同时释放占用的名额。可以重复调用。
+func (t *TCPTransport) closePeer(peer *tcpPeer) {
+	peer.closeOnce.Do(func() {
+		peer.conn.Close()
+		if peer.inbound {
+			<-t.inboundSlots
+		}
+	})
+}
+
+// 读取对方发送的消息，直到连接断开。
+func (t *TCPTransport) readLoop(peer *tcpPeer) {
+	defer t.removePeer(peer)
+
+	for {
+		payload, err := readTCPMessage(peer.conn)
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				logrus.WithField("地址", peer.addr).WithError(err).Warn("读取TCP消息失败")
+			}
+			return
+		}
+
+		select {
+		case t.consumeCh <- RPC{From: string(peer.addr), Payload: bytes.NewReader(payload)}:
+		case <-t.quitCh:
+			return
+		}
+	}
+}
+
+// 定期重新连接断开的静态对等节点。
+func (t *TCPTransport) redialLoop() {
+	ticker := time.NewTicker(tcpRedialInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			t.lock.RLock()
+			var missing []NetAddr
+			for addr := range t.staticPeers {
+				if _, ok := t.peers[addr]; !ok {
+					missing = append(missing, addr)
+				}
+			}
+			t.lock.RUnlock()
+
+			for _, addr := range missing {
+				if err := t.Dial(addr); err != nil {
+					logrus.WithField("地址", addr).WithError(err).Debug("重新连接对等节点失败")
+				}
+			}
+		case <-t.quitCh:
+			return
+		}
+	}
+}
+
+// 写入一条带长度前缀的消息。
+func (p *tcpPeer) write(payload []byte) error {
+	p.writeLock.Lock()
+	defer p.writeLock.Unlock()
+
+	p.conn.SetWriteDeadline(time.Now().Add(tcpWriteTimeout))
+	return writeTCPMessage(p.conn, payload)
+}
+
+// 写入4字节大端长度和消息内容。
+func writeTCPMessage(w io.Writer, payload []byte) error {
+	if len(payload) > maxTCPMessageSize {
+		return fmt.Errorf("消息过大(%d字节)", len(payload))
+	}
+
+	frame := make([]byte, 4+len(payload))
+	binary.BigEndian.PutUint32(frame, uint32(len(payload)))
+	copy(frame[4:], payload)
+
+	_, err := w.Write(frame)
+	return err
+}
+
+// 读取一条带长度前缀的消息。
+func readTCPMessage(r io.Reader) ([]byte, error) {
+	var length [4]byte
+	if _, err := io.ReadFull(r, length[:]); err != nil {
+		return nil, err
+	}
+
+	n := binary.BigEndian.Uint32(length[:])
+	if n > maxTCPMessageSize {
+		return nil, fmt.Errorf("消息过大(%d字节)", n)
+	}
+
+	payload := &bytes.Buffer{} // 按实际收到的数据增长，而不是按对方声明的长度预先分配
+	if _, err := io.CopyN(payload, r, int64(n)); err != nil {
+		return nil, err
+	}
+	return payload.Bytes(), nil
+}
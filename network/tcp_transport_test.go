@@ -0,0 +1,103 @@
+package network
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// 读取一条RPC，超时则测试失败。
+func consumeTCP(t *testing.T, tr *TCPTransport) RPC {
+	select {
+	case rpc := <-tr.Consume():
+		return rpc
+	case <-time.After(5 * time.Second):
+		t.Fatal("等待消息超时")
+		return RPC{}
+	}
+}
+
+// 测试两个TCP传输之间互相发送、回复和广播消息。
+func TestTCPTransport(t *testing.T) {
+	tra := NewTCPTransport("127.0.0.1:0")
+	trb := NewTCPTransport("127.0.0.1:0")
+	assert.Nil(t, tra.Listen())
+	assert.Nil(t, trb.Listen())
+	defer tra.Close()
+	defer trb.Close()
+
+	assert.Nil(t, tra.AddPeer(trb.Addr()))
+	assert.Nil(t, tra.SendMessage(trb.Addr(), []byte("hello")))
+
+	// 接受的连接以对方的实际地址为发送者，而不是对方的监听地址
+	rpc := consumeTCP(t, trb)
+	assert.NotEqual(t, string(tra.Addr()), rpc.From)
+	assert.Equal(t, []NetAddr{NetAddr(rpc.From)}, trb.Peers())
+	b, err := io.ReadAll(rpc.Payload)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("hello"), b)
+
+	// 使用RPC.From回复，复用对方建立的连接
+	assert.Nil(t, trb.SendMessage(NetAddr(rpc.From), []byte("world")))
+	rpc = consumeTCP(t, tra)
+	assert.Equal(t, string(trb.Addr()), rpc.From)
+
+	assert.Nil(t, trb.Broadcast(bytes.Repeat([]byte{1}, 100000)))
+	rpc = consumeTCP(t, tra)
+	b, err = io.ReadAll(rpc.Payload)
+	assert.Nil(t, err)
+	assert.Len(t, b, 100000)
+
+	assert.Nil(t, trb.Close())
+	assert.NotNil(t, trb.SendMessage(tra.Addr(), []byte("closed")))
+}
+
+// 测试入站连接数达到上限后新连接被关闭，已有连接断开后释放名额。
+func TestTCPTransportInboundLimit(t *testing.T) {
+	tr := NewTCPTransport("127.0.0.1:0")
+	assert.Nil(t, tr.Listen())
+	defer tr.Close()
+
+	conns := []net.Conn{}
+	for i := 0; i < maxTCPInboundPeers; i++ {
+		conn, err := net.Dial("tcp", string(tr.Addr()))
+		assert.Nil(t, err)
+		defer conn.Close()
+		conns = append(conns, conn)
+	}
+	assert.Eventually(t, func() bool { return len(tr.Peers()) == maxTCPInboundPeers }, 5*time.Second, 10*time.Millisecond)
+
+	// 超过上限的连接被直接关闭
+	rejected, err := net.Dial("tcp", string(tr.Addr()))
+	assert.Nil(t, err)
+	defer rejected.Close()
+	rejected.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, err = rejected.Read(make([]byte, 1))
+	assert.Equal(t, io.EOF, err)
+
+	conns[0].Close()
+	assert.Eventually(t, func() bool { return len(tr.Peers()) == maxTCPInboundPeers-1 }, 5*time.Second, 10*time.Millisecond)
+
+	conn, err := net.Dial("tcp", string(tr.Addr()))
+	assert.Nil(t, err)
+	defer conn.Close()
+	assert.Nil(t, writeTCPMessage(conn, []byte("hello")))
+	rpc := consumeTCP(t, tr)
+	assert.Equal(t, conn.LocalAddr().String(), rpc.From)
+
+	// 声明的长度超过上限的消息导致连接被关闭
+	assert.Nil(t, writeTCPMessage(conns[1], nil))
+	consumeTCP(t, tr)
+	var length [4]byte
+	binary.BigEndian.PutUint32(length[:], maxTCPMessageSize+1)
+	_, err = conns[1].Write(length[:])
+	assert.Nil(t, err)
+	conns[1].SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, err = conns[1].Read(make([]byte, 1))
+	assert.Equal(t, io.EOF, err)
+}
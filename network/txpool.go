@@ -2,6 +2,7 @@ package network
 
 import (
 	"sort"
+	"sync"
 
 	"github.com/Luboy23/Blockchain_Project/core"
 	"github.com/Luboy23/Blockchain_Project/types"
@@ -51,7 +52,9 @@ func (s *TxMapSorter) Less(i, j int) bool {
 
 // 结构体代表一个交易池，用于存储待处理的交易。
 // 它包含一个交易映射，用于存储交易的哈希值和交易对象。
+// 交易池可能被服务器主循环和JSON-RPC请求同时访问，所有方法都持有锁。
 type TxPool struct {
+	lock         sync.RWMutex
 	transactions map[types.Hash]*core.Transaction
 }
 
@@ -65,6 +68,9 @@ func NewTxPool() *TxPool {
 
 // 方法返回交易池中的所有交易，按照首次见到的时间戳排序。
 func (p *TxPool) Transactions() []*core.Transaction {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
 	s := NewTxMapSorter(p.transactions) // 创建一个新的TxMapSorter实例
 	return s.transactions // 返回排序后的交易切片
 }
@@ -72,6 +78,9 @@ func (p *TxPool) Transactions() []*core.Transaction {
 // 方法将一个新的交易添加到交易池中。
 // 它接收一个交易对象，计算其哈希值，并将交易添加到交易映射中。
 func (p *TxPool) Add(tx *core.Transaction) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
 	hash := tx.Hash(core.TxHasher{}) // 计算交易的哈希值
 
 	p.transactions[hash] = tx // 将交易添加到交易映射中
@@ -82,16 +91,56 @@ func (p *TxPool) Add(tx *core.Transaction) error {
 // 检查交易池中是否存在指定的交易。
 // 它接收一个交易的哈希值，并返回true表示交易存在。
 func (p *TxPool) Has(hash types.Hash) bool {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
 	_, ok := p.transactions[hash] // 检查交易映射中是否存在指定的哈希值
 	return ok // 返回检查结果
 }
 
+// 获取交易池中指定哈希的交易。
+func (p *TxPool) Get(hash types.Hash) (*core.Transaction, bool) {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	tx, ok := p.transactions[hash]
+	return tx, ok
+}
+
+// 从交易池中移除指定哈希的交易，通常在交易被打包进区块后调用。
+func (p *TxPool) Remove(hash types.Hash) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	delete(p.transactions, hash) // 从交易映射中删除指定的哈希值
+}
+
+// 返回交易池中由指定地址发送的交易数量。
+func (p *TxPool) CountFrom(addr types.Address) int {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	count := 0
+	for _, tx := range p.transactions {
+		if tx.Sender().Address() == addr {
+			count++
+		}
+	}
+	return count
+}
+
 // 返回交易池中的交易数量。
 func (p *TxPool) Len() int {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
 	return len(p.transactions) // 返回交易映射的长度
 }
 
 //	清空交易池中的所有交易。
 func (p *TxPool) Flush() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
 	p.transactions = make(map[types.Hash]*core.Transaction) // 创建一个新的空交易映射
 }
@@ -0,0 +1,292 @@
+package network
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RFC 6455定义的操作码。
+const (
+	wsOpContinuation byte = 0x0
+	wsOpText         byte = 0x1
+	wsOpBinary       byte = 0x2
+	wsOpClose        byte = 0x8
+	wsOpPing         byte = 0x9
+	wsOpPong         byte = 0xA
+)
+
+// RFC 6455定义的关闭状态码。
+const (
+	wsCloseNormal        uint16 = 1000
+	wsCloseProtocolError uint16 = 1002
+	wsClosePolicy        uint16 = 1008
+	wsCloseTooBig        uint16 = 1009
+)
+
+const (
+	wsGUID           = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11" // 计算Sec-WebSocket-Accept使用的固定GUID
+	maxWSMessageSize = maxJSONRPCRequestSize                  // 单条消息（包括分片）的最大字节数
+	wsWriteTimeout   = 10 * time.Second                       // 写入一帧的超时时间
+)
+
+var errWSClosed = errors.New("WebSocket连接已关闭")
+
+// 检查HTTP请求是否是WebSocket升级请求。
+func isWebSocketUpgrade(r *http.Request) bool {
+	return strings.EqualFold(r.Header.Get("Upgrade"), "websocket") && headerContains(r.Header, "Connection", "upgrade")
+}
+
+// 检查以逗号分隔的请求头中是否包含指定的值（不区分大小写）。
+func headerContains(h http.Header, name, value string) bool {
+	for _, v := range h.Values(name) {
+		for _, s := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(s), value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// 根据Sec-WebSocket-Key计算Sec-WebSocket-Accept。
+func wsAcceptKey(key string) string {
+	sum := sha1.Sum([]byte(key + wsGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// 一个服务端WebSocket连接，只实现了本节点需要的部分：不支持扩展和子协议。
+type wsConn struct {
+	conn      net.Conn
+	br        *bufio.Reader
+	writeLock sync.Mutex // 保证帧不会交错写入
+}
+
+// 完成WebSocket握手，接管HTTP连接。
+func upgradeWebSocket(w http.ResponseWriter, r *http.Request) (*wsConn, error) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "WebSocket握手必须使用GET请求", http.StatusMethodNotAllowed)
+		return nil, fmt.Errorf("WebSocket握手使用了%s请求", r.Method)
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "不支持的WebSocket版本", http.StatusUpgradeRequired)
+		return nil, fmt.Errorf("不支持的WebSocket版本(%s)", r.Header.Get("Sec-WebSocket-Version"))
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if decoded, err := base64.StdEncoding.DecodeString(key); err != nil || len(decoded) != 16 {
+		http.Error(w, "无效的Sec-WebSocket-Key", http.StatusBadRequest)
+		return nil, fmt.Errorf("无效的Sec-WebSocket-Key(%s)", key)
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "连接不支持WebSocket", http.StatusInternalServerError)
+		return nil, fmt.Errorf("HTTP连接不支持接管")
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+
+	resp := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + wsAcceptKey(key) + "\r\n\r\n"
+	if _, err := rw.WriteString(resp); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err := rw.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return &wsConn{conn: conn, br: rw.Reader}, nil
+}
+
+// 读取一条完整的消息，期间自动回复ping和close帧。对方关闭连接时返回errWSClosed。
+func (c *wsConn) ReadMessage() (byte, []byte, error) {
+	var op byte
+	var message []byte
+	for {
+		fin, frameOp, payload, err := readWSFrame(c.br, true)
+		if err != nil {
+			if errors.Is(err, errWSFrameTooBig) {
+				c.Close(wsCloseTooBig, err.Error())
+			} else if !errors.Is(err, io.EOF) {
+				c.Close(wsCloseProtocolError, err.Error())
+			}
+			return 0, nil, err
+		}
+
+		switch frameOp {
+		case wsOpPing:
+			if err := c.writeFrame(wsOpPong, payload); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case wsOpPong:
+			continue
+		case wsOpClose:
+			c.writeFrame(wsOpClose, payload) // 回显关闭帧后关闭连接
+			c.conn.Close()
+			return 0, nil, errWSClosed
+		case wsOpContinuation:
+			if message == nil {
+				c.Close(wsCloseProtocolError, "意外的延续帧")
+				return 0, nil, fmt.Errorf("意外的延续帧")
+			}
+		case wsOpText, wsOpBinary:
+			if message != nil {
+				c.Close(wsCloseProtocolError, "分片消息未结束")
+				return 0, nil, fmt.Errorf("分片消息未结束")
+			}
+			op = frameOp
+			message = []byte{}
+		default:
+			c.Close(wsCloseProtocolError, "未知的操作码")
+			return 0, nil, fmt.Errorf("未知的操作码(%d)", frameOp)
+		}
+
+		if len(message)+len(payload) > maxWSMessageSize {
+			c.Close(wsCloseTooBig, errWSFrameTooBig.Error())
+			return 0, nil, errWSFrameTooBig
+		}
+		message = append(message, payload...)
+		if fin {
+			return op, message, nil
+		}
+	}
+}
+
+// 发送一条文本消息。
+func (c *wsConn) WriteText(data []byte) error {
+	return c.writeFrame(wsOpText, data)
+}
+
+// 发送关闭帧并关闭连接。
+func (c *wsConn) Close(code uint16, reason string) error {
+	payload := make([]byte, 2, 2+len(reason))
+	binary.BigEndian.PutUint16(payload, code)
+	payload = append(payload, reason...)
+	if len(payload) > 125 { // 控制帧的负载不能超过125字节
+		payload = payload[:125]
+	}
+
+	c.writeFrame(wsOpClose, payload)
+	return c.conn.Close()
+}
+
+// 写入一个不分片、不加掩码的帧（服务端发送的帧不加掩码）。
+func (c *wsConn) writeFrame(op byte, payload []byte) error {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+
+	c.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	return writeWSFrame(c.conn, op, payload, nil)
+}
+
+var errWSFrameTooBig = errors.New("WebSocket消息过大")
+
+// 读取一帧，requireMask表示帧必须带有掩码（客户端发送给服务端的帧必须带掩码）。
+func readWSFrame(r io.Reader, requireMask bool) (bool, byte, []byte, error) {
+	head := make([]byte, 2)
+	if _, err := io.ReadFull(r, head); err != nil {
+		return false, 0, nil, err
+	}
+
+	fin := head[0]&0x80 != 0
+	if head[0]&0x70 != 0 {
+		return false, 0, nil, fmt.Errorf("不支持的扩展位")
+	}
+	op := head[0] & 0x0F
+	masked := head[1]&0x80 != 0
+	if requireMask && !masked {
+		return false, 0, nil, fmt.Errorf("客户端发送的帧没有掩码")
+	}
+
+	length := uint64(head[1] & 0x7F)
+	switch length {
+	case 126:
+		ext := make([]byte, 2)
+		if _, err := io.ReadFull(r, ext); err != nil {
+			return false, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext))
+	case 127:
+		ext := make([]byte, 8)
+		if _, err := io.ReadFull(r, ext); err != nil {
+			return false, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext)
+	}
+	if op >= wsOpClose && (length > 125 || !fin) {
+		return false, 0, nil, fmt.Errorf("无效的控制帧")
+	}
+	if length > maxWSMessageSize {
+		return false, 0, nil, errWSFrameTooBig
+	}
+
+	mask := make([]byte, 4)
+	if masked {
+		if _, err := io.ReadFull(r, mask); err != nil {
+			return false, 0, nil, err
+		}
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return false, 0, nil, err
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+
+	return fin, op, payload, nil
+}
+
+// 写入一个不分片的帧，mask不为nil时使用它对负载加掩码。
+func writeWSFrame(w io.Writer, op byte, payload []byte, mask []byte) error {
+	frame := []byte{0x80 | op}
+
+	maskBit := byte(0)
+	if mask != nil {
+		maskBit = 0x80
+	}
+	switch n := len(payload); {
+	case n <= 125:
+		frame = append(frame, maskBit|byte(n))
+	case n <= 0xFFFF:
+		frame = append(frame, maskBit|126, byte(n>>8), byte(n))
+	default:
+		ext := make([]byte, 8)
+		binary.BigEndian.PutUint64(ext, uint64(n))
+		frame = append(append(frame, maskBit|127), ext...)
+	}
+
+	if mask != nil {
+		frame = append(frame, mask...)
+		start := len(frame)
+		frame = append(frame, payload...)
+		for i := start; i < len(frame); i++ {
+			frame[i] ^= mask[(i-start)%4]
+		}
+	} else {
+		frame = append(frame, payload...)
+	}
+
+	_, err := w.Write(frame)
+	return err
+}
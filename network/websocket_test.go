@@ -0,0 +1,210 @@
+package network
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Luboy23/Blockchain_Project/core"
+	"github.com/Luboy23/Blockchain_Project/crypto"
+	"github.com/Luboy23/Blockchain_Project/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// 测试用的WebSocket客户端。
+type wsTestClient struct {
+	t    *testing.T
+	conn net.Conn
+	br   *bufio.Reader
+}
+
+// 连接到测试服务并完成握手。
+func dialWS(t *testing.T, ts *httptest.Server) *wsTestClient {
+	conn, err := net.Dial("tcp", strings.TrimPrefix(ts.URL, "http://"))
+	assert.Nil(t, err)
+
+	key := "dGhlIHNhbXBsZSBub25jZQ=="
+	fmt.Fprintf(conn, "GET / HTTP/1.1\r\nHost: test\r\nUpgrade: websocket\r\nConnection: keep-alive, Upgrade\r\n"+
+		"Sec-WebSocket-Key: %s\r\nSec-WebSocket-Version: 13\r\n\r\n", key)
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+	assert.Equal(t, "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=", resp.Header.Get("Sec-WebSocket-Accept")) // RFC 6455中的示例
+
+	return &wsTestClient{t: t, conn: conn, br: br}
+}
+
+// 发送一帧带掩码的消息。
+func (c *wsTestClient) write(op byte, payload []byte) {
+	assert.Nil(c.t, writeWSFrame(c.conn, op, payload, []byte{1, 2, 3, 4}))
+}
+
+// 读取一帧。
+func (c *wsTestClient) read() (byte, []byte) {
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	fin, op, payload, err := readWSFrame(c.br, false)
+	assert.Nil(c.t, err)
+	assert.True(c.t, fin)
+	return op, payload
+}
+
+// 发送请求并读取响应。
+func (c *wsTestClient) call(id int, method string, params ...any) *JSONRPCResponse {
+	req, err := json.Marshal(map[string]any{"jsonrpc": "2.0", "id": id, "method": method, "params": params})
+	assert.Nil(c.t, err)
+	c.write(wsOpText, req)
+
+	_, payload := c.read()
+	resp := &JSONRPCResponse{}
+	assert.Nil(c.t, json.Unmarshal(payload, resp))
+	return resp
+}
+
+// 读取一条订阅通知。
+func (c *wsTestClient) notification() *RPCSubscriptionNotification {
+	op, payload := c.read()
+	assert.Equal(c.t, wsOpText, op)
+	n := &RPCSubscriptionNotification{}
+	assert.Nil(c.t, json.Unmarshal(payload, n))
+	return n
+}
+
+// 测试通过WebSocket调用方法、订阅新链头和新交易、取消订阅以及订阅数量上限。
+func TestWebSocketSubscriptions(t *testing.T) {
+	s, ts, userKey, validatorKey := jsonrpcTestServer(t)
+	defer ts.Close()
+
+	c := dialWS(t, ts)
+	defer c.conn.Close()
+
+	assert.Equal(t, float64(1), c.call(1, "chain_height").Result)
+
+	c.write(wsOpPing, []byte("hi"))
+	op, payload := c.read()
+	assert.Equal(t, wsOpPong, op)
+	assert.Equal(t, []byte("hi"), payload)
+
+	heads := c.call(2, "subscribe", SubscriptionNewHeads).Result.(string)
+	pending := c.call(3, "subscribe", SubscriptionPendingTransactions).Result.(string)
+	assert.NotEqual(t, heads, pending)
+
+	tx := &core.Transaction{Type: core.TxTypeTransfer, Nonce: 1, Value: 1}
+	assert.Nil(t, tx.Sign(*userKey))
+	assert.Nil(t, s.processTransaction(tx))
+
+	n := c.notification()
+	assert.Equal(t, pending, n.Params.Subscription)
+	assert.Equal(t, "0x"+tx.Hash(core.TxHasher{}).String(), n.Params.Result)
+
+	b, _, err := s.chain.BuildBlock(s.chain.CurrentHeader(), validatorKey.PublicKey(), nil)
+	assert.Nil(t, err)
+	assert.Nil(t, b.Sign(*validatorKey))
+	assert.Nil(t, s.chain.AddBlock(b))
+
+	n = c.notification()
+	assert.Equal(t, heads, n.Params.Subscription)
+	assert.Equal(t, "0x"+b.Hash(core.BlockHasher{}).String(), n.Params.Result.(map[string]any)["hash"])
+
+	assert.Equal(t, true, c.call(4, "unsubscribe", heads).Result)
+	assert.Equal(t, false, c.call(5, "unsubscribe", heads).Result)
+
+	for i := 1; i < maxWSSubscriptions; i++ {
+		assert.Nil(t, c.call(10+i, "subscribe", SubscriptionReorgs).Error)
+	}
+	assert.Equal(t, ErrCodeSubscriptionLimit, c.call(100, "subscribe", SubscriptionReorgs).Error.Code)
+	assert.Equal(t, ErrCodeInvalidParams, c.call(101, "unsubscribe").Error.Code)
+
+	// 客户端发送关闭帧后服务端回显关闭帧
+	c.write(wsOpClose, []byte{0x03, 0xE8})
+	op, _ = c.read()
+	assert.Equal(t, wsOpClose, op)
+}
+
+// 测试客户端发送没有掩码的帧时服务端以协议错误关闭连接。
+func TestWebSocketRejectsUnmaskedFrame(t *testing.T) {
+	_, ts, _, _ := jsonrpcTestServer(t)
+	defer ts.Close()
+
+	c := dialWS(t, ts)
+	defer c.conn.Close()
+
+	assert.Nil(t, writeWSFrame(c.conn, wsOpText, []byte("{}"), nil))
+	op, payload := c.read()
+	assert.Equal(t, wsOpClose, op)
+	assert.Equal(t, []byte{0x03, 0xEA}, payload[:2]) // 1002
+}
+
+// 测试日志过滤条件。
+func TestLogFilter(t *testing.T) {
+	addr := crypto.GeneratePrivatekey().PublicKey().Address()
+	f := &LogFilter{}
+	assert.Nil(t, json.Unmarshal([]byte(fmt.Sprintf(`{"addresses":["0x%s"],"topics":["0x6869"]}`, addr)), f))
+	lf := newLogFilter(f)
+	assert.True(t, lf.match(addr, []byte("hi")))
+	assert.False(t, lf.match(addr, []byte("ho")))
+	assert.False(t, lf.match(types.Address{}, []byte("hi")))
+
+	assert.True(t, newLogFilter(&LogFilter{}).match(types.Address{}, nil))
+
+	assert.NotNil(t, json.Unmarshal([]byte(`{"addresses":["0x12"]}`), &LogFilter{}))
+}
+
+// 测试处理器范围内WebSocket连接数和订阅总数的上限，连接关闭后名额被释放。
+func TestWebSocketHandlerLimits(t *testing.T) {
+	s, rpc, _, _ := jsonrpcTestServer(t)
+	rpc.Close()
+
+	h := NewJSONRPCHandler(s)
+	h.maxWSConns = 2
+	h.maxWSSubs = 3
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+
+	a := dialWS(t, ts)
+	b := dialWS(t, ts)
+	defer b.conn.Close()
+
+	// 连接数已达上限时拒绝升级
+	conn, err := net.Dial("tcp", strings.TrimPrefix(ts.URL, "http://"))
+	assert.Nil(t, err)
+	fmt.Fprintf(conn, "GET / HTTP/1.1\r\nHost: test\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n"+
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n")
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	conn.Close()
+
+	// 订阅总数按所有连接合计，未知的订阅类型不占用名额
+	assert.Equal(t, ErrCodeInvalidParams, a.call(1, "subscribe", "unknown").Error.Code)
+	assert.Nil(t, a.call(2, "subscribe", SubscriptionNewHeads).Error)
+	assert.Nil(t, a.call(3, "subscribe", SubscriptionReorgs).Error)
+	sub := b.call(4, "subscribe", SubscriptionNewHeads).Result.(string)
+	assert.Equal(t, ErrCodeSubscriptionLimit, b.call(5, "subscribe", SubscriptionReorgs).Error.Code)
+
+	// 取消订阅后释放名额
+	assert.Equal(t, true, b.call(6, "unsubscribe", sub).Result)
+	assert.Nil(t, b.call(7, "subscribe", SubscriptionReorgs).Error)
+
+	// 关闭连接后释放连接和订阅的名额
+	a.write(wsOpClose, []byte{0x03, 0xE8})
+	a.read()
+	a.conn.Close()
+	assert.Eventually(t, func() bool {
+		h.wsLock.Lock()
+		defer h.wsLock.Unlock()
+		return h.wsConns == 1 && h.wsSubs == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	c := dialWS(t, ts)
+	defer c.conn.Close()
+	assert.Nil(t, c.call(8, "subscribe", SubscriptionNewHeads).Error)
+	assert.Nil(t, c.call(9, "subscribe", SubscriptionReorgs).Error)
+}
@@ -0,0 +1,254 @@
+package trie
+
+import (
+	"crypto/sha256"
+	"fmt"
+
+	"github.com/Luboy23/Blockchain_Project/types"
+)
+
+// 节点哈希的域分隔前缀，保证叶子哈希与内部节点哈希不会混淆。
+const (
+	leafPrefix byte = 0x00
+	nodePrefix byte = 0x01
+)
+
+// 键的位数，即树的最大深度。
+const keyBits = len(types.Hash{}) * 8
+
+// 一棵稀疏默克尔树，键和值都是32字节的哈希。
+// 只包含一个叶子的子树直接用该叶子的哈希表示，空子树的哈希为零值，因此树的实际深度约为log2(叶子数)。
+// 节点创建后不再修改并缓存自己的哈希，更新时只重建从根到叶子的路径，未修改的子树在副本之间共享。
+type SparseMerkleTree struct {
+	root *node
+}
+
+// 树中的节点。叶子节点保存键和值；内部节点至少包含两个叶子，其中一个子树可以为空。
+type node struct {
+	left, right *node
+	key, value  types.Hash
+	leaf        bool
+	hash        types.Hash
+}
+
+// 创建一棵空树。
+func New() *SparseMerkleTree {
+	return &SparseMerkleTree{}
+}
+
+// 复制树，修改副本不会影响原树。节点不可修改，因此副本与原树共享所有节点。
+func (t *SparseMerkleTree) Copy() *SparseMerkleTree {
+	return &SparseMerkleTree{root: t.root}
+}
+
+// 设置键对应的值。
+func (t *SparseMerkleTree) Update(key, value types.Hash) {
+	t.root = insert(t.root, newLeaf(key, value), 0)
+}
+
+// 删除一个键。
+func (t *SparseMerkleTree) Delete(key types.Hash) {
+	t.root = remove(t.root, key, 0)
+}
+
+// 获取键对应的值。
+func (t *SparseMerkleTree) Get(key types.Hash) (types.Hash, bool) {
+	n := t.root
+	for depth := 0; n != nil && !n.leaf; depth++ {
+		n = n.child(bit(key, depth))
+	}
+
+	if n == nil || n.key != key {
+		return types.Hash{}, false
+	}
+	return n.value, true
+}
+
+// 返回树的根哈希。
+func (t *SparseMerkleTree) Root() types.Hash {
+	return t.root.hashOf()
+}
+
+// 生成键的存在性或不存在性证明。
+func (t *SparseMerkleTree) Prove(key types.Hash) *Proof {
+	proof := &Proof{}
+
+	n := t.root
+	for depth := 0; n != nil && !n.leaf; depth++ {
+		b := bit(key, depth)
+		proof.Siblings = append(proof.Siblings, n.child(1-b).hashOf())
+		n = n.child(b)
+	}
+
+	if n != nil { // 路径终点是一个叶子，可能是要证明的键，也可能是共享前缀的另一个键
+		proof.LeafKey = n.key
+		proof.LeafValue = n.value
+		proof.HasLeaf = true
+	}
+
+	return proof
+}
+
+// 创建一个叶子节点。
+func newLeaf(key, value types.Hash) *node {
+	return &node{key: key, value: value, leaf: true, hash: leafHash(key, value)}
+}
+
+// 创建一个内部节点。
+func newBranch(left, right *node) *node {
+	return &node{left: left, right: right, hash: nodeHash(left.hashOf(), right.hashOf())}
+}
+
+// 返回节点的哈希，空子树的哈希为零值。
+func (n *node) hashOf() types.Hash {
+	if n == nil {
+		return types.Hash{}
+	}
+	return n.hash
+}
+
+// 返回内部节点在指定方向上的子节点，0为左，1为右。
+func (n *node) child(b byte) *node {
+	if b == 0 {
+		return n.left
+	}
+	return n.right
+}
+
+// 将叶子插入位于depth深度的子树，返回新的子树。
+func insert(n, leaf *node, depth int) *node {
+	switch {
+	case n == nil:
+		return leaf
+	case n.leaf && n.key == leaf.key:
+		return leaf
+	case n.leaf:
+		return join(n, leaf, depth)
+	}
+
+	if bit(leaf.key, depth) == 0 {
+		return newBranch(insert(n.left, leaf, depth+1), n.right)
+	}
+	return newBranch(n.left, insert(n.right, leaf, depth+1))
+}
+
+// 将两个不同的叶子合并为位于depth深度的子树，两个键分叉之前的每一层都是只有一侧非空的内部节点。
+func join(a, b *node, depth int) *node {
+	ba, bb := bit(a.key, depth), bit(b.key, depth)
+	switch {
+	case ba < bb:
+		return newBranch(a, b)
+	case ba > bb:
+		return newBranch(b, a)
+	case ba == 0:
+		return newBranch(join(a, b, depth+1), nil)
+	default:
+		return newBranch(nil, join(a, b, depth+1))
+	}
+}
+
+// 从位于depth深度的子树中删除键，返回新的子树。只剩一个叶子的子树收缩为该叶子。
+func remove(n *node, key types.Hash, depth int) *node {
+	switch {
+	case n == nil:
+		return nil
+	case n.leaf && n.key == key:
+		return nil
+	case n.leaf:
+		return n
+	}
+
+	left, right := n.left, n.right
+	if bit(key, depth) == 0 {
+		left = remove(left, key, depth+1)
+		if left == n.left {
+			return n
+		}
+	} else {
+		right = remove(right, key, depth+1)
+		if right == n.right {
+			return n
+		}
+	}
+
+	switch {
+	case left == nil && (right == nil || right.leaf):
+		return right
+	case right == nil && left.leaf:
+		return left
+	}
+	return newBranch(left, right)
+}
+
+// 稀疏默克尔树的证明，从根到路径终点依次记录兄弟节点的哈希。
+type Proof struct {
+	Siblings  []types.Hash // 从根开始的兄弟子树哈希
+	LeafKey   types.Hash   // 路径终点处叶子的键
+	LeafValue types.Hash   // 路径终点处叶子的值
+	HasLeaf   bool         // 路径终点是否为叶子，为false表示终点是空子树
+}
+
+// 验证证明：exists为true时验证key对应的值为value，否则验证树中不存在key。
+func (p *Proof) Verify(root, key, value types.Hash, exists bool) error {
+	if len(p.Siblings) > keyBits {
+		return fmt.Errorf("证明的深度(%d)超过了键的位数", len(p.Siblings))
+	}
+
+	var h types.Hash
+	switch {
+	case exists:
+		if !p.HasLeaf || p.LeafKey != key || p.LeafValue != value {
+			return fmt.Errorf("证明中的叶子与键(%s)不符", key)
+		}
+		h = leafHash(key, value)
+	case p.HasLeaf:
+		if p.LeafKey == key {
+			return fmt.Errorf("键(%s)存在于树中", key)
+		}
+		for d := range p.Siblings { // 另一个叶子必须位于同一路径上
+			if bit(p.LeafKey, d) != bit(key, d) {
+				return fmt.Errorf("证明中的叶子不在键(%s)的路径上", key)
+			}
+		}
+		h = leafHash(p.LeafKey, p.LeafValue)
+	}
+
+	for d := len(p.Siblings) - 1; d >= 0; d-- {
+		if bit(key, d) == 0 {
+			h = nodeHash(h, p.Siblings[d])
+		} else {
+			h = nodeHash(p.Siblings[d], h)
+		}
+	}
+
+	if h != root {
+		return fmt.Errorf("证明计算出的根(%s)与(%s)不符", h, root)
+	}
+
+	return nil
+}
+
+// 返回键的第depth位（从最高位开始）。
+func bit(key types.Hash, depth int) byte {
+	return key[depth/8] >> (7 - depth%8) & 1
+}
+
+// 计算叶子的哈希。
+func leafHash(key, value types.Hash) types.Hash {
+	buf := make([]byte, 0, 1+len(key)+len(value))
+	buf = append(buf, leafPrefix)
+	buf = append(buf, key[:]...)
+	buf = append(buf, value[:]...)
+
+	return types.Hash(sha256.Sum256(buf))
+}
+
+// 计算内部节点的哈希。
+func nodeHash(left, right types.Hash) types.Hash {
+	buf := make([]byte, 0, 1+len(left)+len(right))
+	buf = append(buf, nodePrefix)
+	buf = append(buf, left[:]...)
+	buf = append(buf, right[:]...)
+
+	return types.Hash(sha256.Sum256(buf))
+}
@@ -0,0 +1,131 @@
+package trie
+
+import (
+	"testing"
+
+	"github.com/Luboy23/Blockchain_Project/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEmptyTree(t *testing.T) {
+	tree := New()
+	assert.Equal(t, types.Hash{}, tree.Root())
+
+	key := types.RandomHash()
+	proof := tree.Prove(key)
+	assert.Nil(t, proof.Verify(tree.Root(), key, types.Hash{}, false))
+	assert.NotNil(t, proof.Verify(tree.Root(), key, types.RandomHash(), true))
+}
+
+func TestRootIndependentOfInsertionOrder(t *testing.T) {
+	keys := []types.Hash{}
+	values := []types.Hash{}
+	for i := 0; i < 50; i++ {
+		keys = append(keys, types.RandomHash())
+		values = append(values, types.RandomHash())
+	}
+
+	a, b := New(), New()
+	for i := range keys {
+		a.Update(keys[i], values[i])
+		b.Update(keys[len(keys)-1-i], values[len(keys)-1-i])
+	}
+	assert.Equal(t, a.Root(), b.Root())
+
+	// 修改任意一个值都会改变根
+	root := a.Root()
+	a.Update(keys[7], types.RandomHash())
+	assert.NotEqual(t, root, a.Root())
+
+	// 恢复后根也恢复
+	a.Update(keys[7], values[7])
+	assert.Equal(t, root, a.Root())
+
+	// 删除后与从未插入相同
+	a.Delete(keys[3])
+	c := New()
+	for i := range keys {
+		if i != 3 {
+			c.Update(keys[i], values[i])
+		}
+	}
+	assert.Equal(t, c.Root(), a.Root())
+}
+
+func TestInclusionProof(t *testing.T) {
+	tree := New()
+	keys := []types.Hash{}
+	for i := 0; i < 100; i++ {
+		k := types.RandomHash()
+		keys = append(keys, k)
+		tree.Update(k, types.RandomHash())
+	}
+	root := tree.Root()
+
+	for _, k := range keys {
+		v, ok := tree.Get(k)
+		assert.True(t, ok)
+
+		proof := tree.Prove(k)
+		assert.Nil(t, proof.Verify(root, k, v, true))
+
+		// 错误的值、错误的根以及声称不存在都无法通过验证
+		assert.NotNil(t, proof.Verify(root, k, types.RandomHash(), true))
+		assert.NotNil(t, proof.Verify(types.RandomHash(), k, v, true))
+		assert.NotNil(t, proof.Verify(root, k, v, false))
+	}
+}
+
+func TestNonInclusionProof(t *testing.T) {
+	tree := New()
+	for i := 0; i < 100; i++ {
+		tree.Update(types.RandomHash(), types.RandomHash())
+	}
+	root := tree.Root()
+
+	for i := 0; i < 100; i++ {
+		k := types.RandomHash()
+		proof := tree.Prove(k)
+		assert.Nil(t, proof.Verify(root, k, types.Hash{}, false))
+		assert.NotNil(t, proof.Verify(root, k, types.Hash{}, true))
+	}
+
+	// 共享前缀的键：路径终点是另一个叶子
+	var a, b types.Hash
+	b[31] = 1
+	single := New()
+	single.Update(a, types.RandomHash())
+	proof := single.Prove(b)
+	assert.True(t, proof.HasLeaf)
+	assert.Nil(t, proof.Verify(single.Root(), b, types.Hash{}, false))
+
+	// 篡改兄弟节点的证明无法通过验证
+	k := types.RandomHash()
+	proof = tree.Prove(k)
+	proof.Siblings[0] = types.RandomHash()
+	assert.NotNil(t, proof.Verify(root, k, types.Hash{}, false))
+}
+
+func TestCopy(t *testing.T) {
+	tree := New()
+	keys := []types.Hash{}
+	for i := 0; i < 20; i++ {
+		k := types.RandomHash()
+		keys = append(keys, k)
+		tree.Update(k, types.RandomHash())
+	}
+	root := tree.Root()
+
+	// 修改副本不会影响原树
+	cp := tree.Copy()
+	cp.Update(keys[0], types.RandomHash())
+	cp.Delete(keys[1])
+	cp.Update(types.RandomHash(), types.RandomHash())
+	assert.NotEqual(t, root, cp.Root())
+	assert.Equal(t, root, tree.Root())
+
+	_, ok := tree.Get(keys[1])
+	assert.True(t, ok)
+	_, ok = cp.Get(keys[1])
+	assert.False(t, ok)
+}
@@ -2,7 +2,9 @@ package types
 
 import (
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"strings"
 )
 
 // 定义了一个长度为20的uint8数组，用于表示以太坊地址。
@@ -41,3 +43,69 @@ func AddressFromBytes(b []byte) Address {
 func (a Address) String() string {
 	return hex.EncodeToString(a.ToSlice()) // 返回十六进制字符串
 }
+
+// 从十六进制字符串解析Address，字符串可以带有0x前缀。
+func AddressFromHex(s string) (Address, error) {
+	b, err := DecodeHex(s)
+	if err != nil {
+		return Address{}, err
+	}
+	if len(b) != 20 {
+		return Address{}, fmt.Errorf("地址的长度应该为20字节，而不是%d字节", len(b))
+	}
+
+	return AddressFromBytes(b), nil
+}
+
+// 实现encoding.TextMarshaler接口，编码为0x开头的十六进制字符串。
+func (a Address) MarshalText() ([]byte, error) {
+	return []byte(EncodeHex(a[:])), nil
+}
+
+// 实现encoding.TextUnmarshaler接口，从十六进制字符串解析Address。
+func (a *Address) UnmarshalText(text []byte) error {
+	addr, err := AddressFromHex(string(text))
+	if err != nil {
+		return err
+	}
+
+	*a = addr
+	return nil
+}
+
+// 地址的Bech32编码默认使用的人类可读前缀，不同的网络可以使用不同的前缀。
+const DefaultAddressPrefix = "lb"
+
+var (
+	ErrAddressChecksum = errors.New("地址校验和错误，地址可能输入有误")
+	ErrAddressPrefix   = errors.New("地址的前缀与网络不符")
+)
+
+// 使用指定的人类可读前缀将地址编码为带校验和的Bech32字符串，例如"lb1..."。前缀无效时返回错误。
+func (a Address) Bech32(prefix string) (string, error) {
+	s, err := Bech32Encode(prefix, a[:])
+	if err != nil {
+		return "", fmt.Errorf("无效的地址前缀(%s)：%w", prefix, err)
+	}
+	return s, nil
+}
+
+// 解析带校验和的Bech32地址，并检查其前缀是否为prefix。
+// 输错字符导致校验和不匹配时返回的错误包装了ErrAddressChecksum，前缀不符时包装了ErrAddressPrefix。
+func ParseAddress(s, prefix string) (Address, error) {
+	hrp, data, err := Bech32Decode(s)
+	if errors.Is(err, ErrBech32Checksum) {
+		return Address{}, fmt.Errorf("%w(%s)", ErrAddressChecksum, s)
+	}
+	if err != nil {
+		return Address{}, fmt.Errorf("无效的地址(%s)：%w", s, err)
+	}
+	if hrp != strings.ToLower(prefix) {
+		return Address{}, fmt.Errorf("%w：应为%s，而不是%s", ErrAddressPrefix, strings.ToLower(prefix), hrp)
+	}
+	if len(data) != 20 {
+		return Address{}, fmt.Errorf("地址的长度应该为20字节，而不是%d字节", len(data))
+	}
+
+	return AddressFromBytes(data), nil
+}
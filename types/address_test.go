@@ -0,0 +1,91 @@
+package types
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// 测试BIP-173中的Bech32测试向量。
+func TestBech32Vectors(t *testing.T) {
+	valid := []string{
+		"A12UEL5L",
+		"a12uel5l",
+		"an83characterlonghumanreadablepartthatcontainsthenumber1andtheexcludedcharactersbio1tt5tgs",
+		"abcdef1qpzry9x8gf2tvdw0s3jn54khce6mua7lmqqqxw",
+		"11qqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqc8247j",
+		"split1checkupstagehandshakeupstreamerranterredcaperred2y9e3w",
+		"?1ezyfcl",
+	}
+	for _, s := range valid {
+		hrp, _, err := Bech32Decode(s)
+		assert.Nil(t, err, s)
+		assert.Equal(t, strings.ToLower(s[:strings.LastIndexByte(s, '1')]), hrp)
+	}
+
+	invalid := []string{
+		"\x201nwldj5", // 前缀包含无效字符
+		"\x7f1axkwrx", // 前缀包含无效字符
+		"an84characterslonghumanreadablepartthatcontainsthenumber1andtheexcludedcharactersbio1569pvx", // 超过最大长度
+		"pzry9x0s0muk",  // 没有分隔符
+		"1pzry9x0s0muk", // 前缀为空
+		"x1b4n0q5v",     // 数据部分包含无效字符
+		"li1dgmt3",      // 校验和太短
+		"A1G7SGD8",      // 校验和使用了大写字符计算
+		"10a06t8",       // 前缀为空
+		"1qzzfhee",      // 前缀为空
+		"abcdef1qpzry9x8gf2tvdw0s3jn54khce6mua7lmqqqxW", // 混用大小写
+	}
+	for _, s := range invalid {
+		_, _, err := Bech32Decode(s)
+		assert.NotNil(t, err, s)
+	}
+}
+
+// 测试地址的Bech32编码和解析，以及输错字符和前缀不符时的错误。
+func TestParseAddress(t *testing.T) {
+	addr := AddressFromBytes(RandomBytes(20))
+	s, err := addr.Bech32(DefaultAddressPrefix)
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(s, DefaultAddressPrefix+"1"))
+
+	parsed, err := ParseAddress(s, DefaultAddressPrefix)
+	assert.Nil(t, err)
+	assert.Equal(t, addr, parsed)
+
+	parsed, err = ParseAddress(strings.ToUpper(s), DefaultAddressPrefix)
+	assert.Nil(t, err)
+	assert.Equal(t, addr, parsed)
+
+	// 修改任意一个字符都会被校验和发现
+	for i := len(DefaultAddressPrefix) + 1; i < len(s); i++ {
+		c := byte('q')
+		if s[i] == 'q' {
+			c = 'p'
+		}
+		typo := s[:i] + string(c) + s[i+1:]
+		_, err := ParseAddress(typo, DefaultAddressPrefix)
+		assert.True(t, errors.Is(err, ErrAddressChecksum), typo)
+	}
+
+	other, err := addr.Bech32("test")
+	assert.Nil(t, err)
+	_, err = ParseAddress(other, DefaultAddressPrefix)
+	assert.True(t, errors.Is(err, ErrAddressPrefix))
+
+	// 无效的前缀返回错误而不是panic
+	for _, prefix := range []string{"", "l b", "l1\x7f", strings.Repeat("a", 60)} {
+		_, err = addr.Bech32(prefix)
+		assert.NotNil(t, err, prefix)
+	}
+
+	short, err := Bech32Encode(DefaultAddressPrefix, []byte{1, 2, 3})
+	assert.Nil(t, err)
+	_, err = ParseAddress(short, DefaultAddressPrefix)
+	assert.NotNil(t, err)
+
+	_, err = ParseAddress("lb1"+s[3:len(s)-1]+"b", DefaultAddressPrefix) // b不在字符集中
+	assert.NotNil(t, err)
+}
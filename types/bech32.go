@@ -0,0 +1,176 @@
+package types
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// BIP-173定义的Bech32字符集，去掉了容易混淆的1、b、i、o。
+const bech32Charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+// Bech32字符串的最大长度。
+const bech32MaxLength = 90
+
+var (
+	ErrBech32Checksum  = errors.New("Bech32校验和错误")
+	ErrBech32MixedCase = errors.New("Bech32字符串不能混用大小写")
+)
+
+// 字符到5位数值的映射，-1表示不在字符集中。
+var bech32CharsetRev = func() [128]int8 {
+	var rev [128]int8
+	for i := range rev {
+		rev[i] = -1
+	}
+	for i, c := range bech32Charset {
+		rev[c] = int8(i)
+	}
+	return rev
+}()
+
+// 计算BCH校验多项式。
+func bech32Polymod(values []byte) uint32 {
+	gen := [5]uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+	chk := uint32(1)
+	for _, v := range values {
+		top := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ uint32(v)
+		for i := 0; i < 5; i++ {
+			if (top>>i)&1 == 1 {
+				chk ^= gen[i]
+			}
+		}
+	}
+	return chk
+}
+
+// 将人类可读前缀展开为参与校验和计算的数值。
+func bech32HRPExpand(hrp string) []byte {
+	values := make([]byte, 0, len(hrp)*2+1)
+	for i := 0; i < len(hrp); i++ {
+		values = append(values, hrp[i]>>5)
+	}
+	values = append(values, 0)
+	for i := 0; i < len(hrp); i++ {
+		values = append(values, hrp[i]&31)
+	}
+	return values
+}
+
+// 计算6个字符的校验和。
+func bech32Checksum(hrp string, data []byte) []byte {
+	values := append(bech32HRPExpand(hrp), data...)
+	values = append(values, 0, 0, 0, 0, 0, 0)
+	mod := bech32Polymod(values) ^ 1
+
+	checksum := make([]byte, 6)
+	for i := range checksum {
+		checksum[i] = byte(mod>>(5*(5-i))) & 31
+	}
+	return checksum
+}
+
+// 检查人类可读前缀：长度为1到83，只包含ASCII可见字符。
+func checkBech32HRP(hrp string) error {
+	if len(hrp) < 1 || len(hrp) > 83 {
+		return fmt.Errorf("Bech32前缀的长度应该在1到83之间，而不是%d", len(hrp))
+	}
+	for i := 0; i < len(hrp); i++ {
+		if hrp[i] < 33 || hrp[i] > 126 {
+			return fmt.Errorf("Bech32前缀的第%d个字符无效", i+1)
+		}
+	}
+	return nil
+}
+
+// 将data按8位分组转换为5位分组后编码为Bech32字符串，前缀统一转换为小写。
+func Bech32Encode(hrp string, data []byte) (string, error) {
+	hrp = strings.ToLower(hrp)
+	if err := checkBech32HRP(hrp); err != nil {
+		return "", err
+	}
+
+	values, err := convertBits(data, 8, 5, true)
+	if err != nil {
+		return "", err
+	}
+	if len(hrp)+1+len(values)+6 > bech32MaxLength {
+		return "", fmt.Errorf("Bech32字符串的长度超过了%d", bech32MaxLength)
+	}
+
+	var sb strings.Builder
+	sb.WriteString(hrp)
+	sb.WriteByte('1')
+	for _, v := range append(values, bech32Checksum(hrp, values)...) {
+		sb.WriteByte(bech32Charset[v])
+	}
+	return sb.String(), nil
+}
+
+// 解码Bech32字符串，返回小写的前缀和按8位分组的数据。
+// 字符串可以全部大写或全部小写，校验和错误时返回ErrBech32Checksum。
+func Bech32Decode(s string) (string, []byte, error) {
+	if len(s) > bech32MaxLength {
+		return "", nil, fmt.Errorf("Bech32字符串的长度超过了%d", bech32MaxLength)
+	}
+	lower := strings.ToLower(s)
+	if lower != s && strings.ToUpper(s) != s {
+		return "", nil, ErrBech32MixedCase
+	}
+	s = lower
+
+	sep := strings.LastIndexByte(s, '1')
+	if sep < 1 || sep+7 > len(s) {
+		return "", nil, fmt.Errorf("Bech32字符串缺少前缀、分隔符或校验和")
+	}
+	hrp := s[:sep]
+	if err := checkBech32HRP(hrp); err != nil {
+		return "", nil, err
+	}
+
+	values := make([]byte, 0, len(s)-sep-1)
+	for i := sep + 1; i < len(s); i++ {
+		c := s[i]
+		if c >= 128 || bech32CharsetRev[c] < 0 {
+			return "", nil, fmt.Errorf("Bech32字符串的第%d个字符(%c)无效", i+1, c)
+		}
+		values = append(values, byte(bech32CharsetRev[c]))
+	}
+	if bech32Polymod(append(bech32HRPExpand(hrp), values...)) != 1 {
+		return "", nil, ErrBech32Checksum
+	}
+
+	data, err := convertBits(values[:len(values)-6], 5, 8, false)
+	if err != nil {
+		return "", nil, err
+	}
+	return hrp, data, nil
+}
+
+// 在不同位宽的分组之间转换，pad表示是否补齐最后不足一组的位。
+func convertBits(data []byte, from, to uint, pad bool) ([]byte, error) {
+	var acc, bits uint
+	maxv := uint(1)<<to - 1
+	out := make([]byte, 0, len(data)*int(from)/int(to)+1)
+	for _, v := range data {
+		if uint(v)>>from != 0 {
+			return nil, fmt.Errorf("数值(%d)超过了%d位", v, from)
+		}
+		acc = acc<<from | uint(v)
+		bits += from
+		for bits >= to {
+			bits -= to
+			out = append(out, byte(acc>>bits&maxv))
+		}
+	}
+
+	if pad {
+		if bits > 0 {
+			out = append(out, byte(acc<<(to-bits)&maxv))
+		}
+	} else if bits >= from || acc<<(to-bits)&maxv != 0 {
+		return nil, fmt.Errorf("Bech32数据的填充位无效")
+	}
+	return out, nil
+}
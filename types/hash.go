@@ -68,3 +68,32 @@ func RandomBytes(size int) []byte {
 func RandomHash() Hash {
 	return HashFromBytes(RandomBytes(32)) // 返回生成的随机Hash
 }
+
+// 从十六进制字符串解析Hash，字符串可以带有0x前缀。
+func HashFromHex(s string) (Hash, error) {
+	b, err := DecodeHex(s)
+	if err != nil {
+		return Hash{}, err
+	}
+	if len(b) != 32 {
+		return Hash{}, fmt.Errorf("哈希的长度应该为32字节，而不是%d字节", len(b))
+	}
+
+	return HashFromBytes(b), nil
+}
+
+// 实现encoding.TextMarshaler接口，编码为0x开头的十六进制字符串。
+func (h Hash) MarshalText() ([]byte, error) {
+	return []byte(EncodeHex(h[:])), nil
+}
+
+// 实现encoding.TextUnmarshaler接口，从十六进制字符串解析Hash。
+func (h *Hash) UnmarshalText(text []byte) error {
+	hash, err := HashFromHex(string(text))
+	if err != nil {
+		return err
+	}
+
+	*h = hash
+	return nil
+}
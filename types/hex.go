@@ -0,0 +1,45 @@
+package types
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// 将字节切片编码为0x开头的十六进制字符串。
+func EncodeHex(b []byte) string {
+	return "0x" + hex.EncodeToString(b)
+}
+
+// 解析十六进制字符串，字符串可以带有0x或0X前缀。
+func DecodeHex(s string) ([]byte, error) {
+	if strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X") {
+		s = s[2:]
+	}
+
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("无效的十六进制字符串(%s)：%s", s, err)
+	}
+
+	return b, nil
+}
+
+// 以0x开头的十六进制字符串进行文本编码的字节切片，用于JSON中的任意数据。
+type HexBytes []byte
+
+// 实现encoding.TextMarshaler接口。
+func (b HexBytes) MarshalText() ([]byte, error) {
+	return []byte(EncodeHex(b)), nil
+}
+
+// 实现encoding.TextUnmarshaler接口。
+func (b *HexBytes) UnmarshalText(text []byte) error {
+	decoded, err := DecodeHex(string(text))
+	if err != nil {
+		return err
+	}
+
+	*b = decoded
+	return nil
+}
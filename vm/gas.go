@@ -0,0 +1,68 @@
+package vm
+
+// 操作码的基础燃料消耗。
+const (
+	GasQuick     uint64 = 2   // 栈操作以及读取上下文
+	GasFast      uint64 = 3   // 算术、比较和位运算
+	GasJump      uint64 = 8   // 跳转
+	GasHash      uint64 = 30  // 哈希的基础消耗
+	GasHashWord  uint64 = 6   // 哈希每32字节的额外消耗
+	GasCopyWord  uint64 = 3   // 拼接结果每32字节的额外消耗，防止栈元素无限增长
+	GasSload     uint64 = 50  // 读取存储
+	GasSstore    uint64 = 200 // 写入存储的基础消耗
+	GasStoreByte uint64 = 10  // 写入存储时键和值每字节的额外消耗，防止状态膨胀
+	GasCall      uint64 = 100 // 调用其他合约的基础消耗，被调用者使用的燃料另外扣除
+	GasCodeByte  uint64 = 20  // 部署合约时代码每字节的消耗
+	GasLog       uint64 = 50  // 记录日志的基础消耗
+	GasLogByte   uint64 = 8   // 日志的主题和数据每字节的额外消耗
+
+	GasTx         uint64 = 1000 // 每笔交易的固有消耗，与交易类型和是否执行字节码无关
+	GasTxDataByte uint64 = 16   // 交易数据每字节的固有消耗
+)
+
+// 每个操作码执行前扣除的固定燃料，与数据长度相关的部分在执行时另外扣除。
+var gasTable = map[Opcode]uint64{
+	STOP:     0,
+	PUSH:     GasFast,
+	POP:      GasQuick,
+	DUP:      GasFast,
+	SWAP:     GasFast,
+	ADD:      GasFast,
+	SUB:      GasFast,
+	MUL:      GasFast + 2,
+	DIV:      GasFast + 2,
+	MOD:      GasFast + 2,
+	LT:       GasFast,
+	GT:       GasFast,
+	EQ:       GasFast,
+	ISZERO:   GasFast,
+	AND:      GasFast,
+	OR:       GasFast,
+	NOT:      GasFast,
+	SHA256:   GasHash,
+	CONCAT:   GasFast,
+	SLOAD:    GasSload,
+	SSTORE:   GasSstore,
+	JUMP:     GasJump,
+	JUMPI:    GasJump + 2,
+	JUMPDEST: 1,
+	CALLER:   GasQuick,
+	ADDRESS:  GasQuick,
+	VALUE:    GasQuick,
+	INPUT:    GasQuick,
+	RETURN:   0,
+	REVERT:   0,
+	CALL:     GasCall,
+	LOG:      GasLog,
+}
+
+// 返回操作码的固定燃料消耗，未知操作码返回false。
+func GasCost(op Opcode) (uint64, bool) {
+	gas, ok := gasTable[op]
+	return gas, ok
+}
+
+// 返回n字节数据包含的32字节字数，向上取整。
+func words(n int) uint64 {
+	return (uint64(n) + 31) / 32
+}
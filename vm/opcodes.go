@@ -0,0 +1,90 @@
+package vm
+
+// 定义了虚拟机的操作码。
+type Opcode byte
+
+const (
+	STOP Opcode = 0x00 // 停止执行
+	PUSH Opcode = 0x01 // 压入数据：后跟1字节长度和相应长度的数据
+	POP  Opcode = 0x02 // 弹出栈顶
+	DUP  Opcode = 0x03 // 复制栈顶
+	SWAP Opcode = 0x04 // 交换栈顶的两个元素
+
+	ADD    Opcode = 0x10 // a + b
+	SUB    Opcode = 0x11 // a - b
+	MUL    Opcode = 0x12 // a * b
+	DIV    Opcode = 0x13 // a / b，除数为0时结果为0
+	MOD    Opcode = 0x14 // a % b，除数为0时结果为0
+	LT     Opcode = 0x15 // a < b 时为1，否则为0
+	GT     Opcode = 0x16 // a > b 时为1，否则为0
+	EQ     Opcode = 0x17 // a == b 时为1，否则为0
+	ISZERO Opcode = 0x18 // a == 0 时为1，否则为0
+	AND    Opcode = 0x19 // 按位与
+	OR     Opcode = 0x1a // 按位或
+	NOT    Opcode = 0x1b // 按位取反
+
+	SHA256 Opcode = 0x20 // 计算栈顶数据的SHA-256哈希
+	CONCAT Opcode = 0x21 // 拼接栈顶的两个元素：a || b
+
+	SLOAD  Opcode = 0x30 // 从当前合约的存储中读取键对应的值
+	SSTORE Opcode = 0x31 // 将值写入当前合约存储的键中
+
+	JUMP     Opcode = 0x40 // 无条件跳转，目标必须是JUMPDEST
+	JUMPI    Opcode = 0x41 // 栈顶为条件、其下为目标，条件不为0时跳转
+	JUMPDEST Opcode = 0x42 // 跳转目标标记
+
+	CALLER  Opcode = 0x50 // 压入调用者地址
+	ADDRESS Opcode = 0x51 // 压入当前合约地址
+	VALUE   Opcode = 0x52 // 压入调用附带的金额
+	INPUT   Opcode = 0x53 // 压入调用的输入数据
+
+	RETURN Opcode = 0x60 // 弹出栈顶作为返回数据并停止执行
+	REVERT Opcode = 0x61 // 弹出栈顶作为返回数据并回滚本次调用的所有修改
+	CALL   Opcode = 0x62 // 调用其他合约：依次弹出输入数据、金额和地址，压入返回数据和是否成功
+	LOG    Opcode = 0x63 // 记录事件日志：依次弹出数据和主题
+)
+
+// 操作码的名称，用于错误信息和调试。
+var opcodeNames = map[Opcode]string{
+	STOP:     "STOP",
+	PUSH:     "PUSH",
+	POP:      "POP",
+	DUP:      "DUP",
+	SWAP:     "SWAP",
+	ADD:      "ADD",
+	SUB:      "SUB",
+	MUL:      "MUL",
+	DIV:      "DIV",
+	MOD:      "MOD",
+	LT:       "LT",
+	GT:       "GT",
+	EQ:       "EQ",
+	ISZERO:   "ISZERO",
+	AND:      "AND",
+	OR:       "OR",
+	NOT:      "NOT",
+	SHA256:   "SHA256",
+	CONCAT:   "CONCAT",
+	SLOAD:    "SLOAD",
+	SSTORE:   "SSTORE",
+	JUMP:     "JUMP",
+	JUMPI:    "JUMPI",
+	JUMPDEST: "JUMPDEST",
+	CALLER:   "CALLER",
+	ADDRESS:  "ADDRESS",
+	VALUE:    "VALUE",
+	INPUT:    "INPUT",
+	RETURN:   "RETURN",
+	REVERT:   "REVERT",
+	CALL:     "CALL",
+	LOG:      "LOG",
+}
+
+// 返回操作码的名称。
+func (op Opcode) String() string {
+	if name, ok := opcodeNames[op]; ok {
+		return name
+	}
+
+	return "INVALID"
+}
@@ -0,0 +1,52 @@
+package vm
+
+// 栈的最大深度。
+const maxStackDepth = 1024
+
+// 虚拟机的操作数栈，每个元素都是一个字节切片。
+type Stack struct {
+	data [][]byte
+}
+
+// 创建一个空栈。
+func NewStack() *Stack {
+	return &Stack{
+		data: [][]byte{},
+	}
+}
+
+// 将一个元素压入栈顶。
+func (s *Stack) Push(b []byte) error {
+	if len(s.data) >= maxStackDepth {
+		return ErrStackOverflow
+	}
+
+	s.data = append(s.data, b)
+	return nil
+}
+
+// 弹出栈顶元素。
+func (s *Stack) Pop() ([]byte, error) {
+	if len(s.data) == 0 {
+		return nil, ErrStackUnderflow
+	}
+
+	b := s.data[len(s.data)-1]
+	s.data = s.data[:len(s.data)-1]
+
+	return b, nil
+}
+
+// 返回栈顶元素但不弹出。
+func (s *Stack) Peek() ([]byte, error) {
+	if len(s.data) == 0 {
+		return nil, ErrStackUnderflow
+	}
+
+	return s.data[len(s.data)-1], nil
+}
+
+// 返回栈中元素的数量。
+func (s *Stack) Len() int {
+	return len(s.data)
+}
@@ -0,0 +1,528 @@
+package vm
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/Luboy23/Blockchain_Project/types"
+)
+
+// 交易数据以Magic开头时，其余部分被视为字节码并在区块执行时运行。
+var Magic = []byte{0xbc, 0x01}
+
+var (
+	ErrStackUnderflow  = errors.New("栈下溢")
+	ErrStackOverflow   = errors.New("栈溢出")
+	ErrInvalidOpcode   = errors.New("无效的操作码")
+	ErrInvalidJump     = errors.New("无效的跳转目标")
+	ErrCodeTruncated   = errors.New("字节码被截断")
+	ErrOutOfGas        = errors.New("燃料不足")
+	ErrReverted        = errors.New("执行被回滚")
+	ErrOperandTooLarge = errors.New("数值运算的操作数超过32字节")
+)
+
+// 合约调用的最大嵌套深度，超过该深度的调用直接失败。
+const MaxCallDepth = 64
+
+// 数值运算以256位无符号整数进行，结果对2^256取模。
+var wordModulus = new(big.Int).Lsh(big.NewInt(1), 256)
+
+// 数值运算的操作数最多占用的字节数。栈元素可以通过CONCAT变得很长，
+// 数值运算只收取固定的燃料，因此超过该长度的操作数直接使执行失败。
+const wordSize = 32
+
+// 定义了合约的键值存储，每个合约拥有独立的命名空间。
+type Storage interface {
+	Get(key []byte) []byte
+	Set(key, value []byte)
+}
+
+// 合约执行时记录的事件日志。
+type Log struct {
+	Address types.Address // 记录日志的合约地址
+	Topic   []byte        // 日志主题，用于过滤
+	Data    []byte        // 日志数据
+}
+
+// 定义了虚拟机调用其他合约的接口，由链的状态实现。
+// 被调用的合约在独立的子状态中执行，只有执行成功时修改才会并入调用者的状态。
+type Host interface {
+	// 以caller的身份调用to处的合约，返回返回数据、消耗的燃料以及调用成功时记录的日志。
+	Call(caller, to types.Address, value uint64, input []byte, gas uint64, depth int) ([]byte, uint64, []*Log, error)
+}
+
+// 定义了字节码执行时的上下文。
+type Context struct {
+	Caller  types.Address // 调用者地址，即交易的发送者或调用当前合约的合约
+	Address types.Address // 当前合约的地址，决定存储的命名空间
+	Value   uint64        // 调用附带的金额
+	Input   []byte        // 调用的输入数据
+	Depth   int           // 调用深度，由交易直接发起的调用为0
+}
+
+// 一个基于栈的确定性虚拟机。
+type VM struct {
+	code      []byte  // 要执行的字节码
+	jumpdests []byte  // 有效JUMPDEST位置的位图，第i位为1表示位置i可以作为跳转目标
+	pc        int     // 程序计数器
+	stack     *Stack  // 操作数栈
+	storage   Storage // 当前合约的存储
+	ctx       Context // 执行上下文
+	gas       uint64  // 剩余的燃料
+	limit     uint64  // 燃料上限
+	host      Host    // 用于调用其他合约，为nil时CALL总是失败
+	ret       []byte  // RETURN或REVERT设置的返回数据
+	logs      []*Log  // 按顺序记录的日志，包括成功的内部调用记录的日志
+	stopped   bool    // 是否已经执行了RETURN
+}
+
+// 创建一个新的虚拟机实例，执行最多消耗gas个燃料。
+func New(code []byte, storage Storage, ctx Context, gas uint64) *VM {
+	return &VM{
+		code:      code,
+		jumpdests: analyseJumpDests(code),
+		stack:     NewStack(),
+		storage:   storage,
+		ctx:       ctx,
+		gas:       gas,
+		limit:     gas,
+	}
+}
+
+// 检查交易数据是否为字节码。
+func IsBytecode(data []byte) bool {
+	return bytes.HasPrefix(data, Magic)
+}
+
+// 从交易数据中取出字节码。
+func CodeFromData(data []byte) []byte {
+	return data[len(Magic):]
+}
+
+// 将多段字节码拼接为可以放入交易数据的程序。
+func NewProgram(code ...[]byte) []byte {
+	program := append([]byte{}, Magic...)
+	for _, c := range code {
+		program = append(program, c...)
+	}
+
+	return program
+}
+
+// 生成压入指定数据的PUSH指令。
+func Push(data []byte) []byte {
+	if len(data) > 255 {
+		panic(fmt.Sprintf("PUSH的数据长度不能超过255，而不是 %d", len(data)))
+	}
+
+	return append([]byte{byte(PUSH), byte(len(data))}, data...)
+}
+
+// 返回字节码对应的地址，以原始字节码形式执行的程序使用该地址作为存储命名空间。
+func CodeAddress(code []byte) types.Address {
+	h := sha256.Sum256(code)
+	return types.AddressFromBytes(h[len(h)-20:])
+}
+
+// 设置用于调用其他合约的Host。
+func (vm *VM) SetHost(host Host) {
+	vm.host = host
+}
+
+// 返回RETURN或REVERT设置的返回数据。
+func (vm *VM) ReturnData() []byte {
+	return vm.ret
+}
+
+// 返回执行过程中按顺序记录的日志。执行失败时调用者应丢弃这些日志。
+func (vm *VM) Logs() []*Log {
+	return vm.logs
+}
+
+// 返回虚拟机的操作数栈。
+func (vm *VM) Stack() *Stack {
+	return vm.stack
+}
+
+// 返回已经消耗的燃料。
+func (vm *VM) GasUsed() uint64 {
+	return vm.limit - vm.gas
+}
+
+// 从头开始执行字节码，直到遇到STOP、执行到末尾或者出错。
+// 燃料不足时剩余燃料全部被消耗。
+func (vm *VM) Run() error {
+	for vm.pc < len(vm.code) && !vm.stopped {
+		op := Opcode(vm.code[vm.pc])
+		vm.pc++
+
+		if op == STOP {
+			return nil
+		}
+
+		err := vm.step(op)
+		if errors.Is(err, ErrOutOfGas) {
+			vm.gas = 0
+		}
+		if errors.Is(err, ErrReverted) {
+			return ErrReverted
+		}
+		if err != nil {
+			return fmt.Errorf("执行%s(位置%d)失败：%w", op, vm.pc-1, err)
+		}
+	}
+
+	return nil
+}
+
+// 扣除操作码的固定燃料后执行。
+func (vm *VM) step(op Opcode) error {
+	cost, ok := GasCost(op)
+	if !ok {
+		return fmt.Errorf("%w 0x%02x", ErrInvalidOpcode, byte(op))
+	}
+
+	if err := vm.useGas(cost); err != nil {
+		return err
+	}
+
+	return vm.exec(op)
+}
+
+// 扣除燃料，剩余燃料不足时返回ErrOutOfGas。
+func (vm *VM) useGas(gas uint64) error {
+	if vm.gas < gas {
+		return ErrOutOfGas
+	}
+
+	vm.gas -= gas
+	return nil
+}
+
+// 执行单个操作码。
+func (vm *VM) exec(op Opcode) error {
+	switch op {
+	case PUSH:
+		return vm.execPush()
+	case POP:
+		_, err := vm.stack.Pop()
+		return err
+	case DUP:
+		top, err := vm.stack.Peek()
+		if err != nil {
+			return err
+		}
+		return vm.stack.Push(top)
+	case SWAP:
+		a, b, err := vm.pop2()
+		if err != nil {
+			return err
+		}
+		if err := vm.stack.Push(b); err != nil {
+			return err
+		}
+		return vm.stack.Push(a)
+	case ADD, SUB, MUL, DIV, MOD, LT, GT, EQ, AND, OR:
+		return vm.execBinary(op)
+	case ISZERO:
+		a, err := vm.popInt()
+		if err != nil {
+			return err
+		}
+		return vm.stack.Push(boolWord(a.Sign() == 0))
+	case NOT:
+		a, err := vm.popInt()
+		if err != nil {
+			return err
+		}
+		mask := new(big.Int).Sub(wordModulus, big.NewInt(1))
+		return vm.stack.Push(toWord(new(big.Int).Xor(a, mask)))
+	case SHA256:
+		a, err := vm.stack.Pop()
+		if err != nil {
+			return err
+		}
+		if err := vm.useGas(GasHashWord * words(len(a))); err != nil {
+			return err
+		}
+		h := sha256.Sum256(a)
+		return vm.stack.Push(h[:])
+	case CONCAT:
+		a, b, err := vm.pop2()
+		if err != nil {
+			return err
+		}
+		if err := vm.useGas(GasCopyWord * words(len(a)+len(b))); err != nil {
+			return err
+		}
+		return vm.stack.Push(append(append([]byte{}, a...), b...))
+	case SLOAD:
+		key, err := vm.stack.Pop()
+		if err != nil {
+			return err
+		}
+		return vm.stack.Push(vm.storage.Get(key))
+	case SSTORE:
+		key, value, err := vm.pop2()
+		if err != nil {
+			return err
+		}
+		if err := vm.useGas(GasStoreByte * uint64(len(key)+len(value))); err != nil {
+			return err
+		}
+		vm.storage.Set(key, value)
+		return nil
+	case JUMP:
+		dest, err := vm.stack.Pop()
+		if err != nil {
+			return err
+		}
+		return vm.jump(dest)
+	case JUMPI:
+		dest, c, err := vm.pop2()
+		if err != nil {
+			return err
+		}
+		cond, err := toInt(c)
+		if err != nil {
+			return err
+		}
+		if cond.Sign() == 0 {
+			return nil
+		}
+		return vm.jump(dest)
+	case JUMPDEST:
+		return nil
+	case CALLER:
+		return vm.stack.Push(vm.ctx.Caller.ToSlice())
+	case ADDRESS:
+		return vm.stack.Push(vm.ctx.Address.ToSlice())
+	case VALUE:
+		return vm.stack.Push(toWord(new(big.Int).SetUint64(vm.ctx.Value)))
+	case INPUT:
+		if err := vm.useGas(GasCopyWord * words(len(vm.ctx.Input))); err != nil {
+			return err
+		}
+		return vm.stack.Push(append([]byte{}, vm.ctx.Input...))
+	case RETURN, REVERT:
+		ret, err := vm.stack.Pop()
+		if err != nil {
+			return err
+		}
+		vm.ret = ret
+		if op == REVERT {
+			return ErrReverted
+		}
+		vm.stopped = true
+		return nil
+	case CALL:
+		return vm.execCall()
+	case LOG:
+		topic, data, err := vm.pop2()
+		if err != nil {
+			return err
+		}
+		if err := vm.useGas(GasLogByte * uint64(len(topic)+len(data))); err != nil {
+			return err
+		}
+		vm.logs = append(vm.logs, &Log{Address: vm.ctx.Address, Topic: topic, Data: data})
+		return nil
+	default:
+		return fmt.Errorf("%w 0x%02x", ErrInvalidOpcode, byte(op))
+	}
+}
+
+// 执行PUSH：读取1字节长度以及后续的数据并压入栈。
+func (vm *VM) execPush() error {
+	if vm.pc >= len(vm.code) {
+		return ErrCodeTruncated
+	}
+
+	n := int(vm.code[vm.pc])
+	if vm.pc+1+n > len(vm.code) {
+		return ErrCodeTruncated
+	}
+
+	data := make([]byte, n)
+	copy(data, vm.code[vm.pc+1:vm.pc+1+n])
+	vm.pc += 1 + n
+
+	return vm.stack.Push(data)
+}
+
+// 执行CALL：依次弹出输入数据、金额和地址，把剩余燃料的63/64转交给被调用者。
+// 调用结束后压入返回数据，再压入1（成功）或0（失败）。被调用者失败不会使调用者失败。
+func (vm *VM) execCall() error {
+	input, err := vm.stack.Pop()
+	if err != nil {
+		return err
+	}
+	to, value, err := vm.pop2()
+	if err != nil {
+		return err
+	}
+
+	amount, err := toInt(value)
+	if err != nil {
+		return err
+	}
+	if vm.host == nil || len(to) != len(types.Address{}) || !amount.IsUint64() || vm.ctx.Depth+1 > MaxCallDepth {
+		return vm.pushCallResult(nil, false)
+	}
+
+	gas := vm.gas - vm.gas/64
+	ret, gasUsed, logs, err := vm.host.Call(vm.ctx.Address, types.AddressFromBytes(to), amount.Uint64(), input, gas, vm.ctx.Depth+1)
+	if gasUsed > gas {
+		gasUsed = gas
+	}
+	vm.gas -= gasUsed
+	if err == nil {
+		vm.logs = append(vm.logs, logs...)
+	}
+
+	return vm.pushCallResult(ret, err == nil)
+}
+
+// 压入调用的返回数据和是否成功。
+func (vm *VM) pushCallResult(ret []byte, ok bool) error {
+	if ret == nil {
+		ret = []byte{}
+	}
+	if err := vm.stack.Push(ret); err != nil {
+		return err
+	}
+
+	return vm.stack.Push(boolWord(ok))
+}
+
+// 执行二元运算，先压入的元素为左操作数a，栈顶元素为右操作数b。
+func (vm *VM) execBinary(op Opcode) error {
+	x, y, err := vm.pop2()
+	if err != nil {
+		return err
+	}
+
+	a, err := toInt(x)
+	if err != nil {
+		return err
+	}
+	b, err := toInt(y)
+	if err != nil {
+		return err
+	}
+	result := new(big.Int)
+
+	switch op {
+	case ADD:
+		result.Add(a, b)
+	case SUB:
+		result.Sub(a, b)
+	case MUL:
+		result.Mul(a, b)
+	case DIV:
+		if b.Sign() != 0 {
+			result.Div(a, b)
+		}
+	case MOD:
+		if b.Sign() != 0 {
+			result.Mod(a, b)
+		}
+	case LT:
+		return vm.stack.Push(boolWord(a.Cmp(b) < 0))
+	case GT:
+		return vm.stack.Push(boolWord(a.Cmp(b) > 0))
+	case EQ:
+		return vm.stack.Push(boolWord(a.Cmp(b) == 0))
+	case AND:
+		result.And(a, b)
+	case OR:
+		result.Or(a, b)
+	}
+
+	return vm.stack.Push(toWord(result))
+}
+
+// 弹出两个元素，返回时a为先压入的元素，b为栈顶元素。
+func (vm *VM) pop2() ([]byte, []byte, error) {
+	b, err := vm.stack.Pop()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	a, err := vm.stack.Pop()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return a, b, nil
+}
+
+// 弹出栈顶元素并解释为256位无符号整数。
+func (vm *VM) popInt() (*big.Int, error) {
+	a, err := vm.stack.Pop()
+	if err != nil {
+		return nil, err
+	}
+	return toInt(a)
+}
+
+// 跳转到指定位置，目标必须是JUMPDEST且不能位于PUSH的数据中。
+func (vm *VM) jump(dest []byte) error {
+	d, err := toInt(dest)
+	if err != nil {
+		return err
+	}
+	if !d.IsInt64() || d.Int64() >= int64(len(vm.code)) || !vm.isJumpDest(int(d.Int64())) {
+		return fmt.Errorf("%w：%s", ErrInvalidJump, d)
+	}
+
+	vm.pc = int(d.Int64())
+	return nil
+}
+
+// 检查指定位置是否为有效的JUMPDEST。
+func (vm *VM) isJumpDest(dest int) bool {
+	return vm.jumpdests[dest/8]&(1<<(dest%8)) != 0
+}
+
+// 扫描一遍字节码，返回有效JUMPDEST位置的位图，PUSH的数据中的字节不是有效的跳转目标。
+func analyseJumpDests(code []byte) []byte {
+	bitmap := make([]byte, (len(code)+7)/8)
+	for pc := 0; pc < len(code); pc++ {
+		switch Opcode(code[pc]) {
+		case JUMPDEST:
+			bitmap[pc/8] |= 1 << (pc % 8)
+		case PUSH:
+			if pc+1 < len(code) {
+				pc += 1 + int(code[pc+1]) // 跳过PUSH的数据
+			}
+		}
+	}
+
+	return bitmap
+}
+
+// 将字节切片按大端序解释为256位无符号整数，超过32字节时返回ErrOperandTooLarge。
+func toInt(b []byte) (*big.Int, error) {
+	if len(b) > wordSize {
+		return nil, fmt.Errorf("%w：%d字节", ErrOperandTooLarge, len(b))
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+// 将整数对2^256取模后编码为32字节的大端序字节切片。
+func toWord(i *big.Int) []byte {
+	i = new(big.Int).Mod(i, wordModulus)
+	return i.FillBytes(make([]byte, 32))
+}
+
+// 将布尔值编码为32字节的0或1。
+func boolWord(b bool) []byte {
+	if b {
+		return toWord(big.NewInt(1))
+	}
+	return toWord(big.NewInt(0))
+}
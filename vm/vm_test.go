@@ -0,0 +1,510 @@
+package vm
+
+import (
+	"crypto/sha256"
+	"math/big"
+	"testing"
+
+	"github.com/Luboy23/Blockchain_Project/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// 用于测试的内存存储。
+type memoryStorage map[string][]byte
+
+func (s memoryStorage) Get(key []byte) []byte {
+	return s[string(key)]
+}
+
+func (s memoryStorage) Set(key, value []byte) {
+	s[string(key)] = value
+}
+
+// 拼接字节码片段。
+func code(parts ...[]byte) []byte {
+	out := []byte{}
+	for _, p := range parts {
+		out = append(out, p...)
+	}
+	return out
+}
+
+// 生成单个操作码。
+func op(o Opcode) []byte {
+	return []byte{byte(o)}
+}
+
+// 生成压入整数的PUSH指令。
+func pushInt(i int64) []byte {
+	return Push(big.NewInt(i).Bytes())
+}
+
+// 将整数编码为32字节的字。
+func word(i int64) []byte {
+	return toWord(big.NewInt(i))
+}
+
+// 测试中使用的燃料上限，足够执行所有的测试程序。
+const testGas = 1_000_000
+
+// 执行字节码并返回虚拟机。
+func run(t *testing.T, c []byte) (*VM, error) {
+	vm := New(c, memoryStorage{}, Context{}, testGas)
+	return vm, vm.Run()
+}
+
+// 执行字节码并返回栈顶元素。
+func runTop(t *testing.T, c []byte) []byte {
+	vm, err := run(t, c)
+	assert.Nil(t, err)
+	top, err := vm.Stack().Peek()
+	assert.Nil(t, err)
+	return top
+}
+
+func TestStackOps(t *testing.T) {
+	vm, err := run(t, code(Push([]byte("a")), Push([]byte("b")), op(SWAP)))
+	assert.Nil(t, err)
+	top, _ := vm.Stack().Pop()
+	assert.Equal(t, []byte("a"), top)
+	top, _ = vm.Stack().Pop()
+	assert.Equal(t, []byte("b"), top)
+
+	vm, err = run(t, code(Push([]byte("a")), op(DUP)))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, vm.Stack().Len())
+
+	vm, err = run(t, code(Push([]byte("a")), Push([]byte("b")), op(POP)))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, vm.Stack().Len())
+	assert.Equal(t, []byte("a"), runTop(t, code(Push([]byte("a")), Push([]byte("b")), op(POP))))
+
+	vm, err = run(t, code(Push([]byte{})))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{}, runTop(t, code(Push([]byte{}))))
+}
+
+func TestStackUnderflow(t *testing.T) {
+	for _, o := range []Opcode{POP, DUP, SWAP, ADD, SUB, MUL, DIV, MOD, LT, GT, EQ, ISZERO, AND, OR, NOT, SHA256, CONCAT, SLOAD, SSTORE, JUMP, JUMPI, RETURN, REVERT, CALL, LOG} {
+		_, err := run(t, op(o))
+		assert.ErrorIs(t, err, ErrStackUnderflow, o.String())
+	}
+
+	// 二元操作只有一个操作数时同样下溢
+	_, err := run(t, code(pushInt(1), op(ADD)))
+	assert.ErrorIs(t, err, ErrStackUnderflow)
+}
+
+func TestStackOverflow(t *testing.T) {
+	c := pushInt(1)
+	for i := 0; i < maxStackDepth; i++ {
+		c = append(c, byte(DUP))
+	}
+
+	_, err := run(t, c)
+	assert.ErrorIs(t, err, ErrStackOverflow)
+}
+
+func TestArithmetic(t *testing.T) {
+	cases := []struct {
+		op   Opcode
+		a, b int64
+		want int64
+	}{
+		{ADD, 2, 3, 5},
+		{SUB, 7, 3, 4},
+		{MUL, 6, 7, 42},
+		{DIV, 42, 5, 8},
+		{DIV, 42, 0, 0},
+		{MOD, 42, 5, 2},
+		{MOD, 42, 0, 0},
+		{LT, 1, 2, 1},
+		{LT, 2, 1, 0},
+		{LT, 2, 2, 0},
+		{GT, 2, 1, 1},
+		{GT, 1, 2, 0},
+		{GT, 2, 2, 0},
+		{EQ, 5, 5, 1},
+		{EQ, 5, 6, 0},
+		{AND, 0b1100, 0b1010, 0b1000},
+		{OR, 0b1100, 0b1010, 0b1110},
+	}
+
+	for _, c := range cases {
+		top := runTop(t, code(pushInt(c.a), pushInt(c.b), op(c.op)))
+		assert.Equal(t, word(c.want), top, "%s(%d, %d)", c.op, c.a, c.b)
+	}
+}
+
+func TestArithmeticWraps(t *testing.T) {
+	// 0 - 1 = 2^256 - 1
+	max := runTop(t, code(pushInt(0), pushInt(1), op(SUB)))
+	assert.Equal(t, new(big.Int).Sub(wordModulus, big.NewInt(1)), new(big.Int).SetBytes(max))
+
+	// (2^256 - 1) + 1 = 0
+	assert.Equal(t, word(0), runTop(t, code(Push(max), pushInt(1), op(ADD))))
+
+	// (2^256 - 1) * 2 = 2^256 - 2
+	assert.Equal(t, new(big.Int).Sub(wordModulus, big.NewInt(2)), new(big.Int).SetBytes(runTop(t, code(Push(max), pushInt(2), op(MUL)))))
+}
+
+func TestUnaryOps(t *testing.T) {
+	assert.Equal(t, word(1), runTop(t, code(pushInt(0), op(ISZERO))))
+	assert.Equal(t, word(1), runTop(t, code(Push([]byte{}), op(ISZERO))))
+	assert.Equal(t, word(0), runTop(t, code(pushInt(9), op(ISZERO))))
+
+	max := runTop(t, code(pushInt(0), op(NOT)))
+	assert.Equal(t, new(big.Int).Sub(wordModulus, big.NewInt(1)), new(big.Int).SetBytes(max))
+	assert.Equal(t, word(0), runTop(t, code(Push(max), op(NOT))))
+}
+
+func TestHashAndConcat(t *testing.T) {
+	h := sha256.Sum256([]byte("hello"))
+	assert.Equal(t, h[:], runTop(t, code(Push([]byte("hello")), op(SHA256))))
+
+	assert.Equal(t, []byte("foobar"), runTop(t, code(Push([]byte("foo")), Push([]byte("bar")), op(CONCAT))))
+}
+
+func TestStorage(t *testing.T) {
+	storage := memoryStorage{}
+	c := code(
+		Push([]byte("key")), Push([]byte("value")), op(SSTORE),
+		Push([]byte("key")), op(SLOAD),
+		Push([]byte("missing")), op(SLOAD),
+	)
+
+	vm := New(c, storage, Context{}, testGas)
+	assert.Nil(t, vm.Run())
+	assert.Equal(t, []byte("value"), storage.Get([]byte("key")))
+
+	missing, _ := vm.Stack().Pop()
+	assert.Empty(t, missing)
+	loaded, _ := vm.Stack().Pop()
+	assert.Equal(t, []byte("value"), loaded)
+}
+
+func TestJumps(t *testing.T) {
+	// 0: PUSH 1 0x06   3: JUMP   4: PUSH 0 (被跳过)  6: JUMPDEST  7: PUSH 1 0x2a
+	c := code(pushInt(6), op(JUMP), Push([]byte{}), op(JUMPDEST), pushInt(42))
+	vm, err := run(t, c)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, vm.Stack().Len())
+	assert.Equal(t, []byte{42}, runTop(t, c))
+
+	// 条件为0时不跳转
+	// 0: PUSH 1 0x0a   3: PUSH 1 0x00   6: JUMPI   7: PUSH 1 0x01   10: JUMPDEST
+	c = code(pushInt(10), Push([]byte{0}), op(JUMPI), pushInt(1), op(JUMPDEST))
+	assert.Equal(t, []byte{1}, runTop(t, c))
+
+	// 条件不为0时跳转
+	c = code(pushInt(10), pushInt(1), op(JUMPI), pushInt(1), op(JUMPDEST))
+	vm, err = run(t, c)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, vm.Stack().Len())
+}
+
+func TestLoop(t *testing.T) {
+	// 计算 5 + 4 + 3 + 2 + 1，计数器保存在存储中
+	//  0: PUSH "i" PUSH 5 SSTORE
+	//  7: PUSH "s" PUSH 0 SSTORE
+	// 14: JUMPDEST
+	// 15: PUSH "s" PUSH "s" SLOAD PUSH "i" SLOAD ADD SSTORE
+	// 28: PUSH "i" PUSH "i" SLOAD PUSH 1 SUB SSTORE
+	// 40: PUSH 14 PUSH "i" SLOAD JUMPI
+	c := code(
+		Push([]byte("i")), pushInt(5), op(SSTORE),
+		Push([]byte("s")), Push([]byte{0}), op(SSTORE),
+		op(JUMPDEST),
+		Push([]byte("s")), Push([]byte("s")), op(SLOAD), Push([]byte("i")), op(SLOAD), op(ADD), op(SSTORE),
+		Push([]byte("i")), Push([]byte("i")), op(SLOAD), pushInt(1), op(SUB), op(SSTORE),
+		pushInt(14), Push([]byte("i")), op(SLOAD), op(JUMPI),
+	)
+
+	storage := memoryStorage{}
+	assert.Nil(t, New(c, storage, Context{}, testGas).Run())
+	assert.Equal(t, word(15), storage.Get([]byte("s")))
+	assert.Equal(t, word(0), storage.Get([]byte("i")))
+}
+
+func TestInvalidJump(t *testing.T) {
+	// 目标不是JUMPDEST
+	_, err := run(t, code(pushInt(0), op(JUMP)))
+	assert.ErrorIs(t, err, ErrInvalidJump)
+
+	// 目标超出字节码范围
+	_, err = run(t, code(pushInt(100), op(JUMP)))
+	assert.ErrorIs(t, err, ErrInvalidJump)
+
+	// 目标位于PUSH的数据中，即使该字节等于JUMPDEST也不能跳转
+	_, err = run(t, code(pushInt(4), op(JUMP), Push([]byte{byte(JUMPDEST)})))
+	assert.ErrorIs(t, err, ErrInvalidJump)
+}
+
+func TestOperandTooLarge(t *testing.T) {
+	long := Push(make([]byte, 33))
+	for _, c := range [][]byte{
+		code(long, pushInt(1), op(ADD)),
+		code(pushInt(1), long, op(EQ)),
+		code(long, op(ISZERO)),
+		code(long, op(NOT)),
+		code(pushInt(0), long, op(JUMPI)),
+		code(long, op(JUMP)),
+	} {
+		_, err := run(t, c)
+		assert.ErrorIs(t, err, ErrOperandTooLarge)
+	}
+
+	// 通过CONCAT得到的长元素同样不能参与数值运算
+	_, err := run(t, code(pushInt(1), pushInt(1), op(CONCAT), op(DUP), op(CONCAT), op(DUP), op(CONCAT), op(DUP), op(CONCAT), op(DUP), op(CONCAT), op(DUP), op(CONCAT), op(ISZERO)))
+	assert.ErrorIs(t, err, ErrOperandTooLarge)
+
+	// 32字节的操作数仍然可以参与运算
+	assert.Equal(t, word(1), runTop(t, code(Push(word(0)), op(ISZERO))))
+}
+
+func TestContextOps(t *testing.T) {
+	ctx := Context{
+		Caller:  types.AddressFromBytes(types.RandomBytes(20)),
+		Address: types.AddressFromBytes(types.RandomBytes(20)),
+	}
+
+	vm := New(code(op(CALLER), op(ADDRESS)), memoryStorage{}, ctx, testGas)
+	assert.Nil(t, vm.Run())
+
+	addr, _ := vm.Stack().Pop()
+	assert.Equal(t, ctx.Address.ToSlice(), addr)
+	caller, _ := vm.Stack().Pop()
+	assert.Equal(t, ctx.Caller.ToSlice(), caller)
+}
+
+func TestStop(t *testing.T) {
+	vm, err := run(t, code(pushInt(1), op(STOP), pushInt(2)))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, vm.Stack().Len())
+
+	// 空字节码
+	_, err = run(t, []byte{})
+	assert.Nil(t, err)
+}
+
+func TestInvalidOpcode(t *testing.T) {
+	_, err := run(t, []byte{0xff})
+	assert.ErrorIs(t, err, ErrInvalidOpcode)
+}
+
+func TestTruncatedPush(t *testing.T) {
+	_, err := run(t, []byte{byte(PUSH)})
+	assert.ErrorIs(t, err, ErrCodeTruncated)
+
+	_, err = run(t, []byte{byte(PUSH), 3, 1, 2})
+	assert.ErrorIs(t, err, ErrCodeTruncated)
+}
+
+func TestProgram(t *testing.T) {
+	program := NewProgram(pushInt(1), op(POP))
+	assert.True(t, IsBytecode(program))
+	assert.False(t, IsBytecode([]byte("foo")))
+	assert.Equal(t, code(pushInt(1), op(POP)), CodeFromData(program))
+
+	assert.Equal(t, CodeAddress([]byte{1}), CodeAddress([]byte{1}))
+	assert.NotEqual(t, CodeAddress([]byte{1}), CodeAddress([]byte{2}))
+}
+
+func TestGasUsed(t *testing.T) {
+	vm, err := run(t, code(pushInt(1), pushInt(2), op(ADD), op(POP)))
+	assert.Nil(t, err)
+	assert.Equal(t, 3*GasFast+GasQuick, vm.GasUsed())
+
+	// 哈希按数据长度额外收费：33字节为2个字
+	vm, err = run(t, code(Push(make([]byte, 33)), op(SHA256)))
+	assert.Nil(t, err)
+	assert.Equal(t, GasFast+GasHash+2*GasHashWord, vm.GasUsed())
+
+	// 拼接按结果长度额外收费
+	vm, err = run(t, code(Push(make([]byte, 20)), Push(make([]byte, 20)), op(CONCAT)))
+	assert.Nil(t, err)
+	assert.Equal(t, 3*GasFast+2*GasCopyWord, vm.GasUsed())
+
+	// 写入存储按键和值的长度额外收费
+	vm, err = run(t, code(Push([]byte("k")), Push([]byte("vv")), op(SSTORE)))
+	assert.Nil(t, err)
+	assert.Equal(t, 2*GasFast+GasSstore+3*GasStoreByte, vm.GasUsed())
+
+	// 所有已定义的操作码都有燃料消耗
+	for o := range opcodeNames {
+		_, ok := GasCost(o)
+		assert.True(t, ok, o.String())
+	}
+}
+
+func TestOutOfGas(t *testing.T) {
+	c := code(pushInt(1), pushInt(2), op(ADD))
+
+	// 燃料恰好足够
+	vm := New(c, memoryStorage{}, Context{}, 3*GasFast)
+	assert.Nil(t, vm.Run())
+	assert.Equal(t, 3*GasFast, vm.GasUsed())
+
+	// 燃料不足时消耗全部燃料
+	vm = New(c, memoryStorage{}, Context{}, 3*GasFast-1)
+	assert.ErrorIs(t, vm.Run(), ErrOutOfGas)
+	assert.Equal(t, 3*GasFast-1, vm.GasUsed())
+
+	// 动态部分的燃料不足时不会写入存储
+	storage := memoryStorage{}
+	vm = New(code(Push([]byte("k")), Push([]byte("v")), op(SSTORE)), storage, Context{}, 2*GasFast+GasSstore)
+	assert.ErrorIs(t, vm.Run(), ErrOutOfGas)
+	assert.Empty(t, storage)
+
+	// 死循环最终因燃料耗尽而停止
+	// 0: JUMPDEST  1: PUSH 1 0x00  4: JUMP
+	vm = New(code(op(JUMPDEST), Push([]byte{0}), op(JUMP)), memoryStorage{}, Context{}, 10000)
+	assert.ErrorIs(t, vm.Run(), ErrOutOfGas)
+	assert.Equal(t, uint64(10000), vm.GasUsed())
+}
+
+// 用于测试的Host，记录最近一次调用并返回固定的结果。
+type mockHost struct {
+	caller, to types.Address
+	value      uint64
+	input      []byte
+	gas        uint64
+	depth      int
+
+	ret     []byte
+	gasUsed uint64
+	logs    []*Log
+	err     error
+}
+
+func (h *mockHost) Call(caller, to types.Address, value uint64, input []byte, gas uint64, depth int) ([]byte, uint64, []*Log, error) {
+	h.caller, h.to, h.value, h.input, h.gas, h.depth = caller, to, value, input, gas, depth
+	return h.ret, h.gasUsed, h.logs, h.err
+}
+
+func TestCallContextOps(t *testing.T) {
+	ctx := Context{Value: 7, Input: []byte("input")}
+
+	vm := New(code(op(VALUE), op(INPUT)), memoryStorage{}, ctx, testGas)
+	assert.Nil(t, vm.Run())
+
+	input, _ := vm.Stack().Pop()
+	assert.Equal(t, []byte("input"), input)
+	value, _ := vm.Stack().Pop()
+	assert.Equal(t, word(7), value)
+}
+
+func TestReturnAndRevert(t *testing.T) {
+	vm, err := run(t, code(Push([]byte("ret")), op(RETURN), pushInt(1)))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("ret"), vm.ReturnData())
+	assert.Equal(t, 0, vm.Stack().Len()) // RETURN之后的指令不再执行
+
+	vm, err = run(t, code(Push([]byte("why")), op(REVERT), pushInt(1)))
+	assert.ErrorIs(t, err, ErrReverted)
+	assert.Equal(t, []byte("why"), vm.ReturnData())
+	assert.Equal(t, 0, vm.Stack().Len())
+
+	// 没有执行RETURN时返回数据为空
+	vm, err = run(t, pushInt(1))
+	assert.Nil(t, err)
+	assert.Nil(t, vm.ReturnData())
+}
+
+func TestCall(t *testing.T) {
+	self := types.AddressFromBytes(types.RandomBytes(20))
+	to := types.AddressFromBytes(types.RandomBytes(20))
+	host := &mockHost{ret: []byte("ok"), gasUsed: 500}
+
+	c := code(Push(to.ToSlice()), pushInt(9), Push([]byte("in")), op(CALL))
+	vm := New(c, memoryStorage{}, Context{Address: self, Depth: 3}, testGas)
+	vm.SetHost(host)
+	assert.Nil(t, vm.Run())
+
+	assert.Equal(t, self, host.caller)
+	assert.Equal(t, to, host.to)
+	assert.Equal(t, uint64(9), host.value)
+	assert.Equal(t, []byte("in"), host.input)
+	assert.Equal(t, 4, host.depth)
+
+	// 被调用者获得剩余燃料的63/64，调用者扣除被调用者实际消耗的燃料
+	remaining := testGas - 3*GasFast - GasCall
+	assert.Equal(t, remaining-remaining/64, host.gas)
+	assert.Equal(t, 3*GasFast+GasCall+500, vm.GasUsed())
+
+	ok, _ := vm.Stack().Pop()
+	assert.Equal(t, word(1), ok)
+	ret, _ := vm.Stack().Pop()
+	assert.Equal(t, []byte("ok"), ret)
+}
+
+func TestCallFailure(t *testing.T) {
+	to := types.AddressFromBytes(types.RandomBytes(20))
+	c := code(Push(to.ToSlice()), pushInt(0), Push([]byte{}), op(CALL))
+
+	// 被调用者失败时压入0，调用者继续执行
+	host := &mockHost{ret: []byte("why"), err: ErrReverted}
+	vm := New(c, memoryStorage{}, Context{}, testGas)
+	vm.SetHost(host)
+	assert.Nil(t, vm.Run())
+	ok, _ := vm.Stack().Pop()
+	assert.Equal(t, word(0), ok)
+	ret, _ := vm.Stack().Pop()
+	assert.Equal(t, []byte("why"), ret)
+
+	// 达到调用深度上限时不会调用Host
+	host = &mockHost{}
+	vm = New(c, memoryStorage{}, Context{Depth: MaxCallDepth}, testGas)
+	vm.SetHost(host)
+	assert.Nil(t, vm.Run())
+	assert.Equal(t, types.Address{}, host.to)
+	ok, _ = vm.Stack().Pop()
+	assert.Equal(t, word(0), ok)
+
+	// 地址长度不正确
+	vm = New(code(Push([]byte{1}), pushInt(0), Push([]byte{}), op(CALL)), memoryStorage{}, Context{}, testGas)
+	vm.SetHost(&mockHost{})
+	assert.Nil(t, vm.Run())
+	ok, _ = vm.Stack().Pop()
+	assert.Equal(t, word(0), ok)
+
+	// 没有Host时调用失败
+	vm, err := run(t, c)
+	assert.Nil(t, err)
+	ok, _ = vm.Stack().Pop()
+	assert.Equal(t, word(0), ok)
+}
+
+func TestLog(t *testing.T) {
+	self := types.AddressFromBytes(types.RandomBytes(20))
+	callee := &Log{Address: types.AddressFromBytes(types.RandomBytes(20)), Topic: []byte("inner")}
+	host := &mockHost{logs: []*Log{callee}}
+
+	c := code(
+		Push([]byte("first")), Push([]byte("data")), op(LOG),
+		Push(callee.Address.ToSlice()), pushInt(0), Push([]byte{}), op(CALL), op(POP), op(POP),
+		Push([]byte("last")), Push([]byte{}), op(LOG),
+	)
+	vm := New(c, memoryStorage{}, Context{Address: self}, testGas)
+	vm.SetHost(host)
+	assert.Nil(t, vm.Run())
+
+	// 内部调用的日志按发生的顺序插入
+	logs := vm.Logs()
+	assert.Len(t, logs, 3)
+	assert.Equal(t, &Log{Address: self, Topic: []byte("first"), Data: []byte("data")}, logs[0])
+	assert.Equal(t, callee, logs[1])
+	assert.Equal(t, []byte("last"), logs[2].Topic)
+
+	// 失败的内部调用的日志被丢弃
+	host.err = ErrReverted
+	vm = New(c, memoryStorage{}, Context{Address: self}, testGas)
+	vm.SetHost(host)
+	assert.Nil(t, vm.Run())
+	assert.Len(t, vm.Logs(), 2)
+
+	// 日志按主题和数据的长度收费
+	vm, err := run(t, code(Push([]byte("ab")), Push([]byte("cde")), op(LOG)))
+	assert.Nil(t, err)
+	assert.Equal(t, 2*GasFast+GasLog+5*GasLogByte, vm.GasUsed())
+}